@@ -626,6 +626,22 @@ func (c *Client) GetSignerCounters(ids ...string) (*GetSignerCountersResponse, e
 	return &reply, cothority.ErrorOrNil(err, "request failed")
 }
 
+// GetRateLimits returns the quota left to the identity for every rate limit
+// in the rule of the action of the darc.
+func (c *Client) GetRateLimits(dID darc.ID, action darc.Action, id darc.Identity) ([]RateLimitQuota, error) {
+	reply := &GetRateLimitsResponse{}
+	_, err := c.SendProtobufParallel(c.Roster.List, &GetRateLimits{
+		SkipchainID: c.ID,
+		DarcID:      dID,
+		Action:      action,
+		Identity:    id.String(),
+	}, reply, c.options)
+	if err != nil {
+		return nil, xerrors.Errorf("request: %v", err)
+	}
+	return reply.Quotas, nil
+}
+
 // DownloadState is used by a new node to ask to download the global state.
 // The first call to DownloadState needs to have start = 0, so that the
 // service creates a snapshot of the current state which it will serve over
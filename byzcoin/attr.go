@@ -0,0 +1,237 @@
+package byzcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// AttrInterpreterFn is the signature of an attribute interpreter that can be
+// enabled per chain through the ChainConfig. It receives the state of the
+// trie at the moment the instruction is verified, the instruction itself and
+// the value of the attribute, which is the part after "attr:<name>:".
+//
+// To stay replay-safe, an interpreter must only depend on its arguments: the
+// values stored in the trie, the block index and, if the trie can be cast to
+// a TimeReader, the timestamp of the block being created. It must never read
+// the local clock or any other state of the node.
+type AttrInterpreterFn func(rst ReadOnlyStateTrie, inst Instruction, attr string) error
+
+// The following attribute interpreters are registered by default and can be
+// enabled in the ChainConfig.
+const (
+	// AttrTimeID checks that the block timestamp is inside an interval given
+	// in seconds since the Unix epoch: attr:time:after=<sec>&before=<sec>
+	AttrTimeID = "time"
+	// AttrCoinBalanceID checks that a coin instance holds at least or at
+	// most a given amount: attr:coin_balance:id=<hex>&min=<n>&max=<n>
+	AttrCoinBalanceID = "coin_balance"
+	// AttrValueEqualsID checks that the value of an instance is equal to the
+	// given hex-encoded bytes: attr:value_equals:id=<hex>&value=<hex>
+	AttrValueEqualsID = "value_equals"
+)
+
+// attrRegistry maps the name of an attribute to its interpreter.
+type attrRegistry struct {
+	registry map[string]AttrInterpreterFn
+	sync.Mutex
+}
+
+func (ar *attrRegistry) register(name string, f AttrInterpreterFn) error {
+	ar.Lock()
+	defer ar.Unlock()
+
+	if _, exists := ar.registry[name]; exists {
+		return xerrors.New("attribute interpreter already registered")
+	}
+	ar.registry[name] = f
+	return nil
+}
+
+func (ar *attrRegistry) search(name string) (AttrInterpreterFn, bool) {
+	ar.Lock()
+	f, exists := ar.registry[name]
+	ar.Unlock()
+	return f, exists
+}
+
+var globalAttrRegistry = &attrRegistry{
+	registry: make(map[string]AttrInterpreterFn),
+}
+
+func init() {
+	for name, f := range map[string]AttrInterpreterFn{
+		AttrTimeID:        evalAttrTime,
+		AttrCoinBalanceID: evalAttrCoinBalance,
+		AttrValueEqualsID: evalAttrValueEquals,
+	} {
+		log.ErrFatal(globalAttrRegistry.register(name, f))
+	}
+}
+
+// RegisterGlobalAttrInterpreter stores an attribute interpreter under the
+// given name. The interpreter is only used by chains that list the name in
+// ChainConfig.AttrInterpreters. This should be called during module
+// initialization, and every node of a roster must register the same
+// interpreters.
+func RegisterGlobalAttrInterpreter(name string, f AttrInterpreterFn) error {
+	err := globalAttrRegistry.register(name, f)
+	return cothority.ErrorOrNil(err, "registration failed")
+}
+
+// GetAttrInterpreterNames returns the sorted list of the names of all
+// registered attribute interpreters.
+func GetAttrInterpreterNames() []string {
+	globalAttrRegistry.Lock()
+	names := make([]string, 0, len(globalAttrRegistry.registry))
+	for name := range globalAttrRegistry.registry {
+		names = append(names, name)
+	}
+	globalAttrRegistry.Unlock()
+	sort.Strings(names)
+	return names
+}
+
+// makeChainAttrInterpreters returns the attribute interpreters enabled in the
+// configuration of the chain, bound to the given trie and instruction.
+func makeChainAttrInterpreters(rst ReadOnlyStateTrie, inst Instruction,
+	config *ChainConfig) (darc.AttrInterpreters, error) {
+	evalAttr := darc.AttrInterpreters{}
+	for _, name := range config.AttrInterpreters {
+		f, exists := globalAttrRegistry.search(name)
+		if !exists {
+			return nil, xerrors.Errorf("unknown attribute interpreter '%s'", name)
+		}
+		evalAttr[name] = func(attr string) error {
+			return f(rst, inst, attr)
+		}
+	}
+	return evalAttr, nil
+}
+
+// parseAttrInt64 returns the integer value of the key, or def if the key is
+// not present.
+func parseAttrInt64(vals url.Values, key string, def int64) (int64, error) {
+	str := vals.Get(key)
+	if str == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, xerrors.Errorf("parsing %s: %v", key, err)
+	}
+	return v, nil
+}
+
+// parseAttrInstanceID returns the instance ID given in hex by the key.
+func parseAttrInstanceID(vals url.Values, key string) (InstanceID, error) {
+	buf, err := hex.DecodeString(vals.Get(key))
+	if err != nil {
+		return InstanceID{}, xerrors.Errorf("decoding %s: %v", key, err)
+	}
+	if len(buf) != len(InstanceID{}) {
+		return InstanceID{}, xerrors.Errorf("%s must be an instance ID of "+
+			"32 bytes", key)
+	}
+	return NewInstanceID(buf), nil
+}
+
+// evalAttrTime uses the timestamp of the block under creation, so that
+// replaying the chain gives the same result as the original execution.
+func evalAttrTime(rst ReadOnlyStateTrie, inst Instruction, attr string) error {
+	vals, err := url.ParseQuery(attr)
+	if err != nil {
+		return xerrors.Errorf("parsing query: %v", err)
+	}
+	tr, ok := rst.(TimeReader)
+	if !ok {
+		return xerrors.New("the trie doesn't give access to the block time")
+	}
+	now := tr.GetCurrentBlockTimestamp() / 1e9
+
+	after, err := parseAttrInt64(vals, "after", -1)
+	if err != nil {
+		return err
+	}
+	before, err := parseAttrInt64(vals, "before", now+1)
+	if err != nil {
+		return err
+	}
+	if after < now && now < before {
+		return nil
+	}
+	return xerrors.Errorf("the current block time is %d which does not fit "+
+		"in the interval (%d, %d)", now, after, before)
+}
+
+func evalAttrCoinBalance(rst ReadOnlyStateTrie, inst Instruction, attr string) error {
+	vals, err := url.ParseQuery(attr)
+	if err != nil {
+		return xerrors.Errorf("parsing query: %v", err)
+	}
+	id, err := parseAttrInstanceID(vals, "id")
+	if err != nil {
+		return err
+	}
+	min, err := parseAttrInt64(vals, "min", 0)
+	if err != nil {
+		return err
+	}
+	max, err := parseAttrInt64(vals, "max", -1)
+	if err != nil {
+		return err
+	}
+	if min < 0 {
+		return xerrors.New("min cannot be negative")
+	}
+
+	buf, _, _, _, err := GetValueContract(rst, id.Slice())
+	if err != nil {
+		return xerrors.Errorf("getting coin: %v", err)
+	}
+	var coin Coin
+	if err := protobuf.Decode(buf, &coin); err != nil {
+		return xerrors.Errorf("decoding coin: %v", err)
+	}
+	if coin.Value < uint64(min) {
+		return xerrors.Errorf("coin balance %d is below %d", coin.Value, min)
+	}
+	if max >= 0 && coin.Value > uint64(max) {
+		return xerrors.Errorf("coin balance %d is above %d", coin.Value, max)
+	}
+	return nil
+}
+
+func evalAttrValueEquals(rst ReadOnlyStateTrie, inst Instruction, attr string) error {
+	vals, err := url.ParseQuery(attr)
+	if err != nil {
+		return xerrors.Errorf("parsing query: %v", err)
+	}
+	id, err := parseAttrInstanceID(vals, "id")
+	if err != nil {
+		return err
+	}
+	expected, err := hex.DecodeString(vals.Get("value"))
+	if err != nil {
+		return xerrors.Errorf("decoding value: %v", err)
+	}
+
+	buf, _, _, _, err := GetValueContract(rst, id.Slice())
+	if err != nil {
+		return xerrors.Errorf("getting instance: %v", err)
+	}
+	if !bytes.Equal(buf, expected) {
+		return xerrors.Errorf("value of instance %x is not the expected one",
+			id.Slice())
+	}
+	return nil
+}
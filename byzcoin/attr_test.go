@@ -0,0 +1,106 @@
+package byzcoin
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// timedROSTSimul adds the block timestamp to the simulation so that the
+// attributes depending on the time can be evaluated.
+type timedROSTSimul struct {
+	*ROSTSimul
+	currentBlockInfo
+}
+
+func TestAttr_Registry(t *testing.T) {
+	err := RegisterGlobalAttrInterpreter(AttrTimeID, evalAttrTime)
+	require.Error(t, err)
+
+	require.Contains(t, GetAttrInterpreterNames(), AttrTimeID)
+	require.Contains(t, GetAttrInterpreterNames(), AttrCoinBalanceID)
+	require.Contains(t, GetAttrInterpreterNames(), AttrValueEqualsID)
+
+	config := &ChainConfig{AttrInterpreters: []string{AttrTimeID}}
+	evalAttr, err := makeChainAttrInterpreters(NewROSTSimul(), Instruction{}, config)
+	require.NoError(t, err)
+	require.Len(t, evalAttr, 1)
+	require.NotNil(t, evalAttr[AttrTimeID])
+
+	config.AttrInterpreters = append(config.AttrInterpreters, "unknown")
+	_, err = makeChainAttrInterpreters(NewROSTSimul(), Instruction{}, config)
+	require.Error(t, err)
+}
+
+func TestAttr_Time(t *testing.T) {
+	now := time.Now().Unix()
+	rst := &timedROSTSimul{
+		ROSTSimul:        NewROSTSimul(),
+		currentBlockInfo: currentBlockInfo{timestamp: now * 1e9},
+	}
+
+	require.NoError(t, evalAttrTime(rst, Instruction{}, ""))
+	require.NoError(t, evalAttrTime(rst, Instruction{},
+		fmt.Sprintf("after=%d&before=%d", now-1, now+1)))
+	require.Error(t, evalAttrTime(rst, Instruction{},
+		fmt.Sprintf("after=%d", now)))
+	require.Error(t, evalAttrTime(rst, Instruction{},
+		fmt.Sprintf("before=%d", now)))
+	require.Error(t, evalAttrTime(rst, Instruction{}, "after=abc"))
+
+	// Without access to the block time, the attribute must not pass.
+	require.Error(t, evalAttrTime(NewROSTSimul(), Instruction{}, ""))
+}
+
+func TestAttr_CoinBalance(t *testing.T) {
+	rst := NewROSTSimul()
+	id, err := rst.CreateCoin("test", 100)
+	require.NoError(t, err)
+	idStr := hex.EncodeToString(id.Slice())
+
+	require.NoError(t, evalAttrCoinBalance(rst, Instruction{}, "id="+idStr))
+	require.NoError(t, evalAttrCoinBalance(rst, Instruction{},
+		"id="+idStr+"&min=100&max=100"))
+	require.Error(t, evalAttrCoinBalance(rst, Instruction{},
+		"id="+idStr+"&min=101"))
+	require.Error(t, evalAttrCoinBalance(rst, Instruction{},
+		"id="+idStr+"&max=99"))
+	require.Error(t, evalAttrCoinBalance(rst, Instruction{},
+		"id="+idStr+"&min=-1"))
+	require.Error(t, evalAttrCoinBalance(rst, Instruction{}, "id=1234"))
+	require.Error(t, evalAttrCoinBalance(rst, Instruction{},
+		"id="+hex.EncodeToString(make([]byte, 32))))
+}
+
+func TestAttr_ValueEquals(t *testing.T) {
+	rst := NewROSTSimul()
+	id, err := rst.CreateCoin("test", 100)
+	require.NoError(t, err)
+	idStr := hex.EncodeToString(id.Slice())
+	value, _, _, _, err := rst.GetValues(id.Slice())
+	require.NoError(t, err)
+
+	require.NoError(t, evalAttrValueEquals(rst, Instruction{},
+		"id="+idStr+"&value="+hex.EncodeToString(value)))
+	require.Error(t, evalAttrValueEquals(rst, Instruction{},
+		"id="+idStr+"&value=1234"))
+	require.Error(t, evalAttrValueEquals(rst, Instruction{},
+		"id="+idStr+"&value=xyz"))
+}
+
+func TestChainConfig_SanityCheckAttr(t *testing.T) {
+	config := ChainConfig{
+		BlockInterval:    time.Second,
+		MaxBlockSize:     16000,
+		AttrInterpreters: []string{AttrTimeID},
+	}
+	config.Roster.List = make([]*network.ServerIdentity, 3)
+	require.NoError(t, config.sanityCheck(nil))
+
+	config.AttrInterpreters = []string{"unknown"}
+	require.Error(t, config.sanityCheck(nil))
+}
@@ -93,6 +93,13 @@ func ConfigInvokeUpdateConfig(c *cli.Context) error {
 		config.DarcContractIDs = darcContractIDsSlice
 	}
 
+	// AttrInterpreters
+	// we need the names to be separated by commas
+	attrInterpreters := c.String("attrInterpreters")
+	if attrInterpreters != "" {
+		config.AttrInterpreters = strings.Split(attrInterpreters, ",")
+	}
+
 	configBuf, err := protobuf.Encode(&config)
 	if err != nil {
 		return xerrors.Errorf("failed to encode config: %v", err)
@@ -31,7 +31,8 @@ Here is the config data:
     OUTRES=`runBA0 contract config invoke updateConfig\
                 --blockInterval 7s\
                 --maxBlockSize 5000000\
-                --darcContractIDs darc,darc2,darc3`
+                --darcContractIDs darc,darc2,darc3\
+                --attrInterpreters time,value_equals`
 
     matchOK "$OUTRES" "^Config contract updated! \(instance ID is [a-f0-9]{64}\)
 Here is the config data:
@@ -42,7 +43,10 @@ Here is the config data:
 -- DarcContractIDs:
 --- darc contract ID 0: darc
 --- darc contract ID 1: darc2
---- darc contract ID 2: darc3$"
+--- darc contract ID 2: darc3
+-- AttrInterpreters:
+--- attr interpreter 0: time
+--- attr interpreter 1: value_equals$"
 
 }
 
@@ -0,0 +1,356 @@
+package clicontracts
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+// NFTSpawn is used to spawn a new nft contract.
+func NFTSpawn(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	owner := c.String("owner")
+	if owner == "" {
+		return xerrors.New("--owner flag is required")
+	}
+	metadata := c.String("metadata")
+	if metadata == "" {
+		return xerrors.New("--metadata flag is required")
+	}
+
+	args := byzcoin.Arguments{
+		{Name: "owner", Value: []byte(owner)},
+		{Name: "metadata", Value: []byte(metadata)},
+	}
+	if royaltyCoin := c.String("royaltyCoin"); royaltyCoin != "" {
+		coinBuf, err := hex.DecodeString(royaltyCoin)
+		if err != nil {
+			return xerrors.New("failed to decode the royaltyCoin string")
+		}
+		royaltyBuf, err := protobuf.Encode(&contracts.NFTRoyalty{
+			Beneficiary: byzcoin.NewInstanceID(coinBuf),
+			Coins:       c.Uint64("royalty"),
+		})
+		if err != nil {
+			return xerrors.Errorf("encoding royalty: %v", err)
+		}
+		args = append(args, byzcoin.Argument{Name: "royalty", Value: royaltyBuf})
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	dstr := c.String("darc")
+	if dstr == "" {
+		dstr = cfg.AdminDarc.GetIdentityString()
+	}
+	d, err := lib.GetDarcByString(cl, dstr)
+	if err != nil {
+		return err
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return err
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return fmt.Errorf("couldn't get signer counters: %v", err)
+	}
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(d.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ContractNFTID,
+			Args:       args,
+		},
+		SignerCounter: []uint64{counters.Counters[0] + 1},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ctx.FillSignersAndSignWith(*signer)
+	if err != nil {
+		return err
+	}
+
+	if lib.FindRecursivefBool("export", c) {
+		return lib.ExportTransaction(ctx)
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return err
+	}
+
+	instID := ctx.Instructions[0].DeriveID("").Slice()
+	log.Infof("Spawned a new nft contract. Its instance id is:\n%x", instID)
+
+	return lib.WaitPropagation(c, cl)
+}
+
+// NFTInvokeTransfer gives an nft to a new owner. If the nft has a royalty,
+// it is fetched from the coin given with --coin.
+func NFTInvokeTransfer(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	owner := c.String("owner")
+	if owner == "" {
+		return xerrors.New("--owner flag is required")
+	}
+
+	instID := c.String("instid")
+	if instID == "" {
+		return xerrors.New("--instid flag is required")
+	}
+	instIDBuf, err := hex.DecodeString(instID)
+	if err != nil {
+		return xerrors.New("failed to decode the instid string")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	nft, err := getNFT(cl, instIDBuf)
+	if err != nil {
+		return err
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return err
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return fmt.Errorf("couldn't get signer counters: %v", err)
+	}
+
+	var instrs []byzcoin.Instruction
+	if nft.Royalty != nil && nft.Royalty.Coins > 0 {
+		coin := c.String("coin")
+		if coin == "" {
+			return xerrors.Errorf("the nft has a royalty of %d coins, "+
+				"please give the coin to pay it with --coin", nft.Royalty.Coins)
+		}
+		coinBuf, err := hex.DecodeString(coin)
+		if err != nil {
+			return xerrors.New("failed to decode the coin string")
+		}
+		coinsBuf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(coinsBuf, nft.Royalty.Coins)
+		instrs = append(instrs, byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(coinBuf),
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "fetch",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: coinsBuf}},
+			},
+		})
+	}
+	instrs = append(instrs, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(instIDBuf),
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractNFTID,
+			Command:    "transfer",
+			Args:       byzcoin.Arguments{{Name: "owner", Value: []byte(owner)}},
+		},
+	})
+	for i := range instrs {
+		instrs[i].SignerCounter = []uint64{counters.Counters[0] + uint64(i) + 1}
+	}
+
+	ctx, err := cl.CreateTransaction(instrs...)
+	if err != nil {
+		return err
+	}
+	err = ctx.FillSignersAndSignWith(*signer)
+	if err != nil {
+		return err
+	}
+
+	if lib.FindRecursivefBool("export", c) {
+		return lib.ExportTransaction(ctx)
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("NFT transferred to %s! (instance ID is %x)", owner, instIDBuf)
+
+	return lib.WaitPropagation(c, cl)
+}
+
+// NFTGet checks the proof and displays the content of an nft contract.
+func NFTGet(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	_, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	instID := c.String("instid")
+	if instID == "" {
+		return xerrors.New("--instid flag is required")
+	}
+	instIDBuf, err := hex.DecodeString(instID)
+	if err != nil {
+		return xerrors.New("failed to decode the instID string" + instID)
+	}
+
+	nft, err := getNFT(cl, instIDBuf)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Owner: %s", nft.Owner)
+	log.Infof("Metadata: %s", nft.Metadata)
+	if nft.Royalty != nil {
+		log.Infof("Royalty: %d coins to %x", nft.Royalty.Coins,
+			nft.Royalty.Beneficiary.Slice())
+	}
+	for _, t := range nft.History {
+		log.Infof("Transfer at block %d: %s -> %s", t.BlockIndex, t.From, t.To)
+	}
+
+	return nil
+}
+
+// NFTDelete deletes the nft instance
+func NFTDelete(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	instID := c.String("instid")
+	if instID == "" {
+		return xerrors.New("--instid flag is required")
+	}
+	instIDBuf, err := hex.DecodeString(instID)
+	if err != nil {
+		return xerrors.New("failed to decode the instid string")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return err
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return fmt.Errorf("couldn't get signer counters: %v", err)
+	}
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(instIDBuf),
+		Delete: &byzcoin.Delete{
+			ContractID: contracts.ContractNFTID,
+		},
+		SignerCounter: []uint64{counters.Counters[0] + 1},
+	})
+	if err != nil {
+		return err
+	}
+	err = ctx.FillSignersAndSignWith(*signer)
+	if err != nil {
+		return err
+	}
+
+	if lib.FindRecursivefBool("export", c) {
+		return lib.ExportTransaction(ctx)
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("NFT contract deleted! (instance ID is %x)", instIDBuf)
+
+	return lib.WaitPropagation(c, cl)
+}
+
+// getNFT checks the proof and returns the nft with the given instance ID.
+func getNFT(cl *byzcoin.Client, instID []byte) (*contracts.NFT, error) {
+	pr, err := cl.GetProofFromLatest(instID)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get proof: %v", err)
+	}
+	proof := pr.Proof
+
+	match := proof.InclusionProof.Match(instID)
+	if !match {
+		return nil, xerrors.New("proof does not match")
+	}
+
+	_, resultBuf, cid, _, err := proof.KeyValue()
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get value out of proof: %v", err)
+	}
+	if cid != contracts.ContractNFTID {
+		return nil, xerrors.Errorf("instance is a %s contract, not an nft", cid)
+	}
+
+	var nft contracts.NFT
+	err = protobuf.Decode(resultBuf, &nft)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't decode nft: %v", err)
+	}
+	return &nft, nil
+}
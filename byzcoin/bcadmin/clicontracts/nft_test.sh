@@ -0,0 +1,56 @@
+# This method should be called from the byzcoin/bcadmin/test.sh script
+
+testContractNFT() {
+    run testNFTSpawn
+    run testNFTTransfer
+}
+
+testNFTSpawn() {
+    runCoBG 1 2 3
+    runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+    eval $SED
+    [ -z "$BC" ] && exit 1
+
+    testOK runBA darc add -out_id ./darc_id.txt -out_key ./darc_key.txt -unrestricted
+    ID=`cat ./darc_id.txt`
+    KEY=`cat ./darc_key.txt`
+    testOK runBA darc rule -rule "spawn:nft" --identity "$KEY" --darc "$ID" --sign "$KEY"
+
+    testFail runBA0 contract nft spawn --owner "$KEY" --darc "$ID" --sign "$KEY"
+    OUTRES=`runBA0 contract nft spawn --owner "$KEY" --metadata "laptop #42" --darc "$ID" --sign "$KEY"`
+    matchOK "$OUTRES" "^Spawned a new nft contract. Its instance id is:
+[0-9a-f]{64}$"
+
+    NFT_ID=$( echo "$OUTRES" | sed -n 2p )
+    testGrep "Owner: $KEY" runBA0 contract nft get -i $NFT_ID
+    testGrep "Metadata: laptop #42" runBA0 contract nft get -i $NFT_ID
+}
+
+testNFTTransfer() {
+    runCoBG 1 2 3
+    runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+    eval $SED
+    [ -z "$BC" ] && exit 1
+
+    testOK runBA darc add -out_id ./darc_id.txt -out_key ./darc_key.txt -unrestricted
+    ID=`cat ./darc_id.txt`
+    KEY=`cat ./darc_key.txt`
+    testOK runBA darc rule -rule "spawn:nft" --identity "$KEY" --darc "$ID" --sign "$KEY"
+    testOK runBA darc add -out_key ./darc_key2.txt
+    KEY2=`cat ./darc_key2.txt`
+
+    OUTRES=`runBA0 contract nft spawn --owner "$KEY" --metadata "certificate" --darc "$ID" --sign "$KEY"`
+    NFT_ID=$( echo "$OUTRES" | sed -n 2p )
+
+    # Only the owner can transfer the nft.
+    testFail runBA0 contract nft invoke transfer -i $NFT_ID --owner "$KEY" --sign "$KEY2"
+    testOK runBA0 contract nft invoke transfer -i $NFT_ID --owner "$KEY2" --sign "$KEY"
+    testGrep "Owner: $KEY2" runBA0 contract nft get -i $NFT_ID
+    testGrep "$KEY -> $KEY2" runBA0 contract nft get -i $NFT_ID
+    testFail runBA0 contract nft invoke transfer -i $NFT_ID --owner "$KEY2" --sign "$KEY"
+    testOK runBA0 contract nft invoke transfer -i $NFT_ID --owner "$KEY" --sign "$KEY2"
+
+    testFail runBA0 contract nft delete -i $NFT_ID --sign "$KEY2"
+    testOK runBA0 contract nft delete -i $NFT_ID --sign "$KEY"
+    testFail runBA0 contract nft get -i $NFT_ID
+}
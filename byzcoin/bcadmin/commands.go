@@ -65,7 +65,7 @@ var cmds = cli.Commands{
                                       --instid, i <instance ID>
                                       [--sign <pub key>]
                              }
-   CONTRACT   {value,deferred,config}`,
+   CONTRACT   {value,deferred,config,name,nft}`,
 		Subcommands: cli.Commands{
 			{
 				Name:  "value",
@@ -327,6 +327,10 @@ var cmds = cli.Commands{
 										Name:  "darcContractIDs",
 										Usage: "darcContractIDs separated by comas (optional)",
 									},
+									cli.StringFlag{
+										Name:  "attrInterpreters",
+										Usage: "names of the attribute interpreters to enable, separated by comas (optional)",
+									},
 								},
 							},
 						},
@@ -439,6 +443,118 @@ var cmds = cli.Commands{
 					},
 				},
 			},
+			{
+				Name:  "nft",
+				Usage: "Manipulate an nft contract",
+				Subcommands: cli.Commands{
+					{
+						Name:   "spawn",
+						Usage:  "spawn an nft contract",
+						Action: clicontracts.NFTSpawn,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "owner",
+								Usage: "the identity of the owner, for example ed25519:... (required)",
+							},
+							cli.StringFlag{
+								Name:  "metadata",
+								Usage: "the metadata describing the asset (required)",
+							},
+							cli.StringFlag{
+								Name:  "royaltyCoin",
+								Usage: "the coin instance receiving the royalty (optional)",
+							},
+							cli.Uint64Flag{
+								Name:  "royalty",
+								Usage: "the number of coins paid at every transfer (optional)",
+							},
+							cli.StringFlag{
+								Name:  "darc",
+								Usage: "DARC with the right to spawn an nft contract (default is the admin DARC)",
+							},
+							cli.StringFlag{
+								Name:  "sign",
+								Usage: "public key of the signing entity (default is the admin public key)",
+							},
+						},
+					},
+					{
+						Name:  "invoke",
+						Usage: "invoke an nft contract",
+						Subcommands: cli.Commands{
+							{
+								Name:   "transfer",
+								Usage:  "give the nft to a new owner",
+								Action: clicontracts.NFTInvokeTransfer,
+								Flags: []cli.Flag{
+									cli.StringFlag{
+										Name:   "bc",
+										EnvVar: "BC",
+										Usage:  "the ByzCoin config to use (required)",
+									},
+									cli.StringFlag{
+										Name:  "instid, i",
+										Usage: "the instance ID of the nft contract",
+									},
+									cli.StringFlag{
+										Name:  "owner",
+										Usage: "the identity of the new owner, for example ed25519:... (required)",
+									},
+									cli.StringFlag{
+										Name:  "coin",
+										Usage: "the coin instance paying the royalty, if any",
+									},
+									cli.StringFlag{
+										Name:  "sign",
+										Usage: "public key of the current owner (default is the admin public key)",
+									},
+								},
+							},
+						},
+					},
+					{
+						Name:   "get",
+						Usage:  "if the proof matches, display the owner, the metadata and the history of the nft",
+						Action: clicontracts.NFTGet,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "instid, i",
+								Usage: "the instance id (required)",
+							},
+						},
+					},
+					{
+						Name:   "delete",
+						Usage:  "delete an nft contract",
+						Action: clicontracts.NFTDelete,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "instid, i",
+								Usage: "the instance ID of the nft contract",
+							},
+							cli.StringFlag{
+								Name:  "sign",
+								Usage: "public key of the owner (default is the admin public key)",
+							},
+						},
+					},
+				},
+			},
 		},
 	},
 
@@ -933,6 +1049,30 @@ var cmds = cli.Commands{
 		Action:    mint,
 	},
 
+	{
+		Name:  "proof",
+		Usage: "work with proof bundles",
+		Subcommands: cli.Commands{
+			{
+				Name:      "verify",
+				Usage:     "verify a proof bundle offline, and print what it proves",
+				ArgsUsage: "bundle-file",
+				Action:    proofVerify,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config giving the ID of the chain",
+					},
+					cli.StringFlag{
+						Name:  "id",
+						Usage: "the ID of the chain, in hex, instead of --bc",
+					},
+				},
+			},
+		},
+	},
+
 	{
 		Name:    "qr",
 		Usage:   "generates a QRCode containing the description of the BC Config",
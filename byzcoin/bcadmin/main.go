@@ -1809,6 +1809,78 @@ func getInstance(c *cli.Context) error {
 	return nil
 }
 
+// proofVerify verifies a proof bundle offline, against the ID of the chain
+// given by the ByzCoin config or by --id, and prints what it proves.
+func proofVerify(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please give the proof bundle file")
+	}
+	var id skipchain.SkipBlockID
+	switch {
+	case c.String("id") != "":
+		buf, err := hex.DecodeString(c.String("id"))
+		if err != nil {
+			return xerrors.Errorf("couldn't decode --id: %v", err)
+		}
+		id = buf
+	case c.String("bc") != "":
+		cfg, _, err := lib.LoadConfig(c.String("bc"))
+		if err != nil {
+			return err
+		}
+		id = cfg.ByzCoinID
+	default:
+		return xerrors.New("--bc or --id flag is required")
+	}
+
+	buf, err := ioutil.ReadFile(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("couldn't read bundle: %v", err)
+	}
+	b, err := skipchain.DecodeProofBundle(buf)
+	if err != nil {
+		return err
+	}
+
+	out := new(strings.Builder)
+	switch b.Type {
+	case skipchain.ProofBundleByzCoin:
+		p, key, err := byzcoin.ImportProof(buf, id)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "- Block: %d (%x)\n", p.Latest.Index, p.Latest.Hash)
+		fmt.Fprintf(out, "- Key: %x\n", key)
+		ok, err := p.InclusionProof.Exists(key)
+		if err != nil {
+			return xerrors.Errorf("invalid proof for the key: %v", err)
+		}
+		if !ok {
+			out.WriteString("-- Present: false\n")
+			break
+		}
+		value, contractID, darcID, err := p.Get(key)
+		if err != nil {
+			return xerrors.Errorf("couldn't get value out of proof: %v", err)
+		}
+		out.WriteString("-- Present: true\n")
+		fmt.Fprintf(out, "-- Value: %x\n", value)
+		fmt.Fprintf(out, "-- ContractID: %s\n", contractID)
+		fmt.Fprintf(out, "-- DarcID: %x\n", darcID)
+	case skipchain.ProofBundleSkipchain:
+		sbs, err := skipchain.ImportProof(buf, id)
+		if err != nil {
+			return err
+		}
+		latest := sbs[len(sbs)-1]
+		fmt.Fprintf(out, "- Block: %d (%x)\n", latest.Index, latest.Hash)
+	default:
+		return xerrors.Errorf("unknown proof type %s", b.Type)
+	}
+	fmt.Fprintf(c.App.Writer, "Proof verified for chain %x\n%s", id, out)
+	return nil
+}
+
 type configPrivate struct {
 	Owner darc.Signer
 }
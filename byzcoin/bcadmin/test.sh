@@ -22,6 +22,7 @@ export BC_WAIT=true
 . "../clicontracts/deferred_test.sh"
 . "../clicontracts/value_test.sh"
 . "../clicontracts/name_test.sh"
+. "../clicontracts/nft_test.sh"
 
 main(){
     startTest
@@ -53,6 +54,7 @@ main(){
     run testContractDeferred
     run testContractConfig
     run testContractName
+    run testContractNFT
     stopTest
 }
 
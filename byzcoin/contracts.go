@@ -342,6 +342,10 @@ type darcContractIDs struct {
 	IDs []string
 }
 
+type attrInterpreterNames struct {
+	Names []string
+}
+
 // We need to override BasicContract.Verify because of the genesis config special case.
 func (c *contractConfig) VerifyInstruction(rst ReadOnlyStateTrie, inst Instruction, msg []byte) error {
 	pr, err := rst.GetProof(ConfigInstanceID.Slice())
@@ -413,6 +417,7 @@ func (c *contractConfig) FormatMethod(instr Instruction) string {
 //   - max_block_size int64
 //   - roster         onet.Roster
 //   - darc_contracts darcContractID
+//   - attr_interpreters attrInterpreterNames (optional)
 func (c *contractConfig) Spawn(rst ReadOnlyStateTrie, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
 	darcBuf := inst.Spawn.Args.Search("darc")
 	d, err := darc.NewFromProtobuf(darcBuf)
@@ -455,6 +460,18 @@ func (c *contractConfig) Spawn(rst ReadOnlyStateTrie, inst Instruction, coins []
 	}
 	c.DarcContractIDs = dcIDs.IDs
 
+	if buf := inst.Spawn.Args.Search("attr_interpreters"); buf != nil {
+		names := attrInterpreterNames{}
+		err = protobuf.Decode(buf, &names)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("decoding attr names: %v", err)
+		}
+		c.AttrInterpreters = names.Names
+		if err = c.sanityCheck(nil); err != nil {
+			return nil, nil, xerrors.Errorf("sanity check: %v", err)
+		}
+	}
+
 	configBuf, err := protobuf.Encode(c)
 	if err != nil {
 		return nil, nil, xerrors.Errorf("encoding config: %v", err)
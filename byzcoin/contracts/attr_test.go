@@ -1,6 +1,7 @@
 package contracts
 
 import (
+	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
@@ -386,3 +387,164 @@ func TestAttrBlockIndex(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, resp.Error, "does not fit in the interval")
 }
+
+// The attribute interpreters enabled in the chain config must be honoured by
+// every contract, even the ones not knowing about them.
+func TestAttrChainConfig(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:" + ContractValueID}, signer.Identity())
+	require.NoError(t, err)
+
+	later := time.Now().Add(time.Hour).Unix()
+	gDarc := &genesisMsg.GenesisDarc
+	require.NoError(t, gDarc.Rules.AddRule("invoke:"+ContractValueID+".update",
+		[]byte(fmt.Sprintf("%s & attr:%s:before=%d", signer.Identity(),
+			byzcoin.AttrTimeID, later))))
+	require.NoError(t, gDarc.Rules.AddRule("delete:"+ContractValueID,
+		[]byte(fmt.Sprintf("%s & attr:%s:after=%d", signer.Identity(),
+			byzcoin.AttrTimeID, later))))
+	genesisMsg.BlockInterval = time.Second
+	genesisMsg.AttrInterpreters = []string{byzcoin.AttrTimeID}
+
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractValueID,
+			Args: []byzcoin.Argument{{
+				Name:  "value",
+				Value: []byte("abc"),
+			}},
+		},
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	myID := ctx.Instructions[0].DeriveID("")
+
+	// Invoke ok - the block time is before the limit
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: myID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractValueID,
+			Command:    "update",
+			Args: []byzcoin.Argument{{
+				Name:  "value",
+				Value: []byte("def"),
+			}},
+		},
+		SignerCounter: []uint64{2},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	// Delete fail - the block time is before the limit
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: myID,
+		Delete: &byzcoin.Delete{
+			ContractID: ContractValueID,
+		},
+		SignerCounter: []uint64{3},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+
+	resp, err := cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+	require.Contains(t, resp.Error, "does not fit in the interval")
+}
+
+// A signer can only update the value once, the second update must be refused
+// and the quota must show that nothing is left.
+func TestAttrRateLimit(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:" + ContractValueID}, signer.Identity())
+	require.NoError(t, err)
+
+	gDarc := &genesisMsg.GenesisDarc
+	action := darc.Action("invoke:" + ContractValueID + ".update")
+	require.NoError(t, gDarc.Rules.AddRule(action,
+		[]byte(signer.Identity().String()+" & attr:"+
+			byzcoin.AttrRateLimitID+":max=1&blocks=1000")))
+	genesisMsg.BlockInterval = time.Second
+	genesisMsg.AttrInterpreters = []string{byzcoin.AttrRateLimitID}
+
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractValueID,
+			Args: []byzcoin.Argument{{
+				Name:  "value",
+				Value: []byte("abc"),
+			}},
+		},
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	myID := ctx.Instructions[0].DeriveID("")
+
+	quotas, err := cl.GetRateLimits(gDarc.GetBaseID(), action, signer.Identity())
+	require.NoError(t, err)
+	require.Len(t, quotas, 1)
+	require.Equal(t, uint64(1), quotas[0].Remaining)
+
+	for i, value := range []string{"def", "ghi"} {
+		ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+			InstanceID: myID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: ContractValueID,
+				Command:    "update",
+				Args: []byzcoin.Argument{{
+					Name:  "value",
+					Value: []byte(value),
+				}},
+			},
+			SignerCounter: []uint64{uint64(2 + i)},
+		})
+		require.NoError(t, err)
+		require.NoError(t, ctx.FillSignersAndSignWith(signer))
+
+		resp, err := cl.AddTransactionAndWait(ctx, 10)
+		if i == 0 {
+			require.NoError(t, err)
+		} else {
+			require.Error(t, err)
+			require.Contains(t, resp.Error, "reached the rate limit")
+		}
+	}
+
+	quotas, err = cl.GetRateLimits(gDarc.GetBaseID(), action, signer.Identity())
+	require.NoError(t, err)
+	require.Len(t, quotas, 1)
+	require.Equal(t, uint64(1), quotas[0].Used)
+	require.Equal(t, uint64(0), quotas[0].Remaining)
+}
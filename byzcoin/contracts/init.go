@@ -18,4 +18,20 @@ func init() {
 	if err != nil {
 		log.ErrFatal(err)
 	}
+	err = byzcoin.RegisterGlobalContract(ContractMultiSigID, contractMultiSigFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+	err = byzcoin.RegisterGlobalContract(ContractTokenID, contractTokenFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+	err = byzcoin.RegisterGlobalContract(ContractTokenAccountID, contractTokenAccountFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+	err = byzcoin.RegisterGlobalContract(ContractNFTID, contractNFTFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
 }
@@ -0,0 +1,480 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractMultiSigID denotes a contract that holds coins which can only be
+// transferred once enough of its owners approved the transfer.
+const ContractMultiSigID = "multisig"
+
+// MultiSigDepositID returns the ID of the deposit account of the wallet. As
+// the coin contract derives the IDs of the coins it spawns differently, only
+// the multisig contract can create it.
+func MultiSigDepositID(wallet byzcoin.InstanceID) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte("multisig deposit"))
+	h.Write(wallet.Slice())
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// ContractMultiSig is a wallet shared by a set of owners. Every transfer out
+// of the wallet must be approved by Threshold owners, the approvals being
+// collected over as many blocks as needed.
+//
+// Spawning a multisig takes the argument "struct" holding a protobuf encoded
+// MultiSigWallet, of which only Owners, Threshold, ProposalBlocks and
+// Coin.Name are used. The coins given as input with the same name are stored
+// in the wallet. The spawn also creates a darc allowing every owner to
+// propose and approve, and requiring all owners to evolve it. The wallet is
+// governed by this darc. Finally, the spawn creates the deposit account of
+// the wallet, a coin instance at MultiSigDepositID, so that the wallet can be
+// funded with a coin transfer.
+//
+// The following methods are available:
+//   - store puts the coins given to the instance, and the coins transferred
+//     to its deposit account, into the wallet. Anybody can store coins, but
+//     the instruction must not have any signer.
+//   - propose creates a new transfer of "coins" to the coin instance given in
+//     "destination". The "coins"-argument must be a 64-bit uint in
+//     LittleEndian. All the signers must be owners, and count as approvals.
+//   - approve adds the signers to the approvals of the proposal given in the
+//     argument "proposal", a 64-bit uint in LittleEndian.
+//
+// As soon as a proposal has Threshold approvals, the coins are transferred.
+// Proposals that don't reach the threshold in ProposalBlocks blocks are
+// removed.
+// You can only delete a multisig instance if the wallet is empty.
+type ContractMultiSig struct {
+	byzcoin.BasicContract
+	MultiSigWallet
+}
+
+func contractMultiSigFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &ContractMultiSig{}
+	err := protobuf.Decode(in, &c.MultiSigWallet)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+// VerifyInstruction overrides the definition in BasicContract. Storing coins
+// is allowed for everybody, but without signers, else the counters of the
+// signers could be increased without their signature. For the other
+// instructions every signer counts as an approval, so all the signatures must
+// be valid, and not only the ones needed to fulfill the rule.
+func (c *ContractMultiSig) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, ctxHash []byte) error {
+	if inst.GetType() == byzcoin.InvokeType && inst.Invoke.Command == "store" {
+		if len(inst.SignerIdentities) > 0 || len(inst.Signatures) > 0 {
+			return xerrors.New("storing coins must not be signed")
+		}
+		return nil
+	}
+	err := c.BasicContract.VerifyInstruction(rst, inst, ctxHash)
+	if err != nil {
+		return xerrors.Errorf("verifying instruction: %v", err)
+	}
+	if len(inst.Signatures) != len(inst.SignerIdentities) {
+		return xerrors.New("length of identities does not match the length of signatures")
+	}
+	for i, id := range inst.SignerIdentities {
+		if err := id.Verify(ctxHash, inst.Signatures[i]); err != nil {
+			return xerrors.Errorf("invalid signature of %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// Spawn creates a new multisig wallet and the darc governing it.
+func (c *ContractMultiSig) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var ca byzcoin.InstanceID
+	if rst.GetVersion() >= byzcoin.VersionPreID {
+		ca, err = inst.DeriveIDArg("", "preID")
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't get deriveID: %v", err)
+		}
+	} else {
+		ca = inst.DeriveID("")
+	}
+
+	structBuf := inst.Spawn.Args.Search("struct")
+	if structBuf == nil {
+		return nil, nil, xerrors.New("multisig needs struct argument")
+	}
+	err = protobuf.Decode(structBuf, &c.MultiSigWallet)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't decode MultiSigWallet: %v", err)
+	}
+	if err = c.checkOwners(); err != nil {
+		return
+	}
+	if c.Coin.Name.Equal(byzcoin.InstanceID{}) {
+		c.Coin.Name = CoinName
+	}
+	c.Coin.Value = 0
+	c.Proposals = nil
+	c.NextProposal = 0
+	cout = c.storeCoins(coins)
+
+	d, err := c.makeDarc(ca)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("creating darc: %v", err)
+	}
+	dBuf, err := d.ToProto()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding darc: %v", err)
+	}
+	wBuf, err := protobuf.Encode(&c.MultiSigWallet)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding wallet: %v", err)
+	}
+	// The darc of the wallet has no rule for the deposit account, so its
+	// coins can only be stored in the wallet.
+	depBuf, err := protobuf.Encode(&byzcoin.Coin{Name: c.Coin.Name})
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding deposit account: %v", err)
+	}
+
+	log.Lvlf2("Spawning multisig to %x with darc %x", ca.Slice(), d.GetBaseID())
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, byzcoin.NewInstanceID(d.GetBaseID()),
+			byzcoin.ContractDarcID, dBuf, d.GetBaseID()),
+		byzcoin.NewStateChange(byzcoin.Create, ca, ContractMultiSigID, wBuf,
+			d.GetBaseID()),
+		byzcoin.NewStateChange(byzcoin.Create, MultiSigDepositID(ca),
+			ContractCoinID, depBuf, d.GetBaseID()),
+	}
+	return
+}
+
+// Invoke stores coins in the wallet, or proposes and approves transfers.
+func (c *ContractMultiSig) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	c.removeExpired(rst.GetIndex())
+
+	switch inst.Invoke.Command {
+	case "store":
+		cout = c.storeCoins(coins)
+		sc, err = c.storeDeposit(rst, inst.InstanceID)
+		if err != nil {
+			return
+		}
+	case "propose":
+		if err = c.checkSigners(inst); err != nil {
+			return
+		}
+		var coinsArg uint64
+		coinsArg, err = uint64Arg(inst.Invoke.Args, "coins")
+		if err != nil {
+			return
+		}
+		target := inst.Invoke.Args.Search("destination")
+		if len(target) != len(byzcoin.InstanceID{}) {
+			return nil, nil, xerrors.New("argument \"destination\" must be an instance ID")
+		}
+		if coinsArg > c.Coin.Value {
+			return nil, nil, xerrors.New("not enough coins in the wallet")
+		}
+		p := MultiSigProposal{
+			ID:          c.NextProposal,
+			Destination: byzcoin.NewInstanceID(target),
+			Coins:       coinsArg,
+			Expiry:      rst.GetIndex() + int(c.ProposalBlocks),
+		}
+		p.addApprovals(inst.SignerIdentities)
+		c.NextProposal++
+		c.Proposals = append(c.Proposals, p)
+		log.Lvlf2("proposal %d to transfer %d to %x", p.ID, p.Coins, target)
+		sc, err = c.executeIfApproved(rst, len(c.Proposals)-1)
+		if err != nil {
+			return
+		}
+	case "approve":
+		if err = c.checkSigners(inst); err != nil {
+			return
+		}
+		var id uint64
+		id, err = uint64Arg(inst.Invoke.Args, "proposal")
+		if err != nil {
+			return
+		}
+		index := -1
+		for i, p := range c.Proposals {
+			if p.ID == id {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil, nil, xerrors.Errorf("proposal %d doesn't exist or expired", id)
+		}
+		c.Proposals[index].addApprovals(inst.SignerIdentities)
+		sc, err = c.executeIfApproved(rst, index)
+		if err != nil {
+			return
+		}
+	default:
+		return nil, nil, xerrors.New("multisig contract can only store, propose and approve")
+	}
+
+	var wBuf []byte
+	wBuf, err = protobuf.Encode(&c.MultiSigWallet)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding wallet: %v", err)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractMultiSigID, wBuf, darcID))
+	return
+}
+
+// Delete removes the wallet, which must be empty.
+func (c *ContractMultiSig) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.Coin.Value > 0 {
+		err = xerrors.New("cannot destroy a multisig wallet that still has coins in it")
+		return
+	}
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractMultiSigID, nil, darcID),
+	}
+	dep, ok, err := getDeposit(rst, inst.InstanceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		if dep.Value > 0 {
+			return nil, nil, xerrors.New("cannot destroy a multisig wallet that still has coins in its deposit account")
+		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Remove,
+			MultiSigDepositID(inst.InstanceID), ContractCoinID, nil, darcID))
+	}
+	return
+}
+
+// checkOwners verifies that the owners and the threshold are consistent.
+func (c *ContractMultiSig) checkOwners() error {
+	if len(c.Owners) == 0 {
+		return xerrors.New("multisig needs at least one owner")
+	}
+	if c.Threshold == 0 || int(c.Threshold) > len(c.Owners) {
+		return xerrors.Errorf("threshold must be between 1 and %d", len(c.Owners))
+	}
+	if c.ProposalBlocks == 0 {
+		return xerrors.New("proposals must be valid for at least one block")
+	}
+	for i := range c.Owners {
+		for j := i + 1; j < len(c.Owners); j++ {
+			if c.Owners[i].Equal(&c.Owners[j]) {
+				return xerrors.Errorf("owner %s is given twice", c.Owners[i])
+			}
+		}
+	}
+	return nil
+}
+
+// checkSigners verifies that all the signers of the instruction are owners.
+func (c *ContractMultiSig) checkSigners(inst byzcoin.Instruction) error {
+	if len(inst.SignerIdentities) == 0 {
+		return xerrors.New("instruction needs to be signed by an owner")
+	}
+	for _, signer := range inst.SignerIdentities {
+		if !c.isOwner(signer) {
+			return xerrors.Errorf("%s is not an owner of the wallet", signer)
+		}
+	}
+	return nil
+}
+
+func (c *ContractMultiSig) isOwner(id darc.Identity) bool {
+	for _, owner := range c.Owners {
+		if owner.Equal(&id) {
+			return true
+		}
+	}
+	return false
+}
+
+// makeDarc returns the darc governing the wallet with the given ID.
+func (c *ContractMultiSig) makeDarc(id byzcoin.InstanceID) (*darc.Darc, error) {
+	owners := make([]string, len(c.Owners))
+	for i, owner := range c.Owners {
+		owners[i] = owner.String()
+	}
+	anyOwner := expression.InitOrExpr(owners...)
+	allOwners := expression.InitAndExpr(owners...)
+
+	// The rules are added in a fixed order so that all nodes create the
+	// same darc.
+	rules := darc.NewRules()
+	for _, r := range []struct {
+		action darc.Action
+		expr   expression.Expr
+	}{
+		{"invoke:" + byzcoin.ContractDarcID + ".evolve", allOwners},
+		{"_sign", anyOwner},
+		{"invoke:" + ContractMultiSigID + ".propose", anyOwner},
+		{"invoke:" + ContractMultiSigID + ".approve", anyOwner},
+		{"delete:" + ContractMultiSigID, allOwners},
+	} {
+		if err := rules.AddRule(r.action, r.expr); err != nil {
+			return nil, err
+		}
+	}
+	return darc.NewDarc(rules, append([]byte("multisig wallet "), id.Slice()...)), nil
+}
+
+// storeCoins adds the coins with the name of the wallet and returns the
+// other ones.
+func (c *ContractMultiSig) storeCoins(coins []byzcoin.Coin) []byzcoin.Coin {
+	cout := []byzcoin.Coin{}
+	for _, co := range coins {
+		if c.Coin.Name.Equal(co.Name) && c.Coin.SafeAdd(co.Value) == nil {
+			continue
+		}
+		cout = append(cout, co)
+	}
+	return cout
+}
+
+// getDeposit returns the deposit account of the wallet, and whether it
+// exists. The wallets spawned before the deposit accounts were added don't
+// have one.
+func getDeposit(rst byzcoin.ReadOnlyStateTrie, wallet byzcoin.InstanceID) (byzcoin.Coin, bool, error) {
+	var dep byzcoin.Coin
+	buf, _, cid, _, err := rst.GetValues(MultiSigDepositID(wallet).Slice())
+	if err != nil || cid != ContractCoinID {
+		return dep, false, nil
+	}
+	if err := protobuf.Decode(buf, &dep); err != nil {
+		return dep, false, xerrors.Errorf("decoding deposit account: %v", err)
+	}
+	return dep, true, nil
+}
+
+// storeDeposit moves the coins of the deposit account into the wallet.
+func (c *ContractMultiSig) storeDeposit(rst byzcoin.ReadOnlyStateTrie, wallet byzcoin.InstanceID) ([]byzcoin.StateChange, error) {
+	dep, ok, err := getDeposit(rst, wallet)
+	if err != nil || !ok || dep.Value == 0 {
+		return nil, err
+	}
+	if err := c.Coin.SafeAdd(dep.Value); err != nil {
+		return nil, xerrors.Errorf("storing deposit: %v", err)
+	}
+	dep.Value = 0
+	buf, err := protobuf.Encode(&dep)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding deposit account: %v", err)
+	}
+	_, _, _, darcID, err := rst.GetValues(MultiSigDepositID(wallet).Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("reading trie: %v", err)
+	}
+	return []byzcoin.StateChange{byzcoin.NewStateChange(byzcoin.Update,
+		MultiSigDepositID(wallet), ContractCoinID, buf, darcID)}, nil
+}
+
+// removeExpired drops the proposals that cannot be approved anymore.
+func (c *ContractMultiSig) removeExpired(index int) {
+	var proposals []MultiSigProposal
+	for _, p := range c.Proposals {
+		if p.Expiry >= index {
+			proposals = append(proposals, p)
+		} else {
+			log.Lvlf2("proposal %d expired", p.ID)
+		}
+	}
+	c.Proposals = proposals
+}
+
+// executeIfApproved transfers the coins of the proposal at the given index
+// if it has enough approvals, and removes it from the wallet.
+func (c *ContractMultiSig) executeIfApproved(rst byzcoin.ReadOnlyStateTrie, index int) (byzcoin.StateChanges, error) {
+	p := c.Proposals[index]
+	if len(p.Approvals) < int(c.Threshold) {
+		return nil, nil
+	}
+
+	v, _, cid, did, err := rst.GetValues(p.Destination.Slice())
+	if err == nil && cid != ContractCoinID {
+		err = xerrors.New("destination is not a coin contract")
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("getting destination: %v", err)
+	}
+	var target byzcoin.Coin
+	if err := protobuf.Decode(v, &target); err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal target account: %v", err)
+	}
+	if !target.Name.Equal(c.Coin.Name) {
+		return nil, xerrors.New("destination holds another type of coins")
+	}
+	if err := c.Coin.SafeSub(p.Coins); err != nil {
+		return nil, xerrors.Errorf("executing proposal %d: %v", p.ID, err)
+	}
+	if err := target.SafeAdd(p.Coins); err != nil {
+		return nil, xerrors.Errorf("executing proposal %d: %v", p.ID, err)
+	}
+	targetBuf, err := protobuf.Encode(&target)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't marshal target account: %v", err)
+	}
+	c.Proposals = append(c.Proposals[:index], c.Proposals[index+1:]...)
+
+	log.Lvlf2("executing proposal %d: transferring %d to %x", p.ID, p.Coins,
+		p.Destination.Slice())
+	return byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Update, p.Destination, ContractCoinID,
+			targetBuf, did),
+	}, nil
+}
+
+// addApprovals adds the identities that didn't approve the proposal yet.
+func (p *MultiSigProposal) addApprovals(ids []darc.Identity) {
+	for _, id := range ids {
+		found := false
+		for _, approval := range p.Approvals {
+			if approval.Equal(&id) {
+				found = true
+			}
+		}
+		if !found {
+			p.Approvals = append(p.Approvals, id)
+		}
+	}
+}
+
+// uint64Arg returns the argument as a 64-bit uint in LittleEndian.
+func uint64Arg(args byzcoin.Arguments, name string) (uint64, error) {
+	buf := args.Search(name)
+	if buf == nil {
+		return 0, xerrors.Errorf("argument \"%s\" is missing", name)
+	}
+	if len(buf) != 8 {
+		return 0, xerrors.Errorf("argument \"%s\" is wrong length", name)
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
@@ -0,0 +1,207 @@
+package contracts
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+func TestMultiSig_Spawn(t *testing.T) {
+	ct := newCT(t, "spawn:multisig")
+	owners := []darc.Signer{darc.NewSignerEd25519(nil, nil),
+		darc.NewSignerEd25519(nil, nil)}
+
+	spawn := func(w MultiSigWallet, coins ...byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+		buf, err := protobuf.Encode(&w)
+		require.NoError(t, err)
+		inst := byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractMultiSigID,
+				Args:       byzcoin.Arguments{{Name: "struct", Value: buf}},
+			},
+		}
+		c, err := contractMultiSigFromBytes(nil)
+		require.NoError(t, err)
+		return c.Spawn(ct, inst, coins)
+	}
+
+	ids := []darc.Identity{owners[0].Identity(), owners[1].Identity()}
+	_, _, err := spawn(MultiSigWallet{Owners: ids, Threshold: 3, ProposalBlocks: 1})
+	require.Error(t, err)
+	_, _, err = spawn(MultiSigWallet{Owners: ids, Threshold: 0, ProposalBlocks: 1})
+	require.Error(t, err)
+	_, _, err = spawn(MultiSigWallet{Owners: ids, Threshold: 1, ProposalBlocks: 0})
+	require.Error(t, err)
+	_, _, err = spawn(MultiSigWallet{Owners: []darc.Identity{ids[0], ids[0]},
+		Threshold: 1, ProposalBlocks: 1})
+	require.Error(t, err)
+
+	other := byzcoin.Coin{Name: iid("other"), Value: 1}
+	sc, co, err := spawn(MultiSigWallet{Owners: ids, Threshold: 2, ProposalBlocks: 1},
+		byzcoin.Coin{Name: CoinName, Value: 10}, other)
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{other}, co)
+	require.Len(t, sc, 3)
+	require.Equal(t, byzcoin.ContractDarcID, sc[0].ContractID)
+	require.Equal(t, ContractMultiSigID, sc[1].ContractID)
+	require.Equal(t, sc[0].InstanceID, sc[1].DarcID)
+	require.Equal(t, ContractCoinID, sc[2].ContractID)
+	require.Equal(t, MultiSigDepositID(byzcoin.NewInstanceID(sc[1].InstanceID)),
+		byzcoin.NewInstanceID(sc[2].InstanceID))
+	require.Equal(t, sc[0].InstanceID, sc[2].DarcID)
+
+	d, err := darc.NewFromProtobuf(sc[0].Value)
+	require.NoError(t, err)
+	require.Equal(t, darc.ID(sc[0].InstanceID), d.GetBaseID())
+	require.True(t, d.Rules.Contains("invoke:multisig.propose"))
+	require.True(t, d.Rules.Contains("invoke:multisig.approve"))
+
+	var w MultiSigWallet
+	require.NoError(t, protobuf.Decode(sc[1].Value, &w))
+	require.Equal(t, uint64(10), w.Coin.Value)
+	require.True(t, w.Coin.Name.Equal(CoinName))
+}
+
+func TestMultiSig_ProposeApprove(t *testing.T) {
+	ct := newCT(t)
+	owners := []darc.Signer{darc.NewSignerEd25519(nil, nil),
+		darc.NewSignerEd25519(nil, nil), darc.NewSignerEd25519(nil, nil)}
+	var ids []darc.Identity
+	for _, o := range owners {
+		ids = append(ids, o.Identity())
+	}
+
+	msAddr := iid("multisig")
+	w := MultiSigWallet{
+		Coin:           byzcoin.Coin{Name: CoinName, Value: 10},
+		Owners:         ids,
+		Threshold:      2,
+		ProposalBlocks: 10,
+	}
+	wBuf, err := protobuf.Encode(&w)
+	require.NoError(t, err)
+	ct.Store(msAddr, wBuf, ContractMultiSigID, gdarc.GetBaseID())
+	coAddr := iid("destination")
+	ct.Store(coAddr, ciZero, ContractCoinID, gdarc.GetBaseID())
+
+	invoke := func(cmd string, args byzcoin.Arguments, signers ...darc.Signer) ([]byzcoin.StateChange, error) {
+		inst := byzcoin.Instruction{
+			InstanceID: msAddr,
+			Invoke:     &byzcoin.Invoke{Command: cmd, Args: args},
+		}
+		for _, s := range signers {
+			inst.SignerIdentities = append(inst.SignerIdentities, s.Identity())
+		}
+		c, err := contractMultiSigFromBytes(ct.values[string(msAddr.Slice())])
+		require.NoError(t, err)
+		sc, _, err := c.Invoke(ct, inst, nil)
+		if err == nil {
+			for _, s := range sc {
+				ct.Store(byzcoin.NewInstanceID(s.InstanceID), s.Value,
+					s.ContractID, s.DarcID)
+			}
+		}
+		return sc, err
+	}
+	uint64Buf := func(v uint64) []byte {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, v)
+		return buf
+	}
+	propose := byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(2)},
+		{Name: "destination", Value: coAddr.Slice()},
+	}
+	wallet := func() MultiSigWallet {
+		var w MultiSigWallet
+		require.NoError(t, protobuf.Decode(ct.values[string(msAddr.Slice())], &w))
+		return w
+	}
+
+	// Only owners can propose, and not more than the wallet holds.
+	_, err = invoke("propose", propose, darc.NewSignerEd25519(nil, nil))
+	require.Error(t, err)
+	_, err = invoke("propose", byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(11)},
+		{Name: "destination", Value: coAddr.Slice()},
+	}, owners[0])
+	require.Error(t, err)
+
+	sc, err := invoke("propose", propose, owners[0])
+	require.NoError(t, err)
+	require.Len(t, sc, 1)
+	require.Len(t, wallet().Proposals, 1)
+
+	// Approving twice doesn't count twice.
+	sc, err = invoke("approve", byzcoin.Arguments{{Name: "proposal", Value: uint64Buf(0)}},
+		owners[0])
+	require.NoError(t, err)
+	require.Len(t, sc, 1)
+	require.Len(t, wallet().Proposals[0].Approvals, 1)
+
+	sc, err = invoke("approve", byzcoin.Arguments{{Name: "proposal", Value: uint64Buf(0)}},
+		owners[1])
+	require.NoError(t, err)
+	require.Len(t, sc, 2)
+	require.Equal(t, byzcoin.NewStateChange(byzcoin.Update, coAddr, ContractCoinID,
+		ciTwo, gdarc.GetBaseID()), sc[0])
+	require.Len(t, wallet().Proposals, 0)
+	require.Equal(t, uint64(8), wallet().Coin.Value)
+
+	// The proposal doesn't exist anymore.
+	_, err = invoke("approve", byzcoin.Arguments{{Name: "proposal", Value: uint64Buf(0)}},
+		owners[2])
+	require.Error(t, err)
+
+	// Two signers in one instruction reach the threshold immediately.
+	sc, err = invoke("propose", propose, owners[1], owners[2])
+	require.NoError(t, err)
+	require.Len(t, sc, 2)
+	require.Equal(t, uint64(6), wallet().Coin.Value)
+
+	// A proposal expires after ProposalBlocks blocks.
+	_, err = invoke("propose", propose, owners[0])
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), wallet().Proposals[0].ID)
+	ct.index += 20
+	_, err = invoke("approve", byzcoin.Arguments{{Name: "proposal", Value: uint64Buf(2)}},
+		owners[1])
+	require.Error(t, err)
+	_, err = invoke("store", nil)
+	require.NoError(t, err)
+	require.Len(t, wallet().Proposals, 0)
+	require.Equal(t, uint64(6), wallet().Coin.Value)
+
+	// The coins transferred to the deposit account are stored in the
+	// wallet.
+	depAddr := MultiSigDepositID(msAddr)
+	depBuf, err := protobuf.Encode(&byzcoin.Coin{Name: CoinName, Value: 5})
+	require.NoError(t, err)
+	ct.Store(depAddr, depBuf, ContractCoinID, gdarc.GetBaseID())
+	sc, err = invoke("store", nil)
+	require.NoError(t, err)
+	require.Len(t, sc, 2)
+	require.Equal(t, uint64(11), wallet().Coin.Value)
+	var dep byzcoin.Coin
+	require.NoError(t, protobuf.Decode(ct.values[string(depAddr.Slice())], &dep))
+	require.Equal(t, uint64(0), dep.Value)
+
+	// Storing doesn't accept signers, whose counters would be increased
+	// without a valid signature.
+	c, err := contractMultiSigFromBytes(ct.values[string(msAddr.Slice())])
+	require.NoError(t, err)
+	store := byzcoin.Instruction{
+		InstanceID: msAddr,
+		Invoke:     &byzcoin.Invoke{Command: "store"},
+	}
+	require.NoError(t, c.VerifyInstruction(ct, store, nil))
+	store.SignerIdentities = []darc.Identity{owners[0].Identity()}
+	store.SignerCounter = []uint64{1}
+	store.Signatures = [][]byte{{}}
+	require.Error(t, c.VerifyInstruction(ct, store, nil))
+}
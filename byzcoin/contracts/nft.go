@@ -0,0 +1,265 @@
+package contracts
+
+import (
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractNFTID denotes a contract holding a non-fungible token.
+const ContractNFTID = "nft"
+
+// ContractNFT registers a unique asset owned by one identity.
+//
+// Spawning an NFT takes the argument "owner" with the string of the identity
+// of the owner, the argument "metadata" describing the asset, and the
+// optional argument "royalty" holding a protobuf encoded NFTRoyalty. The ID
+// of the NFT is derived from the "preID" argument, if given. The spawn also
+// creates a darc for the asset, allowing the owner to sign, to transfer and
+// to delete the NFT. The darc cannot be evolved by the owner, so that the
+// royalty and the history cannot be bypassed. The NFT is governed by this
+// darc.
+//
+// The following method is available:
+//   - transfer gives the asset to the identity given as a string in "owner".
+//     The darc of the asset is evolved so that the rules are given to the new
+//     owner, and the transfer is added to the history. If the NFT has a
+//     royalty, the coins given as input pay it, and the remaining coins are
+//     returned.
+//
+// Deleting the NFT also removes all the rules of its darc.
+type ContractNFT struct {
+	byzcoin.BasicContract
+	NFT
+}
+
+func contractNFTFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &ContractNFT{}
+	err := protobuf.Decode(in, &c.NFT)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+// Spawn creates a new NFT and its darc.
+func (c *ContractNFT) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	ca, err := inst.DeriveIDArg("", "preID")
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't get deriveID: %v", err)
+	}
+
+	c.Owner, err = darc.ParseIdentity(string(inst.Spawn.Args.Search("owner")))
+	if err != nil {
+		return nil, nil, xerrors.Errorf("parsing owner: %v", err)
+	}
+	c.Metadata = inst.Spawn.Args.Search("metadata")
+	if len(c.Metadata) == 0 {
+		return nil, nil, xerrors.New("nft needs metadata argument")
+	}
+	c.Royalty = nil
+	if royaltyBuf := inst.Spawn.Args.Search("royalty"); royaltyBuf != nil {
+		c.Royalty = &NFTRoyalty{}
+		err = protobuf.Decode(royaltyBuf, c.Royalty)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't decode NFTRoyalty: %v", err)
+		}
+		_, _, cid, _, err := rst.GetValues(c.Royalty.Beneficiary.Slice())
+		if err == nil && cid != ContractCoinID {
+			err = xerrors.New("beneficiary is not a coin instance")
+		}
+		if err != nil {
+			return nil, nil, xerrors.Errorf("getting beneficiary: %v", err)
+		}
+	}
+	c.History = nil
+
+	d := darc.NewDarc(nftRules(c.Owner), append([]byte("nft "), ca.Slice()...))
+	dBuf, err := d.ToProto()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding darc: %v", err)
+	}
+	nftBuf, err := protobuf.Encode(&c.NFT)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding nft: %v", err)
+	}
+
+	log.Lvlf2("Spawning nft to %x for %s", ca.Slice(), c.Owner)
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, byzcoin.NewInstanceID(d.GetBaseID()),
+			byzcoin.ContractDarcID, dBuf, d.GetBaseID()),
+		byzcoin.NewStateChange(byzcoin.Create, ca, ContractNFTID, nftBuf,
+			d.GetBaseID()),
+	}
+	return
+}
+
+// Invoke transfers the NFT to a new owner.
+func (c *ContractNFT) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	switch inst.Invoke.Command {
+	case "transfer":
+		var owner darc.Identity
+		owner, err = darc.ParseIdentity(string(inst.Invoke.Args.Search("owner")))
+		if err != nil {
+			return nil, nil, xerrors.Errorf("parsing owner: %v", err)
+		}
+		if owner.Equal(&c.Owner) {
+			return nil, nil, xerrors.New("the new owner already owns the nft")
+		}
+
+		if c.Royalty != nil {
+			var royaltySc byzcoin.StateChange
+			royaltySc, cout, err = c.payRoyalty(rst, coins)
+			if err != nil {
+				return
+			}
+			sc = append(sc, royaltySc)
+		}
+
+		var darcSc byzcoin.StateChange
+		darcSc, err = evolveNFTDarc(rst, darcID, nftRules(owner))
+		if err != nil {
+			return
+		}
+		sc = append(sc, darcSc)
+
+		log.Lvlf2("transferring nft %x from %s to %s", inst.InstanceID.Slice(),
+			c.Owner, owner)
+		c.History = append(c.History, NFTTransfer{
+			From:       c.Owner,
+			To:         owner,
+			BlockIndex: rst.GetIndex(),
+		})
+		c.Owner = owner
+	default:
+		return nil, nil, xerrors.New("nft contract can only transfer")
+	}
+
+	var nftBuf []byte
+	nftBuf, err = protobuf.Encode(&c.NFT)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding nft: %v", err)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractNFTID, nftBuf, darcID))
+	return
+}
+
+// Delete removes the NFT and the rules of its darc.
+func (c *ContractNFT) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	darcSc, err := evolveNFTDarc(rst, darcID, darc.NewRules())
+	if err != nil {
+		return
+	}
+	sc = byzcoin.StateChanges{
+		darcSc,
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractNFTID, nil, darcID),
+	}
+	return
+}
+
+// payRoyalty takes the royalty out of the coins and returns the state change
+// of the beneficiary together with the remaining coins.
+func (c *ContractNFT) payRoyalty(rst byzcoin.ReadOnlyStateTrie, coins []byzcoin.Coin) (byzcoin.StateChange, []byzcoin.Coin, error) {
+	v, _, cid, did, err := rst.GetValues(c.Royalty.Beneficiary.Slice())
+	if err == nil && cid != ContractCoinID {
+		err = xerrors.New("beneficiary is not a coin instance")
+	}
+	if err != nil {
+		return byzcoin.StateChange{}, nil, xerrors.Errorf("getting beneficiary: %v", err)
+	}
+	var beneficiary byzcoin.Coin
+	if err := protobuf.Decode(v, &beneficiary); err != nil {
+		return byzcoin.StateChange{}, nil, xerrors.Errorf("couldn't unmarshal beneficiary: %v", err)
+	}
+
+	due := c.Royalty.Coins
+	cout := []byzcoin.Coin{}
+	for _, co := range coins {
+		if due > 0 && co.Name.Equal(beneficiary.Name) {
+			paid := co.Value
+			if paid > due {
+				paid = due
+			}
+			due -= paid
+			co.Value -= paid
+			if err := beneficiary.SafeAdd(paid); err != nil {
+				return byzcoin.StateChange{}, nil, err
+			}
+		}
+		if co.Value > 0 {
+			cout = append(cout, co)
+		}
+	}
+	if due > 0 {
+		return byzcoin.StateChange{}, nil, xerrors.Errorf("missing %d coins "+
+			"to pay the royalty", due)
+	}
+
+	buf, err := protobuf.Encode(&beneficiary)
+	if err != nil {
+		return byzcoin.StateChange{}, nil, xerrors.Errorf("couldn't marshal beneficiary: %v", err)
+	}
+	return byzcoin.NewStateChange(byzcoin.Update, c.Royalty.Beneficiary,
+		ContractCoinID, buf, did), cout, nil
+}
+
+// nftRules returns the rules of the darc of an NFT owned by the identity.
+func nftRules(owner darc.Identity) darc.Rules {
+	expr := expression.Expr(owner.String())
+	rules := darc.NewRules()
+	for _, action := range []darc.Action{
+		"_sign",
+		"invoke:" + ContractNFTID + ".transfer",
+		"delete:" + ContractNFTID,
+	} {
+		// The actions are all different, so AddRule cannot fail.
+		rules.AddRule(action, expr)
+	}
+	return rules
+}
+
+// evolveNFTDarc returns the state change replacing the rules of the darc of
+// the NFT.
+func evolveNFTDarc(rst byzcoin.ReadOnlyStateTrie, darcID darc.ID, rules darc.Rules) (byzcoin.StateChange, error) {
+	v, _, _, _, err := rst.GetValues(darcID)
+	if err != nil {
+		return byzcoin.StateChange{}, xerrors.Errorf("getting darc: %v", err)
+	}
+	d, err := darc.NewFromProtobuf(v)
+	if err != nil {
+		return byzcoin.StateChange{}, xerrors.Errorf("decoding darc: %v", err)
+	}
+	newD := d.Copy()
+	if err := newD.EvolveFrom(d); err != nil {
+		return byzcoin.StateChange{}, xerrors.Errorf("evolving darc: %v", err)
+	}
+	newD.Rules = rules
+	buf, err := newD.ToProto()
+	if err != nil {
+		return byzcoin.StateChange{}, xerrors.Errorf("encoding darc: %v", err)
+	}
+	return byzcoin.NewStateChange(byzcoin.Update, byzcoin.NewInstanceID(darcID),
+		byzcoin.ContractDarcID, buf, darcID), nil
+}
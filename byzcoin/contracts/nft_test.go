@@ -0,0 +1,109 @@
+package contracts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+func TestNFT_SpawnTransfer(t *testing.T) {
+	ct := newCT(t, "spawn:nft")
+	owner := darc.NewSignerEd25519(nil, nil)
+	buyer := darc.NewSignerEd25519(nil, nil)
+
+	beneficiary := iid("beneficiary")
+	ct.Store(beneficiary, ciZero, ContractCoinID, gdarc.GetBaseID())
+	royaltyBuf, err := protobuf.Encode(&NFTRoyalty{Beneficiary: beneficiary, Coins: 2})
+	require.NoError(t, err)
+
+	spawn := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractNFTID,
+			Args: byzcoin.Arguments{
+				{Name: "owner", Value: []byte(owner.Identity().String())},
+				{Name: "royalty", Value: royaltyBuf},
+			},
+		},
+	}
+	c, err := contractNFTFromBytes(nil)
+	require.NoError(t, err)
+	_, _, err = c.Spawn(ct, spawn, nil)
+	require.Error(t, err)
+
+	spawn.Spawn.Args = append(spawn.Spawn.Args,
+		byzcoin.Argument{Name: "metadata", Value: []byte("certificate")})
+	sc, _, err := c.Spawn(ct, spawn, nil)
+	require.NoError(t, err)
+	require.Len(t, sc, 2)
+	for _, s := range sc {
+		ct.Store(byzcoin.NewInstanceID(s.InstanceID), s.Value, s.ContractID, s.DarcID)
+	}
+	nftID := byzcoin.NewInstanceID(sc[1].InstanceID)
+	darcID := sc[1].DarcID
+	require.Equal(t, darcID, darc.ID(sc[0].InstanceID))
+
+	transfer := func(to darc.Signer, coins ...byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+		inst := byzcoin.Instruction{
+			InstanceID: nftID,
+			Invoke: &byzcoin.Invoke{
+				Command: "transfer",
+				Args: byzcoin.Arguments{
+					{Name: "owner", Value: []byte(to.Identity().String())},
+				},
+			},
+		}
+		c, err := contractNFTFromBytes(ct.values[string(nftID.Slice())])
+		require.NoError(t, err)
+		return c.Invoke(ct, inst, coins)
+	}
+
+	_, _, err = transfer(owner)
+	require.Error(t, err)
+	_, _, err = transfer(buyer, byzcoin.Coin{Name: CoinName, Value: 1})
+	require.Error(t, err)
+
+	sc, cout, err := transfer(buyer, byzcoin.Coin{Name: CoinName, Value: 3})
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{{Name: CoinName, Value: 1}}, cout)
+	require.Len(t, sc, 3)
+	require.Equal(t, byzcoin.NewStateChange(byzcoin.Update, beneficiary,
+		ContractCoinID, ciTwo, gdarc.GetBaseID()), sc[0])
+
+	// The darc is evolved and given to the buyer.
+	d, err := darc.NewFromProtobuf(sc[1].Value)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), d.Version)
+	require.Equal(t, darcID, d.GetBaseID())
+	require.Equal(t, buyer.Identity().String(),
+		string(d.Rules.Get("invoke:nft.transfer")))
+
+	var nft NFT
+	require.NoError(t, protobuf.Decode(sc[2].Value, &nft))
+	buyerID := buyer.Identity()
+	require.True(t, nft.Owner.Equal(&buyerID))
+	require.Equal(t, []byte("certificate"), nft.Metadata)
+	require.Len(t, nft.History, 1)
+	ownerID := owner.Identity()
+	require.True(t, nft.History[0].From.Equal(&ownerID))
+	require.False(t, d.Rules.Contains("invoke:darc.evolve"))
+	for _, s := range sc {
+		ct.Store(byzcoin.NewInstanceID(s.InstanceID), s.Value, s.ContractID, s.DarcID)
+	}
+
+	// Deleting the NFT removes the rules of its darc.
+	c, err = contractNFTFromBytes(ct.values[string(nftID.Slice())])
+	require.NoError(t, err)
+	sc, _, err = c.Delete(ct, byzcoin.Instruction{InstanceID: nftID,
+		Delete: &byzcoin.Delete{ContractID: ContractNFTID}}, nil)
+	require.NoError(t, err)
+	require.Len(t, sc, 2)
+	require.Equal(t, byzcoin.Remove, sc[1].StateAction)
+	d, err = darc.NewFromProtobuf(sc[0].Value)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), d.Version)
+	require.Len(t, d.Rules.List, 0)
+}
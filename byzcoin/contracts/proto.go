@@ -0,0 +1,119 @@
+package contracts
+
+import (
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+// PROTOSTART
+// type :byzcoin.InstanceID:bytes
+// type :darc.ID:bytes
+// package contracts;
+//
+// import "byzcoin.proto";
+// import "darc.proto";
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "Contracts";
+
+// MultiSigWallet is the data stored in a multisig instance. The coins are
+// held by the instance itself, and can only be sent to another coin instance
+// once Threshold of the Owners approved the transfer.
+type MultiSigWallet struct {
+	// Coin holds the type and the amount of coins in the wallet.
+	Coin byzcoin.Coin
+	// Owners are the identities allowed to propose and approve transfers.
+	Owners []darc.Identity
+	// Threshold is the number of owners that must approve a transfer.
+	Threshold uint32
+	// ProposalBlocks is the number of blocks after which a proposal that
+	// didn't reach the threshold expires.
+	ProposalBlocks uint64
+	// Proposals holds the transfers waiting for approvals.
+	Proposals []MultiSigProposal
+	// NextProposal is the ID of the next proposal.
+	NextProposal uint64
+}
+
+// MultiSigProposal is a transfer waiting for approvals.
+type MultiSigProposal struct {
+	// ID identifies the proposal in the wallet.
+	ID uint64
+	// Destination is the coin instance receiving the coins.
+	Destination byzcoin.InstanceID
+	// Coins is the amount to transfer.
+	Coins uint64
+	// Approvals are the owners that approved the transfer.
+	Approvals []darc.Identity
+	// Expiry is the index of the last block where the proposal can be
+	// approved.
+	Expiry int
+}
+
+// Token holds the description and the total supply of a fungible token. The
+// darc of the token instance is the minter darc: its rule
+// "invoke:token.mint" defines who can create new tokens.
+type Token struct {
+	// Name is the human readable name of the token.
+	Name string
+	// Symbol is the short name of the token, like a ticker.
+	Symbol string
+	// Decimals is the number of decimals used to display an amount.
+	Decimals uint32
+	// MaxSupply is the maximum number of tokens that can be minted. If it
+	// is 0, there is no maximum.
+	MaxSupply uint64
+	// Supply is the number of tokens that have been minted and not burnt.
+	Supply uint64
+}
+
+// TokenAccount holds the balance of a fungible token. The name of the
+// balance is the instance ID of the token.
+type TokenAccount struct {
+	// Balance holds the token and the amount in the account.
+	Balance byzcoin.Coin
+	// Allowances are the amounts other identities can transfer out of the
+	// account.
+	Allowances []TokenAllowance
+}
+
+// TokenAllowance is the amount of tokens a spender can transfer out of an
+// account it doesn't own.
+type TokenAllowance struct {
+	// Spender is the identity allowed to transfer the tokens.
+	Spender darc.Identity
+	// Coins is the amount the spender can still transfer.
+	Coins uint64
+}
+
+// NFT is a unique asset owned by one identity. The darc of the instance is
+// evolved at every transfer so that only the current owner can use it.
+type NFT struct {
+	// Owner is the identity owning the asset.
+	Owner darc.Identity
+	// Metadata describes the asset and cannot be changed.
+	Metadata []byte
+	// Royalty, if set, must be paid at every transfer.
+	Royalty *NFTRoyalty `protobuf:"opt"`
+	// History holds all the transfers of the asset, the oldest first.
+	History []NFTTransfer
+}
+
+// NFTRoyalty is the amount of coins paid to the beneficiary when an NFT is
+// transferred.
+type NFTRoyalty struct {
+	// Beneficiary is the coin instance receiving the royalty.
+	Beneficiary byzcoin.InstanceID
+	// Coins is the amount of the royalty.
+	Coins uint64
+}
+
+// NFTTransfer records a change of owner of an NFT.
+type NFTTransfer struct {
+	// From is the previous owner.
+	From darc.Identity
+	// To is the new owner.
+	To darc.Identity
+	// BlockIndex is the index of the last block before the transfer.
+	BlockIndex int
+}
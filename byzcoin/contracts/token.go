@@ -0,0 +1,433 @@
+package contracts
+
+import (
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractTokenID denotes a contract describing a fungible token and keeping
+// track of its total supply.
+const ContractTokenID = "token"
+
+// ContractTokenAccountID denotes a contract holding the tokens of one
+// account.
+const ContractTokenAccountID = "tokenAccount"
+
+// maxTokenDecimals is the highest number of decimals a token can have.
+const maxTokenDecimals = 18
+
+// ContractToken describes a fungible token. As every mint goes through the
+// token instance, its Supply is always the sum of all the account balances,
+// which can be proven with a proof of the token instance.
+//
+// Spawning a token takes the argument "struct" holding a protobuf encoded
+// Token, of which Supply is ignored. The optional argument "darcID" sets the
+// minter darc, which defaults to the darc of the spawn instruction. The ID of
+// the token is derived from the "preID" argument, if given.
+//
+// The following method is available:
+//   - mint creates "coins" tokens in the token account given in
+//     "destination", as long as MaxSupply is not reached.
+type ContractToken struct {
+	byzcoin.BasicContract
+	Token
+}
+
+func contractTokenFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &ContractToken{}
+	err := protobuf.Decode(in, &c.Token)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+// Spawn creates a new token.
+func (c *ContractToken) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+	if did := inst.Spawn.Args.Search("darcID"); did != nil {
+		darcID = darc.ID(did)
+	}
+
+	ca, err := inst.DeriveIDArg("", "preID")
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't get deriveID: %v", err)
+	}
+
+	structBuf := inst.Spawn.Args.Search("struct")
+	if structBuf == nil {
+		return nil, nil, xerrors.New("token needs struct argument")
+	}
+	err = protobuf.Decode(structBuf, &c.Token)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't decode Token: %v", err)
+	}
+	if c.Name == "" || c.Symbol == "" {
+		return nil, nil, xerrors.New("token needs a name and a symbol")
+	}
+	if c.Decimals > maxTokenDecimals {
+		return nil, nil, xerrors.Errorf("token cannot have more than %d decimals",
+			maxTokenDecimals)
+	}
+	c.Supply = 0
+
+	tokenBuf, err := protobuf.Encode(&c.Token)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding token: %v", err)
+	}
+	log.Lvlf2("Spawning token %s to %x with minter darc %x", c.Symbol,
+		ca.Slice(), darcID)
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, ca, ContractTokenID, tokenBuf, darcID),
+	}
+	return
+}
+
+// Invoke mints new tokens.
+func (c *ContractToken) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	switch inst.Invoke.Command {
+	case "mint":
+		var coinsArg uint64
+		coinsArg, err = uint64Arg(inst.Invoke.Args, "coins")
+		if err != nil {
+			return
+		}
+		supply := byzcoin.Coin{Value: c.Supply}
+		if err = supply.SafeAdd(coinsArg); err != nil {
+			return
+		}
+		if c.MaxSupply > 0 && supply.Value > c.MaxSupply {
+			return nil, nil, xerrors.Errorf("minting %d would exceed the "+
+				"maximum supply of %d", coinsArg, c.MaxSupply)
+		}
+		c.Supply = supply.Value
+
+		var target *tokenAccountInstance
+		target, err = loadTokenAccount(rst, inst.Invoke.Args.Search("destination"))
+		if err != nil {
+			return
+		}
+		if !target.Balance.Name.Equal(inst.InstanceID) {
+			return nil, nil, xerrors.New("destination holds another token")
+		}
+		if err = target.Balance.SafeAdd(coinsArg); err != nil {
+			return
+		}
+		var targetSc byzcoin.StateChange
+		targetSc, err = target.stateChange()
+		if err != nil {
+			return
+		}
+		log.Lvlf2("minting %d %s to %x", coinsArg, c.Symbol, target.id.Slice())
+		sc = append(sc, targetSc)
+	default:
+		return nil, nil, xerrors.New("token contract can only mint")
+	}
+
+	var tokenBuf []byte
+	tokenBuf, err = protobuf.Encode(&c.Token)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding token: %v", err)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractTokenID, tokenBuf, darcID))
+	return
+}
+
+// ContractTokenAccount holds the tokens of one account, together with the
+// allowances given to other identities.
+//
+// Spawning an account takes the argument "token" with the instance ID of the
+// token. The optional argument "darcID" sets the darc of the account, which
+// defaults to the darc of the spawn instruction. The ID of the account is
+// derived from the "preID" argument, if given.
+//
+// The following methods are available:
+//   - transfer sends "coins" tokens to the account given in "destination".
+//   - approve allows the identity given as a string in "spender" to transfer
+//     up to "coins" tokens out of the account, replacing any previous
+//     allowance. An allowance of 0 removes it.
+//   - transferFrom sends "coins" tokens to the account given in
+//     "destination". It must be signed only by a spender, and is not
+//     verified against the darc of the account, but against the allowance of
+//     the spender, which is decreased.
+//   - burn destroys "coins" tokens and removes them from the supply.
+//
+// All "coins" arguments are 64-bit uint in LittleEndian. You can only delete
+// an account if it is empty.
+type ContractTokenAccount struct {
+	byzcoin.BasicContract
+	TokenAccount
+}
+
+func contractTokenAccountFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &ContractTokenAccount{}
+	err := protobuf.Decode(in, &c.TokenAccount)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+// VerifyInstruction overrides the definition in BasicContract so that a
+// spender can call transferFrom without being in the darc of the account.
+func (c *ContractTokenAccount) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, ctxHash []byte) error {
+	if inst.GetType() != byzcoin.InvokeType || inst.Invoke.Command != "transferFrom" {
+		return c.BasicContract.VerifyInstruction(rst, inst, ctxHash)
+	}
+
+	if len(inst.SignerIdentities) != 1 || len(inst.Signatures) != 1 {
+		return xerrors.New("transferFrom must be signed by the spender only")
+	}
+	if err := byzcoin.VerifySignerCounters(rst, inst); err != nil {
+		return err
+	}
+	if err := inst.SignerIdentities[0].Verify(ctxHash, inst.Signatures[0]); err != nil {
+		return xerrors.Errorf("invalid signature: %v", err)
+	}
+	if _, ok := c.allowance(inst.SignerIdentities[0]); !ok {
+		return xerrors.New("signer has no allowance on this account")
+	}
+	return nil
+}
+
+// Spawn creates a new, empty, token account.
+func (c *ContractTokenAccount) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+	if did := inst.Spawn.Args.Search("darcID"); did != nil {
+		darcID = darc.ID(did)
+	}
+
+	ca, err := inst.DeriveIDArg("", "preID")
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't get deriveID: %v", err)
+	}
+
+	token := inst.Spawn.Args.Search("token")
+	_, _, cid, _, err := rst.GetValues(token)
+	if err == nil && cid != ContractTokenID {
+		err = xerrors.New("argument \"token\" is not a token instance")
+	}
+	if err != nil {
+		return nil, nil, xerrors.Errorf("getting token: %v", err)
+	}
+
+	c.TokenAccount = TokenAccount{
+		Balance: byzcoin.Coin{Name: byzcoin.NewInstanceID(token)},
+	}
+	accountBuf, err := protobuf.Encode(&c.TokenAccount)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding account: %v", err)
+	}
+	log.Lvlf2("Spawning token account to %x, with darc %x", ca.Slice(), darcID)
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, ca, ContractTokenAccountID,
+			accountBuf, darcID),
+	}
+	return
+}
+
+// Invoke transfers, burns, or approves the transfer of tokens.
+func (c *ContractTokenAccount) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	var coinsArg uint64
+	coinsArg, err = uint64Arg(inst.Invoke.Args, "coins")
+	if err != nil {
+		return
+	}
+
+	switch inst.Invoke.Command {
+	case "transfer", "transferFrom":
+		if inst.Invoke.Command == "transferFrom" {
+			spender := inst.SignerIdentities[0]
+			allowance, _ := c.allowance(spender)
+			if allowance < coinsArg {
+				return nil, nil, xerrors.Errorf("%s is not allowed to "+
+					"transfer %d tokens", spender, coinsArg)
+			}
+			c.setAllowance(spender, allowance-coinsArg)
+		}
+
+		target := inst.Invoke.Args.Search("destination")
+		if inst.InstanceID.Equal(byzcoin.NewInstanceID(target)) {
+			return nil, nil, xerrors.New("cannot send tokens to ourselves")
+		}
+		var account *tokenAccountInstance
+		account, err = loadTokenAccount(rst, target)
+		if err != nil {
+			return
+		}
+		if !account.Balance.Name.Equal(c.Balance.Name) {
+			return nil, nil, xerrors.New("destination holds another token")
+		}
+		if err = c.Balance.SafeSub(coinsArg); err != nil {
+			return
+		}
+		if err = account.Balance.SafeAdd(coinsArg); err != nil {
+			return
+		}
+		var targetSc byzcoin.StateChange
+		targetSc, err = account.stateChange()
+		if err != nil {
+			return
+		}
+		log.Lvlf2("transferring %d tokens to %x", coinsArg, target)
+		sc = append(sc, targetSc)
+	case "approve":
+		var spender darc.Identity
+		spender, err = darc.ParseIdentity(string(inst.Invoke.Args.Search("spender")))
+		if err != nil {
+			return nil, nil, xerrors.Errorf("parsing spender: %v", err)
+		}
+		c.setAllowance(spender, coinsArg)
+	case "burn":
+		if err = c.Balance.SafeSub(coinsArg); err != nil {
+			return
+		}
+		var tokenBuf []byte
+		var tokenDarc darc.ID
+		tokenBuf, _, _, tokenDarc, err = rst.GetValues(c.Balance.Name.Slice())
+		if err != nil {
+			return nil, nil, xerrors.Errorf("getting token: %v", err)
+		}
+		var token Token
+		if err = protobuf.Decode(tokenBuf, &token); err != nil {
+			return nil, nil, xerrors.Errorf("decoding token: %v", err)
+		}
+		supply := byzcoin.Coin{Value: token.Supply}
+		if err = supply.SafeSub(coinsArg); err != nil {
+			return
+		}
+		token.Supply = supply.Value
+		tokenBuf, err = protobuf.Encode(&token)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("encoding token: %v", err)
+		}
+		log.Lvlf2("burning %d %s", coinsArg, token.Symbol)
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update,
+			c.Balance.Name, ContractTokenID, tokenBuf, tokenDarc))
+	default:
+		return nil, nil, xerrors.New("token account contract can only " +
+			"transfer, approve, transferFrom and burn")
+	}
+
+	var accountBuf []byte
+	accountBuf, err = protobuf.Encode(&c.TokenAccount)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding account: %v", err)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractTokenAccountID, accountBuf, darcID))
+	return
+}
+
+// Delete removes the account, which must be empty.
+func (c *ContractTokenAccount) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.Balance.Value > 0 {
+		err = xerrors.New("cannot destroy a token account that still has tokens in it")
+		return
+	}
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID,
+			ContractTokenAccountID, nil, darcID),
+	}
+	return
+}
+
+// allowance returns the amount the spender can transfer, and false if it has
+// no allowance.
+func (c *ContractTokenAccount) allowance(spender darc.Identity) (uint64, bool) {
+	for _, a := range c.Allowances {
+		if a.Spender.Equal(&spender) {
+			return a.Coins, true
+		}
+	}
+	return 0, false
+}
+
+// setAllowance replaces the allowance of the spender. An allowance of 0
+// removes the spender.
+func (c *ContractTokenAccount) setAllowance(spender darc.Identity, coins uint64) {
+	var allowances []TokenAllowance
+	for _, a := range c.Allowances {
+		if !a.Spender.Equal(&spender) {
+			allowances = append(allowances, a)
+		}
+	}
+	if coins > 0 {
+		allowances = append(allowances, TokenAllowance{Spender: spender, Coins: coins})
+	}
+	c.Allowances = allowances
+}
+
+// tokenAccountInstance is a token account read from the trie.
+type tokenAccountInstance struct {
+	TokenAccount
+	id     byzcoin.InstanceID
+	darcID darc.ID
+}
+
+func loadTokenAccount(rst byzcoin.ReadOnlyStateTrie, id []byte) (*tokenAccountInstance, error) {
+	if len(id) != len(byzcoin.InstanceID{}) {
+		return nil, xerrors.New("argument \"destination\" must be an instance ID")
+	}
+	v, _, cid, did, err := rst.GetValues(id)
+	if err == nil && cid != ContractTokenAccountID {
+		err = xerrors.New("destination is not a token account")
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("getting destination: %v", err)
+	}
+	ta := &tokenAccountInstance{id: byzcoin.NewInstanceID(id), darcID: did}
+	if err := protobuf.Decode(v, &ta.TokenAccount); err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal target account: %v", err)
+	}
+	return ta, nil
+}
+
+func (ta *tokenAccountInstance) stateChange() (byzcoin.StateChange, error) {
+	buf, err := protobuf.Encode(&ta.TokenAccount)
+	if err != nil {
+		return byzcoin.StateChange{}, xerrors.Errorf("couldn't marshal target account: %v", err)
+	}
+	return byzcoin.NewStateChange(byzcoin.Update, ta.id, ContractTokenAccountID,
+		buf, ta.darcID), nil
+}
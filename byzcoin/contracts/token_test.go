@@ -0,0 +1,232 @@
+package contracts
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// tokenTest holds a token with two accounts stored in a mock trie.
+type tokenTest struct {
+	*cvTest
+	t        *testing.T
+	token    byzcoin.InstanceID
+	accounts []byzcoin.InstanceID
+}
+
+func newTokenTest(t *testing.T, maxSupply uint64) *tokenTest {
+	tt := &tokenTest{cvTest: newCT(t), t: t}
+
+	tokenBuf, err := protobuf.Encode(&Token{Name: "Test", Symbol: "TST",
+		Decimals: 2, MaxSupply: maxSupply})
+	require.NoError(t, err)
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractTokenID,
+			Args:       byzcoin.Arguments{{Name: "struct", Value: tokenBuf}},
+		},
+	}
+	c, err := contractTokenFromBytes(nil)
+	require.NoError(t, err)
+	sc, _, err := c.Spawn(tt, inst, nil)
+	require.NoError(t, err)
+	tt.apply(sc)
+	tt.token = byzcoin.NewInstanceID(sc[0].InstanceID)
+
+	for i := 0; i < 2; i++ {
+		inst := byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractTokenAccountID,
+				Args: byzcoin.Arguments{
+					{Name: "token", Value: tt.token.Slice()},
+					{Name: "preID", Value: []byte{byte(i)}},
+				},
+			},
+		}
+		c, err := contractTokenAccountFromBytes(nil)
+		require.NoError(t, err)
+		sc, _, err := c.Spawn(tt, inst, nil)
+		require.NoError(t, err)
+		tt.apply(sc)
+		tt.accounts = append(tt.accounts, byzcoin.NewInstanceID(sc[0].InstanceID))
+	}
+	return tt
+}
+
+func (tt *tokenTest) apply(sc []byzcoin.StateChange) {
+	for _, s := range sc {
+		tt.Store(byzcoin.NewInstanceID(s.InstanceID), s.Value, s.ContractID, s.DarcID)
+	}
+}
+
+func (tt *tokenTest) invoke(id byzcoin.InstanceID, cmd string, args byzcoin.Arguments,
+	signers ...darc.Signer) error {
+	inst := byzcoin.Instruction{
+		InstanceID: id,
+		Invoke:     &byzcoin.Invoke{Command: cmd, Args: args},
+	}
+	for _, s := range signers {
+		inst.SignerIdentities = append(inst.SignerIdentities, s.Identity())
+	}
+	c, err := tt.getContract(id)
+	require.NoError(tt.t, err)
+	sc, _, err := c.Invoke(tt, inst, nil)
+	if err == nil {
+		tt.apply(sc)
+	}
+	return err
+}
+
+func (tt *tokenTest) getContract(id byzcoin.InstanceID) (byzcoin.Contract, error) {
+	if tt.contractIDs[string(id.Slice())] == ContractTokenID {
+		return contractTokenFromBytes(tt.values[string(id.Slice())])
+	}
+	return contractTokenAccountFromBytes(tt.values[string(id.Slice())])
+}
+
+func (tt *tokenTest) supply() uint64 {
+	var token Token
+	require.NoError(tt.t, protobuf.Decode(tt.values[string(tt.token.Slice())], &token))
+	return token.Supply
+}
+
+func (tt *tokenTest) balance(i int) uint64 {
+	var account TokenAccount
+	require.NoError(tt.t, protobuf.Decode(tt.values[string(tt.accounts[i].Slice())], &account))
+	return account.Balance.Value
+}
+
+func coinsArgs(v uint64, dest byzcoin.InstanceID) byzcoin.Arguments {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return byzcoin.Arguments{
+		{Name: "coins", Value: buf},
+		{Name: "destination", Value: dest.Slice()},
+	}
+}
+
+func TestToken_Spawn(t *testing.T) {
+	ct := newCT(t)
+	spawn := func(token Token) error {
+		buf, err := protobuf.Encode(&token)
+		require.NoError(t, err)
+		inst := byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractTokenID,
+				Args:       byzcoin.Arguments{{Name: "struct", Value: buf}},
+			},
+		}
+		c, err := contractTokenFromBytes(nil)
+		require.NoError(t, err)
+		_, _, err = c.Spawn(ct, inst, nil)
+		return err
+	}
+
+	require.Error(t, spawn(Token{Symbol: "TST"}))
+	require.Error(t, spawn(Token{Name: "Test"}))
+	require.Error(t, spawn(Token{Name: "Test", Symbol: "TST", Decimals: 19}))
+	require.NoError(t, spawn(Token{Name: "Test", Symbol: "TST", Decimals: 18}))
+
+	// An account needs an existing token.
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractTokenAccountID,
+			Args: byzcoin.Arguments{
+				{Name: "token", Value: gdarc.GetBaseID()},
+			},
+		},
+	}
+	c, err := contractTokenAccountFromBytes(nil)
+	require.NoError(t, err)
+	_, _, err = c.Spawn(ct, inst, nil)
+	require.Error(t, err)
+}
+
+func TestToken_MintBurn(t *testing.T) {
+	tt := newTokenTest(t, 100)
+
+	require.NoError(t, tt.invoke(tt.token, "mint", coinsArgs(60, tt.accounts[0])))
+	require.NoError(t, tt.invoke(tt.token, "mint", coinsArgs(40, tt.accounts[1])))
+	require.Error(t, tt.invoke(tt.token, "mint", coinsArgs(1, tt.accounts[1])))
+	require.Error(t, tt.invoke(tt.token, "mint", coinsArgs(1, tt.token)))
+	require.Equal(t, uint64(100), tt.supply())
+	require.Equal(t, uint64(60), tt.balance(0))
+
+	require.Error(t, tt.invoke(tt.accounts[0], "burn", coinsArgs(61, tt.token)))
+	require.NoError(t, tt.invoke(tt.accounts[0], "burn", coinsArgs(10, tt.token)))
+	require.Equal(t, uint64(90), tt.supply())
+	require.Equal(t, uint64(50), tt.balance(0))
+	require.NoError(t, tt.invoke(tt.token, "mint", coinsArgs(10, tt.accounts[1])))
+	require.Equal(t, uint64(100), tt.supply())
+
+	require.Error(t, tt.invoke(tt.accounts[0], "transfer", coinsArgs(51, tt.accounts[1])))
+	require.Error(t, tt.invoke(tt.accounts[0], "transfer", coinsArgs(1, tt.accounts[0])))
+	require.NoError(t, tt.invoke(tt.accounts[0], "transfer", coinsArgs(20, tt.accounts[1])))
+	require.Equal(t, uint64(30), tt.balance(0))
+	require.Equal(t, uint64(70), tt.balance(1))
+	require.Equal(t, uint64(100), tt.supply())
+}
+
+func TestToken_Allowance(t *testing.T) {
+	tt := newTokenTest(t, 0)
+	require.NoError(t, tt.invoke(tt.token, "mint", coinsArgs(100, tt.accounts[0])))
+
+	spender := darc.NewSignerEd25519(nil, nil)
+	approve := coinsArgs(30, byzcoin.InstanceID{})
+	approve[1] = byzcoin.Argument{Name: "spender", Value: []byte(spender.Identity().String())}
+	require.NoError(t, tt.invoke(tt.accounts[0], "approve", approve))
+
+	// The spender is verified against its allowance and not the darc.
+	transferFrom := byzcoin.Instruction{
+		InstanceID: tt.accounts[0],
+		Invoke: &byzcoin.Invoke{
+			Command: "transferFrom",
+			Args:    coinsArgs(20, tt.accounts[1]),
+		},
+		SignerIdentities: []darc.Identity{spender.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+	ctxHash := []byte("context hash")
+	sig, err := spender.Sign(ctxHash)
+	require.NoError(t, err)
+	transferFrom.Signatures = [][]byte{sig}
+	c, err := tt.getContract(tt.accounts[0])
+	require.NoError(t, err)
+	tt.setSignatureCounter(spender.Identity().String(), 0)
+	require.NoError(t, c.VerifyInstruction(tt, transferFrom, ctxHash))
+	require.Error(t, c.VerifyInstruction(tt, transferFrom, []byte("other hash")))
+	tt.setSignatureCounter(spender.Identity().String(), 1)
+	require.Error(t, c.VerifyInstruction(tt, transferFrom, ctxHash))
+
+	other := darc.NewSignerEd25519(nil, nil)
+	sig, err = other.Sign(ctxHash)
+	require.NoError(t, err)
+	transferFrom.SignerIdentities = []darc.Identity{other.Identity()}
+	transferFrom.Signatures = [][]byte{sig}
+	tt.setSignatureCounter(other.Identity().String(), 0)
+	require.Error(t, c.VerifyInstruction(tt, transferFrom, ctxHash))
+
+	require.NoError(t, tt.invoke(tt.accounts[0], "transferFrom",
+		coinsArgs(20, tt.accounts[1]), spender))
+	require.Error(t, tt.invoke(tt.accounts[0], "transferFrom",
+		coinsArgs(11, tt.accounts[1]), spender))
+	require.NoError(t, tt.invoke(tt.accounts[0], "transferFrom",
+		coinsArgs(10, tt.accounts[1]), spender))
+	require.Equal(t, uint64(70), tt.balance(0))
+	require.Equal(t, uint64(30), tt.balance(1))
+
+	// The allowance is used up and removed.
+	var account TokenAccount
+	require.NoError(t, protobuf.Decode(tt.values[string(tt.accounts[0].Slice())], &account))
+	require.Len(t, account.Allowances, 0)
+	require.Error(t, tt.invoke(tt.accounts[0], "transferFrom",
+		coinsArgs(1, tt.accounts[1]), spender))
+}
@@ -235,3 +235,87 @@ func (p Proof) VerifyAndDecode(suite network.Suite, cid string, value interface{
 	err = protobuf.DecodeWithConstructors(buf, value, network.DefaultConstructors(suite))
 	return cothority.ErrorOrNil(err, "decoding")
 }
+
+// Export returns the proof of the key as an encoded skipchain.ProofBundle,
+// which can be verified offline with ImportProof. The genesis block of the
+// skipchain is added to the bundle, so that the roster of the first link can
+// be verified.
+func (p Proof) Export(genesis *skipchain.SkipBlock, key []byte) ([]byte, error) {
+	if len(p.Links) == 0 || !p.Links[0].To.Equal(genesis.Hash) {
+		return nil, xerrors.New("the proof doesn't start at the genesis block")
+	}
+	trieProof, err := protobuf.Encode(&p.InclusionProof)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding trie proof: %v", err)
+	}
+	latest := p.Latest
+	b := &skipchain.ProofBundle{
+		Version:   skipchain.ProofBundleVersion,
+		Type:      skipchain.ProofBundleByzCoin,
+		GenesisID: genesis.Hash,
+		Blocks:    []*skipchain.SkipBlock{genesis, &latest},
+		Links:     p.Links,
+		TrieProof: trieProof,
+		Key:       key,
+	}
+	if p.InclusionProof.Match(key) {
+		b.Value, b.ContractID, _, err = p.Get(key)
+		if err != nil {
+			return nil, xerrors.Errorf("getting value: %v", err)
+		}
+	}
+	buf, err := b.Encode()
+	return buf, cothority.ErrorOrNil(err, "encoding bundle")
+}
+
+// ImportProof returns the proof and the key of the encoded bundle, once it
+// has been verified for the skipchain with the given genesis ID. If the
+// bundle has a value, the proof is checked to hold the key with this value,
+// otherwise it is checked to prove that the key is absent.
+func ImportProof(buf []byte, genesisID skipchain.SkipBlockID) (*Proof, []byte, error) {
+	b, err := skipchain.DecodeProofBundle(buf)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("decoding bundle: %v", err)
+	}
+	if b.Type != skipchain.ProofBundleByzCoin {
+		return nil, nil, xerrors.Errorf("not a byzcoin proof, but a %s proof", b.Type)
+	}
+	if len(b.Blocks) != 2 {
+		return nil, nil, xerrors.New("expected the genesis and the latest blocks")
+	}
+	genesis := b.Blocks[0]
+	if !b.GenesisID.Equal(genesisID) || !genesis.Hash.Equal(genesisID) ||
+		!genesis.CalculateHash().Equal(genesisID) {
+		return nil, nil, xerrors.New("the proof is for another skipchain")
+	}
+
+	p := &Proof{Latest: *b.Blocks[1], Links: b.Links}
+	err = protobuf.Decode(b.TrieProof, &p.InclusionProof)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("decoding trie proof: %v", err)
+	}
+	if err := p.VerifyFromBlock(genesis); err != nil {
+		return nil, nil, xerrors.Errorf("verifying proof: %v", err)
+	}
+
+	// Match is also false if the proof is not for the key, so an absence
+	// is only accepted if the proof is valid for the key.
+	ok, err := p.InclusionProof.Exists(b.Key)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("the proof is not for the key: %v", err)
+	}
+	if !ok {
+		if b.Value != nil || b.ContractID != "" {
+			return nil, nil, xerrors.New("the value is not in the proof")
+		}
+		return p, b.Key, nil
+	}
+	value, contractID, _, err := p.Get(b.Key)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("getting value: %v", err)
+	}
+	if !bytes.Equal(value, b.Value) || contractID != b.ContractID {
+		return nil, nil, xerrors.New("the value is not the one of the proof")
+	}
+	return p, b.Key, nil
+}
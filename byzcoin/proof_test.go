@@ -58,6 +58,69 @@ func TestVerify(t *testing.T) {
 	require.True(t, xerrors.Is(p.Verify(s.genesis.SkipChainID()), ErrorVerifyTrieRoot))
 }
 
+func TestProof_Export(t *testing.T) {
+	s := createSC(t)
+	p, err := NewProof(s.c, s.s, s.genesis.Hash, s.key)
+	require.NoError(t, err)
+	buf, err := p.Export(s.genesis, s.key)
+	require.NoError(t, err)
+
+	imported, key, err := ImportProof(buf, s.genesis.Hash)
+	require.NoError(t, err)
+	require.Equal(t, s.key, key)
+	val, _, _, err := imported.Get(key)
+	require.NoError(t, err)
+	require.Equal(t, s.value, val)
+
+	_, _, err = ImportProof(buf, s.genesis2.Hash)
+	require.Error(t, err)
+	_, err = p.Export(s.genesis2, s.key)
+	require.Error(t, err)
+
+	// The value of the bundle must be the one of the proof.
+	b, err := skipchain.DecodeProofBundle(buf)
+	require.NoError(t, err)
+	b.Value = []byte("another value")
+	buf, err = b.Encode()
+	require.NoError(t, err)
+	_, _, err = ImportProof(buf, s.genesis.Hash)
+	require.Error(t, err)
+
+	// A proof of absence has no value.
+	absent := []byte{1}
+	p, err = NewProof(s.c, s.s, s.genesis.Hash, absent)
+	require.NoError(t, err)
+	buf, err = p.Export(s.genesis, absent)
+	require.NoError(t, err)
+	imported, key, err = ImportProof(buf, s.genesis.Hash)
+	require.NoError(t, err)
+	require.Equal(t, absent, key)
+	require.False(t, imported.InclusionProof.Match(key))
+
+	// The proof of a key cannot be passed off as the proof of absence of
+	// another key.
+	p, err = NewProof(s.c, s.s, s.genesis.Hash, s.key)
+	require.NoError(t, err)
+	buf, err = p.Export(s.genesis, s.key)
+	require.NoError(t, err)
+	b, err = skipchain.DecodeProofBundle(buf)
+	require.NoError(t, err)
+	var other []byte
+	for i := 0; i < 256 && other == nil; i++ {
+		if _, err := p.InclusionProof.Exists([]byte{byte(i)}); err != nil {
+			other = []byte{byte(i)}
+		}
+	}
+	require.NotNil(t, other)
+	b.Key = other
+	b.Value = nil
+	b.ContractID = ""
+	buf, err = b.Encode()
+	require.NoError(t, err)
+	_, _, err = ImportProof(buf, s.genesis.Hash)
+	require.Error(t, err)
+}
+
 type sc struct {
 	c            *stateTrie             // a usable collectionDB to store key/value pairs
 	s            *skipchain.SkipBlockDB // a usable skipchain DB to store blocks
@@ -85,6 +85,9 @@ type CreateGenesisBlock struct {
 	// DarcContracts is the set of contracts that can be parsed as a DARC.
 	// At least one contract must be given.
 	DarcContractIDs []string
+	// AttrInterpreters is the set of registered attribute interpreters
+	// enabled for this chain.
+	AttrInterpreters []string `protobuf:"opt"`
 }
 
 // CreateGenesisBlockResponse holds the genesis-block of the new skipchain.
@@ -177,6 +180,10 @@ type ChainConfig struct {
 	Roster          onet.Roster
 	MaxBlockSize    int
 	DarcContractIDs []string
+	// AttrInterpreters lists the names of the registered attribute
+	// interpreters that every contract of this chain honours when
+	// evaluating "attr:" expressions.
+	AttrInterpreters []string `protobuf:"opt"`
 }
 
 // Proof represents everything necessary to verify a given
@@ -415,6 +422,40 @@ type GetSignerCountersResponse struct {
 	Index uint64 `protobuf:"opt"`
 }
 
+// GetRateLimits is a request to get the quota left to an identity for every
+// rate limit in the rule of an action of a darc.
+type GetRateLimits struct {
+	SkipchainID skipchain.SkipBlockID
+	DarcID      darc.ID
+	Action      darc.Action
+	// Identity is the string representation of the identity, as it is
+	// given by darc.Identity.String().
+	Identity string
+}
+
+// GetRateLimitsResponse holds one quota per rate limit found in the rule.
+type GetRateLimitsResponse struct {
+	Quotas []RateLimitQuota
+}
+
+// RateLimitQuota describes the state of one rate limit for an identity.
+type RateLimitQuota struct {
+	// Attr is the value of the attribute, e.g. max=10&blocks=100
+	Attr string
+	// Max is the number of executions allowed per window.
+	Max uint64
+	// Blocks is the length of a window in blocks.
+	Blocks uint64
+	// Used is the number of executions counted in the current window.
+	Used uint64
+	// Remaining is the number of executions left in the current window.
+	Remaining uint64
+	// WindowEnd is the index of the first block of the next window.
+	WindowEnd int
+	// BlockIndex is the index of the block the quota has been computed at.
+	BlockIndex int
+}
+
 // GetInstanceVersion is a request asking the service to fetch
 // the version of the given instance
 type GetInstanceVersion struct {
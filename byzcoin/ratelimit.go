@@ -0,0 +1,286 @@
+package byzcoin
+
+import (
+	"crypto/sha256"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// AttrRateLimitID limits the number of times every signer of an instruction
+// can execute an action: attr:rate_limit:max=<n>&blocks=<m> allows at most n
+// executions per window of m blocks. The windows are aligned on the block
+// index, so the first window goes from block 0 to block m-1.
+//
+// The counters are stored in the trie, one per darc, action, rate limit and
+// identity, and are incremented once the instruction has been accepted. Only
+// the attributes written in the rule of the action can be counted, so a rate
+// limit in the "_sign" rule of a delegated darc is refused.
+const AttrRateLimitID = "rate_limit"
+
+func init() {
+	log.ErrFatal(globalAttrRegistry.register(AttrRateLimitID, evalAttrRateLimit))
+}
+
+// rateLimit holds the parsed values of a rate_limit attribute.
+type rateLimit struct {
+	max    uint64
+	blocks uint64
+}
+
+// rateLimitCounter is stored in the trie and counts the executions of one
+// identity during the window.
+type rateLimitCounter struct {
+	Window uint64
+	Count  uint64
+}
+
+func parseRateLimit(attr string) (rateLimit, error) {
+	vals, err := url.ParseQuery(attr)
+	if err != nil {
+		return rateLimit{}, xerrors.Errorf("parsing query: %v", err)
+	}
+	max, err := strconv.ParseUint(vals.Get("max"), 10, 64)
+	if err != nil {
+		return rateLimit{}, xerrors.Errorf("parsing max: %v", err)
+	}
+	blocks, err := strconv.ParseUint(vals.Get("blocks"), 10, 64)
+	if err != nil {
+		return rateLimit{}, xerrors.Errorf("parsing blocks: %v", err)
+	}
+	if blocks == 0 {
+		return rateLimit{}, xerrors.New("blocks must be greater than zero")
+	}
+	return rateLimit{max: max, blocks: blocks}, nil
+}
+
+// window returns the window the block with the given index falls in.
+func (rl rateLimit) window(index int) uint64 {
+	if index < 0 {
+		return 0
+	}
+	return uint64(index) / rl.blocks
+}
+
+// rateLimitKey returns the key of the counter of the identity for the given
+// rate limit attribute in the rule of the action.
+func rateLimitKey(darcID darc.ID, action darc.Action, attr string, id string) []byte {
+	h := sha256.New()
+	h.Write([]byte("ratelimit_"))
+	h.Write(darcID)
+	h.Write([]byte(action))
+	h.Write([]byte(attr))
+	h.Write([]byte(id))
+	return h.Sum(nil)
+}
+
+// getRateLimitCount returns the number of executions already counted in the
+// given window, together with the version of the counter. The version is -1
+// if the counter doesn't exist yet.
+func getRateLimitCount(rst ReadOnlyStateTrie, key []byte, window uint64) (uint64, int64, error) {
+	buf, version, _, _, err := rst.GetValues(key)
+	if xerrors.Is(err, errKeyNotSet) {
+		return 0, -1, nil
+	}
+	if err != nil {
+		return 0, 0, xerrors.Errorf("reading trie: %v", err)
+	}
+	var counter rateLimitCounter
+	if err := protobuf.Decode(buf, &counter); err != nil {
+		return 0, 0, xerrors.Errorf("decoding counter: %v", err)
+	}
+	if counter.Window != window {
+		return 0, int64(version), nil
+	}
+	return counter.Count, int64(version), nil
+}
+
+// evalAttrRateLimit verifies that none of the signers of the instruction
+// reached the limit in the current window.
+func evalAttrRateLimit(rst ReadOnlyStateTrie, inst Instruction, attr string) error {
+	rl, err := parseRateLimit(attr)
+	if err != nil {
+		return err
+	}
+	d, err := instanceDarc(rst, inst.InstanceID)
+	if err != nil {
+		return err
+	}
+	window := rl.window(rst.GetIndex())
+	action := darc.Action(inst.Action())
+	attrs, err := findRateLimitAttrs(d.Rules.Get(action))
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, a := range attrs {
+		found = found || a == attr
+	}
+	if !found {
+		return xerrors.New("a rate limit must be in the rule of the action, " +
+			"and not in the rule of a delegated darc")
+	}
+	for _, id := range inst.SignerIdentities {
+		key := rateLimitKey(d.GetBaseID(), action, attr, id.String())
+		count, _, err := getRateLimitCount(rst, key, window)
+		if err != nil {
+			return err
+		}
+		if count >= rl.max {
+			return xerrors.Errorf("%s reached the rate limit of %d "+
+				"executions per %d blocks", id, rl.max, rl.blocks)
+		}
+	}
+	return nil
+}
+
+// instanceDarc returns the darc controlling the instance.
+func instanceDarc(rst ReadOnlyStateTrie, iid InstanceID) (*darc.Darc, error) {
+	_, _, _, darcID, err := rst.GetValues(iid.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("reading trie: %v", err)
+	}
+	buf, _, _, _, err := rst.GetValues(darcID)
+	if err != nil {
+		return nil, xerrors.Errorf("reading trie: %v", err)
+	}
+	d, err := darc.NewFromProtobuf(buf)
+	return d, cothority.ErrorOrNil(err, "decoding darc")
+}
+
+// findRateLimitAttrs returns the value of every rate_limit attribute of the
+// expression. The expression is tokenised by the parser of the darcs, so
+// that the attributes are the ones it evaluates.
+func findRateLimitAttrs(expr expression.Expr) ([]string, error) {
+	prefix := "attr:" + AttrRateLimitID + ":"
+	var attrs []string
+	seen := make(map[string]bool)
+	_, err := expression.Evaluate(expression.InitParser(func(s string) bool {
+		if strings.HasPrefix(s, prefix) && !seen[s] {
+			seen[s] = true
+			attrs = append(attrs, strings.TrimPrefix(s, prefix))
+		}
+		return false
+	}), expr)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing expression: %v", err)
+	}
+	return attrs, nil
+}
+
+// incrementRateLimitCounters returns the state changes that count the
+// execution of the instruction for all the rate limits of its rule. It must
+// be called with the trie as it was when the instruction was verified.
+func incrementRateLimitCounters(rst ReadOnlyStateTrie, instr Instruction) (StateChanges, error) {
+	config, err := rst.LoadConfig()
+	if err != nil {
+		// There is nothing to count before the genesis config exists.
+		if _, _, _, _, err2 := rst.GetValues(ConfigInstanceID.Slice()); xerrors.Is(err2, errKeyNotSet) {
+			return nil, nil
+		}
+		return nil, xerrors.Errorf("reading config: %v", err)
+	}
+	enabled := false
+	for _, name := range config.AttrInterpreters {
+		if name == AttrRateLimitID {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	d, err := getInstanceDarc(rst, instr.InstanceID, config.DarcContractIDs)
+	if err != nil {
+		return nil, xerrors.Errorf("darc not found: %v", err)
+	}
+	action := darc.Action(instr.Action())
+	attrs, err := findRateLimitAttrs(d.Rules.Get(action))
+	if err != nil {
+		return nil, err
+	}
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+
+	var scs StateChanges
+	for _, attr := range attrs {
+		rl, err := parseRateLimit(attr)
+		if err != nil {
+			return nil, err
+		}
+		window := rl.window(rst.GetIndex())
+		for _, id := range instr.SignerIdentities {
+			key := rateLimitKey(d.GetBaseID(), action, attr, id.String())
+			count, version, err := getRateLimitCount(rst, key, window)
+			if err != nil {
+				return nil, err
+			}
+			buf, err := protobuf.Encode(&rateLimitCounter{
+				Window: window,
+				Count:  count + 1,
+			})
+			if err != nil {
+				return nil, xerrors.Errorf("encoding counter: %v", err)
+			}
+			sc := NewStateChange(Create, NewInstanceID(key), "", buf, darc.ID([]byte{}))
+			if version >= 0 {
+				sc.StateAction = Update
+				sc.Version = uint64(version) + 1
+			}
+			scs = append(scs, sc)
+		}
+	}
+	return scs, nil
+}
+
+// getRateLimitQuotas returns the state of all the rate limits of the rule
+// of the action for the given identity.
+func getRateLimitQuotas(rst ReadOnlyStateTrie, darcID darc.ID,
+	action darc.Action, id string) ([]RateLimitQuota, error) {
+	d, err := rst.LoadDarc(darcID)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't find darc: %v", err)
+	}
+	if !d.Rules.Contains(action) {
+		return nil, xerrors.Errorf("action '%v' does not exist", action)
+	}
+
+	attrs, err := findRateLimitAttrs(d.Rules.Get(action))
+	if err != nil {
+		return nil, err
+	}
+	var quotas []RateLimitQuota
+	for _, attr := range attrs {
+		rl, err := parseRateLimit(attr)
+		if err != nil {
+			return nil, err
+		}
+		window := rl.window(rst.GetIndex())
+		key := rateLimitKey(d.GetBaseID(), action, attr, id)
+		count, _, err := getRateLimitCount(rst, key, window)
+		if err != nil {
+			return nil, err
+		}
+		quota := RateLimitQuota{
+			Attr:       attr,
+			Max:        rl.max,
+			Blocks:     rl.blocks,
+			Used:       count,
+			WindowEnd:  int((window + 1) * rl.blocks),
+			BlockIndex: rst.GetIndex(),
+		}
+		if count < rl.max {
+			quota.Remaining = rl.max - count
+		}
+		quotas = append(quotas, quota)
+	}
+	return quotas, nil
+}
@@ -0,0 +1,95 @@
+package byzcoin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+)
+
+func TestRateLimit_Parse(t *testing.T) {
+	rl, err := parseRateLimit("max=3&blocks=10")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), rl.max)
+	require.Equal(t, uint64(10), rl.blocks)
+	require.Equal(t, uint64(0), rl.window(-1))
+	require.Equal(t, uint64(0), rl.window(9))
+	require.Equal(t, uint64(1), rl.window(10))
+
+	_, err = parseRateLimit("max=3")
+	require.Error(t, err)
+	_, err = parseRateLimit("max=3&blocks=0")
+	require.Error(t, err)
+	_, err = parseRateLimit("max=-1&blocks=10")
+	require.Error(t, err)
+}
+
+func TestRateLimit_FindAttrs(t *testing.T) {
+	expr := expression.Expr("ed25519:abcd & attr:rate_limit:max=1&blocks=2 | " +
+		"(darc:1234 & attr:block:after=1 & attr:rate_limit:max=3&blocks=4 )")
+	attrs, err := findRateLimitAttrs(expr)
+	require.NoError(t, err)
+	require.Equal(t, []string{"max=1&blocks=2", "max=3&blocks=4"}, attrs)
+	attrs, err = findRateLimitAttrs(expression.Expr("ed25519:abcd"))
+	require.NoError(t, err)
+	require.Empty(t, attrs)
+
+	// The attributes are found without spaces around them.
+	attrs, err = findRateLimitAttrs(expression.Expr(
+		"ed25519:abcd|attr:rate_limit:max=1&blocks=2"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"max=1&blocks=2"}, attrs)
+	attrs, err = findRateLimitAttrs(expression.Expr(
+		"(ed25519:abcd|attr:rate_limit:max=1&blocks=2 )&ed25519:ef"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"max=1&blocks=2"}, attrs)
+	_, err = findRateLimitAttrs(expression.Expr("(attr:rate_limit:max=1"))
+	require.Error(t, err)
+}
+
+func TestRateLimit_Eval(t *testing.T) {
+	rst := NewROSTSimul()
+	signer := darc.NewSignerEd25519(nil, nil)
+	id := signer.Identity()
+	d, err := rst.CreateBasicDarc(&id, "rate limit")
+	require.NoError(t, err)
+	attr := "max=2&blocks=10"
+	require.NoError(t, d.Rules.AddRule("invoke:value.update",
+		expression.Expr(id.String()+"&attr:rate_limit:"+attr)))
+	require.NoError(t, rst.CreateSCB(Update, ContractDarcID,
+		NewInstanceID(d.GetBaseID()), d, nil))
+	iid, err := rst.CreateRandomInstance("value", &Coin{}, d.GetBaseID())
+	require.NoError(t, err)
+
+	inst := Instruction{
+		InstanceID:       iid,
+		Invoke:           &Invoke{ContractID: "value", Command: "update"},
+		SignerIdentities: []darc.Identity{id},
+	}
+	require.NoError(t, evalAttrRateLimit(rst, inst, attr))
+
+	// A rate limit that is not in the rule of the action, like one in the
+	// rule of a delegated darc, is refused.
+	require.Error(t, evalAttrRateLimit(rst, inst, "max=3&blocks=10"))
+
+	key := rateLimitKey(d.GetBaseID(), darc.Action(inst.Action()), attr, id.String())
+	require.NoError(t, rst.CreateSCB(Create, "", NewInstanceID(key),
+		&rateLimitCounter{Window: 0, Count: 1}, nil))
+	require.NoError(t, evalAttrRateLimit(rst, inst, attr))
+
+	require.NoError(t, rst.CreateSCB(Update, "", NewInstanceID(key),
+		&rateLimitCounter{Window: 0, Count: 2}, nil))
+	require.Error(t, evalAttrRateLimit(rst, inst, attr))
+
+	// A counter of an older window doesn't count anymore.
+	count, version, err := getRateLimitCount(rst, key, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), count)
+	require.Equal(t, int64(1), version)
+
+	// The counters are per identity.
+	other := darc.NewSignerEd25519(nil, nil).Identity()
+	inst.SignerIdentities = []darc.Identity{other}
+	require.NoError(t, evalAttrRateLimit(rst, inst, attr))
+}
@@ -55,6 +55,18 @@ func incrementSignerCounters(st ReadOnlyStateTrie, ids []darc.Identity) (StateCh
 	return scs, nil
 }
 
+// VerifySignerCounters verifies that the counters of the instruction follow
+// the counters of its signers. A contract overriding VerifyInstruction
+// without verifying the instruction against a darc must call it to protect
+// against replay attacks.
+func VerifySignerCounters(st ReadOnlyStateTrie, instr Instruction) error {
+	err := verifySignerCounters(st, instr.SignerCounter, instr.SignerIdentities)
+	if err != nil {
+		return xerrors.Errorf("signer counter: %v", err)
+	}
+	return nil
+}
+
 // verifySignerCounters verifies whether the given counters are valid with
 // respect to the current counters.
 func verifySignerCounters(st ReadOnlyStateTrie, counters []uint64, ids []darc.Identity) error {
@@ -299,6 +299,20 @@ func (s *Service) CreateGenesisBlock(req *CreateGenesisBlock) (
 		},
 	}
 
+	// The argument is only added when needed so that the genesis
+	// instruction stays the same for chains without attribute
+	// interpreters.
+	if len(req.AttrInterpreters) > 0 {
+		attrNamesBuf, err := protobuf.Encode(&attrInterpreterNames{
+			Names: req.AttrInterpreters,
+		})
+		if err != nil {
+			return nil, xerrors.Errorf("encoding attr names: %v", err)
+		}
+		spawnGenesis.Args = append(spawnGenesis.Args,
+			Argument{Name: "attr_interpreters", Value: attrNamesBuf})
+	}
+
 	// Create the genesis-transaction with a special key, it acts as a
 	// reference to the actual genesis transaction.
 	ctx := ClientTransaction{
@@ -667,6 +681,20 @@ func (s *Service) GetSignerCounters(req *GetSignerCounters) (*GetSignerCountersR
 	return &resp, nil
 }
 
+// GetRateLimits returns the quota left to an identity for the rate limits of
+// an action of a darc.
+func (s *Service) GetRateLimits(req *GetRateLimits) (*GetRateLimitsResponse, error) {
+	st, err := s.GetReadOnlyStateTrie(req.SkipchainID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting trie: %v", err)
+	}
+	quotas, err := getRateLimitQuotas(st, req.DarcID, req.Action, req.Identity)
+	if err != nil {
+		return nil, xerrors.Errorf("getting quotas: %v", err)
+	}
+	return &GetRateLimitsResponse{Quotas: quotas}, nil
+}
+
 // GetUpdates returns instances that have a newer versions than the ones
 // passed to it.
 func (s *Service) GetUpdates(pr *GetUpdatesRequest) (*GetUpdatesReply, error) {
@@ -2339,6 +2367,15 @@ func (s *Service) processOneTx(sst *stagingStateTrie, tx ClientTransaction,
 			return nil, nil, err
 		}
 
+		rateLimitScs, err := incrementRateLimitCounters(sst, instr)
+		if err != nil {
+			err = xerrors.Errorf("%s failed to update rate limit counters: %v",
+				s.ServerIdentity(), err)
+			s.addError(tx, err)
+			return nil, nil, err
+		}
+		counterScs = append(counterScs, rateLimitScs...)
+
 		// Counter used in the seed provided to generated Spawn instructions.
 		// Provides different seeds in case multiple Spawns are generated by a
 		// single instruction.
@@ -3055,6 +3092,7 @@ func newService(c *onet.Context) (onet.Service, error) {
 		s.GetUpdates,
 		s.CheckAuthorization,
 		s.GetSignerCounters,
+		s.GetRateLimits,
 		s.DownloadState,
 		s.GetInstanceVersion,
 		s.GetLastInstanceVersion,
@@ -623,6 +623,68 @@ func TestService_GetProof(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestService_Observer(t *testing.T) {
+	bArgs := defaultBCTArgs
+	bArgs.Nodes = 4
+	b := newBCT(t, &bArgs)
+	defer b.CloseAll()
+	// The last node is not part of the roster, but observes the chain.
+	b.Roster = onet.NewRoster(b.Roster.List[:3])
+	b.GenesisMessage.Roster = *b.Roster
+	b.CreateByzCoin()
+
+	observer := b.Services[3]
+	sks := observer.skService()
+	sks.SetObserveInterval(100 * time.Millisecond)
+	_, err := sks.AddObserve(&skipchain.AddObserve{
+		SkipchainID: b.Genesis.SkipChainID(),
+		Roster:      b.Roster,
+	})
+	require.NoError(t, err)
+
+	cl := NewClientKeep(b.Genesis.SkipChainID(),
+		*onet.NewRoster([]*network.ServerIdentity{b.Servers[3].ServerIdentity}))
+	blocks := make(chan *skipchain.SkipBlock, 10)
+	go func() {
+		cl.StreamTransactions(func(resp StreamingResponse, err error) {
+			if err == nil {
+				blocks <- resp.Block
+			}
+		})
+	}()
+
+	ctx, _ := b.SpawnDummy(nil)
+	key := ctx.Instructions[0].Hash()
+	select {
+	case sb := <-blocks:
+		require.Equal(t, 1, sb.Index)
+	case <-time.After(10 * b.PropagationInterval):
+		require.Fail(t, "didn't get the block from the observer")
+	}
+
+	// The observer serves proofs of the new block.
+	var rep *GetProofResponse
+	for i := 0; i < 10; i++ {
+		rep, err = cl.GetProof(key)
+		require.NoError(t, err)
+		if rep.Proof.InclusionProof.Match(key) {
+			break
+		}
+		time.Sleep(b.PropagationInterval)
+	}
+	require.True(t, rep.Proof.InclusionProof.Match(key))
+	require.NoError(t, rep.Proof.Verify(b.Genesis.SkipChainID()))
+
+	// But it doesn't accept transactions.
+	_, err = observer.AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: b.Genesis.SkipChainID(),
+		Transaction: ctx,
+	})
+	require.Error(t, err)
+	require.NoError(t, cl.Close())
+}
+
 func TestService_DarcProxy(t *testing.T) {
 	b := newBCTRun(t, nil)
 	defer b.CloseAll()
@@ -671,6 +671,11 @@ func (c ChainConfig) sanityCheck(old *ChainConfig) error {
 	if len(c.Roster.List) < 3 {
 		return xerrors.New("need at least 3 nodes to have a majority")
 	}
+	for _, name := range c.AttrInterpreters {
+		if _, exists := globalAttrRegistry.search(name); !exists {
+			return xerrors.Errorf("unknown attribute interpreter '%s'", name)
+		}
+	}
 	if old != nil {
 		return cothority.ErrorOrNil(old.checkNewRoster(c.Roster), "roster check")
 	}
@@ -716,6 +721,8 @@ func (c ChainConfig) checkNewRoster(newRoster onet.Roster) error {
 // --- darc contract ID 0: darc
 // --- darc contract ID 1: darc2
 // --- darc contract ID 2: darc3'
+// -- AttrInterpreters:
+// --- attr interpreter 0: time
 // ```
 func (c ChainConfig) String() string {
 	res := new(strings.Builder)
@@ -727,6 +734,12 @@ func (c ChainConfig) String() string {
 	for i, darcID := range c.DarcContractIDs {
 		fmt.Fprintf(res, "--- darc contract ID %d: %s\n", i, darcID)
 	}
+	if len(c.AttrInterpreters) > 0 {
+		res.WriteString("-- AttrInterpreters:\n")
+		for i, name := range c.AttrInterpreters {
+			fmt.Fprintf(res, "--- attr interpreter %d: %s\n", i, name)
+		}
+	}
 	return res.String()
 }
 
@@ -478,11 +478,16 @@ func (instr Instruction) VerifyWithOption(st ReadOnlyStateTrie, msg []byte, ops
 		return d
 	}
 
-	if ops.EvalAttr != nil {
-		err := darc.EvalExprAttr(d.Rules.Get(darc.Action(instr.Action())), getDarc, ops.EvalAttr, identitiesWithCorrectSignatures...)
-		return cothority.ErrorOrNil(err, "evaluating darc")
+	// The attributes enabled in the chain config are available to every
+	// contract, but the contract can override them with its own.
+	evalAttr, err := makeChainAttrInterpreters(st, instr, config)
+	if err != nil {
+		return xerrors.Errorf("attribute interpreters: %v", err)
+	}
+	for name, attrFunc := range ops.EvalAttr {
+		evalAttr[name] = attrFunc
 	}
-	err = darc.EvalExpr(d.Rules.Get(darc.Action(instr.Action())), getDarc, identitiesWithCorrectSignatures...)
+	err = darc.EvalExprAttr(d.Rules.Get(darc.Action(instr.Action())), getDarc, evalAttr, identitiesWithCorrectSignatures...)
 	return cothority.ErrorOrNil(err, "evaluating darc")
 }
 
@@ -67,6 +67,11 @@ var cmds = cli.Commands{
 				Value: 1,
 			}},
 	},
+	{
+		Name:        "multisig",
+		Usage:       "handles multi-signature wallets",
+		Subcommands: multiSigCmds,
+	},
 }
 
 type config struct {
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+
+	"github.com/urfave/cli"
+)
+
+var multiSigCmds = cli.Commands{
+	{
+		Name:      "create",
+		Usage:     "creates a multi-signature wallet owned by the given public keys",
+		ArgsUsage: "threshold blocks public-key [public-key...]",
+		Action:    multiSigCreate,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "darc",
+				Usage: "darc allowing you to spawn:multisig",
+			},
+			cli.Uint64Flag{
+				Name:  "coins",
+				Usage: "coins to transfer from your account to the new wallet",
+			},
+		},
+	},
+	{
+		Name:      "show",
+		Usage:     "shows the balance and the pending proposals of a wallet",
+		ArgsUsage: "wallet-id",
+		Action:    multiSigShow,
+	},
+	{
+		Name:      "deposit",
+		Usage:     "transfers coins from your account to a wallet",
+		ArgsUsage: "wallet-id amount",
+		Action:    multiSigDeposit,
+	},
+	{
+		Name:      "propose",
+		Usage:     "proposes to transfer coins from a wallet to an account",
+		ArgsUsage: "wallet-id amount public-key",
+		Action:    multiSigPropose,
+	},
+	{
+		Name:      "approve",
+		Usage:     "approves a pending transfer of a wallet",
+		ArgsUsage: "wallet-id proposal-id",
+		Action:    multiSigApprove,
+	},
+}
+
+func multiSigCreate(c *cli.Context) error {
+	if c.NArg() < 3 {
+		return xerrors.New("please give the following arguments: threshold blocks public-key [public-key...]")
+	}
+	threshold, err := strconv.ParseUint(c.Args().Get(0), 10, 32)
+	if err != nil {
+		return xerrors.Errorf("parsing threshold: %v", err)
+	}
+	blocks, err := strconv.ParseUint(c.Args().Get(1), 10, 64)
+	if err != nil {
+		return xerrors.Errorf("parsing blocks: %v", err)
+	}
+	wallet := contracts.MultiSigWallet{
+		Threshold:      uint32(threshold),
+		ProposalBlocks: blocks,
+	}
+	for _, pubStr := range c.Args()[2:] {
+		pub, err := encoding.StringHexToPoint(cothority.Suite, pubStr)
+		if err != nil {
+			return xerrors.Errorf("parsing public key: %v", err)
+		}
+		wallet.Owners = append(wallet.Owners, darc.NewIdentityEd25519(pub))
+	}
+	walletBuf, err := protobuf.Encode(&wallet)
+	if err != nil {
+		return xerrors.Errorf("encoding wallet: %v", err)
+	}
+	darcID, err := hex.DecodeString(c.String("darc"))
+	if err != nil || len(darcID) != 32 {
+		return xerrors.New("please give the darc with --darc")
+	}
+
+	cfg, cl, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, err := sendInstructions(c, cfg, cl, byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(darcID),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ContractMultiSigID,
+			Args:       byzcoin.Arguments{{Name: "struct", Value: walletBuf}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	walletID := ctx.Instructions[0].DeriveID("")
+	log.Infof("Multisig wallet is: %x", walletID.Slice())
+
+	// The deposit account of the wallet only exists once the wallet is
+	// spawned, so the coins are transferred in a second transaction.
+	if amount := c.Uint64("coins"); amount > 0 {
+		instrs, err := depositInstructions(cfg, walletID, amount)
+		if err != nil {
+			return err
+		}
+		_, err = sendInstructions(c, cfg, cl, instrs...)
+		return err
+	}
+	return nil
+}
+
+func multiSigShow(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return xerrors.New("please give the wallet-id")
+	}
+	walletID, err := parseWalletID(c.Args().First())
+	if err != nil {
+		return err
+	}
+	_, cl, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	resp, err := cl.GetProofFromLatest(walletID.Slice())
+	if err != nil {
+		return err
+	}
+	_, value, cid, _, err := resp.Proof.KeyValue()
+	if err != nil {
+		return err
+	}
+	if cid != contracts.ContractMultiSigID {
+		return xerrors.New("this is not a multisig wallet")
+	}
+	var wallet contracts.MultiSigWallet
+	if err := protobuf.Decode(value, &wallet); err != nil {
+		return err
+	}
+
+	log.Info("Balance is:", wallet.Coin.Value)
+	log.Infof("Threshold is: %d of %d", wallet.Threshold, len(wallet.Owners))
+	for _, owner := range wallet.Owners {
+		log.Info("Owner:", owner)
+	}
+	for _, p := range wallet.Proposals {
+		log.Infof("Proposal %d: %d coins to %x, %d approvals, expires at block %d",
+			p.ID, p.Coins, p.Destination.Slice(), len(p.Approvals), p.Expiry)
+	}
+	return nil
+}
+
+func multiSigDeposit(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return xerrors.New("please give the following arguments: wallet-id amount")
+	}
+	walletID, err := parseWalletID(c.Args().First())
+	if err != nil {
+		return err
+	}
+	amount, err := strconv.ParseUint(c.Args().Get(1), 10, 64)
+	if err != nil {
+		return err
+	}
+	cfg, cl, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	instrs, err := depositInstructions(cfg, walletID, amount)
+	if err != nil {
+		return err
+	}
+	_, err = sendInstructions(c, cfg, cl, instrs...)
+	return err
+}
+
+func multiSigPropose(c *cli.Context) error {
+	if c.NArg() < 3 {
+		return xerrors.New("please give the following arguments: wallet-id amount public-key")
+	}
+	walletID, err := parseWalletID(c.Args().First())
+	if err != nil {
+		return err
+	}
+	amount, err := strconv.ParseUint(c.Args().Get(1), 10, 64)
+	if err != nil {
+		return err
+	}
+	targetBuf, err := hex.DecodeString(c.Args().Get(2))
+	if err != nil {
+		return err
+	}
+	target, err := coinHash(targetBuf)
+	if err != nil {
+		return fmt.Errorf("couldn't create hash of coin: %v", err)
+	}
+	cfg, cl, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	_, err = sendInstructions(c, cfg, cl, byzcoin.Instruction{
+		InstanceID: walletID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractMultiSigID,
+			Command:    "propose",
+			Args: byzcoin.Arguments{
+				{Name: "coins", Value: uint64Buf(amount)},
+				{Name: "destination", Value: target.Slice()},
+			},
+		},
+	})
+	return err
+}
+
+func multiSigApprove(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return xerrors.New("please give the following arguments: wallet-id proposal-id")
+	}
+	walletID, err := parseWalletID(c.Args().First())
+	if err != nil {
+		return err
+	}
+	proposal, err := strconv.ParseUint(c.Args().Get(1), 10, 64)
+	if err != nil {
+		return err
+	}
+	cfg, cl, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	_, err = sendInstructions(c, cfg, cl, byzcoin.Instruction{
+		InstanceID: walletID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractMultiSigID,
+			Command:    "approve",
+			Args: byzcoin.Arguments{
+				{Name: "proposal", Value: uint64Buf(proposal)},
+			},
+		},
+	})
+	return err
+}
+
+func parseWalletID(str string) (byzcoin.InstanceID, error) {
+	buf, err := hex.DecodeString(str)
+	if err != nil || len(buf) != 32 {
+		return byzcoin.InstanceID{}, xerrors.New("the wallet-id must be 32 bytes in hex")
+	}
+	return byzcoin.NewInstanceID(buf), nil
+}
+
+// depositInstructions returns the instructions transferring the coins from
+// the account of the wallet to the deposit account of the multisig wallet, and
+// storing them in the multisig wallet.
+func depositInstructions(cfg config, walletID byzcoin.InstanceID, amount uint64) ([]byzcoin.Instruction, error) {
+	iid, err := coinHashPub(cfg.KeyPair.Public)
+	if err != nil {
+		return nil, err
+	}
+	return []byzcoin.Instruction{
+		{
+			InstanceID: iid,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "transfer",
+				Args: byzcoin.Arguments{
+					{Name: "coins", Value: uint64Buf(amount)},
+					{Name: "destination", Value: contracts.MultiSigDepositID(walletID).Slice()},
+				},
+			},
+		},
+		{
+			InstanceID: walletID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractMultiSigID,
+				Command:    "store",
+			},
+		},
+	}, nil
+}
+
+func uint64Buf(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return buf
+}
+
+// sendInstructions signs the instructions with the key of the wallet and
+// sends them in one transaction. Storing coins in a multisig wallet is not
+// signed, as the multisig contract refuses signers for it.
+func sendInstructions(c *cli.Context, cfg config, cl *byzcoin.Client,
+	instrs ...byzcoin.Instruction) (byzcoin.ClientTransaction, error) {
+	signer := darc.NewSignerEd25519(cfg.KeyPair.Public, cfg.KeyPair.Private)
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return byzcoin.ClientTransaction{}, fmt.Errorf("couldn't get signer counter: %v", err)
+	}
+	for i := range instrs {
+		if isMultiSigStore(instrs[i]) {
+			continue
+		}
+		counters.Counters[0]++
+		instrs[i].SignerCounter = []uint64{counters.Counters[0]}
+		instrs[i].SignerIdentities = []darc.Identity{signer.Identity()}
+	}
+	ctx, err := cl.CreateTransaction(instrs...)
+	if err != nil {
+		return ctx, err
+	}
+	digest := ctx.Instructions.Hash()
+	for i := range ctx.Instructions {
+		if isMultiSigStore(ctx.Instructions[i]) {
+			continue
+		}
+		if err := ctx.Instructions[i].SignWith(digest, signer); err != nil {
+			return ctx, err
+		}
+	}
+	if _, err := cl.AddTransactionAndWait(ctx, 10); err != nil {
+		return ctx, err
+	}
+	log.Info("Transaction succeeded")
+	return ctx, lib.WaitPropagation(c, cl)
+}
+
+func isMultiSigStore(instr byzcoin.Instruction) bool {
+	return instr.Invoke != nil &&
+		instr.Invoke.ContractID == contracts.ContractMultiSigID &&
+		instr.Invoke.Command == "store"
+}
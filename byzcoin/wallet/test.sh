@@ -18,6 +18,7 @@ main(){
   run testMulti
   run testLoadSave
   run testCoin
+  run testMultiSig
   stopTest
 }
 
@@ -80,6 +81,42 @@ testCoin(){
   testGrep "Balance is: 1100" runWallet 1 show
 }
 
+testMultiSig(){
+  rm -rf config wallet{1,2}
+  runCoBG 1 2 3
+  testOK runBA create public.toml --interval .5s
+  bc=config/bc*cfg
+  key=config/key*cfg
+  runGrepSed "Admin DARC:" "s/.* //" runBA latest $bc
+  DARC=$SED
+  testOK runWallet 1 join $bc
+  runGrepSed "Public key is:" "s/.* //" runWallet 1 show
+  PUB=$SED
+  testOK runBA mint $bc $key $PUB 1000
+  testOK runWallet 2 join $bc
+  runGrepSed "Public key is:" "s/.* //" runWallet 2 show
+  PUB2=$SED
+  testOK runBA darc rule -rule spawn:multisig -identity ed25519:$PUB
+
+  testFail runWallet 1 multisig create --darc $DARC 3 10 $PUB $PUB2
+  runGrepSed "Multisig wallet is:" "s/.* //" runWallet 1 multisig create --darc $DARC --coins 100 2 10 $PUB $PUB2
+  MS=$SED
+  testGrep "Balance is: 900" runWallet 1 show
+  testGrep "Balance is: 100" runWallet 1 multisig show $MS
+
+  testFail runWallet 1 multisig propose $MS 200 $PUB
+  testOK runWallet 1 multisig propose $MS 40 $PUB
+  testGrep "Proposal 0: 40 coins" runWallet 1 multisig show $MS
+  testFail runWallet 2 multisig approve $MS 1
+  testOK runWallet 2 multisig approve $MS 0
+  testGrep "Balance is: 60" runWallet 1 multisig show $MS
+  testGrep "Balance is: 940" runWallet 1 show
+
+  testOK runWallet 1 multisig deposit $MS 10
+  testGrep "Balance is: 70" runWallet 1 multisig show $MS
+  testGrep "Balance is: 930" runWallet 1 show
+}
+
 runBA(){
   ./bcadmin -c config/ --debug $DBG_BA "$@"
 }
@@ -9,9 +9,11 @@ import (
 
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso/protocol"
 	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/network"
 	"go.dedis.ch/protobuf"
@@ -49,7 +51,7 @@ func NewClient(byzcoin *byzcoin.Client) *Client {
 // then it asks the Calypso cothority to start the DKG.
 func (c *Client) CreateLTS(ltsRoster *onet.Roster, darcID darc.ID, signers []darc.Signer, counters []uint64) (reply *CreateLTSReply, err error) {
 	// Make the transaction and get its proof
-	buf, err := protobuf.Encode(&LtsInstanceInfo{*ltsRoster})
+	buf, err := protobuf.Encode(&LtsInstanceInfo{Roster: *ltsRoster})
 	if err != nil {
 		return nil, xerrors.Errorf("encoding roster: %v", err)
 	}
@@ -93,6 +95,151 @@ func (c *Client) CreateLTS(ltsRoster *onet.Roster, darcID darc.ID, signers []dar
 	return reply, nil
 }
 
+// RefreshLTS proactively refreshes the shares of the LTS with the same
+// roster. It first sends a transaction to ByzCoin to increase the epoch of the
+// LTS instance, which needs the "invoke:longTermSecret.refresh" rule, then it
+// asks the Calypso cothority to refresh the shares.
+func (c *Client) RefreshLTS(ltsID byzcoin.InstanceID, signers []darc.Signer,
+	counters []uint64) (reply *RefreshLTSReply, err error) {
+	tx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion,
+		byzcoin.Instruction{
+			InstanceID: ltsID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: ContractLongTermSecretID,
+				Command:    "refresh",
+			},
+			SignerCounter: counters,
+		},
+	)
+	if err := tx.FillSignersAndSignWith(signers...); err != nil {
+		return nil, xerrors.Errorf("signing txn: %v", err)
+	}
+
+	atr, err := c.bcClient.AddTransactionAndWait(tx, 10)
+	if err != nil {
+		return nil, xerrors.Errorf("adding transaction: %v", err)
+	}
+
+	resp, err := c.bcClient.GetProofAfter(ltsID.Slice(), true, &atr.Proof.Latest)
+	if err != nil {
+		return nil, xerrors.Errorf("getting txn proof: %v", err)
+	}
+	var info LtsInstanceInfo
+	err = resp.Proof.VerifyAndDecode(cothority.Suite, ContractLongTermSecretID, &info)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding LTS instance: %v", err)
+	}
+
+	reply = &RefreshLTSReply{}
+	err = c.c.SendProtobuf(info.Roster.List[0], &RefreshLTS{
+		Proof: resp.Proof,
+	}, reply)
+	if err != nil {
+		return nil, xerrors.Errorf("send RefreshLTS message: %v", err)
+	}
+	return reply, nil
+}
+
+// MigrateWrites allows the writes to migrate to the LTS newLTS, with one
+// 'migrate' instruction per write signed by the signers, and then asks the
+// LTS of every write to re-encrypt its secret to newLTS. The counters are
+// used for the first instruction, and increased by one for every following
+// instruction. The migrations are returned in the order of the writes, and
+// the new writes can be created with Write.Migrate and AddWrite, using the
+// darc of the previous write.
+func (c *Client) MigrateWrites(writeIDs []byzcoin.InstanceID,
+	newLTS byzcoin.InstanceID, signers []darc.Signer, counters []uint64) (
+	[]WriteMigration, error) {
+	var instrs []byzcoin.Instruction
+	for i, id := range writeIDs {
+		ctrs := make([]uint64, len(counters))
+		for j := range counters {
+			ctrs[j] = counters[j] + uint64(i)
+		}
+		instrs = append(instrs, byzcoin.Instruction{
+			InstanceID: id,
+			Invoke: &byzcoin.Invoke{
+				ContractID: ContractWriteID,
+				Command:    "migrate",
+				Args: byzcoin.Arguments{{Name: "lts",
+					Value: newLTS.Slice()}},
+			},
+			SignerCounter: ctrs,
+		})
+	}
+	tx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion, instrs...)
+	if err := tx.FillSignersAndSignWith(signers...); err != nil {
+		return nil, xerrors.Errorf("signing txn: %v", err)
+	}
+	atr, err := c.bcClient.AddTransactionAndWait(tx, 10)
+	if err != nil {
+		return nil, xerrors.Errorf("adding transaction: %v", err)
+	}
+
+	getProof := func(id byzcoin.InstanceID) (*byzcoin.Proof, error) {
+		resp, err := c.bcClient.GetProofAfter(id.Slice(), true,
+			&atr.Proof.Latest)
+		if err != nil {
+			return nil, xerrors.Errorf("getting proof: %v", err)
+		}
+		return &resp.Proof, nil
+	}
+	ltsProof, err := getProof(newLTS)
+	if err != nil {
+		return nil, err
+	}
+
+	// The writes are sent to a node of their LTS, grouped by LTS.
+	var ltsIDs []byzcoin.InstanceID
+	requests := make(map[byzcoin.InstanceID]*MigrateWrites)
+	indexes := make(map[byzcoin.InstanceID][]int)
+	for i, id := range writeIDs {
+		proof, err := getProof(id)
+		if err != nil {
+			return nil, err
+		}
+		var write Write
+		err = proof.VerifyAndDecode(cothority.Suite, ContractWriteID, &write)
+		if err != nil {
+			return nil, xerrors.Errorf("didn't get a write instance: %v", err)
+		}
+		req, ok := requests[write.LTSID]
+		if !ok {
+			req = &MigrateWrites{NewLTS: *ltsProof}
+			requests[write.LTSID] = req
+			ltsIDs = append(ltsIDs, write.LTSID)
+		}
+		req.Writes = append(req.Writes, *proof)
+		indexes[write.LTSID] = append(indexes[write.LTSID], i)
+	}
+
+	migrations := make([]WriteMigration, len(writeIDs))
+	for _, id := range ltsIDs {
+		proof, err := getProof(id)
+		if err != nil {
+			return nil, err
+		}
+		var info LtsInstanceInfo
+		err = proof.VerifyAndDecode(cothority.Suite, ContractLongTermSecretID,
+			&info)
+		if err != nil {
+			return nil, xerrors.Errorf("decoding LTS instance: %v", err)
+		}
+		reply := &MigrateWritesReply{}
+		err = c.c.SendProtobuf(info.Roster.List[0], requests[id], reply)
+		if err != nil {
+			return nil, xerrors.Errorf("send MigrateWrites message: %v", err)
+		}
+		if len(reply.Migrations) != len(indexes[id]) {
+			return nil, xerrors.New("got a wrong number of migrations")
+		}
+		for i, m := range reply.Migrations {
+			migrations[indexes[id][i]] = m
+		}
+	}
+	return migrations, nil
+}
+
 // Authorise adds a ByzCoinID to the list of authorized IDs. It can only be called
 // from localhost, except if the COTHORITY_ALLOW_INSECURE_ADMIN is set to 'true'.
 // Deprecated: please use Authorize.
@@ -141,6 +288,34 @@ func (c *Client) DecryptKey(dkr *DecryptKey) (reply *DecryptKeyReply, err error)
 	return reply, cothority.ErrorOrNil(err, "sending DecryptKey message")
 }
 
+// DecryptKeyShares asks the LTS for the decryption shares of the secret of
+// the write, re-encrypted to the ephemeral public key Xe. The request is
+// signed with xc, the private key of the reader, so that nobody else can ask
+// for the shares. The shares can then be verified and combined using
+// DecryptKeySharesReply.RecoverKey with the private key of Xe.
+func (c *Client) DecryptKeyShares(read, write *byzcoin.Proof, xc kyber.Scalar,
+	Xe kyber.Point) (reply *DecryptKeySharesReply, err error) {
+	readID := byzcoin.NewInstanceID(read.InclusionProof.Key())
+	ts := time.Now().Unix()
+	msg, err := decryptSharesMessage(readID, Xe, ts)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := schnorr.Sign(cothority.Suite, xc, msg)
+	if err != nil {
+		return nil, xerrors.Errorf("creating schnorr signature: %v", err)
+	}
+	reply = &DecryptKeySharesReply{}
+	err = c.c.SendProtobuf(c.bcClient.Roster.List[0], &DecryptKeyShares{
+		Read:      *read,
+		Write:     *write,
+		Ephemeral: Xe,
+		Timestamp: ts,
+		Signature: sig,
+	}, reply)
+	return reply, cothority.ErrorOrNil(err, "sending DecryptKeyShares message")
+}
+
 // WaitProof calls the byzcoin client's wait proof
 func (c *Client) WaitProof(id byzcoin.InstanceID, interval time.Duration,
 	value []byte) (*byzcoin.Proof, error) {
@@ -237,6 +412,122 @@ func (c *Client) AddRead(proof *byzcoin.Proof, signer darc.Signer, signerCtr uin
 	return reply, nil
 }
 
+// AddPaidRead creates a Read Instance for a Write Instance with a Cost. The
+// Cost is taken out of the coin instance of the reader and credited to the
+// beneficiary of the write in the same transaction. The signer needs to be
+// allowed to fetch coins from the payer. The coins are not refunded if the
+// write is revoked later. Instead of the payer, the read can also be paid
+// with the coins of a coin.fetch instruction preceding it in the same
+// transaction.
+//
+// Input:
+//   - proof - A ByzCoin proof of the Write Operation.
+//   - signer - The data owner who can create a read instance.
+//   - signerCtr - A monotonically increasing counter for the signer.
+//   - payer - The coin instance the Cost is taken from.
+//   - wait - The number of blocks to wait -- 0 means no wait
+//
+// Output:
+//   - reply - ReadReply containing the transaction response and instance id
+//   - err - Error if any, nil otherwise.
+func (c *Client) AddPaidRead(proof *byzcoin.Proof, signer darc.Signer,
+	signerCtr uint64, payer byzcoin.InstanceID, wait int) (
+	reply *ReadReply, err error) {
+	read := &Read{
+		Write: byzcoin.NewInstanceID(proof.InclusionProof.Key()),
+		Xc:    signer.Ed25519.Point,
+	}
+	readBuf, err := protobuf.Encode(read)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding Read message: %v", err)
+	}
+
+	ctx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion,
+		byzcoin.Instruction{
+			InstanceID: read.Write,
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractReadID,
+				Args: byzcoin.Arguments{
+					{Name: "read", Value: readBuf},
+					{Name: "payer", Value: payer.Slice()},
+				},
+			},
+			SignerCounter: []uint64{signerCtr},
+		},
+	)
+	err = ctx.FillSignersAndSignWith(signer)
+	if err != nil {
+		return nil, xerrors.Errorf("signing txn: %v", err)
+	}
+
+	reply = &ReadReply{}
+	reply.InstanceID = ctx.Instructions[0].DeriveID("")
+	reply.AddTxResponse, err = c.bcClient.AddTransactionAndWait(ctx, wait)
+	if err != nil {
+		return nil, xerrors.Errorf("adding txn: %v", err)
+	}
+	return reply, nil
+}
+
+// PricedWrites returns the Write Instances with a Cost that have been
+// spawned with the given darc, and have not been revoked.
+func (c *Client) PricedWrites(darcID darc.ID) ([]PricedWrite, error) {
+	id := PriceListID(darcID)
+	resp, err := c.bcClient.GetProofFromLatest(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("getting proof: %v", err)
+	}
+	ok, err := resp.Proof.InclusionProof.Exists(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("checking proof: %v", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	var list PriceList
+	err = resp.Proof.VerifyAndDecode(cothority.Suite, ContractPriceListID,
+		&list)
+	if err != nil {
+		return nil, xerrors.Errorf("didn't get a price list: %v", err)
+	}
+	return list.Writes, nil
+}
+
+// RevokeWrite revokes a Write Instance by adding a transaction on the byzcoin
+// client. Once revoked, no new Read Instance can be created and the LTS
+// refuses to re-encrypt the secret. The signer needs to fulfill the
+// "invoke:calypsoWrite.revoke" rule of the darc of the write.
+//
+// Input:
+//   - writeID - The instance ID of the Write Instance
+//   - signer - The signer authorizing the revocation
+//   - signerCtr - A monotonically increasing counter for the signer
+//   - wait - The number of blocks to wait -- 0 means no wait
+//
+// Output:
+//   - reply - AddTxResponse containing the transaction response
+//   - err - Error if any, nil otherwise.
+func (c *Client) RevokeWrite(writeID byzcoin.InstanceID, signer darc.Signer,
+	signerCtr uint64, wait int) (reply *byzcoin.AddTxResponse, err error) {
+	ctx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion,
+		byzcoin.Instruction{
+			InstanceID: writeID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: ContractWriteID,
+				Command:    "revoke",
+			},
+			SignerCounter: []uint64{signerCtr},
+		},
+	)
+	err = ctx.FillSignersAndSignWith(signer)
+	if err != nil {
+		return nil, xerrors.Errorf("signing txn: %v", err)
+	}
+
+	reply, err = c.bcClient.AddTransactionAndWait(ctx, wait)
+	return reply, cothority.ErrorOrNil(err, "adding txn")
+}
+
 // SpawnDarc spawns a Darc Instance by adding a transaction on the byzcoin client.
 // Input:
 //   - signer - The signer authorizing the spawn of this darc (calypso "admin")
@@ -283,6 +574,8 @@ func (c *Client) SpawnDarc(signer darc.Signer, signerCtr uint64,
 // in the Calypso service. The resulting secret key can be used
 // with a symmetric decryption algorithm to decrypt the data
 // stored in the Data field of the WriteInstance.
+// If the key was too long to be embedded in a point, it is decrypted from
+// KeyCipher using the recovered point.
 //
 // Input:
 //   - xc - the private key of the reader
@@ -298,9 +591,60 @@ func (r *DecryptKeyReply) RecoverKey(xc kyber.Scalar) (key []byte, err error) {
 
 	// Decrypt r.C to keyPointHat
 	XhatInv.Add(r.C, XhatInv)
-	key, err = XhatInv.Data()
+	return keyFromPoint(XhatInv, r.KeyCipher)
+}
+
+// RecoverKey verifies the proofs of the decryption shares and recovers the
+// secret key from the valid shares, using xe, the private key of the
+// ephemeral key given in the request. The indexes of the nodes that returned
+// an invalid share are returned in blame, even if there were enough valid
+// shares to recover the key.
+//
+// Output:
+//   - key - the re-assembled key
+//   - blame - the indexes in the LTS roster of the misbehaving nodes
+//   - err - a possible error if the key cannot be recovered
+func (r *DecryptKeySharesReply) RecoverKey(xe kyber.Scalar) (key []byte, blame []int, err error) {
+	if len(r.Commits) == 0 || !r.Commits[0].Equal(r.X) {
+		return nil, nil, xerrors.New("commits don't match the public key")
+	}
+	poly := share.NewPubPoly(cothority.Suite, cothority.Suite.Point().Base(),
+		r.Commits)
+	Xe := cothority.Suite.Point().Mul(xe, nil)
+
+	var shares []*share.PubShare
+	seen := make(map[int]bool)
+	n := 0
+	for _, s := range r.Shares {
+		if s.Index < 0 || seen[s.Index] {
+			blame = append(blame, s.Index)
+			continue
+		}
+		seen[s.Index] = true
+		ui := &share.PubShare{I: s.Index, V: s.Ui}
+		err := protocol.VerifyReencryptReply(r.U, Xe, poly.Eval(s.Index).V,
+			&protocol.ReencryptReply{Ui: ui, Ei: s.Ei, Fi: s.Fi})
+		if err != nil {
+			blame = append(blame, s.Index)
+			continue
+		}
+		shares = append(shares, ui)
+		if s.Index >= n {
+			n = s.Index + 1
+		}
+	}
+
+	threshold := len(r.Commits)
+	if len(shares) < threshold {
+		return nil, blame, xerrors.Errorf("only %d valid shares out of %d "+
+			"needed", len(shares), threshold)
+	}
+	Xhat, err := share.RecoverCommit(cothority.Suite, shares, threshold, n)
 	if err != nil {
-		err = xerrors.Errorf("extracting data from point: %v", err)
+		return nil, blame, xerrors.Errorf("recovering commit: %v", err)
 	}
-	return
+	// Xhat = x(U + Xe), so the decryption of U is Xhat - xe * X.
+	xU := cothority.Suite.Point().Sub(Xhat, cothority.Suite.Point().Mul(xe, r.X))
+	key, err = keyFromPoint(cothority.Suite.Point().Sub(r.C, xU), r.KeyCipher)
+	return key, blame, err
 }
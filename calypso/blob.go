@@ -0,0 +1,675 @@
+package calypso
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sort"
+	"time"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// BlobChunkSize is the maximum size of a chunk of a blob.
+const BlobChunkSize = 1 << 20
+
+// BlobQuota is the default number of bytes of blobs that a node stores for
+// one uploader of an LTS.
+const BlobQuota = 1 << 30
+
+var blobBucketName = []byte("calypso-blobs")
+
+// Root returns the root of the manifest, which binds the size of the blob and
+// the Merkle root of its chunk hashes. As in RFC 6962, the leaves are hashed
+// with a 0x00 prefix and the inner nodes with a 0x01 prefix, so that a leaf
+// can never be taken for an inner node. Pairs of nodes are hashed together,
+// and the last node of an odd level is promoted to the next level.
+func (m BlobManifest) Root() []byte {
+	tree := sha256.Sum256(nil)
+	level := make([][]byte, len(m.ChunkHashes))
+	for i, c := range m.ChunkHashes {
+		h := sha256.New()
+		h.Write([]byte{0})
+		h.Write(c)
+		level[i] = h.Sum(nil)
+	}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write([]byte{1})
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	if len(level) == 1 {
+		copy(tree[:], level[0])
+	}
+
+	h := sha256.New()
+	h.Write([]byte("calypso blob"))
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(m.Size))
+	h.Write(buf)
+	h.Write(tree[:])
+	return h.Sum(nil)
+}
+
+// blobReplicas returns the nodes of the roster that store the chunk with the
+// given key, in order of preference. The nodes are sorted by the hash of the
+// key and their public key, so that the chunks are spread over the roster.
+func blobReplicas(roster *onet.Roster, key []byte, replication int) []*network.ServerIdentity {
+	type rank struct {
+		si   *network.ServerIdentity
+		hash []byte
+	}
+	ranks := make([]rank, len(roster.List))
+	for i, si := range roster.List {
+		h := sha256.New()
+		h.Write(key)
+		si.Public.MarshalTo(h)
+		ranks[i] = rank{si, h.Sum(nil)}
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		return bytes.Compare(ranks[i].hash, ranks[j].hash) < 0
+	})
+	if replication > len(ranks) {
+		replication = len(ranks)
+	}
+	replicas := make([]*network.ServerIdentity, replication)
+	for i := range replicas {
+		replicas[i] = ranks[i].si
+	}
+	return replicas
+}
+
+// StoreBlobChunk stores a chunk of a blob and replicates it on the nodes of
+// the LTS roster. The request must be signed by an uploader allowed to spawn
+// writes.
+func (s *Service) StoreBlobChunk(req *StoreBlobChunk) (*StoreBlobChunkReply, error) {
+	if len(req.Data) > BlobChunkSize {
+		return nil, xerrors.Errorf("chunk is bigger than %d bytes", BlobChunkSize)
+	}
+	h := sha256.Sum256(req.Data)
+	key := append([]byte("c"), h[:]...)
+	err := s.verifyUploader(req.LTSID, key, req.Uploader, &req.Darc,
+		req.Signature)
+	if err != nil {
+		return nil, xerrors.Errorf("verifying uploader: %v", err)
+	}
+	replicas, err := s.storeBlob(req.LTSID, key, req.Data, req.Uploader,
+		req.Replication, func(si *network.ServerIdentity) error {
+			fwd := *req
+			fwd.Replication = 0
+			return s.blobClient().SendProtobuf(si, &fwd, &StoreBlobChunkReply{})
+		})
+	if err != nil {
+		return nil, xerrors.Errorf("storing chunk: %v", err)
+	}
+	return &StoreBlobChunkReply{Hash: h[:], Replicas: replicas}, nil
+}
+
+// StoreBlobManifest stores the manifest of a blob and replicates it on the
+// nodes of the LTS roster. The request must be signed by an uploader allowed
+// to spawn writes.
+func (s *Service) StoreBlobManifest(req *StoreBlobManifest) (*StoreBlobManifestReply, error) {
+	if len(req.Manifest.ChunkHashes) == 0 {
+		return nil, xerrors.New("empty manifest")
+	}
+	for _, h := range req.Manifest.ChunkHashes {
+		if len(h) != sha256.Size {
+			return nil, xerrors.New("invalid chunk hash in manifest")
+		}
+	}
+	chunks := (req.Manifest.Size + BlobChunkSize - 1) / BlobChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	if req.Manifest.Size < 0 || int64(len(req.Manifest.ChunkHashes)) != chunks {
+		return nil, xerrors.New("the size of the manifest doesn't match its chunks")
+	}
+	buf, err := protobuf.Encode(&req.Manifest)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding manifest: %v", err)
+	}
+	if len(buf) > BlobChunkSize {
+		return nil, xerrors.Errorf("manifest is bigger than %d bytes", BlobChunkSize)
+	}
+	root := req.Manifest.Root()
+	key := append([]byte("m"), root...)
+	err = s.verifyUploader(req.LTSID, key, req.Uploader, &req.Darc,
+		req.Signature)
+	if err != nil {
+		return nil, xerrors.Errorf("verifying uploader: %v", err)
+	}
+	replicas, err := s.storeBlob(req.LTSID, key, buf, req.Uploader,
+		req.Replication, func(si *network.ServerIdentity) error {
+			fwd := *req
+			fwd.Replication = 0
+			return s.blobClient().SendProtobuf(si, &fwd, &StoreBlobManifestReply{})
+		})
+	if err != nil {
+		return nil, xerrors.Errorf("storing manifest: %v", err)
+	}
+	return &StoreBlobManifestReply{Root: root, Replicas: replicas}, nil
+}
+
+// GetBlobChunk returns the chunk with the given hash.
+func (s *Service) GetBlobChunk(req *GetBlobChunk) (*GetBlobChunkReply, error) {
+	data, err := s.loadBlob(append([]byte("c"), req.Hash...))
+	if err != nil {
+		return nil, err
+	}
+	return &GetBlobChunkReply{Data: data}, nil
+}
+
+// GetBlobManifest returns the manifest of the blob with the given Merkle root.
+func (s *Service) GetBlobManifest(req *GetBlobManifest) (*GetBlobManifestReply, error) {
+	buf, err := s.loadBlob(append([]byte("m"), req.Root...))
+	if err != nil {
+		return nil, err
+	}
+	reply := &GetBlobManifestReply{}
+	err = protobuf.Decode(buf, &reply.Manifest)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding manifest: %v", err)
+	}
+	return reply, nil
+}
+
+// DeleteBlob deletes the manifest and the chunks of the blob of a revoked or
+// expired write that are stored on this node for the uploader. The values
+// that are also stored for other uploaders are kept.
+func (s *Service) DeleteBlob(req *DeleteBlob) (*DeleteBlobReply, error) {
+	var write Write
+	err := req.Write.VerifyAndDecode(cothority.Suite, ContractWriteID, &write)
+	if err != nil {
+		return nil, xerrors.Errorf("didn't get a write instance: %v", err)
+	}
+	root := req.Manifest.Root()
+	if !bytes.Equal(root, write.BlobRoot) {
+		return nil, xerrors.New("the manifest is not the one of the write")
+	}
+	err = req.Uploader.Verify(blobMessage(write.LTSID,
+		append([]byte("d"), root...)), req.Signature)
+	if err != nil {
+		return nil, xerrors.Errorf("wrong signature of the uploader: %v", err)
+	}
+	if err := s.verifyProof(&req.Write); err != nil {
+		return nil, xerrors.Errorf("verifying write proof: %v", err)
+	}
+	latest, err := s.latestWrite(&req.Write,
+		byzcoin.NewInstanceID(req.Write.InclusionProof.Key()))
+	if err != nil {
+		return nil, xerrors.Errorf("getting latest write: %v", err)
+	}
+	if latest.CheckValidity(time.Now().Unix()) == nil {
+		return nil, xerrors.New("only the blobs of revoked or expired writes " +
+			"can be deleted")
+	}
+
+	keys := [][]byte{append([]byte("m"), root...)}
+	for _, h := range req.Manifest.ChunkHashes {
+		keys = append(keys, append([]byte("c"), h...))
+	}
+	reply := &DeleteBlobReply{}
+	err = s.blobDB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(s.blobBucket)
+		for _, key := range keys {
+			ok, err := unownBlob(b, write.LTSID, key, req.Uploader)
+			if err != nil {
+				return err
+			}
+			if ok {
+				reply.Deleted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("writing to db: %v", err)
+	}
+	return reply, nil
+}
+
+// blobMessage returns the message signed by the uploader to store or delete
+// the value with the given key for the LTS.
+func blobMessage(ltsID byzcoin.InstanceID, key []byte) []byte {
+	h := sha256.New()
+	h.Write(ltsID.Slice())
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+// blobOwnerKey returns the key marking that the value with the given key is
+// stored for the uploader of the LTS. All the owners of a value share the
+// prefix "o" + key.
+func blobOwnerKey(key []byte, ltsID byzcoin.InstanceID,
+	uploader darc.Identity) []byte {
+	k := append([]byte("o"), key...)
+	k = append(k, ltsID.Slice()...)
+	return append(k, []byte(uploader.String())...)
+}
+
+// blobUsageKey returns the key holding the number of bytes stored for the
+// uploader of the LTS.
+func blobUsageKey(ltsID byzcoin.InstanceID, uploader darc.Identity) []byte {
+	k := append([]byte("q"), ltsID.Slice()...)
+	return append(k, []byte(uploader.String())...)
+}
+
+// verifyUploader checks that the uploader signed the key for the LTS, and
+// that the darc of the proof, which must come from the ByzCoin of the LTS,
+// allows the uploader to spawn writes. Delegations to other darcs are
+// resolved with the latest version of these darcs.
+func (s *Service) verifyUploader(ltsID byzcoin.InstanceID, key []byte,
+	uploader darc.Identity, proof *byzcoin.Proof, sig []byte) error {
+	if err := uploader.Verify(blobMessage(ltsID, key), sig); err != nil {
+		return xerrors.Errorf("wrong signature: %v", err)
+	}
+	s.storage.Lock()
+	reply := s.storage.Replies[ltsID]
+	s.storage.Unlock()
+	if reply == nil {
+		return xerrors.Errorf("don't know the LTSID '%v'", ltsID)
+	}
+	if !proof.Latest.SkipChainID().Equal(reply.ByzCoinID) {
+		return xerrors.New("the darc is not on the ByzCoin of the LTS")
+	}
+	if err := s.verifyProof(proof); err != nil {
+		return xerrors.Errorf("verifying darc proof: %v", err)
+	}
+	var d darc.Darc
+	err := proof.VerifyAndDecode(cothority.Suite, byzcoin.ContractDarcID, &d)
+	if err != nil {
+		return xerrors.Errorf("didn't get a darc instance: %v", err)
+	}
+
+	cl := byzcoin.NewClient(reply.ByzCoinID, *proof.Latest.Roster)
+	getDarc := func(str string, latest bool) *darc.Darc {
+		if len(str) < 5 || string(str[0:5]) != "darc:" {
+			return nil
+		}
+		darcID, err := hex.DecodeString(str[5:])
+		if err != nil {
+			return nil
+		}
+		resp, err := cl.GetProofFromLatest(darcID)
+		if err != nil || s.verifyProof(&resp.Proof) != nil {
+			return nil
+		}
+		var d darc.Darc
+		err = resp.Proof.VerifyAndDecode(cothority.Suite,
+			byzcoin.ContractDarcID, &d)
+		if err != nil {
+			return nil
+		}
+		return &d
+	}
+	action := darc.Action("spawn:" + ContractWriteID)
+	err = darc.EvalExpr(d.Rules.Get(action), getDarc, uploader.String())
+	return cothority.ErrorOrNil(err, "the uploader cannot spawn writes")
+}
+
+// storeBlob stores the value for the uploader if this node is one of the
+// replicas of the key. If replication is not 0, the value is also sent to the
+// other replicas. It returns the number of replicas that stored the value.
+// Every node stores at most blobQuota bytes for one uploader of an LTS, so
+// that the blobs can't fill its disk. A value stored for several uploaders
+// is stored once, but counts towards the quota of each of them.
+func (s *Service) storeBlob(ltsID byzcoin.InstanceID, key, value []byte,
+	uploader darc.Identity, replication int,
+	send func(*network.ServerIdentity) error) (int, error) {
+	s.storage.Lock()
+	roster := s.storage.Rosters[ltsID]
+	s.storage.Unlock()
+	if roster == nil {
+		return 0, xerrors.Errorf("don't know the LTSID '%v'", ltsID)
+	}
+	if i, _ := roster.Search(s.ServerIdentity().ID); i < 0 {
+		return 0, xerrors.New("this node is not part of the LTS")
+	}
+
+	if replication == 0 {
+		err := s.blobDB.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(s.blobBucket)
+			ownerKey := blobOwnerKey(key, ltsID, uploader)
+			if b.Get(ownerKey) != nil {
+				return nil
+			}
+			usageKey := blobUsageKey(ltsID, uploader)
+			var used uint64
+			if v := b.Get(usageKey); v != nil {
+				used = binary.LittleEndian.Uint64(v)
+			}
+			used += uint64(len(value))
+			if used > uint64(s.blobQuota) {
+				return xerrors.Errorf("the quota of %d bytes for this "+
+					"uploader is used up", s.blobQuota)
+			}
+			buf := make([]byte, 8)
+			binary.LittleEndian.PutUint64(buf, used)
+			if err := b.Put(usageKey, buf); err != nil {
+				return err
+			}
+			if err := b.Put(ownerKey, []byte{1}); err != nil {
+				return err
+			}
+			if b.Get(key) != nil {
+				return nil
+			}
+			return b.Put(key, value)
+		})
+		if err != nil {
+			return 0, xerrors.Errorf("writing to db: %v", err)
+		}
+		return 1, nil
+	}
+
+	stored := 0
+	for _, si := range blobReplicas(roster, key, replication) {
+		var err error
+		if si.Equal(s.ServerIdentity()) {
+			_, err = s.storeBlob(ltsID, key, value, uploader, 0, nil)
+		} else {
+			err = send(si)
+		}
+		if err != nil {
+			log.Warnf("%v: couldn't store %x on %v: %v", s.ServerIdentity(),
+				key, si, err)
+			continue
+		}
+		stored++
+	}
+	if stored == 0 {
+		return 0, xerrors.New("no replica stored the value")
+	}
+	return stored, nil
+}
+
+// unownBlob removes the uploader from the owners of the value with the given
+// key, and gives its size back to the quota of the uploader. The value is
+// deleted once it has no owner left. It returns whether the value was stored
+// for the uploader.
+func unownBlob(b *bbolt.Bucket, ltsID byzcoin.InstanceID,
+	key []byte, uploader darc.Identity) (bool, error) {
+	ownerKey := blobOwnerKey(key, ltsID, uploader)
+	if b.Get(ownerKey) == nil {
+		return false, nil
+	}
+	if err := b.Delete(ownerKey); err != nil {
+		return false, err
+	}
+
+	usageKey := blobUsageKey(ltsID, uploader)
+	if v := b.Get(usageKey); v != nil {
+		used := binary.LittleEndian.Uint64(v)
+		size := uint64(len(b.Get(key)))
+		if size > used {
+			size = used
+		}
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, used-size)
+		if err := b.Put(usageKey, buf); err != nil {
+			return false, err
+		}
+	}
+
+	prefix := append([]byte("o"), key...)
+	if k, _ := b.Cursor().Seek(prefix); bytes.HasPrefix(k, prefix) {
+		return true, nil
+	}
+	return true, b.Delete(key)
+}
+
+func (s *Service) loadBlob(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.blobDB.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(s.blobBucket).Get(key)
+		if v != nil {
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("reading from db: %v", err)
+	}
+	if value == nil {
+		return nil, xerrors.Errorf("unknown blob %x", key[1:])
+	}
+	return value, nil
+}
+
+func (s *Service) blobClient() *onet.Client {
+	return onet.NewClient(cothority.Suite, ServiceName)
+}
+
+// UploadBlob splits the data in chunks and stores them, together with the
+// manifest, on replication nodes of the roster of the LTS. The data should
+// already be encrypted. The signer must be allowed to spawn writes by the
+// darc with the given ID, and the blob counts towards its quota on the
+// nodes. It returns the Merkle root of the chunks, which is to be stored in
+// the BlobRoot of the write.
+func (c *Client) UploadBlob(ltsID byzcoin.InstanceID, roster *onet.Roster,
+	data []byte, replication int, signer darc.Signer,
+	darcID darc.ID) ([]byte, error) {
+	return c.UploadBlobFrom(ltsID, roster, bytes.NewReader(data), replication,
+		signer, darcID)
+}
+
+// UploadBlobFrom works like UploadBlob, but reads the data from r, so that
+// only one chunk is kept in memory.
+func (c *Client) UploadBlobFrom(ltsID byzcoin.InstanceID, roster *onet.Roster,
+	r io.Reader, replication int, signer darc.Signer,
+	darcID darc.ID) ([]byte, error) {
+	if replication < 1 {
+		return nil, xerrors.New("replication must be at least 1")
+	}
+	resp, err := c.bcClient.GetProofFromLatest(darcID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting darc proof: %v", err)
+	}
+	darcProof := resp.Proof
+
+	var manifest BlobManifest
+	buf := make([]byte, BlobChunkSize)
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF && i > 0 {
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, xerrors.Errorf("reading chunk %d: %v", i, err)
+		}
+		h := sha256.Sum256(buf[:n])
+		sig, err := signer.Sign(blobMessage(ltsID,
+			append([]byte("c"), h[:]...)))
+		if err != nil {
+			return nil, xerrors.Errorf("signing chunk %d: %v", i, err)
+		}
+		err = c.sendBlob(roster, h[:], &StoreBlobChunk{LTSID: ltsID,
+			Data: buf[:n], Replication: replication,
+			Uploader: signer.Identity(), Darc: darcProof, Signature: sig},
+			&StoreBlobChunkReply{})
+		if err != nil {
+			return nil, xerrors.Errorf("storing chunk %d: %v", i, err)
+		}
+		manifest.ChunkHashes = append(manifest.ChunkHashes, h[:])
+		manifest.Size += int64(n)
+		if n < BlobChunkSize {
+			break
+		}
+	}
+
+	root := manifest.Root()
+	sig, err := signer.Sign(blobMessage(ltsID, append([]byte("m"), root...)))
+	if err != nil {
+		return nil, xerrors.Errorf("signing manifest: %v", err)
+	}
+	err = c.sendBlob(roster, root, &StoreBlobManifest{LTSID: ltsID,
+		Manifest: manifest, Replication: replication,
+		Uploader: signer.Identity(), Darc: darcProof, Signature: sig},
+		&StoreBlobManifestReply{})
+	if err != nil {
+		return nil, xerrors.Errorf("storing manifest: %v", err)
+	}
+	return root, nil
+}
+
+// sendBlob sends the store request to the replicas of the key, in order,
+// until one of them accepts it.
+func (c *Client) sendBlob(roster *onet.Roster, key []byte, msg, reply interface{}) error {
+	var err error
+	for _, si := range blobReplicas(roster, key, len(roster.List)) {
+		err = c.c.SendProtobuf(si, msg, reply)
+		if err == nil {
+			return nil
+		}
+	}
+	return cothority.ErrorOrNil(err, "no node stored the blob")
+}
+
+// DownloadBlob fetches the blob with the given Merkle root from the nodes of
+// the roster of the LTS. The chunks are checked against the root, which
+// should come from the BlobRoot of the write.
+func (c *Client) DownloadBlob(roster *onet.Roster, root []byte) ([]byte, error) {
+	var data bytes.Buffer
+	if err := c.DownloadBlobTo(roster, root, &data); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// DownloadBlobTo works like DownloadBlob, but writes every chunk to w once
+// it has been checked, so that only one chunk is kept in memory.
+func (c *Client) DownloadBlobTo(roster *onet.Roster, root []byte,
+	w io.Writer) error {
+	manifest, err := c.getManifest(roster, root)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for i, hash := range manifest.ChunkHashes {
+		var chunk []byte
+		err := c.getBlob(roster, hash, &GetBlobChunk{Hash: hash},
+			func() (interface{}, func() bool) {
+				reply := &GetBlobChunkReply{}
+				return reply, func() bool {
+					h := sha256.Sum256(reply.Data)
+					if !bytes.Equal(h[:], hash) {
+						return false
+					}
+					chunk = reply.Data
+					return true
+				}
+			})
+		if err != nil {
+			return xerrors.Errorf("getting chunk %d: %v", i, err)
+		}
+		size += int64(len(chunk))
+		if size > manifest.Size {
+			return xerrors.New("the size of the blob doesn't match its manifest")
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return xerrors.Errorf("writing chunk %d: %v", i, err)
+		}
+	}
+	if size != manifest.Size {
+		return xerrors.New("the size of the blob doesn't match its manifest")
+	}
+	return nil
+}
+
+// DeleteBlob asks every node of the roster of the LTS to delete the blob of
+// the write, which must be revoked or expired. Only the chunks and the
+// manifest stored for the signer are deleted, so the signer must be the one
+// that uploaded the blob. It returns the number of values deleted on all the
+// nodes.
+func (c *Client) DeleteBlob(roster *onet.Roster, write *byzcoin.Proof,
+	signer darc.Signer) (int, error) {
+	var w Write
+	err := write.VerifyAndDecode(cothority.Suite, ContractWriteID, &w)
+	if err != nil {
+		return 0, xerrors.Errorf("didn't get a write instance: %v", err)
+	}
+	if len(w.BlobRoot) == 0 {
+		return 0, xerrors.New("the write has no blob")
+	}
+	manifest, err := c.getManifest(roster, w.BlobRoot)
+	if err != nil {
+		return 0, err
+	}
+	sig, err := signer.Sign(blobMessage(w.LTSID,
+		append([]byte("d"), w.BlobRoot...)))
+	if err != nil {
+		return 0, xerrors.Errorf("signing request: %v", err)
+	}
+	req := &DeleteBlob{Write: *write, Manifest: *manifest,
+		Uploader: signer.Identity(), Signature: sig}
+	deleted := 0
+	for _, si := range roster.List {
+		reply := &DeleteBlobReply{}
+		if err := c.c.SendProtobuf(si, req, reply); err != nil {
+			return deleted, xerrors.Errorf("deleting on %v: %v", si, err)
+		}
+		deleted += reply.Deleted
+	}
+	return deleted, nil
+}
+
+// getManifest fetches the manifest with the given root from the nodes of
+// the roster.
+func (c *Client) getManifest(roster *onet.Roster, root []byte) (*BlobManifest, error) {
+	var manifest BlobManifest
+	err := c.getBlob(roster, root, &GetBlobManifest{Root: root},
+		func() (interface{}, func() bool) {
+			reply := &GetBlobManifestReply{}
+			return reply, func() bool {
+				if !bytes.Equal(reply.Manifest.Root(), root) {
+					return false
+				}
+				manifest = reply.Manifest
+				return true
+			}
+		})
+	if err != nil {
+		return nil, xerrors.Errorf("getting manifest: %v", err)
+	}
+	return &manifest, nil
+}
+
+// getBlob asks the nodes of the roster for the key, starting with its
+// replicas, until one of them returns a valid reply.
+func (c *Client) getBlob(roster *onet.Roster, key []byte, msg interface{},
+	newReply func() (interface{}, func() bool)) error {
+	err := xerrors.New("no node returned a valid blob")
+	for _, si := range blobReplicas(roster, key, len(roster.List)) {
+		reply, valid := newReply()
+		if e := c.c.SendProtobuf(si, msg, reply); e != nil {
+			err = e
+			continue
+		}
+		if valid() {
+			return nil
+		}
+		log.Warnf("%v returned an invalid blob for %x", si, key)
+	}
+	return err
+}
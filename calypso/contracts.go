@@ -1,6 +1,8 @@
 package calypso
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"strings"
 
@@ -36,6 +38,27 @@ func (w Write) String() string {
 	fmt.Fprintf(out, "-- ExtraData: %s\n", w.ExtraData)
 	fmt.Fprintf(out, "-- LTSID: %s\n", w.LTSID)
 	fmt.Fprintf(out, "-- Cost: %x\n", w.Cost)
+	if w.Beneficiary != nil {
+		fmt.Fprintf(out, "-- Beneficiary: %x\n", w.Beneficiary.Slice())
+	}
+	if w.ReadPolicy != "" {
+		fmt.Fprintf(out, "-- ReadPolicy: %s\n", w.ReadPolicy)
+		fmt.Fprintf(out, "-- PolicyIssuer: %s\n", w.PolicyIssuer)
+	}
+	fmt.Fprintf(out, "-- KeyCipher: %x\n", w.KeyCipher)
+	fmt.Fprintf(out, "-- Revoked: %t\n", w.Revoked)
+	fmt.Fprintf(out, "-- Expiry: %d\n", w.Expiry)
+	fmt.Fprintf(out, "-- ReadValidity: %d\n", w.ReadValidity)
+	fmt.Fprintf(out, "-- BlobRoot: %x\n", w.BlobRoot)
+	if w.MigrateTo != nil {
+		fmt.Fprintf(out, "-- MigrateTo: %x\n", w.MigrateTo.Slice())
+	}
+	if w.Migration != nil {
+		fmt.Fprintf(out, "-- MigratedFrom: %x\n", w.Migration.Write.Slice())
+	}
+	if w.MigratedTo != nil {
+		fmt.Fprintf(out, "-- MigratedTo: %x\n", w.MigratedTo.Slice())
+	}
 
 	return out.String()
 }
@@ -50,6 +73,12 @@ func contractWriteFromBytes(in []byte) (byzcoin.Contract, error) {
 // Spawn is used to create a new write- or read-contract. The read-contract is
 // created by the write-instance, because the creation of a new read-instance is
 // protected by the write-contract's darc.
+//
+// If the write has a Cost, the reader pays it either from the coin instance
+// given in the 'payer' argument, which the signers of the read-request must
+// be allowed to fetch coins from, or from the coins fetched by a previous
+// instruction of the transaction. The Cost is credited to the beneficiary of
+// the write in the same state changes as the creation of the read.
 func (c ContractWrite) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
 	cout = coins
 
@@ -75,10 +104,37 @@ func (c ContractWrite) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruc
 		if d := inst.Spawn.Args.Search("darcID"); d != nil {
 			darcID = d
 		}
-		if err = c.Write.CheckProof(cothority.Suite, darcID); err != nil {
+		var prev *Write
+		if c.Write.Migration != nil {
+			prev, err = c.Write.checkMigration(rst, darcID)
+		} else {
+			err = c.Write.CheckProof(cothority.Suite, darcID)
+		}
+		if err != nil {
 			err = xerrors.Errorf("proof of write failed: %v", err)
 			return
 		}
+		if c.Write.MigrateTo != nil || c.Write.MigratedTo != nil {
+			err = xerrors.New("a new write cannot be migrated")
+			return
+		}
+		if len(c.Write.BlobRoot) != 0 && len(c.Write.BlobRoot) != sha256.Size {
+			err = xerrors.New("the blob root must be a sha256 hash")
+			return
+		}
+		if err = c.Write.checkBeneficiary(rst); err != nil {
+			return
+		}
+		if c.Write.ReadPolicy != "" {
+			if _, err = ParseReadPolicy(c.Write.ReadPolicy); err != nil {
+				err = xerrors.Errorf("invalid read policy: %v", err)
+				return
+			}
+			if c.Write.PolicyIssuer == "" {
+				err = xerrors.New("a read policy needs an issuer")
+				return
+			}
+		}
 		instID, err := inst.DeriveIDArg("", "preID")
 		if err != nil {
 			return nil, nil, xerrors.Errorf(
@@ -86,6 +142,22 @@ func (c ContractWrite) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruc
 		}
 		log.Lvlf3("Successfully verified write request and will store in %x", instID)
 		sc = append(sc, byzcoin.NewStateChange(byzcoin.Create, instID, ContractWriteID, w, darcID))
+		if prev != nil {
+			prev.MigratedTo = &instID
+			buf, err := protobuf.Encode(prev)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("encoding previous write: %v", err)
+			}
+			sc = append(sc, byzcoin.NewStateChange(byzcoin.Update,
+				c.Write.Migration.Write, ContractWriteID, buf, darcID))
+		}
+		if c.Cost.Value > 0 {
+			listSc, err := updatePriceList(rst, darcID, instID, &c.Cost)
+			if err != nil {
+				return nil, nil, err
+			}
+			sc = append(sc, *listSc)
+		}
 	case ContractReadID:
 		var rd Read
 		r := inst.Spawn.Args.Search("read")
@@ -99,16 +171,21 @@ func (c ContractWrite) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruc
 		if !rd.Write.Equal(inst.InstanceID) {
 			return nil, nil, xerrors.New("the read request doesn't reference this write-instance")
 		}
-		if c.Cost.Value > 0 {
-			for i, coin := range cout {
-				if coin.Name.Equal(c.Cost.Name) {
-					err := coin.SafeSub(c.Cost.Value)
-					if err != nil {
-						return nil, nil, xerrors.Errorf("couldn't pay for read request: %v", err)
-					}
-					cout[i] = coin
-					break
-				}
+		if c.Revoked {
+			return nil, nil, xerrors.New("the write-instance has been revoked")
+		}
+		if c.Expiry > 0 || c.ReadValidity > 0 {
+			tr, ok := rst.(byzcoin.TimeReader)
+			if !ok {
+				return nil, nil, xerrors.New("internal error: cannot convert " +
+					"ReadOnlyStateTrie to TimeReader")
+			}
+			if err := c.limitRead(&rd, tr.GetCurrentBlockTimestamp()/1e9); err != nil {
+				return nil, nil, err
+			}
+			r, err = protobuf.Encode(&rd)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("encoding read: %v", err)
 			}
 		}
 		instID, err := inst.DeriveIDArg("", "preID")
@@ -118,15 +195,73 @@ func (c ContractWrite) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruc
 		}
 		sc = byzcoin.StateChanges{byzcoin.NewStateChange(byzcoin.Create,
 			instID, ContractReadID, r, darcID)}
+		if c.Cost.Value > 0 {
+			paySc, err := c.payRead(rst, inst, cout)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("couldn't pay for read request: %v", err)
+			}
+			sc = append(sc, paySc...)
+		}
+	case ContractAccessLogID:
+		sc, err = c.spawnAccessLog(rst, inst, darcID)
 	default:
-		err = xerrors.New("can only spawn writes and reads")
+		err = xerrors.New("can only spawn writes, reads and access logs")
 	}
 	return
 }
 
+// limitRead restricts the validity window of the read to the expiry of the
+// write and to its read validity, starting at now.
+func (c ContractWrite) limitRead(rd *Read, now int64) error {
+	if c.Expiry > 0 && now >= c.Expiry {
+		return xerrors.New("the write-instance has expired")
+	}
+	notAfter := c.Expiry
+	if c.ReadValidity > 0 && (notAfter == 0 || now+c.ReadValidity < notAfter) {
+		notAfter = now + c.ReadValidity
+	}
+	if rd.NotAfter == 0 || rd.NotAfter > notAfter {
+		rd.NotAfter = notAfter
+	}
+	return nil
+}
+
+// CheckValidity returns an error if the write has been revoked or if it
+// expired at the unix time now.
+func (w Write) CheckValidity(now int64) error {
+	if w.Revoked {
+		return xerrors.New("the write-instance has been revoked")
+	}
+	if w.Expiry > 0 && now >= w.Expiry {
+		return xerrors.New("the write-instance has expired")
+	}
+	return nil
+}
+
+// CheckValidity returns an error if the read cannot be used at the unix time
+// now.
+func (r Read) CheckValidity(now int64) error {
+	if r.NotBefore > 0 && now < r.NotBefore {
+		return xerrors.New("the read-instance is not yet valid")
+	}
+	if r.NotAfter > 0 && now >= r.NotAfter {
+		return xerrors.New("the read-instance has expired")
+	}
+	return nil
+}
+
 // Invoke supports the following command:
 //  - update - it takes a 'data' and/or 'extraData' argument that is used to
-//    update the data and/or extradata part of the write structure.
+//    update the data and/or extradata part of the write structure. An
+//    'expiry' argument holding a unix time in seconds as an 8-byte
+//    little-endian value changes the expiry of the write.
+//  - revoke - revokes the write, so that no new read can be created and
+//    existing reads cannot be used anymore. This cannot be undone. As the
+//    readers pay when their read is created, nothing is refunded, but the
+//    write is removed from the price list of its darc.
+//  - migrate - allows the LTS of the write to re-encrypt the secret to the
+//    LTS given in the 'lts' argument, using MigrateWrites. The secret can
+//    then be stored in a new write referencing this one.
 func (c *ContractWrite) Invoke(rst byzcoin.ReadOnlyStateTrie,
 	inst byzcoin.Instruction, cin []byzcoin.Coin) ([]byzcoin.StateChange,
 	[]byzcoin.Coin, error) {
@@ -136,10 +271,14 @@ func (c *ContractWrite) Invoke(rst byzcoin.ReadOnlyStateTrie,
 		return nil, nil, err
 	}
 
-	update := false
+	var sc []byzcoin.StateChange
+	if c.Revoked {
+		return nil, nil, xerrors.New("the write-instance has been revoked")
+	}
 
 	switch inst.Invoke.Command {
 	case "update":
+		update := false
 		data := inst.Invoke.Args.Search("data")
 		if data != nil {
 			c.Data = data
@@ -150,12 +289,47 @@ func (c *ContractWrite) Invoke(rst byzcoin.ReadOnlyStateTrie,
 			c.ExtraData = extraData
 			update = true
 		}
+		expiry := inst.Invoke.Args.Search("expiry")
+		if expiry != nil {
+			if len(expiry) != 8 {
+				return nil, nil, xerrors.New("expiry must be 8 bytes")
+			}
+			c.Expiry = int64(binary.LittleEndian.Uint64(expiry))
+			update = true
+		}
+		if !update {
+			return nil, nil, xerrors.New("neither data, extraData nor expiry update")
+		}
+	case "revoke":
+		c.Revoked = true
+		if c.Cost.Value > 0 {
+			listSc, err := updatePriceList(rst, darcID, inst.InstanceID, nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			if listSc != nil {
+				sc = append(sc, *listSc)
+			}
+		}
+	case "migrate":
+		lts := inst.Invoke.Args.Search("lts")
+		if len(lts) != len(byzcoin.InstanceID{}) {
+			return nil, nil, xerrors.New("need the new LTS in the 'lts' argument")
+		}
+		ltsID := byzcoin.NewInstanceID(lts)
+		if c.MigratedTo != nil {
+			return nil, nil, xerrors.New("the write has already been migrated")
+		}
+		if ltsID.Equal(c.LTSID) {
+			return nil, nil, xerrors.New("the write already uses this LTS")
+		}
+		if _, err := getLtsInstance(rst, ltsID); err != nil {
+			return nil, nil, xerrors.Errorf("getting new LTS: %v", err)
+		}
+		c.MigrateTo = &ltsID
 	default:
-		return nil, nil, xerrors.New("only know 'update' command")
-	}
-
-	if !update {
-		return nil, nil, xerrors.New("neither data nor extraData update")
+		return nil, nil, xerrors.New("only know 'update', 'revoke' and " +
+			"'migrate' commands")
 	}
 
 	var ciBuf []byte
@@ -163,8 +337,8 @@ func (c *ContractWrite) Invoke(rst byzcoin.ReadOnlyStateTrie,
 	if err != nil {
 		return nil, nil, err
 	}
-	return []byzcoin.StateChange{byzcoin.NewStateChange(byzcoin.Update,
-		inst.InstanceID, ContractWriteID, ciBuf, darcID)}, cin, nil
+	return append([]byzcoin.StateChange{byzcoin.NewStateChange(byzcoin.Update,
+		inst.InstanceID, ContractWriteID, ciBuf, darcID)}, sc...), cin, nil
 }
 
 // ContractReadID references a read contract system-wide.
@@ -214,9 +388,17 @@ func (c *contractLTS) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruct
 	if err != nil {
 		return nil, nil, xerrors.Errorf("passed lts_instance_info argument is invalid: %v", err)
 	}
+	if info.Epoch != 0 {
+		return nil, nil, xerrors.New("a new LTS must start at epoch 0")
+	}
 	return byzcoin.StateChanges{byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractLongTermSecretID, infoBuf, darcID)}, coins, nil
 }
 
+// Invoke supports the following commands:
+//  - reshare - it takes a 'lts_instance_info' argument with the new roster
+//    of the LTS, which must overlap with a threshold of the current roster.
+//  - refresh - increases the epoch of the LTS, so that the nodes can
+//    proactively refresh their shares with the same roster.
 func (c *contractLTS) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
 	var darcID darc.ID
 	curBuf, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
@@ -224,8 +406,22 @@ func (c *contractLTS) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruc
 		return nil, nil, xerrors.Errorf("getting values: %v", err)
 	}
 
-	if inst.Invoke.Command != "reshare" {
-		return nil, nil, xerrors.New("can only reshare long-term secrets")
+	switch inst.Invoke.Command {
+	case "reshare":
+	case "refresh":
+		var info LtsInstanceInfo
+		err = protobuf.DecodeWithConstructors(curBuf, &info, network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return nil, nil, xerrors.Errorf("current info is invalid: %v", err)
+		}
+		info.Epoch++
+		infoBuf, err := protobuf.Encode(&info)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("encoding info: %v", err)
+		}
+		return byzcoin.StateChanges{byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractLongTermSecretID, infoBuf, darcID)}, coins, nil
+	default:
+		return nil, nil, xerrors.New("can only reshare or refresh long-term secrets")
 	}
 	infoBuf := inst.Invoke.Args.Search("lts_instance_info")
 	if infoBuf == nil || len(infoBuf) == 0 {
@@ -251,6 +447,15 @@ func (c *contractLTS) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruc
 		return nil, nil, xerrors.New("new roster does not overlap enough with current roster")
 	}
 
+	// The epoch is kept, as it counts the refreshes of the same secret.
+	if newInfo.Epoch != curInfo.Epoch {
+		newInfo.Epoch = curInfo.Epoch
+		infoBuf, err = protobuf.Encode(&newInfo)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("encoding info: %v", err)
+		}
+	}
+
 	return byzcoin.StateChanges{byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractLongTermSecretID, infoBuf, darcID)}, coins, nil
 }
 
@@ -266,15 +471,24 @@ func intersectRosters(r1, r2 *onet.Roster) int {
 
 // VerifyInstruction uses a specific verification based on attr in the case it
 // is a read spawn. This will check if any makeAttInterpreter has been
-// registered in the service and apply them.
+// registered in the service and apply them. Access receipts are verified
+// against the LTS instead of the darc.
 func (c ContractWrite) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, ctxHash []byte) error {
+	if inst.GetType() == byzcoin.SpawnType && inst.Spawn.ContractID == ContractAccessLogID {
+		return c.verifyAccessReceipt(rst, inst)
+	}
 	if inst.GetType() == byzcoin.SpawnType && inst.Spawn.ContractID == ContractReadID {
 
 		evalAttr := darc.AttrInterpreters{}
 		for _, makeAttrInterpreterWrapper := range readMakeAttrInterpreter {
 			evalAttr[makeAttrInterpreterWrapper.name] = makeAttrInterpreterWrapper.interpreter(c, rst, inst)
 		}
-		return inst.VerifyWithOption(rst, ctxHash, &byzcoin.VerificationOptions{EvalAttr: evalAttr})
+		err := inst.VerifyWithOption(rst, ctxHash, &byzcoin.VerificationOptions{EvalAttr: evalAttr})
+		if err != nil || c.Cost.Value == 0 ||
+			inst.Spawn.Args.Search("payer") == nil {
+			return err
+		}
+		return verifyPayer(rst, inst, ctxHash)
 	}
 	return inst.VerifyWithOption(rst, ctxHash, nil)
 }
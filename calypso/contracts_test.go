@@ -2,7 +2,11 @@ package calypso
 
 import (
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
 	"go.dedis.ch/protobuf"
 	"testing"
 )
@@ -48,3 +52,154 @@ func TestContractWrite_Invoke(t *testing.T) {
 	require.NoError(t, protobuf.Decode(scs[0].Value, &cwNew))
 	require.Equal(t, []byte("newExtraData"), cwNew.ExtraData)
 }
+
+func TestContractWrite_Revoke(t *testing.T) {
+	rost := byzcoin.NewROSTSimul()
+
+	cw := ContractWrite{Write: Write{Data: []byte("data")}}
+	cwID, err := rost.CreateRandomInstance(ContractWriteID, &cw, nil)
+	require.NoError(t, err)
+	instr := byzcoin.Instruction{
+		InstanceID: cwID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractWriteID,
+			Command:    "revoke",
+		}}
+	scs, _, err := cw.Invoke(rost, instr, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(scs))
+	var cwNew ContractWrite
+	require.NoError(t, protobuf.Decode(scs[0].Value, &cwNew))
+	require.True(t, cwNew.Revoked)
+	require.Error(t, cwNew.CheckValidity(0))
+
+	// A revoked write cannot be updated nor read anymore.
+	instr.Invoke.Command = "update"
+	instr.Invoke.Args = byzcoin.Arguments{{Name: "data", Value: []byte("new")}}
+	_, _, err = cwNew.Invoke(rost, instr, nil)
+	require.Error(t, err)
+
+	readBuf, err := protobuf.Encode(&Read{Write: cwID,
+		Xc: cothority.Suite.Point().Base()})
+	require.NoError(t, err)
+	_, _, err = cwNew.Spawn(rost, byzcoin.Instruction{
+		InstanceID: cwID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractReadID,
+			Args:       byzcoin.Arguments{{Name: "read", Value: readBuf}},
+		}}, nil)
+	require.Error(t, err)
+}
+
+func TestContractWrite_ReadValidity(t *testing.T) {
+	cw := ContractWrite{Write: Write{Expiry: 1000, ReadValidity: 100}}
+	require.NoError(t, cw.CheckValidity(999))
+	require.Error(t, cw.CheckValidity(1000))
+
+	rd := Read{}
+	require.NoError(t, cw.limitRead(&rd, 500))
+	require.Equal(t, int64(600), rd.NotAfter)
+	require.NoError(t, rd.CheckValidity(599))
+	require.Error(t, rd.CheckValidity(600))
+
+	// The read is limited to the expiry of the write.
+	rd = Read{NotBefore: 950}
+	require.NoError(t, cw.limitRead(&rd, 920))
+	require.Equal(t, int64(1000), rd.NotAfter)
+	require.Error(t, rd.CheckValidity(940))
+	require.NoError(t, rd.CheckValidity(960))
+
+	require.Error(t, cw.limitRead(&rd, 1000))
+}
+
+func TestAccessLog_Add(t *testing.T) {
+	var al AccessLog
+	readID := byzcoin.NewInstanceID([]byte("read"))
+	for i := 0; i < maxAccessLogReceipts; i++ {
+		require.NoError(t, al.add(AccessReceipt{Read: readID,
+			Timestamp: int64(100 + i)}))
+	}
+	require.Error(t, al.add(AccessReceipt{Read: readID, Timestamp: 100}))
+
+	// The log is full, so the oldest receipt is dropped, and cannot be
+	// logged again.
+	require.NoError(t, al.add(AccessReceipt{Read: readID, Timestamp: 99 +
+		maxAccessLogReceipts + 1}))
+	require.Len(t, al.Receipts, maxAccessLogReceipts)
+	require.Equal(t, int64(101), al.Receipts[0].Timestamp)
+	require.Error(t, al.add(AccessReceipt{Read: readID, Timestamp: 100}))
+}
+
+func TestContractWrite_AccessReceiptSigners(t *testing.T) {
+	// A receipt cannot be logged with signers, as their counters would be
+	// increased without verifying their signatures.
+	signer := darc.NewSignerEd25519(nil, nil)
+	instr := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID([]byte("write")),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractAccessLogID,
+		},
+		SignerIdentities: []darc.Identity{signer.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+	err := ContractWrite{}.VerifyInstruction(byzcoin.NewROSTSimul(), instr, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must not be signed")
+}
+
+func TestContractLTS_Refresh(t *testing.T) {
+	rost := byzcoin.NewROSTSimul()
+	si := network.NewServerIdentity(cothority.Suite.Point().Base(),
+		network.NewAddress(network.TLS, "127.0.0.1:7770"))
+	c := contractLTS{LtsInstanceInfo: LtsInstanceInfo{
+		Roster: *onet.NewRoster([]*network.ServerIdentity{si}),
+		Epoch:  3,
+	}}
+	ltsID, err := rost.CreateRandomInstance(ContractLongTermSecretID,
+		&c.LtsInstanceInfo, nil)
+	require.NoError(t, err)
+
+	instr := byzcoin.Instruction{
+		InstanceID: ltsID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractLongTermSecretID,
+			Command:    "refresh",
+		}}
+	scs, _, err := c.Invoke(rost, instr, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(scs))
+	var info LtsInstanceInfo
+	require.NoError(t, protobuf.DecodeWithConstructors(scs[0].Value, &info,
+		network.DefaultConstructors(cothority.Suite)))
+	require.Equal(t, uint64(4), info.Epoch)
+
+	instr.Invoke.Command = "unknown"
+	_, _, err = c.Invoke(rost, instr, nil)
+	require.Error(t, err)
+}
+
+func TestReadPolicy(t *testing.T) {
+	attrs := map[string]string{"department": "research", "clearance": "2",
+		"role": "team lead"}
+	for policy, ok := range map[string]bool{
+		"department=research":                                         true,
+		"department=sales":                                            false,
+		"clearance>=2 AND department!=sales":                          true,
+		"clearance>2 || role=\"team lead\"":                           true,
+		"NOT (clearance<3)":                                           false,
+		"department=research and (clearance>=3 or level>=1)":          false,
+		"!(department=sales) && (clearance>=3 OR role=\"team lead\")": true,
+		"department>=2":                                               false,
+	} {
+		p, err := ParseReadPolicy(policy)
+		require.NoError(t, err, policy)
+		require.Equal(t, ok, p.Eval(attrs) == nil, policy)
+	}
+
+	for _, policy := range []string{"", "department", "department=",
+		"(clearance>=2", "clearance>=2)", "clearance=>2", "a=b AND",
+		"a=\"b", "a==b", "AND=b"} {
+		_, err := ParseReadPolicy(policy)
+		require.Error(t, err, policy)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// blobUpload encrypts the file given with --file, or STDIN, with a random
+// symmetric key while streaming it to the nodes of the LTS. The key is stored
+// in a new write instance, together with the Merkle root of the blob.
+func blobUpload(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	instid, err := hex.DecodeString(c.String("instid"))
+	if err != nil || len(instid) == 0 {
+		return xerrors.New("please provide the LTS instance ID with --instid")
+	}
+	ltsID := byzcoin.NewInstanceID(instid)
+
+	dstr := c.String("darc")
+	if dstr == "" {
+		dstr = cfg.AdminDarc.GetIdentityString()
+	}
+	d, err := lib.GetDarcByString(cl, dstr)
+	if err != nil {
+		return err
+	}
+
+	var signer *darc.Signer
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to parse the signer: %v", err)
+	}
+
+	ltsKey, err := hex.DecodeString(c.String("key"))
+	if err != nil || len(ltsKey) == 0 {
+		return xerrors.New("please provide the hex string public key with --key")
+	}
+	X := cothority.Suite.Point()
+	err = X.UnmarshalBinary(ltsKey)
+	if err != nil {
+		return xerrors.Errorf("failed to unmarshal key: %v", err)
+	}
+
+	var in io.Reader = os.Stdin
+	if file := c.String("file"); file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return xerrors.Errorf("failed to open file: %v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return xerrors.Errorf("getting signer counters: %v", err)
+	}
+	cc := calypso.NewClient(cl)
+	reply, err := cc.WriteStream(in, ltsID, X, c.Int("replication"), *signer,
+		counters.Counters[0]+1, *d, 10)
+	if err != nil {
+		return xerrors.Errorf("failed to store the file: %v", err)
+	}
+
+	err = lib.WaitPropagation(c, cl)
+	if err != nil {
+		return xerrors.Errorf("waiting for block propagation: %v", err)
+	}
+
+	iidStr := hex.EncodeToString(reply.InstanceID.Slice())
+	if c.Bool("export") {
+		_, err = io.Copy(os.Stdout, bytes.NewReader([]byte(iidStr)))
+		return cothority.ErrorOrNil(err, "failed to copy to stdout")
+	}
+	log.Infof("Stored the file. The write instance id is:\n%s", iidStr)
+	return nil
+}
+
+// blobDownload spawns a read of the write given with --writeid, for the key
+// given with --key, and decrypts the blob of the write to the file given with
+// --out, or STDOUT. The blob is checked against the Merkle root stored in the
+// write.
+func blobDownload(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	writeID, err := hex.DecodeString(c.String("writeid"))
+	if err != nil || len(writeID) == 0 {
+		return xerrors.New("please provide the write instance id with --writeid")
+	}
+
+	var signer *darc.Signer
+	if keyPath := c.String("key"); keyPath == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadSigner(keyPath)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to load key file: %v", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if file := c.String("out"); file != "" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return xerrors.Errorf("failed to create file: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return xerrors.Errorf("getting signer counters: %v", err)
+	}
+	cc := calypso.NewClient(cl)
+	_, err = cc.ReadStream(byzcoin.NewInstanceID(writeID), out, *signer,
+		counters.Counters[0]+1, 10)
+	return cothority.ErrorOrNil(err, "failed to read the file")
+}
+
+// blobDelete deletes the blob of the revoked or expired write given with
+// --writeid from the nodes of its LTS. Only the chunks stored by the signer
+// given with --sign are deleted.
+func blobDelete(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	writeID, err := hex.DecodeString(c.String("writeid"))
+	if err != nil || len(writeID) == 0 {
+		return xerrors.New("please provide the write instance id with --writeid")
+	}
+	resp, err := cl.GetProofFromLatest(writeID)
+	if err != nil {
+		return xerrors.Errorf("couldn't get write proof: %v", err)
+	}
+	var write calypso.Write
+	err = resp.Proof.VerifyAndDecode(cothority.Suite, calypso.ContractWriteID,
+		&write)
+	if err != nil {
+		return xerrors.Errorf("didn't get a write instance: %v", err)
+	}
+	info, err := getLtsInfo(cl, write.LTSID)
+	if err != nil {
+		return err
+	}
+
+	var signer *darc.Signer
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to parse the signer: %v", err)
+	}
+
+	deleted, err := calypso.NewClient(cl).DeleteBlob(&info.Roster,
+		&resp.Proof, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to delete the blob: %v", err)
+	}
+	log.Infof("Deleted %d chunks and manifests of the blob", deleted)
+	return nil
+}
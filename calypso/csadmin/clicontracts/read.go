@@ -25,7 +25,11 @@ import (
 // specified by the --instid argument. By default, the function uses the public
 // key of the signer to encrypt the requested data. However, a different public
 // key can be given a an hexadecimal string representation with --key.
-// With the --export option, the instance id is sent to STDOUT.
+// If the write has a cost, it is taken from the coin instance given with
+// --payer. If the write has a read policy, the credential of the reader is
+// given with --credential, together with the signature of the issuer on it
+// with --credential-signer and --credential-sig. With the --export option, the instance id is sent
+// to STDOUT.
 func ReadSpawn(c *cli.Context) error {
 	bcArg := c.String("bc")
 	if bcArg == "" {
@@ -123,15 +127,40 @@ func ReadSpawn(c *cli.Context) error {
 		return xerrors.Errorf("failed to get the signer counters: %v", err)
 	}
 
+	args := byzcoin.Arguments{
+		{Name: "read", Value: readBuf},
+		{Name: "projectInstID", Value: projectInstIDBuff},
+	}
+	if write.Cost.Value > 0 {
+		payer, err := hex.DecodeString(c.String("payer"))
+		if err != nil || len(payer) == 0 {
+			return xerrors.Errorf("the write costs %d coins, please give "+
+				"the coin to pay it with --payer", write.Cost.Value)
+		}
+		args = append(args, byzcoin.Argument{Name: "payer", Value: payer})
+	}
+	if credential := c.String("credential"); credential != "" {
+		credBuf, err := hex.DecodeString(credential)
+		if err != nil {
+			return xerrors.Errorf("failed to decode credential: %v", err)
+		}
+		credSig, err := hex.DecodeString(c.String("credential-sig"))
+		if err != nil || len(credSig) == 0 {
+			return xerrors.New("please give the signature of the issuer " +
+				"on the credential with --credential-sig")
+		}
+		args = append(args,
+			byzcoin.Argument{Name: "credential", Value: credBuf},
+			byzcoin.Argument{Name: "credentialSigner",
+				Value: []byte(c.String("credential-signer"))},
+			byzcoin.Argument{Name: "credentialSignature", Value: credSig})
+	}
 	ctx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion,
 		byzcoin.Instruction{
 			InstanceID: byzcoin.NewInstanceID(proof.InclusionProof.Key()),
 			Spawn: &byzcoin.Spawn{
 				ContractID: calypso.ContractReadID,
-				Args: byzcoin.Arguments{
-					{Name: "read", Value: readBuf},
-					{Name: "projectInstID", Value: projectInstIDBuff},
-				},
+				Args:       args,
 			},
 			SignerCounter: []uint64{counters.Counters[0] + 1},
 		},
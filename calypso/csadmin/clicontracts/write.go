@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"go.dedis.ch/onet/v3/log"
 	"golang.org/x/xerrors"
@@ -14,6 +15,7 @@ import (
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
 	"go.dedis.ch/cothority/v3/calypso"
 	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/protobuf"
@@ -32,6 +34,11 @@ import (
 // or --readExtra. Both --readExtra and --readData can NOT be used at the same
 // time. If everything goes well, it prints the instance id of the newly spawned
 // Write instance. With the --export option, the instance id is sent to STDOUT.
+// The optional --expiry and --readValidity durations limit how long the secret
+// can be read, and how long each read instance stays valid.
+// With --cost, every read instance must pay the given number of coins to the
+// coin instance given with --beneficiary. With --policy, the readers must
+// have a credential issued by --issuer whose attributes fulfill the policy.
 func WriteSpawn(c *cli.Context) error {
 	bcArg := c.String("bc")
 	if bcArg == "" {
@@ -116,11 +123,37 @@ func WriteSpawn(c *cli.Context) error {
 
 	write := calypso.NewWrite(cothority.Suite, instid, d.GetBaseID(), p, secretBuf)
 	if write == nil {
-		return xerrors.New("got a nil write, this is due to a key that is " +
-			"too long to be embeded")
+		return xerrors.New("got a nil write, failed to encrypt the key")
 	}
 	write.Data = dataBuf
 	write.ExtraData = extraDataBuf
+	if expiry := c.Duration("expiry"); expiry > 0 {
+		write.Expiry = time.Now().Add(expiry).Unix()
+	}
+	if validity := c.Duration("readValidity"); validity > 0 {
+		write.ReadValidity = int64(validity / time.Second)
+	}
+	if cost := c.Uint64("cost"); cost > 0 {
+		benBuf, err := hex.DecodeString(c.String("beneficiary"))
+		if err != nil || len(benBuf) == 0 {
+			return xerrors.New("please provide the coin instance to credit " +
+				"with --beneficiary")
+		}
+		beneficiary := byzcoin.NewInstanceID(benBuf)
+		write.Beneficiary = &beneficiary
+		write.Cost = byzcoin.Coin{Name: contracts.CoinName, Value: cost}
+	}
+	if policy := c.String("policy"); policy != "" {
+		if _, err := calypso.ParseReadPolicy(policy); err != nil {
+			return xerrors.Errorf("invalid --policy: %v", err)
+		}
+		write.ReadPolicy = policy
+		write.PolicyIssuer = c.String("issuer")
+		if write.PolicyIssuer == "" {
+			return xerrors.New("please provide the issuer of the credentials " +
+				"with --issuer")
+		}
+	}
 	writeBuf, err := protobuf.Encode(write)
 	if err != nil {
 		return xerrors.Errorf("failed to encode Write struct: %v", err)
@@ -187,6 +220,75 @@ func WriteSpawn(c *cli.Context) error {
 	return nil
 }
 
+// WriteRevoke revokes a write instance, so that no new read instances can be
+// spawned and the LTS refuses to re-encrypt the secret.
+func WriteRevoke(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return xerrors.Errorf("loading configuration: %v", err)
+	}
+
+	instID := c.String("instid")
+	if instID == "" {
+		return xerrors.New("--instid flag is required")
+	}
+	instIDBuf, err := hex.DecodeString(instID)
+	if err != nil {
+		return xerrors.New("failed to decode the instID string")
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to parse the signer: %v", err)
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return xerrors.Errorf("getting signer counters: %v", err)
+	}
+
+	ctx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion,
+		byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(instIDBuf),
+			Invoke: &byzcoin.Invoke{
+				ContractID: calypso.ContractWriteID,
+				Command:    "revoke",
+			},
+			SignerCounter: []uint64{counters.Counters[0] + 1},
+		},
+	)
+
+	err = ctx.FillSignersAndSignWith(*signer)
+	if err != nil {
+		return xerrors.Errorf("failed to sign transaction: %v", err)
+	}
+
+	if lib.FindRecursivefBool("export", c) {
+		return lib.ExportTransaction(ctx)
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return xerrors.Errorf("failed to send transaction: %v", err)
+	}
+
+	log.Infof("Write instance %x revoked", instIDBuf)
+
+	return lib.WaitPropagation(c, cl)
+}
+
 // WriteGet checks the proof and prints the content of the Write contract.
 func WriteGet(c *cli.Context) error {
 
@@ -264,3 +366,35 @@ func WriteGet(c *cli.Context) error {
 
 	return nil
 }
+
+// WriteList prints the write instances with a cost that have been spawned with
+// the darc given by --darc, and that have not been revoked.
+func WriteList(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return xerrors.Errorf("loading configuration: %v", err)
+	}
+
+	dstr := c.String("darc")
+	if dstr == "" {
+		dstr = cfg.AdminDarc.GetIdentityString()
+	}
+	d, err := lib.GetDarcByString(cl, dstr)
+	if err != nil {
+		return err
+	}
+
+	writes, err := calypso.NewClient(cl).PricedWrites(d.GetBaseID())
+	if err != nil {
+		return xerrors.Errorf("failed to get the priced writes: %v", err)
+	}
+	for _, w := range writes {
+		log.Infof("%x: %d coins", w.Write.Slice(), w.Cost.Value)
+	}
+	return nil
+}
@@ -37,6 +37,26 @@ var cmds = cli.Commands{
 					},
 				},
 			},
+			{
+				Name:   "refresh",
+				Usage:  "proactively refreshes the shares of an LTS, keeping its roster and public key",
+				Action: dkgRefresh,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use (required)",
+					},
+					cli.StringFlag{
+						Name:  "instid, i",
+						Usage: "the instance id of the spawned LTS contract",
+					},
+					cli.StringFlag{
+						Name:  "sign, s",
+						Usage: "public key of the signing entity (default is the admin)",
+					},
+				},
+			},
 			{
 				Name:   "info",
 				Usage:  "prints info about an lts instance",
@@ -55,6 +75,45 @@ var cmds = cli.Commands{
 			},
 		},
 	},
+	{
+		Name:  "lts",
+		Usage: "handles operations on the secrets stored with an LTS",
+		Subcommands: cli.Commands{
+			{
+				Name:   "migrate",
+				Usage:  "re-encrypts writes to a new LTS and spawns new writes referencing them",
+				Action: ltsMigrate,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use (required)",
+					},
+					cli.StringFlag{
+						Name:  "instid, i",
+						Usage: "the instance id of the new LTS",
+					},
+					cli.StringSliceFlag{
+						Name:  "writeid, w",
+						Usage: "instance id of a write to migrate, can be repeated",
+					},
+					cli.IntFlag{
+						Name:  "replication",
+						Value: 2,
+						Usage: "the number of nodes of the new LTS storing every chunk of a blob",
+					},
+					cli.StringFlag{
+						Name:  "sign, s",
+						Usage: "public key of the signing entity (default is the admin)",
+					},
+					cli.BoolFlag{
+						Name:  "export, x",
+						Usage: "exports the instance ids of the new writes to STDOUT",
+					},
+				},
+			},
+		},
+	},
 	{
 		Name:   "reencrypt",
 		Usage:  "decrypt and reencrypt the secret of a write instance given the proofs of write and read instances",
@@ -99,6 +158,117 @@ var cmds = cli.Commands{
 			},
 		},
 	},
+	{
+		Name:   "access",
+		Usage:  "list the access receipts of a write or of a reader",
+		Action: access,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config to use (required)",
+			},
+			cli.StringFlag{
+				Name:  "writeid, w",
+				Usage: "the instance id of the write request",
+			},
+			cli.StringFlag{
+				Name:  "reader, r",
+				Usage: "the hex string public key of the reader",
+			},
+		},
+	},
+	{
+		Name:  "blob",
+		Usage: "stores and fetches encrypted blobs bound to a write instance",
+		Subcommands: cli.Commands{
+			{
+				Name:   "upload",
+				Usage:  "encrypts a file, stores it on the LTS nodes and spawns a write instance holding its key",
+				Action: blobUpload,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use (required)",
+					},
+					cli.StringFlag{
+						Name:  "instid, i",
+						Usage: "the instance id of the LTS contract",
+					},
+					cli.StringFlag{
+						Name:  "key",
+						Usage: "the hex string collective public key of the LTS",
+					},
+					cli.StringFlag{
+						Name:  "file, f",
+						Usage: "the file to upload (default is STDIN)",
+					},
+					cli.IntFlag{
+						Name:  "replication",
+						Value: 2,
+						Usage: "the number of nodes storing every chunk",
+					},
+					cli.StringFlag{
+						Name:  "darc",
+						Usage: "DARC with the right to spawn a write contract (default is the admin DARC)",
+					},
+					cli.StringFlag{
+						Name:  "sign, s",
+						Usage: "public key of the signing entity (default is the admin)",
+					},
+					cli.BoolFlag{
+						Name:  "export, x",
+						Usage: "exports the instance id of the write to STDOUT",
+					},
+				},
+			},
+			{
+				Name:   "download",
+				Usage:  "spawns a read instance, and fetches, checks and decrypts the blob of a write instance",
+				Action: blobDownload,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use (required)",
+					},
+					cli.StringFlag{
+						Name:  "writeid, w",
+						Usage: "the instance id of the write request",
+					},
+					cli.StringFlag{
+						Name:  "key",
+						Usage: "key file of the reader (default is the admin)",
+					},
+					cli.StringFlag{
+						Name:  "out, o",
+						Usage: "the file to write the blob to (default is STDOUT)",
+					},
+				},
+			},
+			{
+				Name:   "delete",
+				Usage:  "deletes the blob of a revoked or expired write instance from the LTS nodes",
+				Action: blobDelete,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use (required)",
+					},
+					cli.StringFlag{
+						Name:  "writeid, w",
+						Usage: "the instance id of the write request",
+					},
+					cli.StringFlag{
+						Name:  "sign, s",
+						Usage: "public key of the entity that uploaded the blob (default is the admin)",
+					},
+				},
+			},
+		},
+	},
 	{
 		Name:  "contract",
 		Usage: "Provides cli interface for contracts",
@@ -188,12 +358,76 @@ var cmds = cli.Commands{
 								Name:  "key",
 								Usage: "hexadecimal LTS public key",
 							},
+							cli.DurationFlag{
+								Name:  "expiry",
+								Usage: "the secret cannot be read anymore after this duration (default is never)",
+							},
+							cli.DurationFlag{
+								Name:  "readValidity",
+								Usage: "how long a read instance can be used after its creation (default is until the expiry)",
+							},
+							cli.Uint64Flag{
+								Name:  "cost",
+								Usage: "the number of coins a reader has to pay for a read instance",
+							},
+							cli.StringFlag{
+								Name:  "beneficiary",
+								Usage: "the coin instance credited with the cost of the reads (required with --cost)",
+							},
+							cli.StringFlag{
+								Name:  "policy",
+								Usage: "the attribute-based policy readers must fulfill, e.g. \"department=research AND clearance>=2\"",
+							},
+							cli.StringFlag{
+								Name:  "issuer",
+								Usage: "the identity controlling the credentials of the readers (required with --policy)",
+							},
 							cli.BoolFlag{
 								Name:  "export, x",
 								Usage: "export the instance id to STDOUT",
 							},
 						},
 					},
+					{
+						Name:   "revoke",
+						Usage:  "revoke a write instance so that its secret cannot be read anymore",
+						Action: clicontracts.WriteRevoke,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "sign, s",
+								Usage: "public key of the signing entity (default is the admin)",
+							},
+							cli.StringFlag{
+								Name:  "instid, i",
+								Usage: "the instance id of the write instance (required)",
+							},
+							cli.BoolFlag{
+								Name:  "export, x",
+								Usage: "export the transaction to STDOUT instead of sending it",
+							},
+						},
+					},
+					{
+						Name:   "list",
+						Usage:  "lists the write instances with a cost spawned with a darc",
+						Action: clicontracts.WriteList,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "darc",
+								Usage: "the DARC of the write instances (default is the admin DARC)",
+							},
+						},
+					},
 					{
 						Name:   "get",
 						Usage:  "if the proof matches, prints the content of the given Write instance ID",
@@ -246,6 +480,22 @@ var cmds = cli.Commands{
 								Name:  "export, x",
 								Usage: "export the instance id to STDOUT",
 							},
+							cli.StringFlag{
+								Name:  "payer",
+								Usage: "the coin instance paying the cost of the write (required if the write has a cost)",
+							},
+							cli.StringFlag{
+								Name:  "credential",
+								Usage: "the credential instance of the reader, if the write has a read policy",
+							},
+							cli.StringFlag{
+								Name:  "credential-signer",
+								Usage: "the identity of the issuer that signed the credential",
+							},
+							cli.StringFlag{
+								Name:  "credential-sig",
+								Usage: "hexadecimal signature of the issuer on the credential",
+							},
 							cli.StringFlag{
 								Name:  "projectInstID, pid",
 								Usage: "The project instance ID, which contains the metadata for verification (optional). This option is not directly used in the contract, it is only useful during the verification process in the case you registered a custom makeAttrInterpreter.",
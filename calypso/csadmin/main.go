@@ -226,6 +226,57 @@ func dkgInfo(c *cli.Context) error {
 		return xerrors.New("couldn't decode info: " + err.Error())
 	}
 	log.Info("lts-roster is:", ltsInfo.Roster.List)
+	log.Info("lts-epoch is:", ltsInfo.Epoch)
+	return nil
+}
+
+// dkgRefresh increases the epoch of the LTS instance and asks the nodes to
+// proactively refresh their shares.
+func dkgRefresh(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	instidstr := c.String("instid")
+	if instidstr == "" {
+		return xerrors.New("please provide an LTS instance ID with --instid")
+	}
+	instid, err := hex.DecodeString(instidstr)
+	if err != nil {
+		return xerrors.Errorf("failed to decode LTS instance id: %v", err)
+	}
+
+	var signer *darc.Signer
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to parse the signer: %v", err)
+	}
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return xerrors.Errorf("getting signer counters: %v", err)
+	}
+
+	reply, err := calypso.NewClient(cl).RefreshLTS(byzcoin.NewInstanceID(instid),
+		[]darc.Signer{*signer}, []uint64{counters.Counters[0] + 1})
+	if err != nil {
+		return xerrors.Errorf("failed to refresh the LTS: %v", err)
+	}
+	log.Infof("Refreshed the LTS to epoch %d with the deals of nodes %v",
+		reply.Epoch, reply.Dealers)
+	if len(reply.Offline) > 0 {
+		log.Warnf("Nodes %v will catch up during the next refresh", reply.Offline)
+	}
 	return nil
 }
 
@@ -384,3 +435,101 @@ func decrypt(c *cli.Context) error {
 
 	return nil
 }
+
+// access lists the access receipts of the write given with --writeid, or of
+// the reader given with --reader. Every receipt is checked against the roster
+// of the LTS of its write.
+func access(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	_, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	var logID byzcoin.InstanceID
+	switch {
+	case c.String("writeid") != "":
+		writeID, err := hex.DecodeString(c.String("writeid"))
+		if err != nil {
+			return xerrors.Errorf("failed to decode write id: %v", err)
+		}
+		logID = calypso.AccessLogWriteID(byzcoin.NewInstanceID(writeID))
+	case c.String("reader") != "":
+		readerBuf, err := hex.DecodeString(c.String("reader"))
+		if err != nil {
+			return xerrors.Errorf("failed to decode reader: %v", err)
+		}
+		reader := cothority.Suite.Point()
+		err = reader.UnmarshalBinary(readerBuf)
+		if err != nil {
+			return xerrors.Errorf("failed to unmarshal reader: %v", err)
+		}
+		logID = calypso.AccessLogReaderID(reader)
+	default:
+		return xerrors.New("please provide either --writeid or --reader")
+	}
+
+	resp, err := cl.GetProofFromLatest(logID.Slice())
+	if err != nil {
+		return xerrors.Errorf("couldn't get proof: %v", err)
+	}
+	exist, err := resp.Proof.InclusionProof.Exists(logID.Slice())
+	if err != nil {
+		return xerrors.Errorf("error while checking if proof exist: %v", err)
+	}
+	if !exist {
+		log.Info("No access found")
+		return nil
+	}
+	var accessLog calypso.AccessLog
+	err = resp.Proof.VerifyAndDecode(cothority.Suite,
+		calypso.ContractAccessLogID, &accessLog)
+	if err != nil {
+		return xerrors.Errorf("didn't get an access log: %v", err)
+	}
+
+	for _, r := range accessLog.Receipts {
+		status := "valid"
+		if err := verifyReceipt(cl, r); err != nil {
+			status = "invalid: " + err.Error()
+		}
+		log.Infof("- Access at %s\n"+
+			"-- Write: %x\n"+
+			"-- Read: %x\n"+
+			"-- Reader: %s\n"+
+			"-- Receipt: %s",
+			time.Unix(r.Timestamp, 0).Format(time.RFC3339), r.Write.Slice(),
+			r.Read.Slice(), r.Xc, status)
+	}
+	return nil
+}
+
+// verifyReceipt checks the signatures of the receipt against the roster of
+// the LTS of its write.
+func verifyReceipt(cl *byzcoin.Client, r calypso.AccessReceipt) error {
+	resp, err := cl.GetProofFromLatest(r.Write.Slice())
+	if err != nil {
+		return xerrors.Errorf("couldn't get write proof: %v", err)
+	}
+	var write calypso.Write
+	err = resp.Proof.VerifyAndDecode(cothority.Suite, calypso.ContractWriteID,
+		&write)
+	if err != nil {
+		return xerrors.Errorf("didn't get a write instance: %v", err)
+	}
+	resp, err = cl.GetProofFromLatest(write.LTSID.Slice())
+	if err != nil {
+		return xerrors.Errorf("couldn't get LTS proof: %v", err)
+	}
+	var info calypso.LtsInstanceInfo
+	err = resp.Proof.VerifyAndDecode(cothority.Suite,
+		calypso.ContractLongTermSecretID, &info)
+	if err != nil {
+		return xerrors.Errorf("didn't get an LTS instance: %v", err)
+	}
+	return r.Verify(&info.Roster)
+}
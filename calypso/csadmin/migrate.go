@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// ltsMigrate allows the writes given with --writeid to migrate to the LTS
+// given with --instid, asks their LTS to re-encrypt the secrets to the new
+// LTS, and spawns the new writes with the darcs of the previous writes. The
+// blobs of the writes are copied to the nodes of the new LTS.
+func ltsMigrate(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	instid, err := hex.DecodeString(c.String("instid"))
+	if err != nil || len(instid) == 0 {
+		return xerrors.New("please provide the new LTS instance ID with --instid")
+	}
+	newLTS := byzcoin.NewInstanceID(instid)
+
+	var writeIDs []byzcoin.InstanceID
+	for _, w := range c.StringSlice("writeid") {
+		id, err := hex.DecodeString(w)
+		if err != nil || len(id) != len(byzcoin.InstanceID{}) {
+			return xerrors.Errorf("invalid write instance id: %s", w)
+		}
+		writeIDs = append(writeIDs, byzcoin.NewInstanceID(id))
+	}
+	if len(writeIDs) == 0 {
+		return xerrors.New("please provide the writes to migrate with --writeid")
+	}
+
+	var signer *darc.Signer
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to parse the signer: %v", err)
+	}
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return xerrors.Errorf("getting signer counters: %v", err)
+	}
+
+	cc := calypso.NewClient(cl)
+	migrations, err := cc.MigrateWrites(writeIDs, newLTS,
+		[]darc.Signer{*signer}, []uint64{counters.Counters[0] + 1})
+	if err != nil {
+		return xerrors.Errorf("failed to migrate the writes: %v", err)
+	}
+
+	newInfo, err := getLtsInfo(cl, newLTS)
+	if err != nil {
+		return err
+	}
+	var newIDs []string
+	for i, m := range migrations {
+		resp, err := cl.GetProofFromLatest(writeIDs[i].Slice())
+		if err != nil {
+			return xerrors.Errorf("couldn't get write proof: %v", err)
+		}
+		var write calypso.Write
+		err = resp.Proof.VerifyAndDecode(cothority.Suite,
+			calypso.ContractWriteID, &write)
+		if err != nil {
+			return xerrors.Errorf("didn't get a write instance: %v", err)
+		}
+		_, _, _, darcID, err := resp.Proof.KeyValue()
+		if err != nil {
+			return xerrors.Errorf("couldn't get darc of write: %v", err)
+		}
+
+		d, err := lib.GetDarcByID(cl, darcID)
+		if err != nil {
+			return xerrors.Errorf("failed to get darc of write: %v", err)
+		}
+
+		if len(write.BlobRoot) > 0 {
+			oldInfo, err := getLtsInfo(cl, write.LTSID)
+			if err != nil {
+				return err
+			}
+			blob, err := cc.DownloadBlob(&oldInfo.Roster, write.BlobRoot)
+			if err != nil {
+				return xerrors.Errorf("failed to download blob: %v", err)
+			}
+			_, err = cc.UploadBlob(newLTS, &newInfo.Roster, blob,
+				c.Int("replication"), *signer, d.GetBaseID())
+			if err != nil {
+				return xerrors.Errorf("failed to upload blob: %v", err)
+			}
+		}
+		counters, err := cl.GetSignerCounters(signer.Identity().String())
+		if err != nil {
+			return xerrors.Errorf("getting signer counters: %v", err)
+		}
+		reply, err := cc.AddWrite(write.Migrate(m), *signer,
+			counters.Counters[0]+1, *d, 10)
+		if err != nil {
+			return xerrors.Errorf("failed to spawn migrated write: %v", err)
+		}
+		newIDs = append(newIDs, hex.EncodeToString(reply.InstanceID.Slice()))
+		if !c.Bool("export") {
+			log.Infof("Migrated write %x to the new write:\n%s",
+				writeIDs[i].Slice(), newIDs[i])
+		}
+	}
+
+	err = lib.WaitPropagation(c, cl)
+	if err != nil {
+		return xerrors.Errorf("waiting for block propagation: %v", err)
+	}
+	if c.Bool("export") {
+		fmt.Println(strings.Join(newIDs, "\n"))
+	}
+	return nil
+}
+
+func getLtsInfo(cl *byzcoin.Client, id byzcoin.InstanceID) (
+	*calypso.LtsInstanceInfo, error) {
+	resp, err := cl.GetProofFromLatest(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get LTS proof: %v", err)
+	}
+	var info calypso.LtsInstanceInfo
+	err = resp.Proof.VerifyAndDecode(cothority.Suite,
+		calypso.ContractLongTermSecretID, &info)
+	if err != nil {
+		return nil, xerrors.Errorf("didn't get an LTS instance: %v", err)
+	}
+	return &info, nil
+}
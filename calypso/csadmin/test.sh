@@ -33,6 +33,10 @@ main(){
     run testContractWrite
     run testContractRead
     run testReencrypt
+    run testAccess
+    run testRevoke
+    run testBlob
+    run testMigrate
     run testDecrypt
     stopTest
 }
@@ -125,6 +129,158 @@ testDkgStart(){
 # - csadmin authorize
 # - csadmin contract write spawn
 # - csadmin contract read spawn
+testRevoke(){
+    rm -f config/*
+    runCoBG 1 2 3
+    runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+    eval $SED
+    [ -z "$BC" ] && exit 1
+
+    # Create a DARC
+    testOK runBA darc add -out_id ./darc_id.txt -out_key ./darc_key.txt -unrestricted
+    ID=`cat ./darc_id.txt`
+    KEY=`cat ./darc_key.txt`
+    testOK runBA darc rule -rule "spawn:longTermSecret" --darc $ID --sign $KEY --identity $KEY
+    testOK runBA darc rule -rule "spawn:calypsoWrite" -darc $ID -sign $KEY -identity $KEY
+    testOK runBA darc rule -rule "spawn:calypsoRead" -darc $ID -sign $KEY -identity $KEY
+
+    # Spawn LTS
+    OUTRES=`runCA0 contract lts spawn --darc "$ID" --sign "$KEY"`
+    LTS_ID=`echo "$OUTRES" | sed -n '2p'` # must be at the second line
+    matchOK $LTS_ID ^[0-9a-f]{64}$
+
+    # Authorize nodes
+    bcID=$( ls config/bc-* | sed -e "s/.*bc-\(.*\).cfg/\1/" )
+    testOK runCA authorize co1/private.toml $bcID
+    testOK runCA authorize co2/private.toml $bcID
+    testOK runCA authorize co3/private.toml $bcID
+
+    runCA0 dkg start --instid "$LTS_ID" -x > key.pub
+    PUB_KEY=`cat key.pub`
+
+    # Spawn write and read
+    runCA0 contract write spawn --darc "$ID" --sign "$KEY" --instid "$LTS_ID"\
+                    --secret "aabbccddeeff0011" --key "$PUB_KEY" -x > writeid.txt
+    WRITE_ID=`cat writeid.txt`
+    OUTRES=`runCA0 contract read spawn --sign $KEY --instid $WRITE_ID`
+    READ_ID=`echo "$OUTRES" | sed -n '2p'` # must be at the second line
+    matchOK $READ_ID ^[0-9a-f]{64}$
+    testOK runCA reencrypt --writeid $WRITE_ID --readid $READ_ID
+
+    # The revocation needs its rule
+    testFail runCA contract write revoke --sign $KEY --instid $WRITE_ID
+    testOK runBA darc rule -rule "invoke:calypsoWrite.revoke" -darc $ID -sign $KEY -identity $KEY
+    testOK runCA contract write revoke --sign $KEY --instid $WRITE_ID
+    testGrep "Revoked: true" runCA0 contract write get --instid $WRITE_ID
+
+    # Neither the existing read nor a new read can be used anymore
+    testFail runCA reencrypt --writeid $WRITE_ID --readid $READ_ID
+    testFail runCA contract read spawn --sign $KEY --instid $WRITE_ID
+}
+
+testBlob(){
+    rm -f config/*
+    runCoBG 1 2 3
+    runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+    eval $SED
+    [ -z "$BC" ] && exit 1
+
+    # Create a DARC
+    testOK runBA darc add -out_id ./darc_id.txt -out_key ./darc_key.txt -unrestricted
+    ID=`cat ./darc_id.txt`
+    KEY=`cat ./darc_key.txt`
+    testOK runBA darc rule -rule "spawn:longTermSecret" --darc $ID --sign $KEY --identity $KEY
+    testOK runBA darc rule -rule "spawn:calypsoWrite" -darc $ID -sign $KEY -identity $KEY
+    testOK runBA darc rule -rule "spawn:calypsoRead" -darc $ID -sign $KEY -identity $KEY
+
+    # Spawn LTS
+    OUTRES=`runCA0 contract lts spawn --darc "$ID" --sign "$KEY"`
+    LTS_ID=`echo "$OUTRES" | sed -n '2p'` # must be at the second line
+    matchOK $LTS_ID ^[0-9a-f]{64}$
+
+    # Authorize nodes
+    bcID=$( ls config/bc-* | sed -e "s/.*bc-\(.*\).cfg/\1/" )
+    testOK runCA authorize co1/private.toml $bcID
+    testOK runCA authorize co2/private.toml $bcID
+    testOK runCA authorize co3/private.toml $bcID
+
+    runCA0 dkg start --instid "$LTS_ID" -x > key.pub
+    PUB_KEY=`cat key.pub`
+
+    # Upload a blob and read it back
+    head -c 3000000 /dev/urandom > blob.in
+    runCA0 blob upload --darc "$ID" --sign "$KEY" --instid "$LTS_ID" \
+                    --key "$PUB_KEY" --file blob.in -x > writeid.txt
+    WRITE_ID=`cat writeid.txt`
+    testGrep "BlobRoot" runCA0 contract write get --instid $WRITE_ID
+    testOK runCA blob download --writeid $WRITE_ID \
+                    --key config/key-$KEY.cfg --out blob.out
+    testOK cmp blob.in blob.out
+
+    # The blob can only be deleted once the write is revoked
+    testFail runCA blob delete --writeid $WRITE_ID --sign $KEY
+    testOK runBA darc rule -rule "invoke:calypsoWrite.revoke" -darc $ID -sign $KEY -identity $KEY
+    testOK runCA contract write revoke --sign $KEY --instid $WRITE_ID
+    testOK runCA blob delete --writeid $WRITE_ID --sign $KEY
+}
+
+testMigrate(){
+    rm -f config/*
+    runCoBG 1 2 3
+    runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+    eval $SED
+    [ -z "$BC" ] && exit 1
+
+    # Create a DARC
+    testOK runBA darc add -out_id ./darc_id.txt -out_key ./darc_key.txt -unrestricted
+    ID=`cat ./darc_id.txt`
+    KEY=`cat ./darc_key.txt`
+    testOK runBA darc rule -rule "spawn:longTermSecret" --darc $ID --sign $KEY --identity $KEY
+    testOK runBA darc rule -rule "spawn:calypsoWrite" -darc $ID -sign $KEY -identity $KEY
+    testOK runBA darc rule -rule "spawn:calypsoRead" -darc $ID -sign $KEY -identity $KEY
+
+    # Spawn two LTS
+    OUTRES=`runCA0 contract lts spawn --darc "$ID" --sign "$KEY"`
+    LTS_ID=`echo "$OUTRES" | sed -n '2p'` # must be at the second line
+    matchOK $LTS_ID ^[0-9a-f]{64}$
+    OUTRES=`runCA0 contract lts spawn --darc "$ID" --sign "$KEY"`
+    NEW_LTS_ID=`echo "$OUTRES" | sed -n '2p'` # must be at the second line
+    matchOK $NEW_LTS_ID ^[0-9a-f]{64}$
+
+    # Authorize nodes
+    bcID=$( ls config/bc-* | sed -e "s/.*bc-\(.*\).cfg/\1/" )
+    testOK runCA authorize co1/private.toml $bcID
+    testOK runCA authorize co2/private.toml $bcID
+    testOK runCA authorize co3/private.toml $bcID
+
+    runCA0 dkg start --instid "$LTS_ID" -x > key.pub
+    PUB_KEY=`cat key.pub`
+    testOK runCA0 dkg start --instid "$NEW_LTS_ID"
+
+    runCA0 contract write spawn --darc "$ID" --sign "$KEY" --instid "$LTS_ID"\
+                    --secret "aabbccddeeff0011" --key "$PUB_KEY" -x > writeid.txt
+    WRITE_ID=`cat writeid.txt`
+
+    # The migration needs its rule
+    testFail runCA lts migrate --sign $KEY --instid $NEW_LTS_ID --writeid $WRITE_ID
+    testOK runBA darc rule -rule "invoke:calypsoWrite.migrate" -darc $ID -sign $KEY -identity $KEY
+    runCA0 lts migrate --sign $KEY --instid $NEW_LTS_ID --writeid $WRITE_ID \
+                    -x > newwriteid.txt
+    NEW_WRITE_ID=`cat newwriteid.txt`
+    matchOK $NEW_WRITE_ID ^[0-9a-f]{64}$
+    testGrep "MigrateTo: $NEW_LTS_ID" runCA0 contract write get --instid $WRITE_ID
+    testGrep "MigratedFrom: $WRITE_ID" runCA0 contract write get --instid $NEW_WRITE_ID
+
+    # The new write is decrypted by the new LTS
+    OUTRES=`runCA0 contract read spawn --sign $KEY --instid $NEW_WRITE_ID`
+    READ_ID=`echo "$OUTRES" | sed -n '2p'` # must be at the second line
+    matchOK $READ_ID ^[0-9a-f]{64}$
+    runCA0 reencrypt --writeid $NEW_WRITE_ID --readid $READ_ID -x > reply.bin
+    OUTRES=`runCA0 decrypt --key config/key-$KEY.cfg < reply.bin`
+    matchOK "$OUTRES" "Key decrypted:
+aabbccddeeff0011"
+}
+
 testReencrypt(){
     rm -f config/*
     runCoBG 1 2 3
@@ -186,6 +342,55 @@ testReencrypt(){
     testOK runCA reencrypt --writeid $WRITE_ID --readid $READ_ID -x
 }
 
+# rely on:
+# - csadmin contract lts spawn
+# - csadmin authorize
+# - csadmin contract write spawn
+# - csadmin contract read spawn
+# - csadmin reencrypt
+testAccess(){
+    rm -f config/*
+    runCoBG 1 2 3
+    runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+    eval $SED
+    [ -z "$BC" ] && exit 1
+
+    testOK runBA darc add -out_id ./darc_id.txt -out_key ./darc_key.txt -unrestricted
+    ID=`cat ./darc_id.txt`
+    KEY=`cat ./darc_key.txt`
+    testOK runBA darc rule -rule "spawn:longTermSecret" --darc $ID --sign $KEY --identity $KEY
+    testOK runBA darc rule -rule "spawn:calypsoWrite" -darc $ID -sign $KEY -identity $KEY
+    testOK runBA darc rule -rule "spawn:calypsoRead" -darc $ID -sign $KEY -identity $KEY
+
+    OUTRES=`runCA0 contract lts spawn --darc "$ID" --sign "$KEY"`
+    LTS_ID=`echo "$OUTRES" | sed -n '2p'`
+    matchOK $LTS_ID ^[0-9a-f]{64}$
+
+    bcID=$( ls config/bc-* | sed -e "s/.*bc-\(.*\).cfg/\1/" )
+    testOK runCA authorize co1/private.toml $bcID
+    testOK runCA authorize co2/private.toml $bcID
+    testOK runCA authorize co3/private.toml $bcID
+
+    runCA0 dkg start --instid "$LTS_ID" -x > key.pub
+    PUB_KEY=`cat key.pub`
+
+    OUTRES=`runCA0 contract write spawn --darc "$ID" --sign "$KEY"\
+                    --instid "$LTS_ID" --secret "aabbccddeeff0011" --key "$PUB_KEY"`
+    WRITE_ID=`echo "$OUTRES" | sed -n '2p'`
+    OUTRES=`runCA0 contract read spawn --sign $KEY --instid $WRITE_ID`
+    READ_ID=`echo "$OUTRES" | sed -n '2p'`
+    matchOK $READ_ID ^[0-9a-f]{64}$
+
+    testFail runCA access
+    testGrep "No access found" runCA access --writeid $WRITE_ID
+
+    testOK runCA reencrypt --writeid $WRITE_ID --readid $READ_ID
+    sleep 2
+    testGrep "Read: $READ_ID" runCA access --writeid $WRITE_ID
+    testGrep "Receipt: valid" runCA access --writeid $WRITE_ID
+    testGrep "Write: $WRITE_ID" runCA access --reader ${KEY#ed25519:}
+}
+
 # rely on:
 # - csadmin contract lts spawn
 # - csadmin authorize
@@ -27,10 +27,27 @@ type storage struct {
 	Rosters map[byzcoin.InstanceID]*onet.Roster
 	Replies map[byzcoin.InstanceID]*CreateLTSReply
 	DKS     map[byzcoin.InstanceID]*dkg.DistKeyShare
+	// Epochs and Refreshes hold the proactive refreshes applied to the
+	// shares since the last DKG.
+	Epochs    map[byzcoin.InstanceID]uint64
+	Refreshes map[byzcoin.InstanceID][]*LTSRefresh
+	// PendingRefresh holds the deal and the vote of this node for the
+	// refresh that is being agreed on.
+	PendingRefresh map[byzcoin.InstanceID]*pendingRefresh
 
 	sync.Mutex
 }
 
+// pendingRefresh is the state of this node in a refresh that has not been
+// applied yet. The deal is kept so that a retry of the refresh gets the same
+// deal, and Vote holds the hash of the deals this node signed, as it must
+// never sign two different sets of deals for the same epoch.
+type pendingRefresh struct {
+	Epoch uint64
+	Deal  *RefreshDeal
+	Vote  []byte
+}
+
 // saves all data.
 func (s *Service) save() error {
 	s.storage.Lock()
@@ -69,6 +86,15 @@ func (s *Service) tryLoad() error {
 		if len(s.storage.DKS) == 0 {
 			s.storage.DKS = make(map[byzcoin.InstanceID]*dkg.DistKeyShare)
 		}
+		if len(s.storage.Epochs) == 0 {
+			s.storage.Epochs = make(map[byzcoin.InstanceID]uint64)
+		}
+		if len(s.storage.Refreshes) == 0 {
+			s.storage.Refreshes = make(map[byzcoin.InstanceID][]*LTSRefresh)
+		}
+		if len(s.storage.PendingRefresh) == 0 {
+			s.storage.PendingRefresh = make(map[byzcoin.InstanceID]*pendingRefresh)
+		}
 		if len(s.storage.AuthorisedByzCoinIDs) == 0 {
 			s.storage.AuthorisedByzCoinIDs = make(map[string]bool)
 		}
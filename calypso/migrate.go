@@ -0,0 +1,491 @@
+package calypso
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// MigrateWrites re-encrypts the secrets of the writes to the new LTS, so
+// that they can be stored in new writes using the new LTS. For every write,
+// the nodes of its LTS first send their shares of the re-encryption, each
+// one blinded with a fresh random secret of the node and proven correct.
+// Then every node verifies the shares and signs the resulting migration,
+// which is accepted by the write contract if it is signed by a threshold of
+// the nodes.
+//
+// This node must be part of the LTS of the writes, and every write must have
+// been allowed to migrate to the new LTS by the 'migrate' command.
+func (s *Service) MigrateWrites(req *MigrateWrites) (*MigrateWritesReply, error) {
+	reply := &MigrateWritesReply{}
+	for i := range req.Writes {
+		m, err := s.migrateWrite(&req.Writes[i], &req.NewLTS)
+		if err != nil {
+			return nil, xerrors.Errorf("migrating write %d: %v", i, err)
+		}
+		reply.Migrations = append(reply.Migrations, *m)
+	}
+	return reply, nil
+}
+
+// migrateWrite collects the shares of the re-encryption of one write and
+// the signatures of the nodes on the migration.
+func (s *Service) migrateWrite(writeProof, ltsProof *byzcoin.Proof) (
+	*WriteMigration, error) {
+	shares, err := s.migrationShares(writeProof, ltsProof)
+	if err != nil {
+		return nil, err
+	}
+	req := &migrationSignRequest{
+		Write:  *writeProof,
+		NewLTS: *ltsProof,
+		Shares: shares,
+	}
+	m, roster, err := s.rewrap(req)
+	if err != nil {
+		return nil, err
+	}
+	req.Signature, err = schnorr.Sign(cothority.Suite, s.getKeyPair().Private,
+		m.Hash())
+	if err != nil {
+		return nil, xerrors.Errorf("signing migration: %v", err)
+	}
+
+	cl := onet.NewClient(cothority.Suite, ServiceName)
+	for _, si := range roster.List {
+		if si.Equal(s.ServerIdentity()) {
+			m.Signatures = append(m.Signatures, req.Signature)
+			continue
+		}
+		var reply migrationSignReply
+		if err := cl.SendProtobuf(si, req, &reply); err != nil {
+			log.Warnf("%v: no migration signature from %v: %v",
+				s.ServerIdentity(), si, err)
+			continue
+		}
+		m.Signatures = append(m.Signatures, reply.Signature)
+	}
+	if err := m.Verify(roster); err != nil {
+		return nil, xerrors.Errorf("verifying migration: %v", err)
+	}
+	log.Lvlf2("%v migrated write %x to LTS %x", s.ServerIdentity(),
+		m.Write.Slice(), m.LTSID.Slice())
+	return m, nil
+}
+
+// migrationShares asks the nodes of the LTS of the write for their shares of
+// the migration to the new LTS. It fails if less than a threshold of the
+// nodes reply.
+func (s *Service) migrationShares(writeProof, ltsProof *byzcoin.Proof) (
+	[]MigrationShare, error) {
+	write, _, _, err := s.verifyMigration(writeProof, ltsProof)
+	if err != nil {
+		return nil, err
+	}
+	s.storage.Lock()
+	roster := s.storage.Rosters[write.LTSID]
+	s.storage.Unlock()
+	n := len(roster.List)
+	threshold := n - (n-1)/3
+
+	req := &migrationShareRequest{Write: *writeProof, NewLTS: *ltsProof}
+	cl := onet.NewClient(cothority.Suite, ServiceName)
+	var shares []MigrationShare
+	for _, si := range roster.List {
+		var reply *migrationShareReply
+		if si.Equal(s.ServerIdentity()) {
+			reply, err = s.migrationShare(req)
+		} else {
+			reply = &migrationShareReply{}
+			err = cl.SendProtobuf(si, req, reply)
+		}
+		if err != nil {
+			log.Warnf("%v: no migration share from %v: %v",
+				s.ServerIdentity(), si, err)
+			continue
+		}
+		shares = append(shares, reply.Share)
+	}
+	if len(shares) < threshold {
+		return nil, xerrors.Errorf("got %d migration shares, need %d",
+			len(shares), threshold)
+	}
+	return shares, nil
+}
+
+// migrationShare returns the share of this node of the migration of a write
+// to a new LTS, blinded with a fresh random secret, together with the proof
+// that it has been created from the share of this node of the old LTS.
+func (s *Service) migrationShare(req *migrationShareRequest) (
+	*migrationShareReply, error) {
+	write, _, newX, err := s.verifyMigration(&req.Write, &req.NewLTS)
+	if err != nil {
+		return nil, err
+	}
+	s.storage.Lock()
+	shared := s.storage.Shared[write.LTSID]
+	xi := shared.V.Clone()
+	index := shared.Index
+	s.storage.Unlock()
+
+	suite := cothority.Suite
+	si := suite.Scalar().Pick(suite.RandomStream())
+	sh := MigrationShare{
+		Index: index,
+		V: suite.Point().Sub(suite.Point().Mul(xi, write.U),
+			suite.Point().Mul(si, newX)),
+		S: suite.Point().Mul(si, nil),
+	}
+
+	// Calculating proofs
+	wx := suite.Scalar().Pick(suite.RandomStream())
+	ws := suite.Scalar().Pick(suite.RandomStream())
+	sh.Challenge = migrationChallenge(write.U, newX, suite.Point().Mul(xi, nil),
+		&sh, suite.Point().Mul(wx, nil), suite.Point().Mul(ws, nil),
+		suite.Point().Sub(suite.Point().Mul(wx, write.U),
+			suite.Point().Mul(ws, newX)))
+	sh.Zx = suite.Scalar().Add(wx, suite.Scalar().Mul(sh.Challenge, xi))
+	sh.Zs = suite.Scalar().Add(ws, suite.Scalar().Mul(sh.Challenge, si))
+	return &migrationShareReply{Share: sh}, nil
+}
+
+// Verify checks that the share has been created from U and the public key
+// newX of the new LTS using the private share corresponding to the public
+// share Xi of the node.
+func (sh MigrationShare) Verify(U, newX, Xi kyber.Point) error {
+	if sh.V == nil || sh.S == nil || sh.Challenge == nil || sh.Zx == nil ||
+		sh.Zs == nil {
+		return xerrors.New("incomplete share")
+	}
+	suite := cothority.Suite
+	negC := suite.Scalar().Neg(sh.Challenge)
+	A1 := suite.Point().Add(suite.Point().Mul(sh.Zx, nil),
+		suite.Point().Mul(negC, Xi))
+	A2 := suite.Point().Add(suite.Point().Mul(sh.Zs, nil),
+		suite.Point().Mul(negC, sh.S))
+	A3 := suite.Point().Sub(suite.Point().Mul(sh.Zx, U),
+		suite.Point().Mul(sh.Zs, newX))
+	A3.Add(A3, suite.Point().Mul(negC, sh.V))
+	c := migrationChallenge(U, newX, Xi, &sh, A1, A2, A3)
+	if !c.Equal(sh.Challenge) {
+		return xerrors.New("invalid proof of the share")
+	}
+	return nil
+}
+
+// migrationChallenge returns the challenge of the proof of a migration
+// share.
+func migrationChallenge(U, newX, Xi kyber.Point, sh *MigrationShare,
+	A1, A2, A3 kyber.Point) kyber.Scalar {
+	hash := sha256.New()
+	hash.Write([]byte("calypso migration share"))
+	binary.Write(hash, binary.LittleEndian, int64(sh.Index))
+	for _, p := range []kyber.Point{U, newX, Xi, sh.V, sh.S, A1, A2, A3} {
+		p.MarshalTo(hash)
+	}
+	return cothority.Suite.Scalar().SetBytes(hash.Sum(nil))
+}
+
+// migrationSign verifies the re-encryption of a write to a new LTS and
+// returns the signature of this node on the migration. The request must be
+// signed by a node of the old LTS.
+func (s *Service) migrationSign(req *migrationSignRequest) (*migrationSignReply, error) {
+	m, roster, err := s.rewrap(req)
+	if err != nil {
+		return nil, err
+	}
+	signed := false
+	for _, si := range roster.List {
+		if schnorr.Verify(cothority.Suite, si.ServicePublic(ServiceName),
+			m.Hash(), req.Signature) == nil {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return nil, xerrors.New("the request is not signed by a node of the LTS")
+	}
+	sig, err := schnorr.Sign(cothority.Suite, s.getKeyPair().Private, m.Hash())
+	if err != nil {
+		return nil, xerrors.Errorf("signing migration: %v", err)
+	}
+	return &migrationSignReply{Signature: sig}, nil
+}
+
+// rewrap verifies the shares of the request and returns the migration of
+// the write, without signatures. With x the private key of the old LTS, X'
+// the public key of the new LTS, and s the secret interpolated from the
+// random secrets of the nodes, the shares recover:
+//
+//	V = x*U - s*X'
+//	S = s*G
+//
+// and the secret is re-encrypted as U' = S and C' = C - V, so that
+// C' - x'*U' = C - x*U. As s is fresh for every migration and no node knows
+// it, V doesn't reveal anything about the secret. It also returns the roster
+// of the old LTS.
+func (s *Service) rewrap(req *migrationSignRequest) (*WriteMigration,
+	*onet.Roster, error) {
+	write, ltsID, newX, err := s.verifyMigration(&req.Write, &req.NewLTS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.storage.Lock()
+	pp := s.storage.Polys[write.LTSID]
+	var commits []kyber.Point
+	for _, c := range pp.Commits {
+		commits = append(commits, c.Clone())
+	}
+	poly := share.NewPubPoly(cothority.Suite, pp.B.Clone(), commits)
+	roster := s.storage.Rosters[write.LTSID]
+	n := len(roster.List)
+	s.storage.Unlock()
+	threshold := n - (n-1)/3
+
+	// Both shares of a node are kept or dropped together, so that V and S
+	// are interpolated over the same nodes.
+	vs := make([]*share.PubShare, n)
+	ss := make([]*share.PubShare, n)
+	for _, sh := range req.Shares {
+		if sh.Index < 0 || sh.Index >= n || vs[sh.Index] != nil {
+			continue
+		}
+		err := sh.Verify(write.U, newX, poly.Eval(sh.Index).V)
+		if err != nil {
+			log.Lvl2(s.ServerIdentity(), "invalid share of node", sh.Index,
+				":", err)
+			continue
+		}
+		vs[sh.Index] = &share.PubShare{I: sh.Index, V: sh.V}
+		ss[sh.Index] = &share.PubShare{I: sh.Index, V: sh.S}
+	}
+	V, err := share.RecoverCommit(cothority.Suite, vs, threshold, n)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to recover commit: %v", err)
+	}
+	S, err := share.RecoverCommit(cothority.Suite, ss, threshold, n)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to recover commit: %v", err)
+	}
+
+	return &WriteMigration{
+		Write:     byzcoin.NewInstanceID(req.Write.InclusionProof.Key()),
+		LTSID:     ltsID,
+		U:         S,
+		C:         cothority.Suite.Point().Sub(write.C, V),
+		KeyCipher: write.KeyCipher,
+	}, roster, nil
+}
+
+// verifyMigration checks the proofs of the write and of the new LTS, and
+// that the latest version of the write allows the migration to the new LTS.
+// It returns the latest write together with the ID and the public key of the
+// new LTS.
+func (s *Service) verifyMigration(writeProof, ltsProof *byzcoin.Proof) (
+	*Write, byzcoin.InstanceID, kyber.Point, error) {
+	var ltsID byzcoin.InstanceID
+	if err := s.verifyProof(writeProof); err != nil {
+		return nil, ltsID, nil, xerrors.Errorf(
+			"write proof cannot be verified to come from scID: %v", err)
+	}
+	if err := s.verifyProof(ltsProof); err != nil {
+		return nil, ltsID, nil, xerrors.Errorf(
+			"LTS proof cannot be verified to come from scID: %v", err)
+	}
+	var info LtsInstanceInfo
+	err := ltsProof.VerifyAndDecode(cothority.Suite, ContractLongTermSecretID,
+		&info)
+	if err != nil {
+		return nil, ltsID, nil, xerrors.Errorf("didn't get an LTS instance: %v",
+			err)
+	}
+	ltsID = byzcoin.NewInstanceID(ltsProof.InclusionProof.Key())
+
+	write, err := s.latestWrite(writeProof,
+		byzcoin.NewInstanceID(writeProof.InclusionProof.Key()))
+	if err != nil {
+		return nil, ltsID, nil, xerrors.Errorf("getting latest write: %v", err)
+	}
+	if write.MigrateTo == nil || !write.MigrateTo.Equal(ltsID) {
+		return nil, ltsID, nil, xerrors.New("the write is not allowed to " +
+			"migrate to this LTS")
+	}
+	if write.MigratedTo != nil {
+		return nil, ltsID, nil, xerrors.New("the write has already been " +
+			"migrated")
+	}
+	if err := write.CheckValidity(time.Now().Unix()); err != nil {
+		return nil, ltsID, nil, err
+	}
+	s.storage.Lock()
+	_, ok := s.storage.Shared[write.LTSID]
+	s.storage.Unlock()
+	if !ok {
+		return nil, ltsID, nil,
+			xerrors.Errorf("don't know the LTSID '%v' stored in write",
+				write.LTSID)
+	}
+
+	X, err := s.getLTSKey(&info, ltsID)
+	if err != nil {
+		return nil, ltsID, nil, err
+	}
+	return write, ltsID, X, nil
+}
+
+// getLTSKey returns the public key of the LTS. If this node is not part of
+// the LTS, it asks the nodes of the LTS, and a threshold of them must reply
+// with the same key.
+func (s *Service) getLTSKey(info *LtsInstanceInfo, id byzcoin.InstanceID) (
+	kyber.Point, error) {
+	s.storage.Lock()
+	reply, ok := s.storage.Replies[id]
+	if ok {
+		X := reply.X.Clone()
+		s.storage.Unlock()
+		return X, nil
+	}
+	s.storage.Unlock()
+
+	n := len(info.Roster.List)
+	threshold := n - (n-1)/3
+	cl := onet.NewClient(cothority.Suite, ServiceName)
+	votes := make(map[string]int)
+	for _, si := range info.Roster.List {
+		var r CreateLTSReply
+		err := cl.SendProtobuf(si, &GetLTSReply{LTSID: id}, &r)
+		if err != nil {
+			log.Warnf("%v: couldn't get the LTS key from %v: %v",
+				s.ServerIdentity(), si, err)
+			continue
+		}
+		votes[r.X.String()]++
+		if votes[r.X.String()] >= threshold {
+			return r.X, nil
+		}
+	}
+	return nil, xerrors.New("didn't get the same LTS key from a threshold of " +
+		"its nodes")
+}
+
+// Hash returns the message signed by the nodes of the old LTS.
+func (m WriteMigration) Hash() []byte {
+	h := sha256.New()
+	h.Write([]byte("calypso migration"))
+	h.Write(m.Write.Slice())
+	h.Write(m.LTSID.Slice())
+	m.U.MarshalTo(h)
+	m.C.MarshalTo(h)
+	h.Write(m.KeyCipher)
+	return h.Sum(nil)
+}
+
+// Verify checks that the migration has been signed by a threshold of the
+// nodes in the roster of the old LTS.
+func (m WriteMigration) Verify(roster *onet.Roster) error {
+	return verifyLTSSignatures(roster, m.Hash(), m.Signatures)
+}
+
+// Migrate returns the write holding the secret of w re-encrypted to the new
+// LTS of the migration. It has to be spawned with the same darc as w.
+func (w Write) Migrate(m WriteMigration) *Write {
+	return &Write{
+		Data:         w.Data,
+		U:            m.U,
+		Ubar:         cothority.Suite.Point().Null(),
+		E:            cothority.Suite.Scalar().Zero(),
+		F:            cothority.Suite.Scalar().Zero(),
+		C:            m.C,
+		ExtraData:    w.ExtraData,
+		LTSID:        m.LTSID,
+		Cost:         w.Cost,
+		KeyCipher:    m.KeyCipher,
+		Expiry:       w.Expiry,
+		ReadValidity: w.ReadValidity,
+		BlobRoot:     w.BlobRoot,
+		Beneficiary:  w.Beneficiary,
+		ReadPolicy:   w.ReadPolicy,
+		PolicyIssuer: w.PolicyIssuer,
+		Migration:    &m,
+	}
+}
+
+// checkMigration verifies that the write holds the secret of a previous
+// write, re-encrypted by the LTS of the previous write to the LTS of this
+// write, and returns the previous write. To keep the access rules, the write
+// must be spawned with the darc of the previous write and have the same
+// cost, expiry and read policy. It must also have the same data, and a
+// previous write can only be migrated once.
+func (w Write) checkMigration(rst byzcoin.ReadOnlyStateTrie,
+	darcID darc.ID) (*Write, error) {
+	m := w.Migration
+	if !m.LTSID.Equal(w.LTSID) || m.U == nil || !m.U.Equal(w.U) ||
+		m.C == nil || !m.C.Equal(w.C) || !bytes.Equal(m.KeyCipher, w.KeyCipher) {
+		return nil, xerrors.New("the write doesn't match its migration")
+	}
+
+	v, _, cid, prevDarcID, err := rst.GetValues(m.Write.Slice())
+	if err == nil && cid != ContractWriteID {
+		err = xerrors.New("not a write instance")
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("getting previous write: %v", err)
+	}
+	var prev Write
+	err = protobuf.DecodeWithConstructors(v, &prev,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("decoding previous write: %v", err)
+	}
+	if prev.Revoked {
+		return nil, xerrors.New("the previous write has been revoked")
+	}
+	if prev.MigratedTo != nil {
+		return nil, xerrors.New("the previous write has already been migrated")
+	}
+	if prev.MigrateTo == nil || !prev.MigrateTo.Equal(w.LTSID) {
+		return nil, xerrors.New("the previous write is not allowed to migrate " +
+			"to this LTS")
+	}
+	if !prevDarcID.Equal(darcID) {
+		return nil, xerrors.New("the write must use the darc of the previous write")
+	}
+	if w.Cost != prev.Cost || w.Expiry != prev.Expiry ||
+		w.ReadValidity != prev.ReadValidity ||
+		w.ReadPolicy != prev.ReadPolicy ||
+		w.PolicyIssuer != prev.PolicyIssuer ||
+		(w.Beneficiary == nil) != (prev.Beneficiary == nil) ||
+		(w.Beneficiary != nil && !w.Beneficiary.Equal(*prev.Beneficiary)) {
+		return nil, xerrors.New("the write must keep the access rules of the " +
+			"previous write")
+	}
+	if !bytes.Equal(w.Data, prev.Data) ||
+		!bytes.Equal(w.ExtraData, prev.ExtraData) ||
+		!bytes.Equal(w.BlobRoot, prev.BlobRoot) {
+		return nil, xerrors.New("the write must keep the data of the " +
+			"previous write")
+	}
+
+	info, err := getLtsInstance(rst, prev.LTSID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Verify(&info.Roster); err != nil {
+		return nil, xerrors.Errorf("verifying migration: %v", err)
+	}
+	return &prev, nil
+}
@@ -0,0 +1,263 @@
+package calypso
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractPriceListID denotes a contract holding the priced writes spawned
+// with a darc. The price lists are created and updated by the write contract
+// when a write with a Cost is spawned or revoked.
+const ContractPriceListID = "calypsoPriceList"
+
+type contractPriceList struct {
+	byzcoin.BasicContract
+	PriceList
+}
+
+func contractPriceListFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractPriceList{}
+	err := protobuf.Decode(in, &c.PriceList)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+// PriceListID returns the ID of the instance holding the priced writes of
+// the darc.
+func PriceListID(darcID darc.ID) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte("calypso price list"))
+	h.Write(darcID)
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// checkBeneficiary makes sure that a write with a Cost has a beneficiary coin
+// instance of the same name as the Cost.
+func (w Write) checkBeneficiary(rst byzcoin.ReadOnlyStateTrie) error {
+	if w.Cost.Value == 0 {
+		return nil
+	}
+	if w.Beneficiary == nil {
+		return xerrors.New("a write with a cost needs a beneficiary")
+	}
+	coin, _, err := getCoin(rst, *w.Beneficiary)
+	if err != nil {
+		return xerrors.Errorf("getting beneficiary: %v", err)
+	}
+	if !coin.Name.Equal(w.Cost.Name) {
+		return xerrors.New("the beneficiary doesn't hold the coins of the cost")
+	}
+	return nil
+}
+
+// verifyPayer makes sure that the signers of the read-request are allowed to
+// fetch coins from the coin instance in the 'payer' argument, if it is given,
+// as the read-request takes the Cost out of it.
+func verifyPayer(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction,
+	ctxHash []byte) error {
+	payerID, err := payerArg(inst)
+	if err != nil {
+		return err
+	}
+	_, pDarcID, err := getCoin(rst, payerID)
+	if err != nil {
+		return xerrors.Errorf("getting payer: %v", err)
+	}
+	d, err := rst.LoadDarc(pDarcID)
+	if err != nil {
+		return xerrors.Errorf("getting darc of payer: %v", err)
+	}
+	action := darc.Action("invoke:" + contracts.ContractCoinID + ".fetch")
+	if !d.Rules.Contains(action) {
+		return xerrors.Errorf("action '%v' does not exist", action)
+	}
+
+	var ids []string
+	for i := range inst.Signatures {
+		if err := inst.SignerIdentities[i].Verify(ctxHash, inst.Signatures[i]); err == nil {
+			ids = append(ids, inst.SignerIdentities[i].String())
+		}
+	}
+	getDarc := func(str string, latest bool) *darc.Darc {
+		if len(str) < 5 || string(str[0:5]) != "darc:" {
+			return nil
+		}
+		darcID, err := hex.DecodeString(str[5:])
+		if err != nil {
+			return nil
+		}
+		d, err := rst.LoadDarc(darcID)
+		if err != nil {
+			return nil
+		}
+		return d
+	}
+	err = darc.EvalExpr(d.Rules.Get(action), getDarc, ids...)
+	return cothority.ErrorOrNil(err, "the signers cannot fetch coins from the payer")
+}
+
+func payerArg(inst byzcoin.Instruction) (byzcoin.InstanceID, error) {
+	payer := inst.Spawn.Args.Search("payer")
+	if len(payer) != len(byzcoin.InstanceID{}) {
+		return byzcoin.InstanceID{}, xerrors.New("need the coin instance of " +
+			"the reader in the 'payer' argument")
+	}
+	return byzcoin.NewInstanceID(payer), nil
+}
+
+// payRead takes the Cost of the write from the reader and credits it to the
+// beneficiary in the same state changes, so that the writer is paid as soon
+// as the read exists. The coins are taken out of the coin instance in the
+// 'payer' argument, which has been checked in VerifyInstruction, or else out
+// of the coins fetched by a previous instruction of the transaction, which
+// are updated in place. Writes spawned before the beneficiary existed only
+// burn the coins.
+func (c *ContractWrite) payRead(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, error) {
+	var sc []byzcoin.StateChange
+	if inst.Spawn.Args.Search("payer") != nil {
+		payerID, err := payerArg(inst)
+		if err != nil {
+			return nil, err
+		}
+		if c.Beneficiary != nil && c.Beneficiary.Equal(payerID) {
+			return nil, nil
+		}
+		payer, pDarcID, err := getCoin(rst, payerID)
+		if err != nil {
+			return nil, xerrors.Errorf("getting payer: %v", err)
+		}
+		if !payer.Name.Equal(c.Cost.Name) {
+			return nil, xerrors.New("the payer doesn't hold the coins of the cost")
+		}
+		if err := payer.SafeSub(c.Cost.Value); err != nil {
+			return nil, xerrors.Errorf("missing coins to pay for the read "+
+				"request: %v", err)
+		}
+		pBuf, err := protobuf.Encode(payer)
+		if err != nil {
+			return nil, xerrors.Errorf("encoding payer: %v", err)
+		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, payerID,
+			contracts.ContractCoinID, pBuf, pDarcID))
+	} else {
+		paid := false
+		for i, coin := range coins {
+			if coin.Name.Equal(c.Cost.Name) {
+				if err := coin.SafeSub(c.Cost.Value); err != nil {
+					return nil, xerrors.Errorf("missing coins to pay for "+
+						"the read request: %v", err)
+				}
+				coins[i] = coin
+				paid = true
+				break
+			}
+		}
+		if !paid {
+			return nil, xerrors.New("need the coins of the cost, from the " +
+				"'payer' argument or from a previous instruction")
+		}
+	}
+
+	if c.Beneficiary == nil {
+		return sc, nil
+	}
+	beneficiary, bDarcID, err := getCoin(rst, *c.Beneficiary)
+	if err != nil {
+		return nil, xerrors.Errorf("getting beneficiary: %v", err)
+	}
+	if err := beneficiary.SafeAdd(c.Cost.Value); err != nil {
+		return nil, xerrors.Errorf("crediting beneficiary: %v", err)
+	}
+	bBuf, err := protobuf.Encode(beneficiary)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding beneficiary: %v", err)
+	}
+	return append(sc, byzcoin.NewStateChange(byzcoin.Update, *c.Beneficiary,
+		contracts.ContractCoinID, bBuf, bDarcID)), nil
+}
+
+// updatePriceList removes the write from the price list of the darc and, if
+// cost is not nil, adds it again with this cost. It returns nil if the price
+// list doesn't change.
+func updatePriceList(rst byzcoin.ReadOnlyStateTrie, darcID darc.ID,
+	writeID byzcoin.InstanceID, cost *byzcoin.Coin) (*byzcoin.StateChange, error) {
+	id := PriceListID(darcID)
+	var list PriceList
+	action := byzcoin.Create
+	ok, err := instanceExists(rst, id)
+	if err != nil {
+		return nil, xerrors.Errorf("checking price list: %v", err)
+	}
+	if ok {
+		action = byzcoin.Update
+		v, _, cid, _, err := rst.GetValues(id.Slice())
+		if err == nil && cid != ContractPriceListID {
+			err = xerrors.New("not a price list")
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("getting price list: %v", err)
+		}
+		err = protobuf.Decode(v, &list)
+		if err != nil {
+			return nil, xerrors.Errorf("decoding price list: %v", err)
+		}
+	} else if cost == nil {
+		return nil, nil
+	}
+
+	writes := list.Writes[:0]
+	for _, w := range list.Writes {
+		if !w.Write.Equal(writeID) {
+			writes = append(writes, w)
+		}
+	}
+	if cost == nil && len(writes) == len(list.Writes) {
+		return nil, nil
+	}
+	list.Writes = writes
+	if cost != nil {
+		list.Writes = append(list.Writes, PricedWrite{Write: writeID,
+			Cost: *cost})
+	}
+	buf, err := protobuf.Encode(&list)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding price list: %v", err)
+	}
+	sc := byzcoin.NewStateChange(action, id, ContractPriceListID, buf, darcID)
+	return &sc, nil
+}
+
+func instanceExists(rst byzcoin.ReadOnlyStateTrie, id byzcoin.InstanceID) (bool, error) {
+	prf, err := rst.GetProof(id.Slice())
+	if err != nil {
+		return false, err
+	}
+	return prf.Exists(id.Slice())
+}
+
+func getCoin(rst byzcoin.ReadOnlyStateTrie, id byzcoin.InstanceID) (
+	*byzcoin.Coin, darc.ID, error) {
+	v, _, cid, did, err := rst.GetValues(id.Slice())
+	if err == nil && cid != contracts.ContractCoinID {
+		err = xerrors.New("not a coin instance")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var coin byzcoin.Coin
+	err = protobuf.Decode(v, &coin)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("decoding coin: %v", err)
+	}
+	return &coin, did, nil
+}
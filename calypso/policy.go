@@ -0,0 +1,280 @@
+package calypso
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/xerrors"
+)
+
+// ReadPolicy is a parsed attribute-based read policy of a write. A policy
+// compares the attributes of the reader with constants, and combines the
+// comparisons with AND, OR, NOT and parentheses, e.g.:
+//
+//	department=research AND (clearance>=2 OR role="team lead")
+//
+// The operators are =, !=, <, <=, > and >=. If both sides of a comparison are
+// integers, they are compared as numbers, else as strings. Attributes that
+// the reader doesn't have never match.
+type ReadPolicy struct {
+	root policyNode
+}
+
+// ParseReadPolicy returns the policy described by s, or an error if s is not
+// a valid policy.
+func ParseReadPolicy(s string) (*ReadPolicy, error) {
+	tokens, err := tokenizePolicy(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &policyParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, xerrors.Errorf("unexpected '%s' in policy", p.tokens[p.pos])
+	}
+	return &ReadPolicy{root: root}, nil
+}
+
+// Eval returns nil if the attributes fulfill the policy, else an error
+// describing the first comparison that failed.
+func (p *ReadPolicy) Eval(attrs map[string]string) error {
+	return p.root.eval(attrs)
+}
+
+type policyNode interface {
+	eval(attrs map[string]string) error
+}
+
+type policyAnd []policyNode
+
+func (n policyAnd) eval(attrs map[string]string) error {
+	for _, c := range n {
+		if err := c.eval(attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type policyOr []policyNode
+
+func (n policyOr) eval(attrs map[string]string) error {
+	var err error
+	for _, c := range n {
+		if err = c.eval(attrs); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+type policyNot struct {
+	node policyNode
+}
+
+func (n policyNot) eval(attrs map[string]string) error {
+	if n.node.eval(attrs) == nil {
+		return xerrors.New("negated condition of the policy is true")
+	}
+	return nil
+}
+
+type policyCmp struct {
+	attr, op, value string
+}
+
+func (n policyCmp) eval(attrs map[string]string) error {
+	v, ok := attrs[n.attr]
+	if !ok {
+		return xerrors.Errorf("missing attribute '%s'", n.attr)
+	}
+	var cmp int
+	a, errA := strconv.ParseInt(v, 10, 64)
+	b, errB := strconv.ParseInt(n.value, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	case n.op == "=" || n.op == "!=":
+		cmp = strings.Compare(v, n.value)
+	default:
+		return xerrors.Errorf("attribute '%s' is not a number", n.attr)
+	}
+
+	var match bool
+	switch n.op {
+	case "=":
+		match = cmp == 0
+	case "!=":
+		match = cmp != 0
+	case "<":
+		match = cmp < 0
+	case "<=":
+		match = cmp <= 0
+	case ">":
+		match = cmp > 0
+	case ">=":
+		match = cmp >= 0
+	}
+	if !match {
+		return xerrors.Errorf("attribute '%s' doesn't match %s%s", n.attr,
+			n.op, n.value)
+	}
+	return nil
+}
+
+type policyParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *policyParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *policyParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *policyParser) parseOr() (policyNode, error) {
+	var or policyOr
+	for {
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, n)
+		if t := p.peek(); !strings.EqualFold(t, "OR") && t != "||" {
+			break
+		}
+		p.next()
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *policyParser) parseAnd() (policyNode, error) {
+	var and policyAnd
+	for {
+		n, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, n)
+		if t := p.peek(); !strings.EqualFold(t, "AND") && t != "&&" {
+			break
+		}
+		p.next()
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *policyParser) parseFactor() (policyNode, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, xerrors.New("unexpected end of policy")
+	case strings.EqualFold(t, "NOT") || t == "!":
+		n, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return policyNot{n}, nil
+	case t == "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, xerrors.New("missing ')' in policy")
+		}
+		return n, nil
+	case !isPolicyName(t):
+		return nil, xerrors.Errorf("expected an attribute, got '%s'", t)
+	}
+	op := p.next()
+	switch op {
+	case "=", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, xerrors.Errorf("expected an operator after '%s'", t)
+	}
+	value := p.next()
+	if strings.HasPrefix(value, `"`) {
+		value = value[1 : len(value)-1]
+	} else if !isPolicyName(value) {
+		return nil, xerrors.Errorf("expected a value after '%s%s'", t, op)
+	}
+	return policyCmp{attr: t, op: op, value: value}, nil
+}
+
+func isPolicyName(t string) bool {
+	for _, r := range t {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("._-", r) {
+			return false
+		}
+	}
+	return t != "" && !strings.EqualFold(t, "AND") &&
+		!strings.EqualFold(t, "OR") && !strings.EqualFold(t, "NOT")
+}
+
+// tokenizePolicy splits the policy in names, quoted strings, operators and
+// parentheses.
+func tokenizePolicy(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, xerrors.New("unterminated string in policy")
+			}
+			tokens = append(tokens, s[i:i+end+2])
+			i += end + 2
+		case strings.IndexByte("=!<>&|", c) >= 0:
+			j := i + 1
+			for j < len(s) && strings.IndexByte("=&|", s[j]) >= 0 && j-i < 2 {
+				j++
+			}
+			op := s[i:j]
+			switch op {
+			case "=", "!=", "<", "<=", ">", ">=", "&&", "||", "!":
+			default:
+				return nil, xerrors.Errorf("unknown operator '%s' in policy", op)
+			}
+			tokens = append(tokens, op)
+			i = j
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t\n()\"=!<>&|", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
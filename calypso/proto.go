@@ -2,6 +2,7 @@ package calypso
 
 import (
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/onet/v3"
@@ -11,6 +12,7 @@ import (
 // type :skipchain.SkipBlockID:bytes
 // package calypso;
 // import "byzcoin.proto";
+// import "darc.proto";
 // import "onet.proto";
 //
 // option java_package = "ch.epfl.dedis.lib.proto";
@@ -47,6 +49,43 @@ type Write struct {
 	LTSID byzcoin.InstanceID
 	// Cost reflects how many coins you'll have to pay for a read-request
 	Cost byzcoin.Coin `protobuf:"opt"`
+	// KeyCipher holds the symmetric key material if it is too long to be
+	// embedded in C. It is then encrypted with a key derived from the random
+	// point stored in C.
+	KeyCipher []byte `protobuf:"opt"`
+	// Revoked is set by the 'revoke' command. Once revoked, the secret
+	// cannot be read anymore.
+	Revoked bool `protobuf:"opt"`
+	// Expiry is the unix time in seconds after which the secret cannot be
+	// read anymore. If it is 0, the write never expires.
+	Expiry int64 `protobuf:"opt"`
+	// ReadValidity is the number of seconds a read instance can be used
+	// after it has been created. If it is 0, reads are valid until the write
+	// expires.
+	ReadValidity int64 `protobuf:"opt"`
+	// BlobRoot is the Merkle root of the chunks of an encrypted blob stored
+	// off-chain on the nodes of the LTS, if the data is too big for Data.
+	BlobRoot []byte `protobuf:"opt"`
+	// Beneficiary is the coin instance of the writer that is credited with
+	// the Cost of every read-request. It is required if Cost is not 0.
+	Beneficiary *byzcoin.InstanceID `protobuf:"opt"`
+	// ReadPolicy is an attribute-based policy the reader must fulfill, as
+	// described in ParseReadPolicy. It is only enforced if the darc of the
+	// write has an attr-rule for spawn:calypsoRead that evaluates it, like
+	// the "credential" interpreter of personhood.
+	ReadPolicy string `protobuf:"opt"`
+	// PolicyIssuer is the identity that must control and sign the attributes
+	// of the reader for the ReadPolicy. It is required if ReadPolicy is set.
+	PolicyIssuer string `protobuf:"opt"`
+	// MigrateTo is set by the 'migrate' command to the LTS the secret may be
+	// re-encrypted to by the LTS of this write.
+	MigrateTo *byzcoin.InstanceID `protobuf:"opt"`
+	// Migration is set if the secret has been re-encrypted from a previous
+	// write. It replaces the proof in Ubar, E and F.
+	Migration *WriteMigration `protobuf:"opt"`
+	// MigratedTo is set to the new write once the secret has been migrated,
+	// so that the write cannot be migrated a second time.
+	MigratedTo *byzcoin.InstanceID `protobuf:"opt"`
 }
 
 // Read is the data stored in a read instance. It has a pointer to the write
@@ -54,6 +93,13 @@ type Write struct {
 type Read struct {
 	Write byzcoin.InstanceID
 	Xc    kyber.Point
+	// NotBefore is the unix time in seconds before which the read cannot be
+	// used. If it is 0, the read is valid immediately.
+	NotBefore int64 `protobuf:"opt"`
+	// NotAfter is the unix time in seconds after which the read cannot be
+	// used anymore. If it is 0, the read doesn't expire. It is set by the
+	// write contract according to the Expiry and ReadValidity of the write.
+	NotAfter int64 `protobuf:"opt"`
 }
 
 // ***
@@ -112,6 +158,24 @@ type ReshareLTS struct {
 type ReshareLTSReply struct {
 }
 
+// RefreshLTS is used to proactively refresh the LTS shares with the same
+// roster. Prior to using this request, the epoch must be increased on the
+// ByzCoin blockchain in the instance specified by InstanceID.
+type RefreshLTS struct {
+	Proof byzcoin.Proof
+}
+
+// RefreshLTSReply is returned upon successful refresh. The LTSID and the
+// public key X remain the same.
+type RefreshLTSReply struct {
+	Epoch uint64
+	// Dealers are the indexes of the nodes whose deals have been used.
+	Dealers []int
+	// Offline are the indexes of the nodes that didn't apply the refresh.
+	// They catch up during the next refresh.
+	Offline []int
+}
+
 // Message used to update the set of valid peers.
 type updateValidPeers struct {
 	Proof byzcoin.Proof
@@ -121,6 +185,19 @@ type updateValidPeers struct {
 type updateValidPeersReply struct {
 }
 
+// Message used by a node that missed a refresh to get its deals. It is
+// signed by the service key of a node of the LTS.
+type refreshFetch struct {
+	LTSID     byzcoin.InstanceID
+	Epoch     uint64
+	Signature []byte
+}
+
+// Message returned with the deals of a past refresh.
+type refreshFetchReply struct {
+	Refresh LTSRefresh
+}
+
 // DecryptKey is sent by a reader after he successfully stored a 'Read' request
 // in byzcoin Client.
 type DecryptKey struct {
@@ -139,6 +216,176 @@ type DecryptKeyReply struct {
 	XhatEnc kyber.Point
 	// X is the aggregate public key of the LTS used.
 	X kyber.Point
+	// KeyCipher is copied from the write instance and holds the encrypted
+	// key material if it didn't fit in C.
+	KeyCipher []byte `protobuf:"opt"`
+}
+
+// DecryptKeyShares is sent by a reader who wants the verifiable decryption
+// shares of the secret instead of a re-encryption. The shares are
+// re-encrypted to an ephemeral key chosen by the reader. The request must be
+// signed by the private key corresponding to Xc in the Read-instance.
+type DecryptKeyShares struct {
+	// Read is the proof that he has been accepted to read the secret.
+	Read byzcoin.Proof
+	// Write is the proof containing the write request.
+	Write byzcoin.Proof
+	// Ephemeral is the public key the shares are re-encrypted to.
+	Ephemeral kyber.Point
+	// Timestamp is the unix time in seconds when the request has been
+	// signed. It must be within one minute of the time of the nodes.
+	Timestamp int64
+	// Signature is the schnorr signature of the reader on the ID of the read
+	// instance, the ephemeral key and the timestamp.
+	Signature []byte
+}
+
+// DecryptKeySharesReply holds the decryption shares of the secret,
+// re-encrypted to the ephemeral key, together with the proofs that they have
+// been created correctly.
+type DecryptKeySharesReply struct {
+	// U is the random part of the encryption, as stored in the write
+	// instance.
+	U kyber.Point
+	// C is the secret encrypted under X, as stored in the write instance.
+	C kyber.Point
+	// KeyCipher is copied from the write instance and holds the encrypted
+	// key material if it didn't fit in C.
+	KeyCipher []byte `protobuf:"opt"`
+	// X is the aggregate public key of the LTS used.
+	X kyber.Point
+	// Commits are the commitments of the public polynomial of the LTS,
+	// used to verify the shares.
+	Commits []kyber.Point
+	// Shares are the re-encrypted decryption shares of the nodes with their
+	// proofs.
+	Shares []DecryptShare
+}
+
+// DecryptShare is the re-encrypted decryption share of one node of the LTS,
+// with the proof that it has been created using the private share of this
+// node.
+type DecryptShare struct {
+	// Index is the index of the node in the LTS.
+	Index int
+	// Ui is the decryption share of the node, re-encrypted to the ephemeral
+	// key.
+	Ui kyber.Point
+	// Ei is the challenge of the proof.
+	Ei kyber.Scalar
+	// Fi is the response of the proof.
+	Fi kyber.Scalar
+}
+
+// AccessReceipt is signed by the nodes of the LTS for every successful
+// re-encryption or decryption of a secret.
+type AccessReceipt struct {
+	// Write is the instance ID of the write holding the secret.
+	Write byzcoin.InstanceID
+	// Read is the instance ID of the read used to access the secret.
+	Read byzcoin.InstanceID
+	// Xc is the public key of the reader.
+	Xc kyber.Point
+	// Timestamp is the unix time in seconds of the access.
+	Timestamp int64
+	// Signatures are the schnorr signatures of the LTS nodes on the receipt.
+	Signatures [][]byte
+}
+
+// PriceList holds all the priced writes spawned with a given darc.
+type PriceList struct {
+	Writes []PricedWrite
+}
+
+// PricedWrite is an entry of the PriceList.
+type PricedWrite struct {
+	// Write is the instance ID of the write.
+	Write byzcoin.InstanceID
+	// Cost is the price of a read-request of the write.
+	Cost byzcoin.Coin
+}
+
+// AccessLog holds the latest access receipts of a write or of a reader.
+type AccessLog struct {
+	Receipts []AccessReceipt
+}
+
+// MigrateWrites asks the LTS of the writes to re-encrypt their secrets to
+// the LTS in NewLTS. All writes must have their MigrateTo set to the new LTS.
+type MigrateWrites struct {
+	// Writes are the proofs of the write instances to migrate.
+	Writes []byzcoin.Proof
+	// NewLTS is the proof of the LTS instance to migrate to.
+	NewLTS byzcoin.Proof
+}
+
+// MigrateWritesReply holds one migration for every write of the request.
+type MigrateWritesReply struct {
+	Migrations []WriteMigration
+}
+
+// WriteMigration is signed by the nodes of the old LTS after re-encrypting
+// the secret of a write to a new LTS. It is stored in the new write, which
+// references the old one.
+type WriteMigration struct {
+	// Write is the instance ID of the migrated write.
+	Write byzcoin.InstanceID
+	// LTSID is the instance ID of the new LTS.
+	LTSID byzcoin.InstanceID
+	// U is the random part of the encryption to the new LTS.
+	U kyber.Point
+	// C is the secret encrypted to the new LTS.
+	C kyber.Point
+	// KeyCipher is copied from the migrated write.
+	KeyCipher []byte `protobuf:"opt"`
+	// Signatures are the schnorr signatures of the nodes of the old LTS on
+	// the migration.
+	Signatures [][]byte
+}
+
+// MigrationShare is the share of a node of the old LTS of the re-encryption
+// of a write to a new LTS. With x_i the share of the node of the private key
+// of the old LTS, X' the public key of the new LTS, and s_i a random scalar
+// of the node:
+//
+//	V = x_i*U - s_i*X'
+//	S = s_i*G
+type MigrationShare struct {
+	Index int
+	V     kyber.Point
+	S     kyber.Point
+	// Challenge, Zx and Zs are the proof that V and S are computed from the
+	// share of the node.
+	Challenge kyber.Scalar
+	Zx        kyber.Scalar
+	Zs        kyber.Scalar
+}
+
+// Message used to ask a node of the old LTS for its share of a migration.
+type migrationShareRequest struct {
+	Write  byzcoin.Proof
+	NewLTS byzcoin.Proof
+}
+
+// Message returned with the share of a node of the old LTS.
+type migrationShareReply struct {
+	Share MigrationShare
+}
+
+// Message used to ask a node of the old LTS to sign a migration.
+type migrationSignRequest struct {
+	Write  byzcoin.Proof
+	NewLTS byzcoin.Proof
+	// Shares are the shares of the nodes of the old LTS.
+	Shares []MigrationShare
+	// Signature is the signature of the requesting node of the old LTS on
+	// the migration.
+	Signature []byte
+}
+
+// Message returned with the signature of a node on the migration.
+type migrationSignReply struct {
+	Signature []byte
 }
 
 // GetLTSReply asks for the shared public key of the corresponding LTSID
@@ -147,7 +394,137 @@ type GetLTSReply struct {
 	LTSID byzcoin.InstanceID
 }
 
+// StoreBlobChunk asks a node of the LTS to store a chunk of an encrypted blob.
+// The chunk is stored under its sha256 hash. Every node stores at most
+// BlobQuota bytes of blobs for one uploader of an LTS.
+type StoreBlobChunk struct {
+	LTSID byzcoin.InstanceID
+	Data  []byte
+	// Replication is the number of nodes of the LTS roster that store the
+	// chunk. If it is 0, only the receiving node stores the chunk.
+	Replication int
+	// Uploader is the identity the chunk is stored for. It must be allowed
+	// to spawn calypsoWrite instances by the darc of the Darc proof, which
+	// must come from the ByzCoin of the LTS.
+	Uploader darc.Identity
+	Darc     byzcoin.Proof
+	// Signature is the signature of the uploader on the LTSID and the
+	// hash of the chunk.
+	Signature []byte
+}
+
+// StoreBlobChunkReply is returned once the chunk has been stored.
+type StoreBlobChunkReply struct {
+	Hash []byte
+	// Replicas is the number of nodes that stored the chunk.
+	Replicas int
+}
+
+// StoreBlobManifest asks a node of the LTS to store the manifest of a blob.
+// The manifest is stored under its root, which binds the size of the blob
+// and the Merkle root of its chunk hashes.
+type StoreBlobManifest struct {
+	LTSID       byzcoin.InstanceID
+	Manifest    BlobManifest
+	Replication int
+	// Uploader, Darc and Signature authorise the request like in
+	// StoreBlobChunk, the signature being on the LTSID and the root of the
+	// manifest.
+	Uploader  darc.Identity
+	Darc      byzcoin.Proof
+	Signature []byte
+}
+
+// StoreBlobManifestReply is returned once the manifest has been stored.
+type StoreBlobManifestReply struct {
+	Root     []byte
+	Replicas int
+}
+
+// GetBlobChunk asks a node for the chunk with the given hash.
+type GetBlobChunk struct {
+	Hash []byte
+}
+
+// GetBlobChunkReply holds the data of the chunk.
+type GetBlobChunkReply struct {
+	Data []byte
+}
+
+// GetBlobManifest asks a node for the manifest of the blob with the given
+// Merkle root.
+type GetBlobManifest struct {
+	Root []byte
+}
+
+// GetBlobManifestReply holds the manifest of the blob.
+type GetBlobManifestReply struct {
+	Manifest BlobManifest
+}
+
+// DeleteBlob asks a node of the LTS to delete the chunks and the manifest of
+// the blob of a write, once the latest version of the write is revoked or
+// expired. Only the values stored for the uploader are deleted, and their
+// size is given back to the quota of the uploader.
+type DeleteBlob struct {
+	// Write is a proof of the write holding the root of the blob.
+	Write    byzcoin.Proof
+	Manifest BlobManifest
+	Uploader darc.Identity
+	// Signature is the signature of the uploader on the LTSID of the
+	// write and the root of the blob.
+	Signature []byte
+}
+
+// DeleteBlobReply is returned once the blob has been deleted.
+type DeleteBlobReply struct {
+	// Deleted is the number of values that were stored for the uploader
+	// on the node.
+	Deleted int
+}
+
+// BlobManifest lists the chunks of a blob.
+type BlobManifest struct {
+	// Size is the total size of the blob.
+	Size int64
+	// ChunkHashes are the sha256 hashes of the chunks, in order.
+	ChunkHashes [][]byte
+}
+
 // LtsInstanceInfo is the information stored in an LTS instance.
 type LtsInstanceInfo struct {
 	Roster onet.Roster
+	// Epoch is increased for every proactive refresh of the shares.
+	Epoch uint64 `protobuf:"opt"`
+}
+
+// LTSRefresh holds all the deals of one proactive refresh of the LTS shares.
+type LTSRefresh struct {
+	LTSID byzcoin.InstanceID
+	Epoch uint64
+	Deals []RefreshDeal
+	// Signatures are the signatures of a threshold of nodes of the LTS on
+	// the hash of the refresh.
+	Signatures [][]byte `protobuf:"opt"`
+}
+
+// RefreshDeal is the contribution of one node to a refresh: a random
+// polynomial with a zero constant term, evaluated for every node of the LTS.
+type RefreshDeal struct {
+	// Index is the index of the share of the dealer.
+	Index int
+	// Commits are the commitments to the coefficients of the polynomial.
+	Commits []kyber.Point
+	// Shares holds the evaluations of the polynomial, encrypted to the
+	// service key of every node of the LTS.
+	Shares []RefreshShare
+	// Signature is the schnorr signature of the dealer on the deal.
+	Signature []byte
+}
+
+// RefreshShare is an evaluation of a refresh polynomial, encrypted using
+// the ephemeral key R.
+type RefreshShare struct {
+	R      kyber.Point
+	Cipher []byte
 }
@@ -39,11 +39,18 @@ type OCS struct {
 	// Can be set by the service to decide whether or not to
 	// do the reencryption
 	Verify VerifyRequest
+	// Can be set by the service to add a signature to the reply of every
+	// node accepting the reencryption.
+	Sign SignRequest
 	// Reencrypted receives a 'true'-value when the protocol finished successfully,
 	// or 'false' if not enough shares have been collected.
 	Reencrypted chan bool
 	Uis         []*share.PubShare // re-encrypted shares
+	// Replies holds the replies used to create Uis, including the one of the
+	// root, so that the proofs of the shares can be given to the client.
+	Replies []ReencryptReply
 	// private fields
+	request  *Reencrypt
 	replies  []ReencryptReply
 	timeout  *time.Timer
 	doneOnce sync.Once
@@ -88,6 +95,7 @@ func (o *OCS) Start() error {
 			return xerrors.New("refused to reencrypt")
 		}
 	}
+	o.request = rc
 	o.timeout = time.AfterFunc(1*time.Minute, func() {
 		log.Lvl1("OCS protocol timeout")
 		o.finish(false)
@@ -106,8 +114,6 @@ func (o *OCS) reencrypt(r structReencrypt) error {
 	log.Lvl3(o.Name() + ": starting reencrypt")
 	defer o.Done()
 
-	ui := o.getUI(r.U, r.Xc)
-
 	if o.Verify != nil {
 		if !o.Verify(&r.Reencrypt) {
 			log.Lvl2(o.ServerIdentity(), "refused to reencrypt")
@@ -116,24 +122,18 @@ func (o *OCS) reencrypt(r structReencrypt) error {
 		}
 	}
 
-	// Calculating proofs
-	si := cothority.Suite.Scalar().Pick(o.Suite().RandomStream())
-	uiHat := cothority.Suite.Point().Mul(si, cothority.Suite.Point().Add(r.U, r.Xc))
-	hiHat := cothority.Suite.Point().Mul(si, nil)
-	hash := sha256.New()
-	ui.V.MarshalTo(hash)
-	uiHat.MarshalTo(hash)
-	hiHat.MarshalTo(hash)
-	ei := cothority.Suite.Scalar().SetBytes(hash.Sum(nil))
-
-	return cothority.ErrorOrNil(
-		o.SendToParent(&ReencryptReply{
-			Ui: ui,
-			Ei: ei,
-			Fi: cothority.Suite.Scalar().Add(si, cothority.Suite.Scalar().Mul(ei, o.Shared.V)),
-		}),
-		"sending ReencryptReply to parent",
-	)
+	reply := o.makeReply(r.U, r.Xc)
+	if o.Sign != nil {
+		var err error
+		reply.Signature, err = o.Sign(&r.Reencrypt)
+		if err != nil {
+			log.Error(o.ServerIdentity(), "couldn't sign request:", err)
+			return cothority.ErrorOrNil(o.SendToParent(&ReencryptReply{}),
+				"sending ReencryptReply to parent")
+		}
+	}
+	return cothority.ErrorOrNil(o.SendToParent(reply),
+		"sending ReencryptReply to parent")
 }
 
 // reencryptReply is the root-node waiting for all replies and generating
@@ -153,24 +153,20 @@ func (o *OCS) reencryptReply(rr structReencryptReply) error {
 	// minus one to exclude the root
 	if len(o.replies) >= int(o.Threshold-1) {
 		o.Uis = make([]*share.PubShare, len(o.List()))
-		o.Uis[0] = o.getUI(o.U, o.Xc)
+		own := o.makeReply(o.U, o.Xc)
+		if o.Sign != nil {
+			var err error
+			own.Signature, err = o.Sign(o.request)
+			if err != nil {
+				log.Error(o.ServerIdentity(), "couldn't sign request:", err)
+			}
+		}
+		o.Uis[0] = own.Ui
+		o.Replies = append([]ReencryptReply{*own}, o.replies...)
 
 		for _, r := range o.replies {
-			// Verify proofs
-			ufi := cothority.Suite.Point().Mul(r.Fi, cothority.Suite.Point().Add(o.U, o.Xc))
-			uiei := cothority.Suite.Point().Mul(cothority.Suite.Scalar().Neg(r.Ei), r.Ui.V)
-			uiHat := cothority.Suite.Point().Add(ufi, uiei)
-
-			gfi := cothority.Suite.Point().Mul(r.Fi, nil)
-			gxi := o.Poly.Eval(r.Ui.I).V
-			hiei := cothority.Suite.Point().Mul(cothority.Suite.Scalar().Neg(r.Ei), gxi)
-			hiHat := cothority.Suite.Point().Add(gfi, hiei)
-			hash := sha256.New()
-			r.Ui.V.MarshalTo(hash)
-			uiHat.MarshalTo(hash)
-			hiHat.MarshalTo(hash)
-			e := cothority.Suite.Scalar().SetBytes(hash.Sum(nil))
-			if e.Equal(r.Ei) {
+			err := VerifyReencryptReply(o.U, o.Xc, o.Poly.Eval(r.Ui.I).V, &r)
+			if err == nil {
 				o.Uis[r.Ui.I] = r.Ui
 			} else {
 				log.Lvl1("Received invalid share from node", r.Ui.I)
@@ -189,6 +185,53 @@ func (o *OCS) reencryptReply(rr structReencryptReply) error {
 	return nil
 }
 
+// makeReply returns the share of this node together with the proof that it
+// has been created using the private share of the node.
+func (o *OCS) makeReply(U, Xc kyber.Point) *ReencryptReply {
+	ui := o.getUI(U, Xc)
+
+	// Calculating proofs
+	si := cothority.Suite.Scalar().Pick(o.Suite().RandomStream())
+	uiHat := cothority.Suite.Point().Mul(si, cothority.Suite.Point().Add(U, Xc))
+	hiHat := cothority.Suite.Point().Mul(si, nil)
+	hash := sha256.New()
+	ui.V.MarshalTo(hash)
+	uiHat.MarshalTo(hash)
+	hiHat.MarshalTo(hash)
+	ei := cothority.Suite.Scalar().SetBytes(hash.Sum(nil))
+
+	return &ReencryptReply{
+		Ui: ui,
+		Ei: ei,
+		Fi: cothority.Suite.Scalar().Add(si, cothority.Suite.Scalar().Mul(ei, o.Shared.V)),
+	}
+}
+
+// VerifyReencryptReply checks that the share in the reply has been created
+// from U and Xc using the private share corresponding to the public share
+// Xi of the node.
+func VerifyReencryptReply(U, Xc, Xi kyber.Point, r *ReencryptReply) error {
+	if r.Ui == nil || r.Ei == nil || r.Fi == nil {
+		return xerrors.New("incomplete reply")
+	}
+	ufi := cothority.Suite.Point().Mul(r.Fi, cothority.Suite.Point().Add(U, Xc))
+	uiei := cothority.Suite.Point().Mul(cothority.Suite.Scalar().Neg(r.Ei), r.Ui.V)
+	uiHat := cothority.Suite.Point().Add(ufi, uiei)
+
+	gfi := cothority.Suite.Point().Mul(r.Fi, nil)
+	hiei := cothority.Suite.Point().Mul(cothority.Suite.Scalar().Neg(r.Ei), Xi)
+	hiHat := cothority.Suite.Point().Add(gfi, hiei)
+	hash := sha256.New()
+	r.Ui.V.MarshalTo(hash)
+	uiHat.MarshalTo(hash)
+	hiHat.MarshalTo(hash)
+	e := cothority.Suite.Scalar().SetBytes(hash.Sum(nil))
+	if !e.Equal(r.Ei) {
+		return xerrors.New("invalid proof of the share")
+	}
+	return nil
+}
+
 func (o *OCS) getUI(U, Xc kyber.Point) *share.PubShare {
 	v := cothority.Suite.Point().Mul(o.Shared.V, U)
 	v.Add(v, cothority.Suite.Point().Mul(o.Shared.V, Xc))
@@ -199,7 +242,9 @@ func (o *OCS) getUI(U, Xc kyber.Point) *share.PubShare {
 }
 
 func (o *OCS) finish(result bool) {
-	o.timeout.Stop()
+	if o.timeout != nil {
+		o.timeout.Stop()
+	}
 	select {
 	case o.Reencrypted <- result:
 		// suceeded
@@ -24,11 +24,18 @@ func init() {
 // allow reencryption.
 type VerifyRequest func(rc *Reencrypt) bool
 
+// SignRequest is a callback-function that can be set by a service. It
+// returns the signature added to the reply of a node once it accepted to
+// reencrypt.
+type SignRequest func(rc *Reencrypt) ([]byte, error)
+
 // Reencrypt asks for a re-encryption share from a node
 type Reencrypt struct {
 	// U is the point from the write-request
 	U kyber.Point
-	// Xc is the public key of the reader
+	// Xc is the public key of the reader, or the ephemeral key the
+	// decryption shares are re-encrypted to. It must not be the neutral
+	// element, as the nodes would then return plain decryption shares.
 	Xc kyber.Point
 	// VerificationData is optional and can be any slice of bytes, so that each
 	// node can verify if the reencryption request is valid or not.
@@ -45,6 +52,8 @@ type ReencryptReply struct {
 	Ui *share.PubShare
 	Ei kyber.Scalar
 	Fi kyber.Scalar
+	// Signature is set if the protocol has a SignRequest callback.
+	Signature []byte `protobuf:"opt"`
 }
 
 type structReencryptReply struct {
@@ -0,0 +1,248 @@
+package protocol
+
+/*
+The refresh-protocol makes the nodes of an LTS agree on the deals of a
+proactive refresh of their shares before applying them. The root collects
+the deals of the nodes and proposes a set of deals. Every node signs the
+proposal, and the deals are only applied with the signatures of a threshold
+of nodes. As an honest node signs only one set of deals per refresh, two
+different sets of deals can never both be applied.
+*/
+
+import (
+	"sync"
+	"time"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	onet.GlobalProtocolRegister(NameRefresh, NewRefresh)
+}
+
+// refreshTimeout is how long the root waits for the protocol to finish.
+const refreshTimeout = time.Minute
+
+// The phases of the root.
+const (
+	phaseDeal = iota
+	phaseVote
+	phaseCommit
+)
+
+// Refresh is used to refresh the shares of an LTS. Before calling `Start`,
+// Data and the callbacks must be initialized by the caller.
+type Refresh struct {
+	*onet.TreeNodeInstance
+	Threshold int // How many nodes must deal, sign and apply the refresh
+	// Data is given to the callbacks of all nodes and has to hold
+	// everything needed to verify the refresh is valid.
+	Data  []byte
+	Deal  DealRefresh
+	Vote  VoteRefresh
+	Apply ApplyRefresh
+	// Finished receives a 'true'-value when a threshold of nodes applied
+	// the refresh, or 'false' if the refresh failed.
+	Finished chan bool
+	// Deals holds the deals applied by the nodes.
+	Deals [][]byte
+	// Applied holds the nodes that applied the deals.
+	Applied []*network.ServerIdentity
+	// private fields
+	phase    int
+	pending  int
+	sigs     [][]byte
+	timeout  *time.Timer
+	doneOnce sync.Once
+	mutex    sync.Mutex
+}
+
+// NewRefresh initialises the structure for use in one round
+func NewRefresh(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	p := &Refresh{
+		TreeNodeInstance: n,
+		Finished:         make(chan bool, 1),
+		Threshold:        len(n.Roster().List) - (len(n.Roster().List)-1)/3,
+	}
+
+	err := p.RegisterHandlers(p.announce, p.dealReply, p.propose, p.vote,
+		p.commit, p.commitReply)
+	if err != nil {
+		return nil, xerrors.Errorf("registring handlers: %v", err)
+	}
+	return p, nil
+}
+
+// Start creates the deal of the root and asks all children for theirs.
+func (p *Refresh) Start() error {
+	log.Lvl3("Starting Protocol")
+	if p.Deal == nil || p.Vote == nil || p.Apply == nil {
+		p.finish(false)
+		return xerrors.New("please initialize the callbacks first")
+	}
+	deal, err := p.Deal(p.Data)
+	if err != nil {
+		p.finish(false)
+		return xerrors.Errorf("creating deal: %v", err)
+	}
+	p.timeout = time.AfterFunc(refreshTimeout, func() {
+		log.Lvl1("Refresh protocol timeout")
+		p.finish(false)
+	})
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Deals = [][]byte{deal}
+	p.phase = phaseDeal
+	return p.broadcast(&RefreshAnnounce{Data: p.Data})
+}
+
+// announce is received by every node to give its deal.
+func (p *Refresh) announce(r structRefreshAnnounce) error {
+	p.Data = r.Data
+	p.timeout = time.AfterFunc(refreshTimeout, func() {
+		p.doneOnce.Do(func() { p.Done() })
+	})
+	deal, err := p.Deal(r.Data)
+	if err != nil {
+		log.Lvl2(p.ServerIdentity(), "refused to deal:", err)
+	}
+	return cothority.ErrorOrNil(p.SendToParent(&RefreshDealReply{Deal: deal}),
+		"sending RefreshDealReply to parent")
+}
+
+// dealReply is the root collecting the deals.
+func (p *Refresh) dealReply(r structRefreshDealReply) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.phase != phaseDeal {
+		return nil
+	}
+	if len(r.Deal) > 0 {
+		p.Deals = append(p.Deals, r.Deal)
+	}
+	p.pending--
+	return p.next()
+}
+
+// propose is received by every node to sign the deals of the root.
+func (p *Refresh) propose(r structRefreshPropose) error {
+	sig, err := p.Vote(p.Data, r.Deals)
+	if err != nil {
+		log.Lvl2(p.ServerIdentity(), "refused to sign the deals:", err)
+	}
+	return cothority.ErrorOrNil(p.SendToParent(&RefreshVote{Signature: sig}),
+		"sending RefreshVote to parent")
+}
+
+// vote is the root collecting the signatures on the deals.
+func (p *Refresh) vote(r structRefreshVote) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.phase != phaseVote {
+		return nil
+	}
+	if len(r.Signature) > 0 {
+		p.sigs = append(p.sigs, r.Signature)
+	}
+	p.pending--
+	return p.next()
+}
+
+// commit is received by every node to apply the signed deals.
+func (p *Refresh) commit(r structRefreshCommit) error {
+	defer p.doneOnce.Do(func() { p.Done() })
+	if p.timeout != nil {
+		p.timeout.Stop()
+	}
+	err := p.Apply(p.Data, r.Deals, r.Signatures)
+	if err != nil {
+		log.Lvl2(p.ServerIdentity(), "couldn't apply the deals:", err)
+	}
+	return cothority.ErrorOrNil(p.SendToParent(&RefreshCommitReply{
+		Applied: err == nil}), "sending RefreshCommitReply to parent")
+}
+
+// commitReply is the root collecting which nodes applied the deals.
+func (p *Refresh) commitReply(r structRefreshCommitReply) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.phase != phaseCommit {
+		return nil
+	}
+	if r.Applied {
+		p.Applied = append(p.Applied, r.ServerIdentity)
+	}
+	p.pending--
+	return p.next()
+}
+
+// next starts the next phase of the root once all children replied. It
+// must be called with the lock held.
+func (p *Refresh) next() error {
+	if p.pending > 0 {
+		return nil
+	}
+	switch p.phase {
+	case phaseDeal:
+		if len(p.Deals) < p.Threshold {
+			p.finish(false)
+			return xerrors.Errorf("only got %d deals out of %d needed",
+				len(p.Deals), p.Threshold)
+		}
+		sig, err := p.Vote(p.Data, p.Deals)
+		if err != nil {
+			p.finish(false)
+			return xerrors.Errorf("signing the deals: %v", err)
+		}
+		p.sigs = [][]byte{sig}
+		p.phase = phaseVote
+		return p.broadcast(&RefreshPropose{Deals: p.Deals})
+	case phaseVote:
+		if len(p.sigs) < p.Threshold {
+			p.finish(false)
+			return xerrors.Errorf("only got %d signatures out of %d needed",
+				len(p.sigs), p.Threshold)
+		}
+		if err := p.Apply(p.Data, p.Deals, p.sigs); err != nil {
+			p.finish(false)
+			return xerrors.Errorf("applying the deals: %v", err)
+		}
+		p.Applied = []*network.ServerIdentity{p.ServerIdentity()}
+		p.phase = phaseCommit
+		return p.broadcast(&RefreshCommit{Deals: p.Deals, Signatures: p.sigs})
+	case phaseCommit:
+		p.finish(len(p.Applied) >= p.Threshold)
+	}
+	return nil
+}
+
+// broadcast sends the message to all children and waits for the replies of
+// the children it could reach. It must be called with the lock held.
+func (p *Refresh) broadcast(msg interface{}) error {
+	p.pending = len(p.Children())
+	errs := p.Broadcast(msg)
+	if len(errs) > 0 {
+		log.Lvlf2("%v couldn't reach some nodes: %v", p.ServerIdentity(), errs)
+	}
+	p.pending -= len(errs)
+	return p.next()
+}
+
+func (p *Refresh) finish(result bool) {
+	if p.timeout != nil {
+		p.timeout.Stop()
+	}
+	select {
+	case p.Finished <- result:
+		// suceeded
+	default:
+		// would have blocked because some other call to finish()
+		// beat us.
+	}
+	p.doneOnce.Do(func() { p.Done() })
+}
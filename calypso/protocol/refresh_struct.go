@@ -0,0 +1,98 @@
+package protocol
+
+/*
+Refresh_struct holds all messages for the refresh protocol.
+*/
+
+import (
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// NameRefresh can be used from other packages to refer to this protocol.
+const NameRefresh = "CalypsoRefresh"
+
+func init() {
+	network.RegisterMessages(&RefreshAnnounce{}, &RefreshDealReply{},
+		&RefreshPropose{}, &RefreshVote{}, &RefreshCommit{},
+		&RefreshCommitReply{})
+}
+
+// DealRefresh is a callback-function that must be set by a service. It
+// returns the deal of the node for the refresh described in data.
+type DealRefresh func(data []byte) ([]byte, error)
+
+// VoteRefresh is a callback-function that must be set by a service. It
+// verifies the deals proposed by the root and returns the signature of the
+// node on them. A node must never sign two different sets of deals for the
+// same refresh.
+type VoteRefresh func(data []byte, deals [][]byte) ([]byte, error)
+
+// ApplyRefresh is a callback-function that must be set by a service. It
+// applies the deals once they have been signed by a threshold of nodes.
+type ApplyRefresh func(data []byte, deals [][]byte, sigs [][]byte) error
+
+// RefreshAnnounce is sent by the root to ask for the deals of the nodes.
+type RefreshAnnounce struct {
+	// Data holds everything needed by the nodes to verify the refresh.
+	Data []byte
+}
+
+type structRefreshAnnounce struct {
+	*onet.TreeNode
+	RefreshAnnounce
+}
+
+// RefreshDealReply returns the deal of a node. It is empty if the node
+// refused to deal.
+type RefreshDealReply struct {
+	Deal []byte
+}
+
+type structRefreshDealReply struct {
+	*onet.TreeNode
+	RefreshDealReply
+}
+
+// RefreshPropose is sent by the root with the deals it proposes to apply.
+type RefreshPropose struct {
+	Deals [][]byte
+}
+
+type structRefreshPropose struct {
+	*onet.TreeNode
+	RefreshPropose
+}
+
+// RefreshVote returns the signature of a node on the proposed deals. It is
+// empty if the node refused the proposal.
+type RefreshVote struct {
+	Signature []byte
+}
+
+type structRefreshVote struct {
+	*onet.TreeNode
+	RefreshVote
+}
+
+// RefreshCommit is sent by the root once a threshold of nodes signed the
+// deals, so that the nodes can apply them.
+type RefreshCommit struct {
+	Deals      [][]byte
+	Signatures [][]byte
+}
+
+type structRefreshCommit struct {
+	*onet.TreeNode
+	RefreshCommit
+}
+
+// RefreshCommitReply tells the root whether the node applied the deals.
+type RefreshCommitReply struct {
+	Applied bool
+}
+
+type structRefreshCommitReply struct {
+	*onet.TreeNode
+	RefreshCommitReply
+}
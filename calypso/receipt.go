@@ -0,0 +1,347 @@
+package calypso
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso/protocol"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractAccessLogID denotes a contract holding the access receipts of a
+// write or of a reader. The access logs are created and updated by spawning
+// a "calypsoAccessLog" on the write instance, with the receipt in the
+// "receipt" argument. The receipt is accepted if it is signed by a
+// threshold of the nodes of the LTS of the write, and the instruction must
+// not have any signer. An access log keeps the latest maxAccessLogReceipts
+// receipts, the older ones are only found in the blocks of ByzCoin.
+const ContractAccessLogID = "calypsoAccessLog"
+
+// maxAccessLogReceipts is the number of receipts kept in an access log.
+const maxAccessLogReceipts = 1000
+
+type contractAccessLog struct {
+	byzcoin.BasicContract
+	AccessLog
+}
+
+func contractAccessLogFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractAccessLog{}
+	err := protobuf.DecodeWithConstructors(in, &c.AccessLog,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+// AccessLogWriteID returns the ID of the instance holding the access
+// receipts of the write.
+func AccessLogWriteID(write byzcoin.InstanceID) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte("calypso access log write"))
+	h.Write(write.Slice())
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// AccessLogReaderID returns the ID of the instance holding the access
+// receipts of the reader with the public key xc.
+func AccessLogReaderID(xc kyber.Point) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte("calypso access log reader"))
+	xc.MarshalTo(h)
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// Hash returns the message signed by the nodes of the LTS.
+func (r AccessReceipt) Hash() []byte {
+	h := sha256.New()
+	h.Write(r.Write.Slice())
+	h.Write(r.Read.Slice())
+	r.Xc.MarshalTo(h)
+	tsBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(tsBuf, uint64(r.Timestamp))
+	h.Write(tsBuf)
+	return h.Sum(nil)
+}
+
+// Verify checks that the receipt has been signed by a threshold of the nodes
+// in the roster.
+func (r AccessReceipt) Verify(roster *onet.Roster) error {
+	return verifyLTSSignatures(roster, r.Hash(), r.Signatures)
+}
+
+// verifyLTSSignatures checks that msg has been signed by a threshold of the
+// nodes in the roster.
+func verifyLTSSignatures(roster *onet.Roster, msg []byte, sigs [][]byte) error {
+	n := len(roster.List)
+	threshold := n - (n-1)/3
+	signed := make([]bool, n)
+	valid := 0
+	for _, sig := range sigs {
+		for i, si := range roster.List {
+			if signed[i] {
+				continue
+			}
+			if schnorr.Verify(cothority.Suite, si.ServicePublic(ServiceName),
+				msg, sig) == nil {
+				signed[i] = true
+				valid++
+				break
+			}
+		}
+	}
+	if valid < threshold {
+		return xerrors.Errorf("only %d valid signatures out of %d needed",
+			valid, threshold)
+	}
+	return nil
+}
+
+// verifyAccessReceipt checks that the receipt references an existing read of
+// the write, and that it is signed by the LTS of the write. As the receipt
+// is not verified against a darc, the instruction must not have signers,
+// whose counters would be increased without checking their signatures.
+func (c ContractWrite) verifyAccessReceipt(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction) error {
+	if len(inst.SignerIdentities) > 0 || len(inst.SignerCounter) > 0 ||
+		len(inst.Signatures) > 0 {
+		return xerrors.New("access receipts must not be signed")
+	}
+	receipt, err := decodeReceipt(inst)
+	if err != nil {
+		return err
+	}
+	if !receipt.Write.Equal(inst.InstanceID) {
+		return xerrors.New("the receipt doesn't reference this write-instance")
+	}
+
+	v, _, cid, _, err := rst.GetValues(receipt.Read.Slice())
+	if err == nil && cid != ContractReadID {
+		err = xerrors.New("not a read instance")
+	}
+	if err != nil {
+		return xerrors.Errorf("getting read instance: %v", err)
+	}
+	var read Read
+	err = protobuf.DecodeWithConstructors(v, &read,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return xerrors.Errorf("decoding read instance: %v", err)
+	}
+	if !read.Write.Equal(inst.InstanceID) || !read.Xc.Equal(receipt.Xc) {
+		return xerrors.New("the receipt doesn't match the read instance")
+	}
+
+	info, err := getLtsInstance(rst, c.LTSID)
+	if err != nil {
+		return err
+	}
+	return cothority.ErrorOrNil(receipt.Verify(&info.Roster),
+		"verifying receipt")
+}
+
+// getLtsInstance returns the LTS instance stored in id.
+func getLtsInstance(rst byzcoin.ReadOnlyStateTrie, id byzcoin.InstanceID) (
+	*LtsInstanceInfo, error) {
+	v, _, cid, _, err := rst.GetValues(id.Slice())
+	if err == nil && cid != ContractLongTermSecretID {
+		err = xerrors.New("not an LTS instance")
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("getting LTS instance: %v", err)
+	}
+	var info LtsInstanceInfo
+	err = protobuf.DecodeWithConstructors(v, &info,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("decoding LTS instance: %v", err)
+	}
+	return &info, nil
+}
+
+// spawnAccessLog appends the receipt to the access logs of the write and of
+// the reader. The receipt has already been checked in VerifyInstruction.
+func (c ContractWrite) spawnAccessLog(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, darcID darc.ID) ([]byzcoin.StateChange, error) {
+	receipt, err := decodeReceipt(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	var sc []byzcoin.StateChange
+	for _, id := range []byzcoin.InstanceID{AccessLogWriteID(receipt.Write),
+		AccessLogReaderID(receipt.Xc)} {
+		action := byzcoin.Create
+		logDarcID := darcID
+		var accessLog AccessLog
+		prf, err := rst.GetProof(id.Slice())
+		if err != nil {
+			return nil, xerrors.Errorf("getting proof of access log: %v", err)
+		}
+		ok, err := prf.Exists(id.Slice())
+		if err != nil {
+			return nil, xerrors.Errorf("checking access log: %v", err)
+		}
+		if ok {
+			action = byzcoin.Update
+			v, _, cid, did, err := rst.GetValues(id.Slice())
+			if err == nil && cid != ContractAccessLogID {
+				err = xerrors.New("not an access log")
+			}
+			if err != nil {
+				return nil, xerrors.Errorf("getting access log: %v", err)
+			}
+			err = protobuf.DecodeWithConstructors(v, &accessLog,
+				network.DefaultConstructors(cothority.Suite))
+			if err != nil {
+				return nil, xerrors.Errorf("decoding access log: %v", err)
+			}
+			logDarcID = did
+		}
+		if err := accessLog.add(*receipt); err != nil {
+			return nil, err
+		}
+		buf, err := protobuf.Encode(&accessLog)
+		if err != nil {
+			return nil, xerrors.Errorf("encoding access log: %v", err)
+		}
+		sc = append(sc, byzcoin.NewStateChange(action, id, ContractAccessLogID,
+			buf, logDarcID))
+	}
+	log.Lvlf2("Logged access of read %x to write %x", receipt.Read.Slice(),
+		receipt.Write.Slice())
+	return sc, nil
+}
+
+// add appends the receipt to the log. If the log is full, the oldest receipt
+// is dropped, and receipts older than the oldest kept receipt are refused,
+// so that dropped receipts cannot be logged again.
+func (al *AccessLog) add(receipt AccessReceipt) error {
+	for _, r := range al.Receipts {
+		if r.Read.Equal(receipt.Read) && r.Timestamp == receipt.Timestamp {
+			return xerrors.New("receipt is already logged")
+		}
+	}
+	if len(al.Receipts) >= maxAccessLogReceipts {
+		if receipt.Timestamp < al.Receipts[0].Timestamp {
+			return xerrors.New("receipt is older than the access log")
+		}
+		al.Receipts = al.Receipts[len(al.Receipts)-maxAccessLogReceipts+1:]
+	}
+	al.Receipts = append(al.Receipts, receipt)
+	return nil
+}
+
+func decodeReceipt(inst byzcoin.Instruction) (*AccessReceipt, error) {
+	buf := inst.Spawn.Args.Search("receipt")
+	if len(buf) == 0 {
+		return nil, xerrors.New("need a receipt argument")
+	}
+	var receipt AccessReceipt
+	err := protobuf.DecodeWithConstructors(buf, &receipt,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("decoding receipt: %v", err)
+	}
+	return &receipt, nil
+}
+
+// receiptFromRequest returns the receipt for the re-encryption request. The
+// request must have been verified before. Migrations don't have a receipt,
+// as they are signed once the new encryption is known.
+func receiptFromRequest(rc *protocol.Reencrypt) (*AccessReceipt, error) {
+	var verificationData vData
+	err := protobuf.DecodeWithConstructors(*rc.VerificationData,
+		&verificationData, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("decoding verification data: %v", err)
+	}
+	if verificationData.NewLTS != nil {
+		return nil, nil
+	}
+	k, v, _, _, err := verificationData.Proof.KeyValue()
+	if err != nil {
+		return nil, xerrors.Errorf("proof cannot return values: %v", err)
+	}
+	var read Read
+	err = protobuf.DecodeWithConstructors(v, &read,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't decode read data: %v", err)
+	}
+	return &AccessReceipt{
+		Write:     read.Write,
+		Read:      byzcoin.NewInstanceID(k),
+		Xc:        read.Xc,
+		Timestamp: verificationData.Timestamp,
+	}, nil
+}
+
+// signReceipt is called by the ocs-protocol to sign the access receipt of
+// an accepted request.
+func (s *Service) signReceipt(rc *protocol.Reencrypt) ([]byte, error) {
+	receipt, err := receiptFromRequest(rc)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	sig, err := schnorr.Sign(cothority.Suite, s.getKeyPair().Private,
+		receipt.Hash())
+	return sig, cothority.ErrorOrNil(err, "signing receipt")
+}
+
+// logAccess sends the receipt collectively signed during the ocs-protocol
+// to the ByzCoin ledger holding the read instance. The access being already
+// granted, an error is only logged by the callers and doesn't prevent the
+// reader from getting the key: the receipt is best-effort, and the read
+// instance stays the authoritative record of the access right.
+func (s *Service) logAccess(readProof *byzcoin.Proof, ocsProto *protocol.OCS) error {
+	rc := &protocol.Reencrypt{U: ocsProto.U, Xc: ocsProto.Xc,
+		VerificationData: &ocsProto.VerificationData}
+	receipt, err := receiptFromRequest(rc)
+	if err != nil {
+		return err
+	}
+	for _, r := range ocsProto.Replies {
+		if r.Signature != nil {
+			receipt.Signatures = append(receipt.Signatures, r.Signature)
+		}
+	}
+	buf, err := protobuf.Encode(receipt)
+	if err != nil {
+		return xerrors.Errorf("encoding receipt: %v", err)
+	}
+
+	ctx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion,
+		byzcoin.Instruction{
+			InstanceID: receipt.Write,
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractAccessLogID,
+				Args:       byzcoin.Arguments{{Name: "receipt", Value: buf}},
+			},
+		})
+	cl := byzcoin.NewClient(readProof.Latest.SkipChainID(),
+		*readProof.Latest.Roster)
+	_, err = cl.AddTransaction(ctx)
+	return cothority.ErrorOrNil(err, "adding receipt transaction")
+}
+
+// checkTimestamp makes sure the request has been created recently, so that
+// receipts cannot be replayed.
+func checkTimestamp(ts int64) error {
+	if time.Since(time.Unix(ts, 0)) > time.Minute ||
+		time.Until(time.Unix(ts, 0)) > time.Minute {
+		return xerrors.New("timestamp of the request is too far off")
+	}
+	return nil
+}
@@ -0,0 +1,543 @@
+package calypso
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso/protocol"
+	dkgprotocol "go.dedis.ch/cothority/v3/dkg/pedersen"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+	dkg "go.dedis.ch/kyber/v3/share/dkg/pedersen"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// RefreshLTS proactively refreshes the shares of the LTS with the same
+// roster, so that shares leaked before the refresh become useless. Every
+// node deals a random polynomial with a zero constant term, and the shares
+// of all nodes are increased by the evaluations of these polynomials. The
+// public key X of the LTS stays the same.
+//
+// The deals are agreed on in the refresh-protocol: the nodes only apply a
+// set of deals signed by a threshold of nodes, and every node signs only one
+// set of deals per epoch.
+//
+// The epoch of the LTS in the proof must be one more than the epoch of the
+// shares, which is done by an invoke:longTermSecret.refresh. At least a
+// threshold of nodes must be online. The nodes that are offline fetch the
+// deals they missed from the other nodes during the next refresh.
+func (s *Service) RefreshLTS(req *RefreshLTS) (*RefreshLTSReply, error) {
+	info, id, err := s.getRefreshInfo(&req.Proof)
+	if err != nil {
+		return nil, err
+	}
+	s.storage.Lock()
+	roster := s.storage.Rosters[id]
+	s.storage.Unlock()
+	if roster == nil {
+		return nil, xerrors.Errorf("don't know the LTSID '%v'", id)
+	}
+	data, err := protobuf.Encode(&refreshLtsConfig{Proof: req.Proof})
+	if err != nil {
+		return nil, xerrors.Errorf("encoding refresh config: %v", err)
+	}
+
+	tree := roster.GenerateNaryTreeWithRoot(len(roster.List), s.ServerIdentity())
+	if tree == nil {
+		return nil, xerrors.New("this node is not in the LTS roster")
+	}
+	pi, err := s.CreateProtocol(protocol.NameRefresh, tree)
+	if err != nil {
+		return nil, xerrors.Errorf("creating protocol: %v", err)
+	}
+	p := pi.(*protocol.Refresh)
+	s.setRefreshCallbacks(p)
+	p.Data = data
+	if err := p.Start(); err != nil {
+		return nil, xerrors.Errorf("starting refresh protocol: %v", err)
+	}
+	if !<-p.Finished {
+		return nil, xerrors.New("the refresh protocol failed")
+	}
+
+	refresh, err := decodeRefresh(id, info.Epoch, p.Deals)
+	if err != nil {
+		return nil, err
+	}
+	reply := &RefreshLTSReply{Epoch: info.Epoch}
+	for _, d := range refresh.Deals {
+		reply.Dealers = append(reply.Dealers, d.Index)
+	}
+	applied := make(map[network.ServerIdentityID]bool)
+	for _, si := range p.Applied {
+		applied[si.ID] = true
+	}
+	for i, si := range roster.List {
+		if !applied[si.ID] {
+			reply.Offline = append(reply.Offline, i)
+		}
+	}
+
+	log.Lvlf2("%v Refreshed LTS with ID: %v to epoch %d", s.ServerIdentity(),
+		id, info.Epoch)
+	return reply, nil
+}
+
+// setRefreshCallbacks sets the callbacks of the refresh-protocol.
+func (s *Service) setRefreshCallbacks(p *protocol.Refresh) {
+	p.Deal = s.refreshDeal
+	p.Vote = s.refreshVote
+	p.Apply = s.refreshApply
+}
+
+// refreshDeal returns the deal of this node for the refresh in data.
+func (s *Service) refreshDeal(data []byte) ([]byte, error) {
+	info, id, err := s.decodeRefreshConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	deal, err := s.getRefreshDeal(id, info.Epoch)
+	if err != nil {
+		return nil, err
+	}
+	return protobuf.Encode(deal)
+}
+
+// refreshVote verifies the deals proposed by the root and signs them. It
+// refuses to sign a different set of deals than the one it already signed
+// for the same epoch.
+func (s *Service) refreshVote(data []byte, deals [][]byte) ([]byte, error) {
+	info, id, err := s.decodeRefreshConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := decodeRefresh(id, info.Epoch, deals)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := s.verifyRefresh(refresh); err != nil {
+		return nil, err
+	}
+
+	h := refresh.Hash()
+	s.storage.Lock()
+	pending := s.storage.PendingRefresh[id]
+	if pending == nil || pending.Epoch != info.Epoch {
+		pending = &pendingRefresh{Epoch: info.Epoch}
+		s.storage.PendingRefresh[id] = pending
+	}
+	if pending.Vote != nil && !bytes.Equal(pending.Vote, h) {
+		s.storage.Unlock()
+		return nil, xerrors.Errorf("already signed other deals for epoch %d",
+			info.Epoch)
+	}
+	pending.Vote = h
+	s.storage.Unlock()
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return schnorr.Sign(cothority.Suite, s.getKeyPair().Private, h)
+}
+
+// refreshApply adds the deals signed by a threshold of nodes to the share
+// of this node.
+func (s *Service) refreshApply(data []byte, deals [][]byte, sigs [][]byte) error {
+	info, id, err := s.decodeRefreshConfig(data)
+	if err != nil {
+		return err
+	}
+	refresh, err := decodeRefresh(id, info.Epoch, deals)
+	if err != nil {
+		return err
+	}
+	refresh.Signatures = sigs
+	return s.applyRefresh(refresh)
+}
+
+// refreshFetch returns a refresh applied by this node, so that nodes which
+// were offline can catch up. Only the nodes of the LTS can fetch refreshes.
+func (s *Service) refreshFetch(req *refreshFetch) (*refreshFetchReply, error) {
+	s.storage.Lock()
+	defer s.storage.Unlock()
+	roster := s.storage.Rosters[req.LTSID]
+	if roster == nil {
+		return nil, xerrors.Errorf("don't know the LTSID '%v'", req.LTSID)
+	}
+	msg := refreshFetchMessage(req.LTSID, req.Epoch)
+	signed := false
+	for _, si := range roster.List {
+		if schnorr.Verify(cothority.Suite, si.ServicePublic(ServiceName), msg,
+			req.Signature) == nil {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return nil, xerrors.New("only the nodes of the LTS can fetch refreshes")
+	}
+	for _, r := range s.storage.Refreshes[req.LTSID] {
+		if r.Epoch == req.Epoch {
+			return &refreshFetchReply{Refresh: *r}, nil
+		}
+	}
+	return nil, xerrors.Errorf("don't know epoch %d of LTS %v", req.Epoch,
+		req.LTSID)
+}
+
+// decodeRefreshConfig verifies the proof in data and catches up with the
+// refreshes before the one in the proof.
+func (s *Service) decodeRefreshConfig(data []byte) (*LtsInstanceInfo,
+	byzcoin.InstanceID, error) {
+	var cfg refreshLtsConfig
+	err := protobuf.DecodeWithConstructors(data, &cfg,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, byzcoin.InstanceID{}, xerrors.Errorf("decoding refresh config: %v", err)
+	}
+	info, id, err := s.getRefreshInfo(&cfg.Proof)
+	if err != nil {
+		return nil, byzcoin.InstanceID{}, err
+	}
+	if err := s.catchUp(id, info.Epoch-1); err != nil {
+		return nil, byzcoin.InstanceID{}, xerrors.Errorf("catching up with previous refreshes: %v", err)
+	}
+	return info, id, nil
+}
+
+// decodeRefresh returns the refresh with the given deals, sorted by the
+// index of the dealer, so that all nodes sign the same refresh whatever the
+// order of the deals.
+func decodeRefresh(id byzcoin.InstanceID, epoch uint64, deals [][]byte) (*LTSRefresh, error) {
+	refresh := &LTSRefresh{LTSID: id, Epoch: epoch}
+	for _, buf := range deals {
+		var d RefreshDeal
+		err := protobuf.DecodeWithConstructors(buf, &d,
+			network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return nil, xerrors.Errorf("decoding deal: %v", err)
+		}
+		refresh.Deals = append(refresh.Deals, d)
+	}
+	sort.Slice(refresh.Deals, func(i, j int) bool {
+		return refresh.Deals[i].Index < refresh.Deals[j].Index
+	})
+	return refresh, nil
+}
+
+// getRefreshInfo verifies the proof and returns the information of the LTS
+// instance in it.
+func (s *Service) getRefreshInfo(proof *byzcoin.Proof) (*LtsInstanceInfo,
+	byzcoin.InstanceID, error) {
+	if err := s.verifyProof(proof); err != nil {
+		return nil, byzcoin.InstanceID{}, xerrors.Errorf("verifying proof: %v", err)
+	}
+	_, _, cid, _, err := proof.KeyValue()
+	if err != nil {
+		return nil, byzcoin.InstanceID{}, xerrors.Errorf("getting contract: %v", err)
+	}
+	if cid != ContractLongTermSecretID {
+		return nil, byzcoin.InstanceID{}, xerrors.New("not an LTS instance")
+	}
+	info, id, err := s.getLtsInfo(proof)
+	if err != nil {
+		return nil, byzcoin.InstanceID{}, xerrors.Errorf("getting LTS info: %v", err)
+	}
+	if info.Epoch == 0 {
+		return nil, byzcoin.InstanceID{}, xerrors.New("the LTS has not been refreshed")
+	}
+	return info, id, nil
+}
+
+// catchUp fetches and applies the refreshes up to epoch that this node
+// missed while it was offline.
+func (s *Service) catchUp(id byzcoin.InstanceID, epoch uint64) error {
+	s.storage.Lock()
+	roster := s.storage.Rosters[id]
+	current := s.storage.Epochs[id]
+	s.storage.Unlock()
+	if roster == nil {
+		return xerrors.Errorf("don't know the LTSID '%v'", id)
+	}
+
+	cl := onet.NewClient(cothority.Suite, ServiceName)
+	for current < epoch {
+		current++
+		sig, err := schnorr.Sign(cothority.Suite, s.getKeyPair().Private,
+			refreshFetchMessage(id, current))
+		if err != nil {
+			return xerrors.Errorf("signing fetch request: %v", err)
+		}
+		log.Lvlf2("%v catching up with epoch %d of LTS %v", s.ServerIdentity(),
+			current, id)
+		err = xerrors.New("no node sent the refresh")
+		for _, si := range roster.List {
+			if si.Equal(s.ServerIdentity()) {
+				continue
+			}
+			var reply refreshFetchReply
+			err = cl.SendProtobuf(si, &refreshFetch{LTSID: id, Epoch: current,
+				Signature: sig}, &reply)
+			if err == nil && !reply.Refresh.LTSID.Equal(id) {
+				err = xerrors.New("got the refresh of another LTS")
+			}
+			if err == nil {
+				err = s.applyRefresh(&reply.Refresh)
+			}
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return xerrors.Errorf("getting epoch %d: %v", current, err)
+		}
+	}
+	return nil
+}
+
+// getRefreshDeal returns the deal of this node for the given epoch. The deal
+// is created only once per epoch, so that a retry of the refresh can still
+// agree on the deals signed before.
+func (s *Service) getRefreshDeal(id byzcoin.InstanceID, epoch uint64) (*RefreshDeal, error) {
+	s.storage.Lock()
+	pending := s.storage.PendingRefresh[id]
+	roster := s.storage.Rosters[id]
+	shared := s.storage.Shared[id]
+	current := s.storage.Epochs[id]
+	s.storage.Unlock()
+	if roster == nil || shared == nil {
+		return nil, xerrors.Errorf("don't know the LTSID '%v'", id)
+	}
+	if current+1 != epoch {
+		return nil, xerrors.Errorf("cannot deal epoch %d while at epoch %d",
+			epoch, current)
+	}
+	if pending != nil && pending.Epoch == epoch && pending.Deal != nil {
+		return pending.Deal, nil
+	}
+
+	suite := cothority.Suite
+	n := len(roster.List)
+	poly := share.NewPriPoly(suite, n-(n-1)/3, suite.Scalar().Zero(),
+		suite.RandomStream())
+	_, commits := poly.Commit(suite.Point().Base()).Info()
+	deal := &RefreshDeal{Index: shared.Index, Commits: commits}
+	for i, si := range roster.List {
+		rs, err := sealRefreshShare(si.ServicePublic(ServiceName), poly.Eval(i).V)
+		if err != nil {
+			return nil, xerrors.Errorf("encrypting share: %v", err)
+		}
+		deal.Shares = append(deal.Shares, *rs)
+	}
+	sig, err := schnorr.Sign(suite, s.getKeyPair().Private, deal.Hash(id, epoch))
+	if err != nil {
+		return nil, xerrors.Errorf("signing deal: %v", err)
+	}
+	deal.Signature = sig
+
+	s.storage.Lock()
+	pending = s.storage.PendingRefresh[id]
+	if pending == nil || pending.Epoch != epoch {
+		pending = &pendingRefresh{Epoch: epoch}
+		s.storage.PendingRefresh[id] = pending
+	}
+	if pending.Deal == nil {
+		pending.Deal = deal
+	}
+	deal = pending.Deal
+	s.storage.Unlock()
+	return deal, s.save()
+}
+
+// applyRefresh verifies that the refresh has been signed by a threshold of
+// nodes and adds its deals to the share of this node.
+func (s *Service) applyRefresh(refresh *LTSRefresh) error {
+	id := refresh.LTSID
+	s.storage.Lock()
+	roster := s.storage.Rosters[id]
+	current := s.storage.Epochs[id]
+	s.storage.Unlock()
+	if roster == nil {
+		return xerrors.Errorf("don't know the LTSID '%v'", id)
+	}
+	err := verifyLTSSignatures(roster, refresh.Hash(), refresh.Signatures)
+	if err != nil {
+		return xerrors.Errorf("verifying the signatures of the refresh: %v", err)
+	}
+	newShared, newDKS, err := s.verifyRefresh(refresh)
+	if err != nil {
+		return err
+	}
+
+	s.storage.Lock()
+	if s.storage.Epochs[id] != current {
+		s.storage.Unlock()
+		return xerrors.New("the LTS has been refreshed concurrently")
+	}
+	s.storage.Shared[id] = newShared
+	s.storage.DKS[id] = newDKS
+	s.storage.Polys[id] = &pubPoly{cothority.Suite.Point().Base(), newShared.Commits}
+	s.storage.Epochs[id] = refresh.Epoch
+	s.storage.Refreshes[id] = append(s.storage.Refreshes[id], refresh)
+	s.storage.Unlock()
+
+	log.Lvlf2("%v applied refresh %d of LTS %v", s.ServerIdentity(),
+		refresh.Epoch, id)
+	return s.save()
+}
+
+// verifyRefresh verifies the deals of the refresh and returns the share of
+// this node with the deals added.
+func (s *Service) verifyRefresh(refresh *LTSRefresh) (*dkgprotocol.SharedSecret,
+	*dkg.DistKeyShare, error) {
+	suite := cothority.Suite
+	id := refresh.LTSID
+	priv := s.getKeyPair().Private
+
+	s.storage.Lock()
+	roster := s.storage.Rosters[id]
+	shared := s.storage.Shared[id]
+	dks := s.storage.DKS[id]
+	current := s.storage.Epochs[id]
+	s.storage.Unlock()
+	if roster == nil || shared == nil || dks == nil {
+		return nil, nil, xerrors.Errorf("don't know the LTSID '%v'", id)
+	}
+	if current+1 != refresh.Epoch {
+		return nil, nil, xerrors.Errorf("cannot apply epoch %d while at epoch %d",
+			refresh.Epoch, current)
+	}
+	n := len(roster.List)
+	if len(refresh.Deals) < n-(n-1)/3 {
+		return nil, nil, xerrors.New("not enough deals in the refresh")
+	}
+
+	delta := suite.Scalar().Zero()
+	commits := make([]kyber.Point, len(dks.Commits))
+	for i, c := range dks.Commits {
+		commits[i] = c.Clone()
+	}
+	dealt := make(map[int]bool)
+	for _, d := range refresh.Deals {
+		if d.Index < 0 || d.Index >= n || dealt[d.Index] {
+			return nil, nil, xerrors.Errorf("invalid dealer index %d", d.Index)
+		}
+		dealt[d.Index] = true
+		err := schnorr.Verify(suite, roster.List[d.Index].ServicePublic(ServiceName),
+			d.Hash(id, refresh.Epoch), d.Signature)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("signature of dealer %d: %v", d.Index, err)
+		}
+		if len(d.Commits) != len(commits) || len(d.Shares) != n {
+			return nil, nil, xerrors.Errorf("deal of dealer %d has wrong size", d.Index)
+		}
+		if !d.Commits[0].Equal(suite.Point().Null()) {
+			return nil, nil, xerrors.Errorf("deal of dealer %d changes the secret", d.Index)
+		}
+		v, err := openRefreshShare(priv, &d.Shares[shared.Index])
+		if err != nil {
+			return nil, nil, xerrors.Errorf("share of dealer %d: %v", d.Index, err)
+		}
+		pub := share.NewPubPoly(suite, suite.Point().Base(), d.Commits)
+		if !suite.Point().Mul(v, nil).Equal(pub.Eval(shared.Index).V) {
+			return nil, nil, xerrors.Errorf("share of dealer %d doesn't match its commits",
+				d.Index)
+		}
+		delta.Add(delta, v)
+		for i := range commits {
+			commits[i].Add(commits[i], d.Commits[i])
+		}
+	}
+
+	newShared := shared.Clone()
+	newShared.V = suite.Scalar().Add(shared.V, delta)
+	newShared.Commits = commits
+	newDKS := *dks
+	newDKS.Commits = commits
+	newDKS.Share = &share.PriShare{I: dks.Share.I, V: newShared.V.Clone()}
+	return newShared, &newDKS, nil
+}
+
+// Hash returns the message signed by the dealer.
+func (d RefreshDeal) Hash(id byzcoin.InstanceID, epoch uint64) []byte {
+	h := sha256.New()
+	h.Write([]byte("calypso refresh deal"))
+	h.Write(id.Slice())
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, epoch)
+	h.Write(buf)
+	binary.LittleEndian.PutUint64(buf, uint64(d.Index))
+	h.Write(buf)
+	for _, c := range d.Commits {
+		c.MarshalTo(h)
+	}
+	for _, sh := range d.Shares {
+		sh.R.MarshalTo(h)
+		h.Write(sh.Cipher)
+	}
+	return h.Sum(nil)
+}
+
+// Hash returns the message signed by the nodes agreeing on the refresh.
+func (r LTSRefresh) Hash() []byte {
+	h := sha256.New()
+	h.Write([]byte("calypso refresh"))
+	h.Write(r.LTSID.Slice())
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, r.Epoch)
+	h.Write(buf)
+	for _, d := range r.Deals {
+		h.Write(d.Hash(r.LTSID, r.Epoch))
+		h.Write(d.Signature)
+	}
+	return h.Sum(nil)
+}
+
+// refreshFetchMessage returns the message signed by a node fetching a
+// refresh.
+func refreshFetchMessage(id byzcoin.InstanceID, epoch uint64) []byte {
+	h := sha256.New()
+	h.Write([]byte("calypso refresh fetch"))
+	h.Write(id.Slice())
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, epoch)
+	h.Write(buf)
+	return h.Sum(nil)
+}
+
+// sealRefreshShare encrypts the share to the public key using an ephemeral
+// key.
+func sealRefreshShare(pub kyber.Point, v kyber.Scalar) (*RefreshShare, error) {
+	r := cothority.Suite.Scalar().Pick(cothority.Suite.RandomStream())
+	buf, err := v.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("marshalling share: %v", err)
+	}
+	cipher, err := sealKey(cothority.Suite.Point().Mul(r, pub), buf)
+	if err != nil {
+		return nil, err
+	}
+	return &RefreshShare{R: cothority.Suite.Point().Mul(r, nil),
+		Cipher: cipher}, nil
+}
+
+// openRefreshShare decrypts the share sealed by sealRefreshShare.
+func openRefreshShare(priv kyber.Scalar, rs *RefreshShare) (kyber.Scalar, error) {
+	buf, err := openKey(cothority.Suite.Point().Mul(priv, rs.R), rs.Cipher)
+	if err != nil {
+		return nil, err
+	}
+	v := cothority.Suite.Scalar()
+	if err := v.UnmarshalBinary(buf); err != nil {
+		return nil, xerrors.Errorf("unmarshalling share: %v", err)
+	}
+	return v, nil
+}
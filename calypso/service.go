@@ -54,6 +54,7 @@ import (
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
 	"go.dedis.ch/protobuf"
+	bbolt "go.etcd.io/bbolt"
 )
 
 // Used for tests
@@ -112,6 +113,14 @@ func init() {
 	if err != nil {
 		log.ErrFatal(err)
 	}
+	err = byzcoin.RegisterGlobalContract(ContractAccessLogID, contractAccessLogFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+	err = byzcoin.RegisterGlobalContract(ContractPriceListID, contractPriceListFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
 }
 
 // Service is our calypso-service. It stores all created LTSs.
@@ -123,6 +132,12 @@ type Service struct {
 	// blocks are only used to insure that proofs start with the expected roster.
 	genesisBlocks     map[string]*skipchain.SkipBlock
 	genesisBlocksLock sync.Mutex
+	// blobDB holds the chunks and manifests of the off-chain blobs.
+	blobDB     *bbolt.DB
+	blobBucket []byte
+	// blobQuota is the number of bytes of blobs stored for one uploader of
+	// an LTS.
+	blobQuota int64
 	// for use by testing only
 	afterReshare func()
 }
@@ -135,11 +150,15 @@ type pubPoly struct {
 
 // vData is sent to all nodes when re-encryption takes place. If Ephemeral
 // is non-nil, Signature needs to hold a valid signature from the reader
-// in the Proof.
+// in the Proof. If the reader asked for the decryption shares,
+// ReaderSignature holds the signature of the request at Timestamp, and the
+// shares are re-encrypted to the ephemeral key of the request.
 type vData struct {
-	Proof     byzcoin.Proof
-	Ephemeral kyber.Point
-	Signature *darc.Signature
+	Proof           byzcoin.Proof
+	Ephemeral       kyber.Point
+	Signature       *darc.Signature
+	Timestamp       int64  `protobuf:"opt"`
+	ReaderSignature []byte `protobuf:"opt"`
 }
 
 // AddReadAttrInterpreter adds a new AttrInterpreters that will be evaluated
@@ -302,7 +321,8 @@ func (s *Service) CreateLTS(req *CreateLTS) (reply *CreateLTSReply, err error) {
 		s.storage.Lock()
 		s.storage.Shared[instID] = shared
 		s.storage.Polys[instID] = &pubPoly{s.Suite().Point().Base(), dks.Commits}
-		s.storage.Rosters[instID] = roster
+		// The roster of the protocol gives the indexes of the shares.
+		s.storage.Rosters[instID] = setupDKG.Roster()
 		s.storage.Replies[instID] = reply
 		s.storage.DKS[instID] = dks
 		s.storage.Unlock()
@@ -322,10 +342,11 @@ func (s *Service) CreateLTS(req *CreateLTS) (reply *CreateLTSReply, err error) {
 // All hosts must be online in this step.
 func (s *Service) ReshareLTS(req *ReshareLTS) (*ReshareLTSReply, error) {
 	// Verify the request
-	roster, id, err := s.getLtsRoster(&req.Proof)
+	info, id, err := s.getLtsInfo(&req.Proof)
 	if err != nil {
 		return nil, xerrors.Errorf("get roster: %v", err)
 	}
+	roster := &info.Roster
 	if err := s.verifyProof(&req.Proof); err != nil {
 		return nil, xerrors.Errorf("verifying proof: %v", err)
 	}
@@ -390,7 +411,7 @@ func (s *Service) ReshareLTS(req *ReshareLTS) (*ReshareLTSReply, error) {
 			Suite:        cothority.Suite,
 			Longterm:     setupDKG.KeyPair.Private,
 			OldNodes:     s.storage.Rosters[id].Publics(),
-			NewNodes:     roster.Publics(),
+			NewNodes:     tree.Roster.Publics(),
 			Share:        s.storage.DKS[id],
 			Threshold:    n - (n-1)/3,
 			OldThreshold: oldn - (oldn-1)/3,
@@ -431,8 +452,10 @@ func (s *Service) ReshareLTS(req *ReshareLTS) (*ReshareLTSReply, error) {
 		}
 		s.storage.Shared[id] = shared
 		s.storage.Polys[id] = &pubPoly{s.Suite().Point().Base(), dks.Commits}
-		s.storage.Rosters[id] = roster
+		s.storage.Rosters[id] = setupDKG.Roster()
 		s.storage.DKS[id] = dks
+		s.storage.Epochs[id] = info.Epoch
+		delete(s.storage.Refreshes, id)
 		s.storage.Unlock()
 		err = s.save()
 		if err != nil {
@@ -507,6 +530,14 @@ func (s *Service) fetchGenesisBlock(scID skipchain.SkipBlockID, roster *onet.Ros
 }
 
 func (s *Service) getLtsRoster(proof *byzcoin.Proof) (*onet.Roster, byzcoin.InstanceID, error) {
+	info, id, err := s.getLtsInfo(proof)
+	if err != nil {
+		return nil, byzcoin.InstanceID{}, err
+	}
+	return &info.Roster, id, nil
+}
+
+func (s *Service) getLtsInfo(proof *byzcoin.Proof) (*LtsInstanceInfo, byzcoin.InstanceID, error) {
 	instanceID, buf, _, _, err := proof.KeyValue()
 	if err != nil {
 		return nil, byzcoin.InstanceID{},
@@ -519,7 +550,7 @@ func (s *Service) getLtsRoster(proof *byzcoin.Proof) (*onet.Roster, byzcoin.Inst
 		return nil, byzcoin.InstanceID{},
 			xerrors.Errorf("decoding roster: %v", err)
 	}
-	return &info.Roster, byzcoin.NewInstanceID(instanceID), nil
+	return &info, byzcoin.NewInstanceID(instanceID), nil
 }
 
 // DecryptKey takes as an input a Read- and a Write-proof. Proofs contain
@@ -532,55 +563,187 @@ func (s *Service) DecryptKey(dkr *DecryptKey) (reply *DecryptKeyReply, err error
 	reply = &DecryptKeyReply{}
 	log.Lvl2(s.ServerIdentity(), "Re-encrypt the key to the public key of the reader")
 
+	read, write, err := s.verifyReadWrite(&dkr.Read, &dkr.Write)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start ocs-protocol to re-encrypt the file's symmetric key under the
+	// reader's public key.
+	log.Lvlf2("%v Public key is: %s", s.ServerIdentity(), read.Xc)
+	ocsProto, err := s.runOCS(write.LTSID, write.U, read.Xc, &vData{
+		Proof:     dkr.Read,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.logAccess(&dkr.Read, ocsProto); err != nil {
+		log.Warnf("%v: couldn't log access: %v", s.ServerIdentity(), err)
+	}
+	reply.X = ocsProto.Shared.X.Clone()
+	nodes := len(ocsProto.Roster().List)
+	threshold := nodes - (nodes-1)/3
+	reply.XhatEnc, err = share.RecoverCommit(cothority.Suite, ocsProto.Uis,
+		threshold, nodes)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to recover commit: %v", err)
+	}
+	reply.C = write.C
+	reply.KeyCipher = write.KeyCipher
+	log.Lvl3("Successfully reencrypted the key")
+	return
+}
+
+// DecryptKeyShares verifies the Read- and the Write-proof like DecryptKey,
+// but instead of re-encrypting the secret, the nodes of the LTS return their
+// decryption shares together with a proof for each share. The request must
+// be signed by the reader of the Read-instance, so that the shares are only
+// sent back on a channel opened by the reader.
+func (s *Service) DecryptKeyShares(req *DecryptKeyShares) (*DecryptKeySharesReply, error) {
+	log.Lvl2(s.ServerIdentity(), "Decrypt the key for the reader")
+
+	read, write, err := s.verifyReadWrite(&req.Read, &req.Write)
+	if err != nil {
+		return nil, err
+	}
+	readID := byzcoin.NewInstanceID(req.Read.InclusionProof.Key())
+	err = verifyReaderSignature(readID, read.Xc, req.Ephemeral, req.Timestamp,
+		req.Signature)
+	if err != nil {
+		return nil, xerrors.Errorf("verifying request: %v", err)
+	}
+
+	// The shares are re-encrypted to the ephemeral key, so that only the
+	// reader who signed the request can use them.
+	ocsProto, err := s.runOCS(write.LTSID, write.U, req.Ephemeral, &vData{
+		Proof:           req.Read,
+		Timestamp:       req.Timestamp,
+		ReaderSignature: req.Signature,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.logAccess(&req.Read, ocsProto); err != nil {
+		log.Warnf("%v: couldn't log access: %v", s.ServerIdentity(), err)
+	}
+	_, commits := ocsProto.Poly.Info()
+	reply := &DecryptKeySharesReply{
+		U:         write.U,
+		C:         write.C,
+		KeyCipher: write.KeyCipher,
+		X:         ocsProto.Shared.X.Clone(),
+		Commits:   commits,
+	}
+	for _, r := range ocsProto.Replies {
+		reply.Shares = append(reply.Shares, DecryptShare{
+			Index: r.Ui.I,
+			Ui:    r.Ui.V,
+			Ei:    r.Ei,
+			Fi:    r.Fi,
+		})
+	}
+	log.Lvl3("Successfully decrypted the key")
+	return reply, nil
+}
+
+// verifyReadWrite checks that both proofs come from an authorised ByzCoin
+// instance, that the read points to the write, and that the LTS of the write
+// is known to this node.
+func (s *Service) verifyReadWrite(readProof, writeProof *byzcoin.Proof) (*Read, *Write, error) {
 	var read Read
-	if err := dkr.Read.VerifyAndDecode(cothority.Suite, ContractReadID, &read); err != nil {
-		return nil, xerrors.New("didn't get a read instance: " + err.Error())
+	if err := readProof.VerifyAndDecode(cothority.Suite, ContractReadID, &read); err != nil {
+		return nil, nil, xerrors.New("didn't get a read instance: " + err.Error())
 	}
 
 	var write Write
-	if err := dkr.Write.VerifyAndDecode(cothority.Suite, ContractWriteID, &write); err != nil {
-		return nil, xerrors.New("didn't get a write instance: " + err.Error())
+	if err := writeProof.VerifyAndDecode(cothority.Suite, ContractWriteID, &write); err != nil {
+		return nil, nil, xerrors.New("didn't get a write instance: " + err.Error())
 	}
-	if !read.Write.Equal(byzcoin.NewInstanceID(dkr.Write.InclusionProof.Key())) {
-		return nil, xerrors.New("read doesn't point to passed write")
+	if !read.Write.Equal(byzcoin.NewInstanceID(writeProof.InclusionProof.Key())) {
+		return nil, nil, xerrors.New("read doesn't point to passed write")
 	}
 	s.storage.Lock()
 	id := write.LTSID
 	roster := s.storage.Rosters[id]
+	s.storage.Unlock()
 	if roster == nil {
-		s.storage.Unlock()
-		return nil,
+		return nil, nil,
 			xerrors.Errorf("don't know the LTSID '%v' stored in write", id)
 	}
-	s.storage.Unlock()
 
-	if err = s.verifyProof(&dkr.Read); err != nil {
-		return nil, xerrors.Errorf(
+	if err := s.verifyProof(readProof); err != nil {
+		return nil, nil, xerrors.Errorf(
 			"read proof cannot be verified to come from scID: %v",
 			err)
 	}
-	if err = s.verifyProof(&dkr.Write); err != nil {
-		return nil, xerrors.Errorf(
+	if err := s.verifyProof(writeProof); err != nil {
+		return nil, nil, xerrors.Errorf(
 			"write proof cannot be verified to come from scID: %v",
 			err)
 	}
 
-	// Start ocs-protocol to re-encrypt the file's symmetric key under the
-	// reader's public key.
+	latest, err := s.latestWrite(writeProof,
+		byzcoin.NewInstanceID(writeProof.InclusionProof.Key()))
+	if err != nil {
+		return nil, nil, xerrors.Errorf("getting latest write: %v", err)
+	}
+	now := time.Now().Unix()
+	if err := latest.CheckValidity(now); err != nil {
+		return nil, nil, err
+	}
+	if err := read.CheckValidity(now); err != nil {
+		return nil, nil, err
+	}
+	return &read, latest, nil
+}
+
+// latestWrite returns the write writeID in the latest block of the ByzCoin
+// of the proof, as the write in a proof sent by the reader might not include
+// a revocation.
+func (s *Service) latestWrite(prf *byzcoin.Proof, writeID byzcoin.InstanceID) (
+	*Write, error) {
+	cl := byzcoin.NewClient(prf.Latest.SkipChainID(), *prf.Latest.Roster)
+	resp, err := cl.GetProofFromLatest(writeID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("getting proof: %v", err)
+	}
+	if resp.Proof.Latest.Index < prf.Latest.Index {
+		return nil, xerrors.New("got a proof older than the one of the reader")
+	}
+	if err := s.verifyProof(&resp.Proof); err != nil {
+		return nil, xerrors.Errorf("verifying proof: %v", err)
+	}
+	var write Write
+	err = resp.Proof.VerifyAndDecode(cothority.Suite, ContractWriteID, &write)
+	if err != nil {
+		return nil, xerrors.Errorf("didn't get a write instance: %v", err)
+	}
+	return &write, nil
+}
+
+// runOCS runs the ocs-protocol on the LTS with the given id and returns the
+// finished protocol instance.
+func (s *Service) runOCS(id byzcoin.InstanceID, U, Xc kyber.Point,
+	verificationData *vData) (*protocol.OCS, error) {
+	s.storage.Lock()
+	roster := s.storage.Rosters[id]
+	s.storage.Unlock()
+	if roster == nil {
+		return nil, xerrors.Errorf("don't know the LTSID '%v'", id)
+	}
+
 	nodes := len(roster.List)
-	threshold := nodes - (nodes-1)/3
 	tree := roster.GenerateNaryTreeWithRoot(nodes, s.ServerIdentity())
 	pi, err := s.CreateProtocol(protocol.NameOCS, tree)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to create ocs-protocol: %v", err)
 	}
 	ocsProto := pi.(*protocol.OCS)
-	ocsProto.U = write.U
-	verificationData := &vData{
-		Proof: dkr.Read,
-	}
-	ocsProto.Xc = read.Xc
-	log.Lvlf2("%v Public key is: %s", s.ServerIdentity(), ocsProto.Xc)
+	ocsProto.U = U
+	ocsProto.Xc = Xc
+	ocsProto.Verify = s.verifyReencryption
+	ocsProto.Sign = s.signReceipt
 	ocsProto.VerificationData, err = protobuf.Encode(verificationData)
 	if err != nil {
 		return nil,
@@ -590,9 +753,8 @@ func (s *Service) DecryptKey(dkr *DecryptKey) (reply *DecryptKeyReply, err error
 	// Make sure everything used from the s.Storage structure is copied, so
 	// there will be no races.
 	s.storage.Lock()
-	ocsProto.Shared = s.storage.Shared[id]
+	ocsProto.Shared = s.storage.Shared[id].Clone()
 	pp := s.storage.Polys[id]
-	reply.X = s.storage.Shared[id].X.Clone()
 	var commits []kyber.Point
 	for _, c := range pp.Commits {
 		commits = append(commits, c.Clone())
@@ -614,14 +776,7 @@ func (s *Service) DecryptKey(dkr *DecryptKey) (reply *DecryptKeyReply, err error
 		return nil, xerrors.New("reencryption got refused")
 	}
 	log.Lvl3("Reencryption protocol is done.")
-	reply.XhatEnc, err = share.RecoverCommit(cothority.Suite, ocsProto.Uis,
-		threshold, nodes)
-	if err != nil {
-		return nil, xerrors.Errorf("failed to recover commit: %v", err)
-	}
-	reply.C = write.C
-	log.Lvl3("Successfully reencrypted the key")
-	return
+	return ocsProto, nil
 }
 
 // GetLTSReply returns the CreateLTSReply message of a previous LTS.
@@ -707,7 +862,10 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 			return nil, xerrors.Errorf("verifying proof: %v", err)
 		}
 
-		roster, id, err := s.getLtsRoster(&cfg.Proof)
+		info, id, err := s.getLtsInfo(&cfg.Proof)
+		if err != nil {
+			return nil, xerrors.Errorf("getting LTS info: %v", err)
+		}
 
 		// Set up the protocol
 		pi, err := dkgprotocol.NewSetup(tn)
@@ -784,7 +942,9 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 			}
 			s.storage.Shared[id] = shared
 			s.storage.DKS[id] = dks
-			s.storage.Rosters[id] = roster
+			s.storage.Rosters[id] = tn.Roster()
+			s.storage.Epochs[id] = info.Epoch
+			delete(s.storage.Refreshes, id)
 			s.storage.Unlock()
 			err = s.save()
 			if err != nil {
@@ -811,7 +971,16 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 		ocs := pi.(*protocol.OCS)
 		ocs.Shared = shared
 		ocs.Verify = s.verifyReencryption
+		ocs.Sign = s.signReceipt
 		return ocs, nil
+	case protocol.NameRefresh:
+		pi, err := protocol.NewRefresh(tn)
+		if err != nil {
+			return nil, xerrors.Errorf("creating refresh protocol instance: %v", err)
+		}
+		refresh := pi.(*protocol.Refresh)
+		s.setRefreshCallbacks(refresh)
+		return refresh, nil
 	}
 	return nil, nil
 }
@@ -833,7 +1002,7 @@ func (s *Service) verifyReencryption(rc *protocol.Reencrypt) bool {
 		if err != nil {
 			return xerrors.Errorf("decoding verification data: %v", err)
 		}
-		_, v0, contractID, _, err := verificationData.Proof.KeyValue()
+		k, v0, contractID, _, err := verificationData.Proof.KeyValue()
 		if err != nil {
 			return xerrors.Errorf("proof cannot return values: %v", err)
 		}
@@ -848,6 +1017,37 @@ func (s *Service) verifyReencryption(rc *protocol.Reencrypt) bool {
 		if verificationData.Ephemeral != nil {
 			return xerrors.New("ephemeral keys not supported yet")
 		}
+		if err := checkTimestamp(verificationData.Timestamp); err != nil {
+			return err
+		}
+
+		// Every node checks the latest version of the write, so that a
+		// leader cannot get the shares of a revoked or expired write, nor
+		// use a read to decrypt another write.
+		if err := s.verifyProof(&verificationData.Proof); err != nil {
+			return xerrors.Errorf("verifying read proof: %v", err)
+		}
+		latest, err := s.latestWrite(&verificationData.Proof, r.Write)
+		if err != nil {
+			return xerrors.Errorf("getting latest write: %v", err)
+		}
+		if !latest.U.Equal(rc.U) {
+			return xerrors.New("the request is not for the write of the read")
+		}
+		now := time.Now().Unix()
+		if err := latest.CheckValidity(now); err != nil {
+			return err
+		}
+		if err := r.CheckValidity(now); err != nil {
+			return err
+		}
+		if verificationData.ReaderSignature != nil {
+			// The shares are re-encrypted to an ephemeral key, so the
+			// request must have been signed by the reader.
+			return verifyReaderSignature(byzcoin.NewInstanceID(k),
+				r.Xc, rc.Xc, verificationData.Timestamp,
+				verificationData.ReaderSignature)
+		}
 		if !r.Xc.Equal(rc.Xc) {
 			return xerrors.New("wrong reader")
 		}
@@ -868,10 +1068,18 @@ func newService(c *onet.Context) (onet.Service, error) {
 		ServiceProcessor: onet.NewServiceProcessor(c),
 		genesisBlocks:    make(map[string]*skipchain.SkipBlock),
 	}
-	if err := s.RegisterHandlers(s.CreateLTS, s.ReshareLTS, s.DecryptKey,
-		s.GetLTSReply, s.Authorise, s.Authorize, s.updateValidPeers); err != nil {
+	if err := s.RegisterHandlers(s.CreateLTS, s.ReshareLTS, s.RefreshLTS,
+		s.DecryptKey, s.DecryptKeyShares, s.GetLTSReply, s.Authorise,
+		s.Authorize, s.updateValidPeers, s.refreshFetch,
+		s.StoreBlobChunk, s.StoreBlobManifest,
+		s.GetBlobChunk, s.GetBlobManifest, s.DeleteBlob, s.MigrateWrites,
+		s.migrationShare, s.migrationSign); err != nil {
 		return nil, xerrors.New("couldn't register messages")
 	}
+	db, bucket := c.GetAdditionalBucket(blobBucketName)
+	s.blobDB = db
+	s.blobBucket = bucket
+	s.blobQuota = BlobQuota
 	if err := s.tryLoad(); err != nil {
 		log.Error(err)
 		return nil, xerrors.Errorf("loading configuration: %v", err)
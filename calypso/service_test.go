@@ -1,6 +1,9 @@
 package calypso
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"sync"
 	"testing"
 	"time"
@@ -10,13 +13,18 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/calypso/protocol"
 	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
 	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/kyber/v3/util/random"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/protobuf"
+	bbolt "go.etcd.io/bbolt"
 )
 
 func TestMain(m *testing.M) {
@@ -54,7 +62,7 @@ func TestService_ReshareLTS_Different(t *testing.T) {
 	// The current DKG is on List[0:nodes], and this new roster will
 	// be on List[nodes:], thus entirely disjoint.
 	otherRoster := onet.NewRoster(s.allRoster.List[nodes:])
-	ltsInstInfoBuf, err := protobuf.Encode(&LtsInstanceInfo{*otherRoster})
+	ltsInstInfoBuf, err := protobuf.Encode(&LtsInstanceInfo{Roster: *otherRoster})
 	require.NoError(t, err)
 
 	ctx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion,
@@ -92,7 +100,7 @@ func TestService_ReshareLTS_Same(t *testing.T) {
 			require.NotNil(t, s.ltsReply.X)
 			sec1 := s.reconstructKey(t)
 
-			ltsInstInfoBuf, err := protobuf.Encode(&LtsInstanceInfo{*s.ltsRoster})
+			ltsInstInfoBuf, err := protobuf.Encode(&LtsInstanceInfo{Roster: *s.ltsRoster})
 			require.NoError(t, err)
 
 			ctx, err := s.cl.CreateTransaction(byzcoin.Instruction{
@@ -160,7 +168,7 @@ func TestService_ReshareLTS_OneMore(t *testing.T) {
 			// Create a new roster that has one more node than
 			// before
 			s.ltsRoster = onet.NewRoster(s.allRoster.List[:nodes+1])
-			ltsInstInfoBuf, err := protobuf.Encode(&LtsInstanceInfo{*s.ltsRoster})
+			ltsInstInfoBuf, err := protobuf.Encode(&LtsInstanceInfo{Roster: *s.ltsRoster})
 			require.NoError(t, err)
 
 			ctx, err := s.cl.CreateTransaction(byzcoin.Instruction{
@@ -210,6 +218,535 @@ func TestService_ReshareLTS_OneMore(t *testing.T) {
 	}
 }
 
+// TestService_RefreshLTS refreshes the shares of the LTS twice, with a node
+// missing the first refresh and catching up during the second one.
+func TestService_RefreshLTS(t *testing.T) {
+	s := newTS(t, 4)
+	defer s.closeAll(t)
+	id := s.ltsReply.InstanceID
+	sec := s.reconstructKey(t)
+
+	late := s.services[3]
+	late.storage.Lock()
+	oldShared, oldDKS, oldPoly := late.storage.Shared[id], late.storage.DKS[id],
+		late.storage.Polys[id]
+	late.storage.Unlock()
+
+	cl := NewClient(s.cl)
+	reply, err := cl.RefreshLTS(id, []darc.Signer{s.signer}, []uint64{2})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), reply.Epoch)
+	require.Len(t, reply.Dealers, 4)
+	require.Len(t, reply.Offline, 0)
+	require.True(t, s.reconstructKey(t).Equal(sec))
+	late.storage.Lock()
+	require.False(t, late.storage.DKS[id].PriShare().V.Equal(oldDKS.PriShare().V))
+
+	// Go back to the shares of epoch 0, as if the node missed the refresh.
+	late.storage.Shared[id], late.storage.DKS[id], late.storage.Polys[id] =
+		oldShared, oldDKS, oldPoly
+	late.storage.Epochs[id] = 0
+	delete(late.storage.Refreshes, id)
+	late.storage.Unlock()
+
+	reply, err = cl.RefreshLTS(id, []darc.Signer{s.signer}, []uint64{3})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), reply.Epoch)
+	require.Len(t, reply.Offline, 0)
+	for _, srv := range s.services[:4] {
+		srv.storage.Lock()
+		require.Equal(t, uint64(2), srv.storage.Epochs[id])
+		srv.storage.Unlock()
+	}
+	require.True(t, s.reconstructKey(t).Equal(sec))
+
+	// The same epoch cannot be applied twice.
+	proof, err := s.cl.GetProof(id.Slice())
+	require.NoError(t, err)
+	_, err = s.services[0].RefreshLTS(&RefreshLTS{Proof: proof.Proof})
+	require.Error(t, err)
+}
+
+// TestService_RefreshVote makes sure that a node never signs two different
+// sets of deals for the same epoch, and that only the nodes of the LTS can
+// fetch the refreshes.
+func TestService_RefreshVote(t *testing.T) {
+	s := newTS(t, 4)
+	defer s.closeAll(t)
+	id := s.ltsReply.InstanceID
+
+	tx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion,
+		byzcoin.Instruction{
+			InstanceID: id,
+			Invoke: &byzcoin.Invoke{
+				ContractID: ContractLongTermSecretID,
+				Command:    "refresh",
+			},
+			SignerCounter: []uint64{2},
+		},
+	)
+	require.NoError(t, tx.FillSignersAndSignWith(s.signer))
+	atr, err := s.cl.AddTransactionAndWait(tx, 10)
+	require.NoError(t, err)
+	proof, err := s.cl.GetProofAfter(id.Slice(), true, &atr.Proof.Latest)
+	require.NoError(t, err)
+	data, err := protobuf.Encode(&refreshLtsConfig{Proof: proof.Proof})
+	require.NoError(t, err)
+
+	var deals [][]byte
+	for _, srv := range s.services {
+		deal, err := srv.refreshDeal(data)
+		require.NoError(t, err)
+		deals = append(deals, deal)
+	}
+	// The deal of a node doesn't change for the same epoch.
+	deal, err := s.services[0].refreshDeal(data)
+	require.NoError(t, err)
+	require.Equal(t, deals[0], deal)
+
+	voter := s.services[0]
+	_, err = voter.refreshVote(data, deals[:3])
+	require.NoError(t, err)
+	_, err = voter.refreshVote(data, deals[:3])
+	require.NoError(t, err)
+	_, err = voter.refreshVote(data, deals[1:])
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "already signed")
+
+	// The signatures of less than a threshold of nodes are refused.
+	sig, err := voter.refreshVote(data, deals[:3])
+	require.NoError(t, err)
+	err = s.services[1].refreshApply(data, deals[:3], [][]byte{sig})
+	require.Error(t, err)
+
+	// A fetch request must be signed by a node of the LTS.
+	_, err = voter.refreshFetch(&refreshFetch{LTSID: id, Epoch: 1})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "only the nodes of the LTS")
+}
+
+// TestService_Blob stores a blob over several chunks and fetches it back.
+func TestService_Blob(t *testing.T) {
+	s := newTS(t, 4)
+	defer s.closeAll(t)
+	id := s.ltsReply.InstanceID
+
+	data := make([]byte, 2*BlobChunkSize+100)
+	random.Bytes(data, random.New())
+	cl := NewClient(s.cl)
+	root, err := cl.UploadBlob(id, s.ltsRoster, data, 2, s.signer,
+		s.gDarc.GetBaseID())
+	require.NoError(t, err)
+	require.Len(t, root, 32)
+
+	// Every chunk must be on exactly two nodes.
+	manifest := BlobManifest{Size: int64(len(data))}
+	for start := 0; start < len(data); start += BlobChunkSize {
+		end := start + BlobChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		h := sha256.Sum256(data[start:end])
+		manifest.ChunkHashes = append(manifest.ChunkHashes, h[:])
+		stored := 0
+		for _, srv := range s.services {
+			if _, err := srv.GetBlobChunk(&GetBlobChunk{Hash: h[:]}); err == nil {
+				stored++
+			}
+		}
+		require.Equal(t, 2, stored)
+	}
+	require.Equal(t, manifest.Root(), root)
+	// The size is bound into the root.
+	manifest.Size--
+	require.NotEqual(t, manifest.Root(), root)
+
+	buf, err := cl.DownloadBlob(s.ltsRoster, root)
+	require.NoError(t, err)
+	require.Equal(t, data, buf)
+
+	// An unknown root must fail.
+	root[0] ^= 1
+	_, err = cl.DownloadBlob(s.ltsRoster, root)
+	require.Error(t, err)
+
+	resp, err := s.cl.GetProofFromLatest(s.gDarc.GetBaseID())
+	require.NoError(t, err)
+	chunkReq := func(ltsID byzcoin.InstanceID, signer darc.Signer,
+		data []byte) *StoreBlobChunk {
+		h := sha256.Sum256(data)
+		sig, err := signer.Sign(blobMessage(ltsID,
+			append([]byte("c"), h[:]...)))
+		require.NoError(t, err)
+		return &StoreBlobChunk{LTSID: ltsID, Data: data,
+			Uploader: signer.Identity(), Darc: resp.Proof, Signature: sig}
+	}
+
+	// Only nodes of the LTS accept chunks.
+	req := chunkReq(byzcoin.NewInstanceID([]byte("unknown")), s.signer,
+		data[:10])
+	req.Replication = 1
+	_, err = s.services[0].StoreBlobChunk(req)
+	require.Error(t, err)
+
+	// Only signers allowed to spawn writes can store chunks, and the
+	// signature must match the chunk.
+	srv := s.services[0]
+	_, err = srv.StoreBlobChunk(chunkReq(id, darc.NewSignerEd25519(nil, nil),
+		data[:10]))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot spawn writes")
+	req = chunkReq(id, s.signer, data[:10])
+	req.Data = data[10:20]
+	_, err = srv.StoreBlobChunk(req)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signature")
+
+	// A node doesn't store more than its quota for an uploader, but storing
+	// the same chunk again is free.
+	_, err = srv.StoreBlobChunk(chunkReq(id, s.signer, data[:10]))
+	require.NoError(t, err)
+	srv.blobQuota = 0
+	_, err = srv.StoreBlobChunk(chunkReq(id, s.signer, data[:10]))
+	require.NoError(t, err)
+	_, err = srv.StoreBlobChunk(chunkReq(id, s.signer, data[10:20]))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "quota")
+}
+
+// TestService_DeleteBlob deletes the blob of a revoked write and checks that
+// it is only deleted for its uploader.
+func TestService_DeleteBlob(t *testing.T) {
+	s := newTS(t, 4)
+	defer s.closeAll(t)
+	cl := NewClient(s.cl)
+
+	data := make([]byte, 2*StreamChunkSize+100)
+	random.Bytes(data, random.New())
+	reply, err := cl.WriteStream(bytes.NewReader(data), s.ltsReply.InstanceID,
+		s.ltsReply.X, 2, s.signer, s.nextCtr(t), *s.gDarc, 10)
+	require.NoError(t, err)
+	writeProof := func() *byzcoin.Proof {
+		resp, err := s.cl.GetProofFromLatest(reply.InstanceID.Slice())
+		require.NoError(t, err)
+		return &resp.Proof
+	}
+	var write Write
+	require.NoError(t, writeProof().VerifyAndDecode(cothority.Suite,
+		ContractWriteID, &write))
+
+	// The blob of a valid write cannot be deleted.
+	_, err = cl.DeleteBlob(s.ltsRoster, writeProof(), s.signer)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "revoked or expired")
+
+	_, err = cl.RevokeWrite(reply.InstanceID, s.signer, s.nextCtr(t), 10)
+	require.NoError(t, err)
+
+	// Another signer doesn't own any of the values.
+	deleted, err := cl.DeleteBlob(s.ltsRoster, writeProof(),
+		darc.NewSignerEd25519(nil, nil))
+	require.NoError(t, err)
+	require.Equal(t, 0, deleted)
+	_, err = cl.DownloadBlob(s.ltsRoster, write.BlobRoot)
+	require.NoError(t, err)
+
+	// Three chunks and the manifest, on two nodes each.
+	deleted, err = cl.DeleteBlob(s.ltsRoster, writeProof(), s.signer)
+	require.NoError(t, err)
+	require.Equal(t, 8, deleted)
+	_, err = cl.DownloadBlob(s.ltsRoster, write.BlobRoot)
+	require.Error(t, err)
+	for _, srv := range s.services {
+		err := srv.blobDB.View(func(tx *bbolt.Tx) error {
+			k, _ := tx.Bucket(srv.blobBucket).Cursor().Seek([]byte("c"))
+			require.False(t, bytes.HasPrefix(k, []byte("c")))
+			return nil
+		})
+		require.NoError(t, err)
+	}
+}
+
+// TestService_Stream encrypts a stream to a blob and decrypts it back.
+func TestService_Stream(t *testing.T) {
+	s := newTS(t, 4)
+	defer s.closeAll(t)
+	cl := NewClient(s.cl)
+
+	data := make([]byte, 2*StreamChunkSize+100)
+	random.Bytes(data, random.New())
+	reply, err := cl.WriteStream(bytes.NewReader(data), s.ltsReply.InstanceID,
+		s.ltsReply.X, 2, s.signer, s.nextCtr(t), *s.gDarc, 10)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	_, err = cl.ReadStream(reply.InstanceID, &out, s.signer, s.nextCtr(t), 10)
+	require.NoError(t, err)
+	require.Equal(t, data, out.Bytes())
+
+	// A write without blob cannot be streamed.
+	prWrite := s.addWriteAndWait(t, []byte("secret key"))
+	_, err = cl.ReadStream(byzcoin.NewInstanceID(prWrite.InclusionProof.Key()),
+		&out, s.signer, s.nextCtr(t), 10)
+	require.Error(t, err)
+}
+
+// TestService_PaidRead checks that the cost of a read is paid to the writer
+// in the transaction spawning the read, either from a payer coin instance or
+// from the coins fetched by a previous instruction.
+func TestService_PaidRead(t *testing.T) {
+	s := newTS(t, 4)
+	defer s.closeAll(t)
+	cl := NewClient(s.cl)
+
+	beneficiary := s.spawnCoin(t, 0)
+	payer := s.spawnCoin(t, 100)
+
+	write := NewWrite(cothority.Suite, s.ltsReply.InstanceID,
+		s.gDarc.GetBaseID(), s.ltsReply.X, []byte("secret key"))
+	write.Cost = byzcoin.Coin{Name: contracts.CoinName, Value: 10}
+	_, err := cl.AddWrite(write, s.signer, s.nextCtr(t), *s.gDarc, 10)
+	require.Error(t, err)
+	write.Beneficiary = &beneficiary
+	writeReply, err := cl.AddWrite(write, s.signer, s.nextCtr(t), *s.gDarc, 10)
+	require.NoError(t, err)
+
+	priced, err := cl.PricedWrites(s.gDarc.GetBaseID())
+	require.NoError(t, err)
+	require.Len(t, priced, 1)
+	require.True(t, priced[0].Write.Equal(writeReply.InstanceID))
+	require.Equal(t, uint64(10), priced[0].Cost.Value)
+
+	// A read without payer nor coins is refused.
+	prWrite := s.waitInstID(t, writeReply.InstanceID)
+	_, err = cl.AddRead(prWrite, s.signer, s.nextCtr(t), 10)
+	require.Error(t, err)
+
+	// The beneficiary is credited as soon as the reads are spawned.
+	ctr := s.nextCtr(t)
+	_, err = cl.AddPaidRead(prWrite, s.signer, ctr, payer, 10)
+	require.NoError(t, err)
+	_, err = cl.AddPaidRead(prWrite, s.signer, ctr+1, payer, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(80), s.coinValue(t, payer))
+	require.Equal(t, uint64(20), s.coinValue(t, beneficiary))
+
+	// The read can also be paid with the coins fetched by the previous
+	// instruction of the transaction.
+	costBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(costBuf, 10)
+	readBuf, err := protobuf.Encode(&Read{Write: writeReply.InstanceID,
+		Xc: s.signer.Ed25519.Point})
+	require.NoError(t, err)
+	ctx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion,
+		byzcoin.Instruction{
+			InstanceID: payer,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "fetch",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: costBuf}},
+			},
+			SignerCounter: []uint64{ctr + 2},
+		},
+		byzcoin.Instruction{
+			InstanceID: writeReply.InstanceID,
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractReadID,
+				Args:       byzcoin.Arguments{{Name: "read", Value: readBuf}},
+			},
+			SignerCounter: []uint64{ctr + 3},
+		})
+	require.NoError(t, ctx.FillSignersAndSignWith(s.signer))
+	_, err = s.cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(70), s.coinValue(t, payer))
+	require.Equal(t, uint64(30), s.coinValue(t, beneficiary))
+
+	// Revoking the write refunds nothing, but removes it from the price
+	// list.
+	_, err = cl.RevokeWrite(writeReply.InstanceID, s.signer, ctr+4, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(70), s.coinValue(t, payer))
+	require.Equal(t, uint64(30), s.coinValue(t, beneficiary))
+
+	priced, err = cl.PricedWrites(s.gDarc.GetBaseID())
+	require.NoError(t, err)
+	require.Len(t, priced, 0)
+}
+
+// TestService_MigrateWrites re-encrypts a write to a second LTS on other
+// nodes and decrypts it with the new LTS.
+func TestService_MigrateWrites(t *testing.T) {
+	nodes := 4
+	s := newTSWithExtras(t, nodes, nodes)
+	defer s.closeAll(t)
+	cl := NewClient(s.cl)
+
+	newRoster := onet.NewRoster(s.allRoster.List[nodes:])
+	buf, err := protobuf.Encode(&LtsInstanceInfo{Roster: *newRoster})
+	require.NoError(t, err)
+	tx, err := s.cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(s.gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractLongTermSecretID,
+			Args: byzcoin.Arguments{{Name: "lts_instance_info",
+				Value: buf}},
+		},
+		SignerCounter: []uint64{s.nextCtr(t)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.FillSignersAndSignWith(s.signer))
+	_, err = s.cl.AddTransactionAndWait(tx, 4)
+	require.NoError(t, err)
+	prLTS := s.waitInstID(t, tx.Instructions[0].DeriveID(""))
+	newLTS, err := s.services[nodes].CreateLTS(&CreateLTS{Proof: *prLTS})
+	require.NoError(t, err)
+
+	key := []byte("secret key")
+	prWrite := s.addWriteAndWait(t, key)
+	writeID := byzcoin.NewInstanceID(prWrite.InclusionProof.Key())
+	var write Write
+	require.NoError(t, prWrite.VerifyAndDecode(cothority.Suite,
+		ContractWriteID, &write))
+
+	// The write must first be allowed to migrate.
+	_, err = s.services[0].MigrateWrites(&MigrateWrites{
+		Writes: []byzcoin.Proof{*prWrite}, NewLTS: *prLTS})
+	require.Error(t, err)
+
+	migrations, err := cl.MigrateWrites([]byzcoin.InstanceID{writeID},
+		newLTS.InstanceID, []darc.Signer{s.signer}, []uint64{s.nextCtr(t)})
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+	require.True(t, migrations[0].Write.Equal(writeID))
+
+	bad := migrations[0]
+	bad.C = cothority.Suite.Point().Pick(cothority.Suite.RandomStream())
+	_, err = cl.AddWrite(write.Migrate(bad), s.signer, s.nextCtr(t), *s.gDarc,
+		10)
+	require.Error(t, err)
+	// The data of the write cannot change with the migration.
+	changed := write.Migrate(migrations[0])
+	changed.Data = []byte("other data")
+	_, err = cl.AddWrite(changed, s.signer, s.nextCtr(t), *s.gDarc, 10)
+	require.Error(t, err)
+
+	reply, err := cl.AddWrite(write.Migrate(migrations[0]), s.signer,
+		s.nextCtr(t), *s.gDarc, 10)
+	require.NoError(t, err)
+	prNew := s.waitInstID(t, reply.InstanceID)
+
+	// The previous write is marked as migrated and cannot be migrated again.
+	prOld := s.waitInstID(t, writeID)
+	var old Write
+	require.NoError(t, prOld.VerifyAndDecode(cothority.Suite,
+		ContractWriteID, &old))
+	require.NotNil(t, old.MigratedTo)
+	require.True(t, old.MigratedTo.Equal(reply.InstanceID))
+	_, err = cl.AddWrite(write.Migrate(migrations[0]), s.signer,
+		s.nextCtr(t), *s.gDarc, 10)
+	require.Error(t, err)
+	_, err = s.services[0].MigrateWrites(&MigrateWrites{
+		Writes: []byzcoin.Proof{*prOld}, NewLTS: *prLTS})
+	require.Error(t, err)
+
+	prRe := s.addReadAndWait(t, prNew, s.signer.Ed25519.Point)
+	dk, err := s.services[nodes].DecryptKey(&DecryptKey{Read: *prRe,
+		Write: *prNew})
+	require.NoError(t, err)
+	require.True(t, dk.X.Equal(newLTS.X))
+	keyCopy, err := dk.RecoverKey(s.signer.Ed25519.Secret)
+	require.NoError(t, err)
+	require.Equal(t, key, keyCopy)
+}
+
+// TestService_MigrateWrites_Shares checks that a node of the old LTS seeing
+// all the shares of the migrations cannot recover the migrated keys, not
+// even with the help of another migrated key.
+func TestService_MigrateWrites_Shares(t *testing.T) {
+	nodes := 4
+	s := newTSWithExtras(t, nodes, nodes)
+	defer s.closeAll(t)
+	cl := NewClient(s.cl)
+
+	newRoster := onet.NewRoster(s.allRoster.List[nodes:])
+	buf, err := protobuf.Encode(&LtsInstanceInfo{Roster: *newRoster})
+	require.NoError(t, err)
+	tx, err := s.cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(s.gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractLongTermSecretID,
+			Args: byzcoin.Arguments{{Name: "lts_instance_info",
+				Value: buf}},
+		},
+		SignerCounter: []uint64{s.nextCtr(t)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.FillSignersAndSignWith(s.signer))
+	_, err = s.cl.AddTransactionAndWait(tx, 4)
+	require.NoError(t, err)
+	prLTS := s.waitInstID(t, tx.Instructions[0].DeriveID(""))
+	newLTS, err := s.services[nodes].CreateLTS(&CreateLTS{Proof: *prLTS})
+	require.NoError(t, err)
+
+	var writeIDs []byzcoin.InstanceID
+	for _, key := range []string{"first key", "second key"} {
+		pr := s.addWriteAndWait(t, []byte(key))
+		writeIDs = append(writeIDs, byzcoin.NewInstanceID(pr.InclusionProof.Key()))
+	}
+	_, err = cl.MigrateWrites(writeIDs, newLTS.InstanceID,
+		[]darc.Signer{s.signer}, []uint64{s.nextCtr(t)})
+	require.NoError(t, err)
+
+	// The private key of the old LTS is only used to know the keys of the
+	// writes.
+	var priShares []*share.PriShare
+	pubShares := make(map[int]kyber.Point)
+	for _, srv := range s.services[:nodes] {
+		shared := srv.storage.Shared[s.ltsReply.InstanceID]
+		priShares = append(priShares, &share.PriShare{I: shared.Index,
+			V: shared.V})
+		pubShares[shared.Index] = cothority.Suite.Point().Mul(shared.V, nil)
+	}
+	x, err := share.RecoverSecret(cothority.Suite, priShares, nodes, nodes)
+	require.NoError(t, err)
+
+	// The first node recovers what it can from the shares of every write.
+	leader := s.services[0]
+	var offsets []kyber.Point
+	for _, id := range writeIDs {
+		resp, err := s.cl.GetProofFromLatest(id.Slice())
+		require.NoError(t, err)
+		prWrite := &resp.Proof
+		var write Write
+		require.NoError(t, prWrite.VerifyAndDecode(cothority.Suite,
+			ContractWriteID, &write))
+		K := cothority.Suite.Point().Sub(write.C,
+			cothority.Suite.Point().Mul(x, write.U))
+
+		shares, err := leader.migrationShares(prWrite, prLTS)
+		require.NoError(t, err)
+		vs := make([]*share.PubShare, nodes)
+		for _, sh := range shares {
+			vs[sh.Index] = &share.PubShare{I: sh.Index, V: sh.V}
+		}
+		V, err := share.RecoverCommit(cothority.Suite, vs, nodes-(nodes-1)/3,
+			nodes)
+		require.NoError(t, err)
+		D := cothority.Suite.Point().Sub(write.C, V)
+		require.False(t, D.Equal(K))
+		offsets = append(offsets, cothority.Suite.Point().Sub(D, K))
+
+		// A share that has been tampered with is refused.
+		bad := shares[0]
+		require.NoError(t, bad.Verify(write.U, newLTS.X, pubShares[bad.Index]))
+		bad.V = cothority.Suite.Point().Add(bad.V, cothority.Suite.Point().Base())
+		require.Error(t, bad.Verify(write.U, newLTS.X, pubShares[bad.Index]))
+	}
+	// Knowing the first key doesn't help to recover the second one.
+	require.False(t, offsets[0].Equal(offsets[1]))
+}
+
 // TestContract_Write creates a write request and check that it gets stored.
 func TestContract_Write(t *testing.T) {
 	s := newTS(t, 5)
@@ -302,6 +839,169 @@ func TestService_DecryptKey(t *testing.T) {
 	require.Equal(t, key2, keyCopy2)
 }
 
+// TestService_DecryptLongKey stores a key that is too long to be embedded in
+// a point and makes sure it can be recovered.
+func TestService_DecryptLongKey(t *testing.T) {
+	s := newTS(t, 5)
+	defer s.closeAll(t)
+
+	// An AES-256 key followed by a GCM nonce.
+	key1 := make([]byte, 32+12)
+	random.Bytes(key1, random.New())
+	write := NewWrite(cothority.Suite, s.ltsReply.InstanceID,
+		s.gDarc.GetBaseID(), s.ltsReply.X, key1)
+	require.NotNil(t, write)
+	require.NotEmpty(t, write.KeyCipher)
+	require.NoError(t, write.CheckProof(cothority.Suite, s.gDarc.GetBaseID()))
+	write.KeyCipher[0] ^= 1
+	require.Error(t, write.CheckProof(cothority.Suite, s.gDarc.GetBaseID()))
+
+	prWr1 := s.addWriteAndWait(t, key1)
+	prRe1 := s.addReadAndWait(t, prWr1, s.signer.Ed25519.Point)
+
+	dk1, err := s.services[0].DecryptKey(&DecryptKey{Read: *prRe1, Write: *prWr1})
+	require.NoError(t, err)
+	require.NotEmpty(t, dk1.KeyCipher)
+	keyCopy1, err := dk1.RecoverKey(s.signer.Ed25519.Secret)
+	require.NoError(t, err)
+	require.Equal(t, key1, keyCopy1)
+
+	_, err = dk1.RecoverKey(cothority.Suite.Scalar().One())
+	require.Error(t, err)
+}
+
+// TestService_DecryptKeyShares asks for the decryption shares instead of a
+// re-encryption and checks that misbehaving nodes are blamed.
+func TestService_DecryptKeyShares(t *testing.T) {
+	s := newTS(t, 5)
+	defer s.closeAll(t)
+
+	key1 := []byte("secret key 1")
+	prWr1 := s.addWriteAndWait(t, key1)
+	prRe1 := s.addReadAndWait(t, prWr1, s.signer.Ed25519.Point)
+
+	readID := byzcoin.NewInstanceID(prRe1.InclusionProof.Key())
+	ts := time.Now().Unix()
+	eph := key.NewKeyPair(cothority.Suite)
+	req := &DecryptKeyShares{Read: *prRe1, Write: *prWr1, Ephemeral: eph.Public,
+		Timestamp: ts}
+	_, err := s.services[0].DecryptKeyShares(req)
+	require.Error(t, err)
+
+	// Only the reader can ask for the shares.
+	msg, err := decryptSharesMessage(readID, eph.Public, ts)
+	require.NoError(t, err)
+	other := darc.NewSignerEd25519(nil, nil)
+	req.Signature, err = schnorr.Sign(cothority.Suite, other.Ed25519.Secret, msg)
+	require.NoError(t, err)
+	_, err = s.services[0].DecryptKeyShares(req)
+	require.Error(t, err)
+
+	req.Signature, err = schnorr.Sign(cothority.Suite, s.signer.Ed25519.Secret, msg)
+	require.NoError(t, err)
+
+	// The signature is bound to the ephemeral key, so a replayed request
+	// cannot ask for shares re-encrypted to another key.
+	attacker := key.NewKeyPair(cothority.Suite)
+	req.Ephemeral = attacker.Public
+	_, err = s.services[0].DecryptKeyShares(req)
+	require.Error(t, err)
+	req.Ephemeral = cothority.Suite.Point().Null()
+	_, err = s.services[0].DecryptKeyShares(req)
+	require.Error(t, err)
+
+	req.Ephemeral = eph.Public
+	dks, err := s.services[0].DecryptKeyShares(req)
+	require.NoError(t, err)
+	require.True(t, dks.X.Equal(s.ltsReply.X))
+	_, _, err = dks.RecoverKey(attacker.Private)
+	require.Error(t, err)
+	keyCopy1, blame, err := dks.RecoverKey(eph.Private)
+	require.NoError(t, err)
+	require.Empty(t, blame)
+	require.Equal(t, key1, keyCopy1)
+
+	// A wrong share is detected.
+	bad := dks.Shares[1].Index
+	dks.Shares[1].Ui = cothority.Suite.Point().Pick(cothority.Suite.RandomStream())
+	_, blame, err = dks.RecoverKey(eph.Private)
+	require.Equal(t, []int{bad}, blame)
+	if len(dks.Shares)-1 >= len(dks.Commits) {
+		require.NoError(t, err)
+	} else {
+		require.Error(t, err)
+	}
+}
+
+// TestService_AccessLog checks that every re-encryption is logged with a
+// receipt signed by the LTS.
+func TestService_AccessLog(t *testing.T) {
+	s := newTS(t, 5)
+	defer s.closeAll(t)
+
+	prWr1 := s.addWriteAndWait(t, []byte("secret key 1"))
+	prRe1 := s.addReadAndWait(t, prWr1, s.signer.Ed25519.Point)
+	_, err := s.services[0].DecryptKey(&DecryptKey{Read: *prRe1, Write: *prWr1})
+	require.NoError(t, err)
+
+	writeID := byzcoin.NewInstanceID(prWr1.InclusionProof.Key())
+	readID := byzcoin.NewInstanceID(prRe1.InclusionProof.Key())
+	for _, id := range []byzcoin.InstanceID{AccessLogWriteID(writeID),
+		AccessLogReaderID(s.signer.Ed25519.Point)} {
+		pr := s.waitInstID(t, id)
+		var accessLog AccessLog
+		require.NoError(t, pr.VerifyAndDecode(cothority.Suite,
+			ContractAccessLogID, &accessLog))
+		require.Len(t, accessLog.Receipts, 1)
+		receipt := accessLog.Receipts[0]
+		require.True(t, receipt.Write.Equal(writeID))
+		require.True(t, receipt.Read.Equal(readID))
+		require.NoError(t, receipt.Verify(s.ltsRoster))
+
+		receipt.Signatures = receipt.Signatures[1:]
+		require.Error(t, receipt.Verify(s.ltsRoster))
+	}
+}
+
+// TestService_MaliciousLeader checks that the nodes of the LTS refuse to
+// re-encrypt a revoked write, even if the leader doesn't check it.
+func TestService_MaliciousLeader(t *testing.T) {
+	s := newTS(t, 4)
+	defer s.closeAll(t)
+	cl := NewClient(s.cl)
+
+	prWr := s.addWriteAndWait(t, []byte("secret key"))
+	prRe := s.addReadAndWait(t, prWr, s.signer.Ed25519.Point)
+	writeID := byzcoin.NewInstanceID(prWr.InclusionProof.Key())
+	var write Write
+	require.NoError(t, prWr.VerifyAndDecode(cothority.Suite, ContractWriteID,
+		&write))
+
+	// A leader skipping the verification gets the re-encryption as long as
+	// the write is valid.
+	vd := &vData{Proof: *prRe, Timestamp: time.Now().Unix()}
+	require.True(t, s.runOCSWithoutVerify(t, write.LTSID, write.U,
+		s.signer.Ed25519.Point, vd))
+
+	// A read of the write cannot be used to decrypt another write.
+	prWr2 := s.addWriteAndWait(t, []byte("secret key 2"))
+	var write2 Write
+	require.NoError(t, prWr2.VerifyAndDecode(cothority.Suite, ContractWriteID,
+		&write2))
+	require.False(t, s.runOCSWithoutVerify(t, write.LTSID, write2.U,
+		s.signer.Ed25519.Point, vd))
+
+	// Once the write is revoked, the other nodes refuse, even if the proof
+	// of the read is older than the revocation.
+	_, err := cl.RevokeWrite(writeID, s.signer, s.nextCtr(t), 10)
+	require.NoError(t, err)
+	_, err = s.services[0].DecryptKey(&DecryptKey{Read: *prRe, Write: *prWr})
+	require.Error(t, err)
+	vd.Timestamp = time.Now().Unix()
+	require.False(t, s.runOCSWithoutVerify(t, write.LTSID, write.U,
+		s.signer.Ed25519.Point, vd))
+}
+
 // TestService_DecryptEphemeralKey requests a read to a different key than the
 // readers.
 func TestService_DecryptEphemeralKey(t *testing.T) {
@@ -395,7 +1095,7 @@ func newTSWithExtras(t *testing.T, nodes int, extras int) ts {
 	s.createGenesis(t)
 
 	// Create LTS instance
-	ltsInstInfoBuf, err := protobuf.Encode(&LtsInstanceInfo{*s.ltsRoster})
+	ltsInstInfoBuf, err := protobuf.Encode(&LtsInstanceInfo{Roster: *s.ltsRoster})
 	require.NoError(t, err)
 	inst := byzcoin.Instruction{
 		InstanceID: byzcoin.NewInstanceID(s.gDarc.GetBaseID()),
@@ -442,7 +1142,13 @@ func (s *ts) createGenesis(t *testing.T) {
 		[]string{"spawn:" + ContractWriteID,
 			"spawn:" + ContractReadID,
 			"spawn:" + ContractLongTermSecretID,
-			"invoke:" + ContractLongTermSecretID + ".reshare"},
+			"invoke:" + ContractLongTermSecretID + ".reshare",
+			"invoke:" + ContractLongTermSecretID + ".refresh",
+			"invoke:" + ContractWriteID + ".revoke",
+			"invoke:" + ContractWriteID + ".migrate",
+			"spawn:" + contracts.ContractCoinID,
+			"invoke:" + contracts.ContractCoinID + ".mint",
+			"invoke:" + contracts.ContractCoinID + ".fetch"},
 		s.signer.Identity())
 	require.NoError(t, err)
 	s.gDarc = &s.genesisMsg.GenesisDarc
@@ -509,6 +1215,81 @@ func (s *ts) addWrite(t *testing.T, key []byte, ctr uint64) byzcoin.InstanceID {
 	return ctx.Instructions[0].DeriveID("")
 }
 
+// nextCtr returns the next counter of the signer.
+func (s *ts) nextCtr(t *testing.T) uint64 {
+	ctr, err := s.cl.GetSignerCounters(s.signer.Identity().String())
+	require.NoError(t, err)
+	return ctr.Counters[0] + 1
+}
+
+// spawnCoin creates a new coin instance holding value coins.
+func (s *ts) spawnCoin(t *testing.T, value uint64) byzcoin.InstanceID {
+	ctr := s.nextCtr(t)
+	valueBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(valueBuf, value)
+	spawn := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(s.gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ContractCoinID,
+			Args: byzcoin.Arguments{{Name: "coinID",
+				Value: random.Bits(256, true, random.New())}},
+		},
+		SignerCounter: []uint64{ctr},
+	}
+	h := sha256.New()
+	h.Write([]byte(contracts.ContractCoinID))
+	h.Write(spawn.Spawn.Args[0].Value)
+	coinID := byzcoin.NewInstanceID(h.Sum(nil))
+	ctx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion, spawn,
+		byzcoin.Instruction{
+			InstanceID: coinID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.ContractCoinID,
+				Command:    "mint",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: valueBuf}},
+			},
+			SignerCounter: []uint64{ctr + 1},
+		})
+	require.NoError(t, ctx.FillSignersAndSignWith(s.signer))
+	_, err := s.cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+	return coinID
+}
+
+// coinValue returns the number of coins in the coin instance.
+func (s *ts) coinValue(t *testing.T, id byzcoin.InstanceID) uint64 {
+	resp, err := s.cl.GetProofFromLatest(id.Slice())
+	require.NoError(t, err)
+	var coin byzcoin.Coin
+	require.NoError(t, resp.Proof.VerifyAndDecode(cothority.Suite,
+		contracts.ContractCoinID, &coin))
+	return coin.Value
+}
+
+// runOCSWithoutVerify runs the ocs-protocol like a malicious leader, without
+// verifying the request, and returns whether the re-encryption succeeded.
+func (s *ts) runOCSWithoutVerify(t *testing.T, id byzcoin.InstanceID, U,
+	Xc kyber.Point, vd *vData) bool {
+	leader := s.services[0]
+	tree := s.ltsRoster.GenerateNaryTreeWithRoot(len(s.ltsRoster.List),
+		leader.ServerIdentity())
+	pi, err := leader.CreateProtocol(protocol.NameOCS, tree)
+	require.NoError(t, err)
+	ocsProto := pi.(*protocol.OCS)
+	ocsProto.U = U
+	ocsProto.Xc = Xc
+	ocsProto.VerificationData, err = protobuf.Encode(vd)
+	require.NoError(t, err)
+	leader.storage.Lock()
+	ocsProto.Shared = leader.storage.Shared[id].Clone()
+	pp := leader.storage.Polys[id]
+	ocsProto.Poly = share.NewPubPoly(cothority.Suite, pp.B, pp.Commits)
+	leader.storage.Unlock()
+	require.NoError(t, ocsProto.SetConfig(&onet.GenericConfig{Data: id.Slice()}))
+	require.NoError(t, ocsProto.Start())
+	return <-ocsProto.Reencrypted
+}
+
 func (s *ts) closeAll(t *testing.T) {
 	require.Nil(t, s.cl.Close())
 	s.local.CloseAll()
@@ -0,0 +1,232 @@
+package calypso
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/random"
+	"golang.org/x/xerrors"
+)
+
+// StreamChunkSize is the size of the encrypted chunks of a stream, except
+// for the last one. It is the same as BlobChunkSize, so that every chunk of
+// the stream is stored in its own chunk of a blob.
+const StreamChunkSize = BlobChunkSize
+
+// StreamKeySize is the size of the symmetric keys used to encrypt streams.
+const StreamKeySize = 32
+
+// EncryptStream encrypts everything read from src with the key and writes
+// it to dst. The data is split in chunks which are encrypted with AES-GCM,
+// using the index of the chunk as nonce. The last chunk is marked in its
+// nonce, so that a truncated stream cannot be decrypted. As the nonces are
+// not random, every key must only be used once.
+func EncryptStream(key []byte, dst io.Writer, src io.Reader) error {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(src)
+	buf := make([]byte, StreamChunkSize)
+	plainSize := StreamChunkSize - aead.Overhead()
+	for i := uint64(0); ; i++ {
+		last, n, err := readStreamChunk(br, buf[:plainSize])
+		if err != nil {
+			return xerrors.Errorf("reading chunk %d: %v", i, err)
+		}
+		ct := aead.Seal(buf[:0], streamNonce(aead, i, last), buf[:n], nil)
+		if _, err := dst.Write(ct); err != nil {
+			return xerrors.Errorf("writing chunk %d: %v", i, err)
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// DecryptStream decrypts the data read from src, which has been encrypted
+// by EncryptStream with the key, and writes it to dst. Every chunk is
+// authenticated before it is written, but if an error is returned, dst might
+// already hold the first chunks of the data.
+func DecryptStream(key []byte, dst io.Writer, src io.Reader) error {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(src)
+	buf := make([]byte, StreamChunkSize)
+	for i := uint64(0); ; i++ {
+		last, n, err := readStreamChunk(br, buf)
+		if err != nil {
+			return xerrors.Errorf("reading chunk %d: %v", i, err)
+		}
+		pt, err := aead.Open(buf[:0], streamNonce(aead, i, last), buf[:n], nil)
+		if err != nil {
+			return xerrors.Errorf("decrypting chunk %d: %v", i, err)
+		}
+		if _, err := dst.Write(pt); err != nil {
+			return xerrors.Errorf("writing chunk %d: %v", i, err)
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// readStreamChunk fills buf from the reader and returns whether it is the
+// last chunk of the stream, together with the number of bytes read.
+func readStreamChunk(br *bufio.Reader, buf []byte) (bool, int, error) {
+	n, err := io.ReadFull(br, buf)
+	switch err {
+	case nil:
+		if _, err := br.Peek(1); err == io.EOF {
+			return true, n, nil
+		} else if err != nil {
+			return false, 0, err
+		}
+		return false, n, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		return true, n, nil
+	default:
+		return false, 0, err
+	}
+}
+
+// streamNonce returns the nonce of the chunk with the given index: the index
+// as a big-endian number, followed by a byte set to 1 for the last chunk.
+func streamNonce(aead cipher.AEAD, index uint64, last bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], index)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func newStreamAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != StreamKeySize {
+		return nil, xerrors.Errorf("the key must be %d bytes", StreamKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, xerrors.Errorf("creating cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, cothority.ErrorOrNil(err, "creating AEAD")
+}
+
+// WriteStream encrypts everything read from r with a new random key, using
+// EncryptStream, and stores the encrypted data as a blob on replication nodes
+// of the LTS. It then spawns a write holding the key, encrypted under X, the
+// public key of the LTS, and the root of the blob. The write is spawned with
+// the darc d, which needs a spawn:calypsoWrite rule for the signer.
+func (c *Client) WriteStream(r io.Reader, ltsID byzcoin.InstanceID,
+	X kyber.Point, replication int, signer darc.Signer, signerCtr uint64,
+	d darc.Darc, wait int) (*WriteReply, error) {
+	info, err := c.getLtsInfo(ltsID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := random.Bits(StreamKeySize*8, false, random.New())
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(EncryptStream(key, pw, r))
+	}()
+	root, err := c.UploadBlobFrom(ltsID, &info.Roster, pr, replication,
+		signer, d.GetBaseID())
+	pr.Close()
+	if err != nil {
+		return nil, xerrors.Errorf("uploading stream: %v", err)
+	}
+
+	write := NewWrite(cothority.Suite, ltsID, d.GetBaseID(), X, key)
+	if write == nil {
+		return nil, xerrors.New("failed to encrypt the key")
+	}
+	write.BlobRoot = root
+	return c.AddWrite(write, signer, signerCtr, d, wait)
+}
+
+// ReadStream spawns a read of the write for the signer, asks the LTS to
+// re-encrypt the key of the write to the signer, and decrypts the blob of the
+// write into w, using DecryptStream. As the proof of the read is needed, wait
+// must be bigger than 0.
+func (c *Client) ReadStream(writeID byzcoin.InstanceID, w io.Writer,
+	signer darc.Signer, signerCtr uint64, wait int) (*ReadReply, error) {
+	if wait <= 0 {
+		return nil, xerrors.New("need to wait for the read to be stored")
+	}
+	resp, err := c.bcClient.GetProofFromLatest(writeID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("getting write proof: %v", err)
+	}
+	writeProof := resp.Proof
+	var write Write
+	err = writeProof.VerifyAndDecode(cothority.Suite, ContractWriteID, &write)
+	if err != nil {
+		return nil, xerrors.Errorf("didn't get a write instance: %v", err)
+	}
+	if len(write.BlobRoot) == 0 {
+		return nil, xerrors.New("the write has no blob")
+	}
+	info, err := c.getLtsInfo(write.LTSID)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.AddRead(&writeProof, signer, signerCtr, wait)
+	if err != nil {
+		return nil, xerrors.Errorf("adding read: %v", err)
+	}
+	resp, err = c.bcClient.GetProofAfter(reply.InstanceID.Slice(), true,
+		&reply.Proof.Latest)
+	if err != nil {
+		return nil, xerrors.Errorf("getting read proof: %v", err)
+	}
+	dkr, err := c.DecryptKey(&DecryptKey{Read: resp.Proof, Write: writeProof})
+	if err != nil {
+		return nil, xerrors.Errorf("re-encrypting key: %v", err)
+	}
+	xc, err := signer.GetPrivate()
+	if err != nil {
+		return nil, xerrors.Errorf("getting private key: %v", err)
+	}
+	key, err := dkr.RecoverKey(xc)
+	if err != nil {
+		return nil, xerrors.Errorf("recovering key: %v", err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(c.DownloadBlobTo(&info.Roster, write.BlobRoot, pw))
+	}()
+	err = DecryptStream(key, w, pr)
+	pr.Close()
+	if err != nil {
+		return nil, xerrors.Errorf("decrypting stream: %v", err)
+	}
+	return reply, nil
+}
+
+// getLtsInfo returns the latest version of the LTS instance.
+func (c *Client) getLtsInfo(ltsID byzcoin.InstanceID) (*LtsInstanceInfo, error) {
+	resp, err := c.bcClient.GetProofFromLatest(ltsID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("getting LTS proof: %v", err)
+	}
+	var info LtsInstanceInfo
+	err = resp.Proof.VerifyAndDecode(cothority.Suite, ContractLongTermSecretID,
+		&info)
+	if err != nil {
+		return nil, xerrors.Errorf("didn't get an LTS instance: %v", err)
+	}
+	return &info, nil
+}
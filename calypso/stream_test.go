@@ -0,0 +1,43 @@
+package calypso
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestEncryptStream(t *testing.T) {
+	key := random.Bits(StreamKeySize*8, false, random.New())
+	plainSize := StreamChunkSize - 16
+	for _, size := range []int{0, 1, plainSize, plainSize + 1, 2 * plainSize} {
+		data := random.Bits(uint(size*8), false, random.New())
+		var enc bytes.Buffer
+		require.NoError(t, EncryptStream(key, &enc, bytes.NewReader(data)))
+		chunks := (size + plainSize - 1) / plainSize
+		if chunks == 0 {
+			chunks = 1
+		}
+		require.Equal(t, size+16*chunks, enc.Len())
+
+		var dec bytes.Buffer
+		require.NoError(t, DecryptStream(key, &dec,
+			bytes.NewReader(enc.Bytes())))
+		require.Equal(t, data, dec.Bytes())
+
+		// Truncated, modified or differently keyed streams must fail.
+		if chunks > 1 {
+			err := DecryptStream(key, &dec,
+				bytes.NewReader(enc.Bytes()[:StreamChunkSize]))
+			require.Error(t, err)
+		}
+		buf := enc.Bytes()
+		buf[len(buf)-1] ^= 1
+		require.Error(t, DecryptStream(key, &dec, bytes.NewReader(buf)))
+		other := random.Bits(StreamKeySize*8, false, random.New())
+		require.Error(t, DecryptStream(other, &dec, bytes.NewReader(buf)))
+	}
+	require.Error(t, EncryptStream(key[:16], &bytes.Buffer{},
+		bytes.NewReader(nil)))
+}
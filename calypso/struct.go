@@ -1,21 +1,35 @@
 package calypso
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 
+	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
 	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/kyber/v3/xof/keccak"
 	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
 )
 
 func init() {
 	network.RegisterMessages(CreateLTS{}, CreateLTSReply{},
 		Authorize{}, AuthorizeReply{},
-		DecryptKey{}, DecryptKeyReply{})
+		DecryptKey{}, DecryptKeyReply{},
+		DecryptKeyShares{}, DecryptKeySharesReply{},
+		RefreshLTS{}, RefreshLTSReply{},
+		StoreBlobChunk{}, StoreBlobChunkReply{},
+		StoreBlobManifest{}, StoreBlobManifestReply{},
+		GetBlobChunk{}, GetBlobChunkReply{},
+		GetBlobManifest{}, GetBlobManifestReply{},
+		DeleteBlob{}, DeleteBlobReply{},
+		MigrateWrites{}, MigrateWritesReply{})
 }
 
 type suite interface {
@@ -34,21 +48,31 @@ type suite interface {
 //   - key - the symmetric key for the document - it will be encrypted in this
 //   method
 //
+// If the key is too long to be embedded in a point, a random point is
+// encrypted in C instead, and the key is encrypted in KeyCipher with a
+// symmetric key derived from this point.
+//
 // Output:
 //   - write - structure containing the encrypted key U, C and the NIZKP of
-//   it containing the reader-darc. If it is nil then we failed to embed the
-//   key because it is too long to represent the key using a point.
+//   it containing the reader-darc. If it is nil then we failed to encrypt
+//   the key.
 func NewWrite(suite suites.Suite, ltsid byzcoin.InstanceID, writeDarc darc.ID, X kyber.Point, key []byte) *Write {
 	wr := &Write{LTSID: ltsid}
 	r := suite.Scalar().Pick(suite.RandomStream())
 	C := suite.Point().Mul(r, X)
 	wr.U = suite.Point().Mul(r, nil)
 
-	// Create proof
+	var kp kyber.Point
 	if len(key) > suite.Point().EmbedLen() {
-		return nil
+		kp = suite.Point().Pick(suite.RandomStream())
+		var err error
+		wr.KeyCipher, err = sealKey(kp, key)
+		if err != nil {
+			return nil
+		}
+	} else {
+		kp = suite.Point().Embed(key, suite.RandomStream())
 	}
-	kp := suite.Point().Embed(key, suite.RandomStream())
 	wr.C = suite.Point().Add(C, kp)
 
 	gBar := suite.Point().Embed(ltsid.Slice(), keccak.New(ltsid.Slice()))
@@ -58,6 +82,7 @@ func NewWrite(suite suites.Suite, ltsid byzcoin.InstanceID, writeDarc darc.ID, X
 	wBar := suite.Point().Mul(s, gBar)
 	hash := sha256.New()
 	wr.C.MarshalTo(hash)
+	hash.Write(wr.KeyCipher)
 	wr.U.MarshalTo(hash)
 	wr.Ubar.MarshalTo(hash)
 	w.MarshalTo(hash)
@@ -69,7 +94,8 @@ func NewWrite(suite suites.Suite, ltsid byzcoin.InstanceID, writeDarc darc.ID, X
 }
 
 // CheckProof verifies that the write-request has actually been created with
-// somebody having access to the secret key.
+// somebody having access to the secret key. The proof also covers KeyCipher,
+// so it cannot be replaced once the write is stored.
 func (wr *Write) CheckProof(suite suite, writeID darc.ID) error {
 	gf := suite.Point().Mul(wr.F, nil)
 	ue := suite.Point().Mul(suite.Scalar().Neg(wr.E), wr.U)
@@ -82,6 +108,7 @@ func (wr *Write) CheckProof(suite suite, writeID darc.ID) error {
 
 	hash := sha256.New()
 	wr.C.MarshalTo(hash)
+	hash.Write(wr.KeyCipher)
 	wr.U.MarshalTo(hash)
 	wr.Ubar.MarshalTo(hash)
 	w.MarshalTo(hash)
@@ -97,10 +124,100 @@ func (wr *Write) CheckProof(suite suite, writeID darc.ID) error {
 		"%s\n%s", e.String(), wr.E.String())
 }
 
+// sealKey encrypts the key using AES-GCM with a symmetric key derived from
+// the point. As every point is only used once, the nonce is always zero.
+func sealKey(kp kyber.Point, key []byte) ([]byte, error) {
+	aead, err := newKeyAEAD(kp)
+	if err != nil {
+		return nil, xerrors.Errorf("creating cipher: %v", err)
+	}
+	return aead.Seal(nil, make([]byte, aead.NonceSize()), key, nil), nil
+}
+
+// openKey decrypts the key sealed by sealKey.
+func openKey(kp kyber.Point, keyCipher []byte) ([]byte, error) {
+	aead, err := newKeyAEAD(kp)
+	if err != nil {
+		return nil, xerrors.Errorf("creating cipher: %v", err)
+	}
+	key, err := aead.Open(nil, make([]byte, aead.NonceSize()), keyCipher, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("decrypting key: %v", err)
+	}
+	return key, nil
+}
+
+// keyFromPoint returns the key stored in the point, or sealed in keyCipher
+// if it was too long to be embedded.
+func keyFromPoint(kp kyber.Point, keyCipher []byte) ([]byte, error) {
+	if len(keyCipher) > 0 {
+		return openKey(kp, keyCipher)
+	}
+	key, err := kp.Data()
+	if err != nil {
+		return nil, xerrors.Errorf("extracting data from point: %v", err)
+	}
+	return key, nil
+}
+
+func newKeyAEAD(kp kyber.Point) (cipher.AEAD, error) {
+	buf, err := kp.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("marshalling point: %v", err)
+	}
+	symKey := sha256.Sum256(buf)
+	block, err := aes.NewCipher(symKey[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptSharesMessage returns the message signed by the reader to ask for
+// the decryption shares of the read instance, re-encrypted to the ephemeral
+// key Xe.
+func decryptSharesMessage(readID byzcoin.InstanceID, Xe kyber.Point,
+	timestamp int64) ([]byte, error) {
+	xeBuf, err := Xe.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't marshal ephemeral key: %v", err)
+	}
+	msg := append([]byte("calypso decrypt shares "), readID.Slice()...)
+	msg = append(msg, xeBuf...)
+	tsBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(tsBuf, uint64(timestamp))
+	return append(msg, tsBuf...), nil
+}
+
+// verifyReaderSignature checks that the request for the decryption shares
+// re-encrypted to Xe has been recently signed by the reader Xc.
+func verifyReaderSignature(readID byzcoin.InstanceID, Xc, Xe kyber.Point,
+	timestamp int64, sig []byte) error {
+	if len(sig) == 0 {
+		return xerrors.New("no signature provided")
+	}
+	if Xe == nil || Xe.Equal(cothority.Suite.Point().Null()) {
+		return xerrors.New("the shares must be re-encrypted to an ephemeral key")
+	}
+	if err := checkTimestamp(timestamp); err != nil {
+		return err
+	}
+	msg, err := decryptSharesMessage(readID, Xe, timestamp)
+	if err != nil {
+		return err
+	}
+	err = schnorr.Verify(cothority.Suite, Xc, msg, sig)
+	return cothority.ErrorOrNil(err, "signature verification failed")
+}
+
 type newLtsConfig struct {
 	byzcoin.Proof
 }
 
+type refreshLtsConfig struct {
+	byzcoin.Proof
+}
+
 type reshareLtsConfig struct {
 	byzcoin.Proof
 	Commits  []kyber.Point
@@ -2,8 +2,11 @@ package eventlog
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
@@ -26,6 +29,9 @@ type Client struct {
 	c          *onet.Client
 	sc         *skipchain.Client
 	signerCtrs []uint64
+	// schemas caches the schemas used by DecodePayload.
+	schemas     *SchemaRegistry
+	schemasLock sync.Mutex
 }
 
 // NewClient creates a new client to talk to the eventlog service.
@@ -154,6 +160,159 @@ func (c *Client) GetEvent(key []byte) (*Event, error) {
 	return &e, nil
 }
 
+// RegisterSchema registers the schema on the eventlog, so that events can
+// carry payloads following it. The signers need the "invoke:eventlog.schema"
+// permission. This method is synchronous, like Create.
+func (c *Client) RegisterSchema(s Schema) error {
+	if err := s.verify(); err != nil {
+		return err
+	}
+	schemaBuf, err := protobuf.Encode(&s)
+	if err != nil {
+		return err
+	}
+	return c.invokeAndWait(schemaCmd, byzcoin.Arguments{
+		{Name: "schema", Value: schemaBuf}})
+}
+
+// GetSchemas returns the schemas registered on the eventlog.
+func (c *Client) GetSchemas() (*SchemaRegistry, error) {
+	key := schemasID(c.Instance).Slice()
+	reply, err := c.ByzCoin.GetProofFromLatest(key)
+	if err != nil {
+		return nil, err
+	}
+	if !reply.Proof.InclusionProof.Match(key) {
+		return &SchemaRegistry{}, nil
+	}
+	_, v0, cid, _, err := reply.Proof.KeyValue()
+	if err != nil {
+		return nil, err
+	}
+	if cid != contractName {
+		return nil, errors.New("schemas instance is not an eventlog instance")
+	}
+	var reg SchemaRegistry
+	if err := protobuf.Decode(v0, &reg); err != nil {
+		return nil, err
+	}
+	return &reg, nil
+}
+
+// DecodePayload returns the fields of the payload of the event, decoded
+// following its schema, or nil if the event has no schema. The schemas are
+// cached, and only fetched again for unknown schemas.
+func (c *Client) DecodePayload(ev Event) (map[string]interface{}, error) {
+	if ev.Schema == "" {
+		return nil, nil
+	}
+	c.schemasLock.Lock()
+	defer c.schemasLock.Unlock()
+	if c.schemas == nil || c.schemas.Get(ev.Schema) == nil {
+		reg, err := c.GetSchemas()
+		if err != nil {
+			return nil, err
+		}
+		c.schemas = reg
+	}
+	s := c.schemas.Get(ev.Schema)
+	if s == nil {
+		return nil, fmt.Errorf("unknown schema \"%s\"", ev.Schema)
+	}
+	return s.Decode(ev.Payload)
+}
+
+// SetRetention sets the retention policy of the eventlog: the events older
+// than maxAge, or that are not among the latest maxCount events, are deleted
+// by Prune. A value of 0 means no limit. The signers need the
+// "invoke:eventlog.retention" permission. This method is synchronous, like
+// Create.
+func (c *Client) SetRetention(maxAge time.Duration, maxCount int) error {
+	buf, err := protobuf.Encode(&Retention{MaxAge: maxAge.Nanoseconds(),
+		MaxCount: maxCount})
+	if err != nil {
+		return err
+	}
+	return c.invokeAndWait(retentionCmd, byzcoin.Arguments{
+		{Name: "retention", Value: buf}})
+}
+
+// GetRetention returns the retention policy of the eventlog, together with
+// the IDs of the redacted events.
+func (c *Client) GetRetention() (*Retention, error) {
+	key := retentionID(c.Instance).Slice()
+	reply, err := c.ByzCoin.GetProofFromLatest(key)
+	if err != nil {
+		return nil, err
+	}
+	if !reply.Proof.InclusionProof.Match(key) {
+		return &Retention{}, nil
+	}
+	_, v0, cid, _, err := reply.Proof.KeyValue()
+	if err != nil {
+		return nil, err
+	}
+	if cid != contractName {
+		return nil, errors.New("retention instance is not an eventlog instance")
+	}
+	var r Retention
+	if err := protobuf.Decode(v0, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Prune deletes the events that are out of the retention policy of the
+// eventlog. Only whole buckets of events are deleted, so some events can be
+// kept a bit longer than the policy says. The signers need the
+// "invoke:eventlog.prune" permission. This method is synchronous, like
+// Create.
+func (c *Client) Prune() error {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(time.Now().UnixNano()))
+	return c.invokeAndWait(pruneCmd, byzcoin.Arguments{
+		{Name: "time", Value: buf}})
+}
+
+// Redact replaces the event with an event holding only its time and the
+// hash of the original event. The original event stays in the block in
+// which it has been logged. The signers need the "invoke:eventlog.redact"
+// permission. This method is synchronous, like Create.
+func (c *Client) Redact(id LogID) error {
+	return c.invokeAndWait(redactCmd, byzcoin.Arguments{
+		{Name: "id", Value: id}})
+}
+
+// invokeAndWait sends an instruction invoking the command on the eventlog,
+// and waits for it to be included.
+func (c *Client) invokeAndWait(cmd string, args byzcoin.Arguments) error {
+	if c.signerCtrs == nil {
+		c.RefreshSignerCounters()
+	}
+
+	instr := byzcoin.Instruction{
+		InstanceID: c.Instance,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contractName,
+			Command:    cmd,
+			Args:       args,
+		},
+		SignerCounter: c.nextCtrs(),
+	}
+	tx, err := c.ByzCoin.CreateTransaction(instr)
+	if err != nil {
+		return err
+	}
+	if err := tx.FillSignersAndSignWith(c.Signers...); err != nil {
+		return err
+	}
+	if _, err := c.ByzCoin.AddTransactionAndWait(tx, 10); err != nil {
+		return err
+	}
+	c.incrementCtrs()
+	return nil
+}
+
 func (c *Client) prepareTx(events []Event) (*byzcoin.ClientTransaction, []LogID, error) {
 	// We need the identity part of the signatures before
 	// calling ToDarcRequest() below, because the identities
@@ -201,17 +360,84 @@ func (c *Client) prepareTx(events []Event) (*byzcoin.ClientTransaction, []LogID,
 // Search executes a search on the filter in req. See the definition of type
 // SearchRequest for additional details about how the filter is interpreted.
 // The ID and Instance fields of the SearchRequest will be filled in from c.
+// If the response is truncated, the search can be continued by sending req
+// again with the Cursor of the response.
+//
+// If req.Prove is set, the response comes with a proof that it holds all
+// the events matching the search, which is verified before the response is
+// returned. The proof holds all the events of the buckets that overlap the
+// time range of the search, so it is best used with a narrow time range.
 func (c *Client) Search(req *SearchRequest) (*SearchResponse, error) {
 	req.ID = c.ByzCoin.ID
 	req.Instance = c.Instance
 
+	if !req.Prove {
+		reply := &SearchResponse{}
+		err := c.c.SendProtobuf(c.ByzCoin.Roster.List[0], req, reply)
+		if err != nil {
+			return nil, err
+		}
+		return reply, nil
+	}
+
+	from := c.ByzCoin.Latest
+	if from == nil {
+		from = c.ByzCoin.Genesis
+	}
+	if from == nil {
+		// The integrity of the genesis block is checked by the skipchain
+		// client.
+		sb, err := c.sc.GetSingleBlock(&c.ByzCoin.Roster, c.ByzCoin.ID)
+		if err != nil {
+			return nil, err
+		}
+		c.ByzCoin.Genesis = sb
+		from = sb
+	}
+	req.ProofFrom = from.Hash
+
 	reply := &SearchResponse{}
 	if err := c.c.SendProtobuf(c.ByzCoin.Roster.List[0], req, reply); err != nil {
 		return nil, err
 	}
+	if reply.Proof == nil {
+		return nil, errors.New("missing proof in search response")
+	}
+	if err := reply.Proof.Index.VerifyFromBlock(from); err != nil {
+		return nil, fmt.Errorf("invalid search proof: %v", err)
+	}
+	if err := reply.Proof.verify(req, reply); err != nil {
+		return nil, fmt.Errorf("invalid search response: %v", err)
+	}
+	if latest := reply.Proof.Index.Latest; c.ByzCoin.Latest == nil ||
+		c.ByzCoin.Latest.Index < latest.Index {
+		c.ByzCoin.Latest = &latest
+	}
 	return reply, nil
 }
 
+// SearchAll executes the search in req and calls the handler for every event
+// found. If a response is truncated, it continues the search from its cursor,
+// until all the events have been found or the handler returns an error.
+func (c *Client) SearchAll(req *SearchRequest, handler func(Event) error) error {
+	r := *req
+	for {
+		resp, err := c.Search(&r)
+		if err != nil {
+			return err
+		}
+		for _, ev := range resp.Events {
+			if err := handler(ev); err != nil {
+				return err
+			}
+		}
+		if !resp.Truncated {
+			return nil
+		}
+		r.Cursor = resp.Cursor
+	}
+}
+
 // StreamHandler is the signature of the handler used when streaming events.
 type StreamHandler func(event Event, blockID []byte, err error)
 
@@ -246,6 +472,21 @@ func (c *Client) StreamEvents(handler StreamHandler) error {
 // event from (inclusive) the given block ID until the connection is closed or
 // the server stops.
 func (c *Client) StreamEventsFrom(handler StreamHandler, id []byte) error {
+	return c.streamBlocksFrom(func(sb *skipchain.SkipBlock, err error) {
+		if err != nil {
+			handler(Event{}, nil, err)
+			return
+		}
+		// don't need to handle error because it's given to the handler
+		_ = handleBlocks(handler, sb)
+	}, id)
+}
+
+// streamBlocksFrom is a blocking call where it calls the handler on every
+// block from (inclusive) the given block ID until the connection is closed or
+// the server stops.
+func (c *Client) streamBlocksFrom(handler func(*skipchain.SkipBlock, error),
+	id []byte) error {
 	// 1. stream to a buffer (because we don't know which ones will be duplicates yet)
 	blockChan := make(chan blockOrErr, 100)
 	// The done channel is also buffered if a panic occurs in the client handler which
@@ -272,7 +513,7 @@ func (c *Client) StreamEventsFrom(handler StreamHandler, id []byte) error {
 		// to keep the behaviour of the other streaming functions, we
 		// don't return an error but let the handler decide what to do
 		// with the error
-		_ = handleBlocks(handler, b)
+		handler(b, nil)
 	}
 
 	var latest *skipchain.SkipBlock
@@ -286,7 +527,7 @@ func (c *Client) StreamEventsFrom(handler StreamHandler, id []byte) error {
 		select {
 		case bOrErr := <-blockChan:
 			if bOrErr.err != nil {
-				handler(Event{}, nil, bOrErr.err)
+				handler(nil, bOrErr.err)
 				break
 			}
 			if !foundLink {
@@ -295,7 +536,7 @@ func (c *Client) StreamEventsFrom(handler StreamHandler, id []byte) error {
 				}
 			}
 			if foundLink {
-				_ = handleBlocks(handler, bOrErr.block)
+				handler(bOrErr.block, nil)
 			}
 		case err := <-streamDone:
 			return err
@@ -310,23 +551,48 @@ type blockOrErr struct {
 
 // handleBlocks calls the handler on the events of the block
 func handleBlocks(handler StreamHandler, sb *skipchain.SkipBlock) error {
+	events, err := blockEvents(sb)
+	if err != nil {
+		handler(Event{}, nil, err)
+		return err
+	}
+	for _, e := range events {
+		if e.err != nil {
+			handler(Event{}, nil, e.err)
+			continue
+		}
+		handler(*e.event, sb.Hash, nil)
+	}
+	return nil
+}
+
+// loggedEvent is an event logged in a block, together with its ID and the
+// eventlog it has been logged on. If the event could not be decoded, err is
+// set.
+type loggedEvent struct {
+	instance byzcoin.InstanceID
+	id       LogID
+	event    *Event
+	err      error
+}
+
+// blockEvents returns the events logged by the accepted transactions of the
+// block, in the order they were logged.
+func blockEvents(sb *skipchain.SkipBlock) ([]loggedEvent, error) {
 	var err error
 	var header byzcoin.DataHeader
 	err = protobuf.DecodeWithConstructors(sb.Data, &header, network.DefaultConstructors(cothority.Suite))
 	if err != nil {
-		err = errors.New("could not unmarshal header while streaming events " + err.Error())
-		handler(Event{}, nil, err)
-		return err
+		return nil, errors.New("could not unmarshal header while streaming events " + err.Error())
 	}
 
 	var body byzcoin.DataBody
 	err = protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
 	if err != nil {
-		err = errors.New("could not unmarshal body while streaming events " + err.Error())
-		handler(Event{}, nil, err)
-		return err
+		return nil, errors.New("could not unmarshal body while streaming events " + err.Error())
 	}
 
+	var events []loggedEvent
 	for _, tx := range body.TxResults {
 		if tx.Accepted {
 			for _, instr := range tx.ClientTransaction.Instructions {
@@ -340,14 +606,18 @@ func handleBlocks(handler StreamHandler, sb *skipchain.SkipBlock) error {
 				if eventBuf == nil {
 					continue
 				}
-				event := &Event{}
-				if err := protobuf.Decode(eventBuf, event); err != nil {
-					handler(Event{}, nil, errors.New("could not decode the event "+err.Error()))
-					continue
+				e := loggedEvent{
+					instance: instr.InstanceID,
+					id:       LogID(instr.DeriveID("").Slice()),
+					event:    &Event{},
+				}
+				if err := protobuf.Decode(eventBuf, e.event); err != nil {
+					e.err = errors.New("could not decode the event " + err.Error())
+					e.event = nil
 				}
-				handler(*event, sb.Hash, nil)
+				events = append(events, e)
 			}
 		}
 	}
-	return nil
+	return events, nil
 }
@@ -1,8 +1,12 @@
 package eventlog
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -284,18 +288,34 @@ func TestClient_Search(t *testing.T) {
 	require.False(t, resp.Truncated)
 	require.Equal(t, 10, len(resp.Events))
 
-	// Search by time range and topic.
-	req = &SearchRequest{Instance: c.Instance, ID: c.ByzCoin.ID, Topic: "a", From: tm0 + 3, To: tm0 + 8}
+	// Search by time range and topic, with a proof.
+	req = &SearchRequest{Instance: c.Instance, ID: c.ByzCoin.ID, Topic: "a", From: tm0 + 3, To: tm0 + 8,
+		Prove: true}
 	resp, err = c.Search(req)
 	require.NoError(t, err)
 	require.NotNil(t, resp)
 	require.False(t, resp.Truncated)
 	require.Equal(t, 3, len(resp.Events))
 
+	// Search by query, limit and order.
+	req = &SearchRequest{Query: `topic:a ("time 3" OR "time 4" OR "time 5")`}
+	resp, err = c.Search(req)
+	require.NoError(t, err)
+	require.False(t, resp.Truncated)
+	require.Equal(t, 2, len(resp.Events))
+	req = &SearchRequest{Query: "topic:b", Limit: 3, Descending: true, Prove: true}
+	resp, err = c.Search(req)
+	require.NoError(t, err)
+	require.True(t, resp.Truncated)
+	require.Equal(t, 3, len(resp.Events))
+	require.Equal(t, "test event at time 18", resp.Events[0].Content)
+	_, err = c.Search(&SearchRequest{Query: "(topic:a"})
+	require.Error(t, err)
+
 	// Cause truncation.
 	sm := searchMax
 	searchMax = 5
-	req = &SearchRequest{Instance: c.Instance, ID: c.ByzCoin.ID}
+	req = &SearchRequest{Instance: c.Instance, ID: c.ByzCoin.ID, Prove: true}
 	resp, err = c.Search(req)
 	require.NoError(t, err)
 	require.NotNil(t, resp)
@@ -317,6 +337,222 @@ func TestClient_Search(t *testing.T) {
 	require.NotNil(t, resp)
 	require.Equal(t, 1, len(resp.Events))
 	require.False(t, resp.Truncated)
+
+	// Page through all events with the cursor, both ways.
+	for _, desc := range []bool{false, true} {
+		req = &SearchRequest{Limit: 3, Descending: desc}
+		var pages int
+		var all []Event
+		for {
+			resp, err = c.Search(req)
+			require.NoError(t, err)
+			all = append(all, resp.Events...)
+			pages++
+			if !resp.Truncated {
+				require.Nil(t, resp.Cursor)
+				break
+			}
+			req.Cursor = resp.Cursor
+		}
+		require.Equal(t, 7, pages)
+		require.Equal(t, logCount+1, len(all))
+		if desc {
+			require.Equal(t, "one more", all[0].Content)
+		} else {
+			require.Equal(t, events, all[:logCount])
+		}
+	}
+
+	// Events at the same time are paged in the order they were logged.
+	tm = time.Now().UnixNano()
+	sameTime := make([]Event, 5)
+	for i := range sameTime {
+		sameTime[i] = Event{Topic: "same", Content: fmt.Sprint(i), When: tm}
+	}
+	_, err = c.Log(sameTime...)
+	require.NoError(t, err)
+	leader.waitForBlock(c.ByzCoin.ID)
+	var found []Event
+	err = c.SearchAll(&SearchRequest{Topic: "same", Limit: 2}, func(ev Event) error {
+		found = append(found, ev)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, sameTime, found)
+
+	_, err = c.Search(&SearchRequest{Cursor: []byte("invalid")})
+	require.Error(t, err)
+
+	// Responses hiding events are refused.
+	req = &SearchRequest{Instance: c.Instance, ID: c.ByzCoin.ID, Topic: "a",
+		Prove: true}
+	resp, err = leader.Search(req)
+	require.NoError(t, err)
+	require.Equal(t, 10, len(resp.Events))
+	require.NoError(t, resp.Proof.verify(req, resp))
+	events = resp.Events
+	resp.Events = events[1:]
+	require.Error(t, resp.Proof.verify(req, resp))
+	resp.Events = events
+	resp.Proof.Events = resp.Proof.Events[1:]
+	require.Error(t, resp.Proof.verify(req, resp))
+}
+
+func TestClient_Schema(t *testing.T) {
+	s, c := newSer(t)
+	leader := s.services[0]
+	defer s.close()
+
+	require.NoError(t, c.Create())
+	waitForKey(t, leader.omni, c.ByzCoin.ID, c.Instance.Slice(), testBlockInterval)
+
+	reg, err := c.GetSchemas()
+	require.NoError(t, err)
+	require.Equal(t, 0, len(reg.Schemas))
+
+	login := Schema{ID: "login", Format: SchemaFormatJSON, Fields: []SchemaField{
+		{Name: "user", Type: FieldString, Required: true},
+		{Name: "ok", Type: FieldBool}}}
+	count := Schema{ID: "count", Format: SchemaFormatProtobuf, Fields: []SchemaField{
+		{Name: "n", Type: FieldInt, Required: true}}}
+	require.NoError(t, c.RegisterSchema(login))
+	require.NoError(t, c.RegisterSchema(count))
+	// Schemas cannot be changed.
+	require.Error(t, c.RegisterSchema(Schema{ID: "login",
+		Format: SchemaFormatJSON, Fields: []SchemaField{{Name: "x", Type: FieldInt}}}))
+	c.RefreshSignerCounters()
+
+	reg, err = c.GetSchemas()
+	require.NoError(t, err)
+	require.Equal(t, []Schema{login, count}, reg.Schemas)
+
+	payload, err := count.Encode(map[string]interface{}{"n": -42})
+	require.NoError(t, err)
+	_, err = c.Log(NewStructuredEvent("auth", "login",
+		[]byte(`{"user": "alice", "ok": true}`)),
+		NewStructuredEvent("count", "count", payload))
+	require.NoError(t, err)
+
+	// Invalid payloads are refused.
+	for _, ev := range []Event{
+		NewStructuredEvent("auth", "login", []byte(`{"ok": true}`)),
+		NewStructuredEvent("auth", "login", []byte(`{"user": 1}`)),
+		NewStructuredEvent("auth", "unknown", []byte(`{}`)),
+		NewStructuredEvent("count", "count", []byte(`{"n": 1}`)),
+		{When: time.Now().UnixNano(), Topic: "auth", Payload: []byte(`{}`)},
+	} {
+		_, err = c.Log(ev)
+		require.Error(t, err)
+		c.RefreshSignerCounters()
+	}
+
+	var resp *SearchResponse
+	for i := 0; i < 10; i++ {
+		resp, err = c.Search(&SearchRequest{})
+		require.NoError(t, err)
+		if len(resp.Events) == 2 {
+			break
+		}
+		leader.waitForBlock(c.ByzCoin.ID)
+	}
+	require.Equal(t, 2, len(resp.Events))
+	fields, err := login.Decode(resp.Events[0].Payload)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"user": "alice", "ok": true}, fields)
+	fields, err = count.Decode(resp.Events[1].Payload)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"n": int64(-42)}, fields)
+}
+
+func TestClient_Retention(t *testing.T) {
+	s, c := newSer(t)
+	leader := s.services[0]
+	defer s.close()
+
+	require.NoError(t, c.Create())
+	waitForKey(t, leader.omni, c.ByzCoin.ID, c.Instance.Slice(), testBlockInterval)
+
+	// Put the events in three buckets: the first two in their own buckets,
+	// and the last two in the head bucket.
+	now := time.Now()
+	events := []Event{
+		{When: now.Add(-25 * time.Second).UnixNano(), Topic: "a", Content: "one"},
+		{When: now.Add(-15 * time.Second).UnixNano(), Topic: "a", Content: "two"},
+		{When: now.UnixNano(), Topic: "a", Content: "user=alice three"},
+		{When: now.UnixNano() + 1, Topic: "a", Content: "four"},
+	}
+	ids, err := c.Log(events...)
+	require.NoError(t, err)
+
+	search := func(query string, expected int) *SearchResponse {
+		var resp *SearchResponse
+		for i := 0; i < 10; i++ {
+			resp, err = c.Search(&SearchRequest{Query: query})
+			require.NoError(t, err)
+			if len(resp.Events) == expected {
+				break
+			}
+			leader.waitForBlock(c.ByzCoin.ID)
+		}
+		require.Equal(t, expected, len(resp.Events), query)
+		return resp
+	}
+	search("", 4)
+	search("alice", 1)
+
+	// Redact the third event.
+	require.NoError(t, c.Redact(ids[2]))
+	search("alice", 0)
+	resp := search("", 4)
+	buf, err := protobuf.Encode(&events[2])
+	require.NoError(t, err)
+	hash := sha256.Sum256(buf)
+	require.Equal(t, Event{When: events[2].When, Redacted: hash[:]},
+		resp.Events[2])
+	require.Equal(t, []byte(ids[2]), resp.IDs[2])
+
+	// Events cannot be redacted twice, and redacted events cannot be logged.
+	require.Error(t, c.Redact(ids[2]))
+	c.RefreshSignerCounters()
+	_, err = c.Log(Event{When: time.Now().UnixNano(), Redacted: hash[:]})
+	require.Error(t, err)
+	c.RefreshSignerCounters()
+
+	// Prune needs a retention policy.
+	require.Error(t, c.Prune())
+	c.RefreshSignerCounters()
+	require.NoError(t, c.SetRetention(0, 2))
+	r, err := c.GetRetention()
+	require.NoError(t, err)
+	require.Equal(t, &Retention{MaxCount: 2, Redacted: [][]byte{ids[2]}}, r)
+
+	// Only the head bucket is kept, and it is linked to the catch-all
+	// bucket, which holds the commitment of the deleted buckets and events.
+	require.NoError(t, c.Prune())
+	resp = search("", 2)
+	require.Equal(t, []byte(ids[3]), resp.IDs[1])
+	for _, id := range ids[:2] {
+		_, err = c.GetEvent(id)
+		require.Error(t, err)
+	}
+	require.NoError(t, leader.checkBuckets(c.Instance, c.ByzCoin.ID, 2))
+	v, err := leader.omni.GetReadOnlyStateTrie(c.ByzCoin.ID)
+	require.NoError(t, err)
+	el := eventLog{Instance: c.Instance, v: v}
+	_, b, err := el.getLatestBucket()
+	require.NoError(t, err)
+	first, err := el.getBucketByID(b.Prev)
+	require.NoError(t, err)
+	require.True(t, first.isFirst())
+	require.Equal(t, 0, len(first.EventRefs))
+	require.Equal(t, 32, len(first.Pruned))
+
+	// Nothing more to prune.
+	require.NoError(t, c.Prune())
+	search("", 2)
+	r, err = c.GetRetention()
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{ids[2]}, r.Redacted)
 }
 
 func TestClient_StreamEvents(t *testing.T) {
@@ -467,6 +703,254 @@ func TestClient_StreamEventsFrom(t *testing.T) {
 	wg.Wait()
 }
 
+// testOutput is a sink output sending the events to a channel, after
+// failing the first fail writes.
+type testOutput struct {
+	events chan *ExportedEvent
+	fail   int
+}
+
+func (o *testOutput) Write(ev *ExportedEvent) error {
+	if o.fail > 0 {
+		o.fail--
+		return errors.New("failing on purpose")
+	}
+	o.events <- ev
+	return nil
+}
+
+func (o *testOutput) Close() error {
+	return nil
+}
+
+func TestSink(t *testing.T) {
+	s, c := newSer(t)
+	leader := s.services[0]
+	defer s.close()
+
+	dir, err := ioutil.TempDir("", "sink")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	checkpoint := filepath.Join(dir, "checkpoint")
+
+	require.Nil(t, c.Create())
+	waitForKey(t, leader.omni, c.ByzCoin.ID, c.Instance.Slice(), testBlockInterval)
+
+	// run starts a sink, and returns the n events it delivers.
+	run := func(n int, fail int) []*ExportedEvent {
+		out := &testOutput{events: make(chan *ExportedEvent, 10), fail: fail}
+		sink := NewSink(c, out, checkpoint)
+		sink.RetryDelay = 10 * time.Millisecond
+		done := make(chan error)
+		go func() {
+			done <- sink.Run()
+		}()
+		var got []*ExportedEvent
+		for len(got) < n {
+			select {
+			case ev := <-out.events:
+				got = append(got, ev)
+			case <-time.After(10 * testBlockInterval):
+				require.Fail(t, "should have got the events")
+			}
+		}
+		require.NoError(t, sink.Close())
+		require.NoError(t, <-done)
+		return got
+	}
+
+	batch1 := []Event{
+		NewEvent("auth", "user alice logged in"),
+		NewEvent("auth", "user bob logged in"),
+	}
+	ids1, err := c.Log(batch1...)
+	require.NoError(t, err)
+	waitForKey(t, leader.omni, c.ByzCoin.ID, ids1[len(ids1)-1], testBlockInterval)
+
+	got := run(len(batch1), 2)
+	for i, ev := range got {
+		require.Equal(t, ids1[i], ev.ID)
+		require.Equal(t, batch1[i].Content, ev.Content)
+		require.NotNil(t, ev.BlockID)
+	}
+
+	// The second sink resumes after the last event of the first one.
+	batch2 := []Event{NewEvent("auth", "user alice logged out")}
+	ids2, err := c.Log(batch2...)
+	require.NoError(t, err)
+	waitForKey(t, leader.omni, c.ByzCoin.ID, ids2[0], testBlockInterval)
+
+	got = run(len(batch2), 0)
+	require.Equal(t, ids2[0], got[0].ID)
+	require.Equal(t, batch2[0].Content, got[0].Content)
+
+	// A new sink skips the redacted events.
+	require.NoError(t, c.Redact(ids1[1]))
+	require.NoError(t, os.Remove(checkpoint))
+	got = run(2, 0)
+	require.Equal(t, ids1[0], got[0].ID)
+	require.Equal(t, ids2[0], got[1].ID)
+}
+
+func TestSink_Pruned(t *testing.T) {
+	s, c := newSer(t)
+	leader := s.services[0]
+	defer s.close()
+
+	require.NoError(t, c.Create())
+	waitForKey(t, leader.omni, c.ByzCoin.ID, c.Instance.Slice(), testBlockInterval)
+
+	// The first two events are in their own buckets, and the last two in
+	// the head bucket.
+	now := time.Now()
+	ids, err := c.Log(
+		Event{When: now.Add(-25 * time.Second).UnixNano(), Topic: "a", Content: "one"},
+		Event{When: now.Add(-15 * time.Second).UnixNano(), Topic: "a", Content: "secret"},
+		Event{When: now.UnixNano(), Topic: "a", Content: "three"},
+		Event{When: now.UnixNano() + 1, Topic: "a", Content: "four"},
+	)
+	require.NoError(t, err)
+	waitForKey(t, leader.omni, c.ByzCoin.ID, ids[3], testBlockInterval)
+
+	// Redact the second event, and then prune it.
+	require.NoError(t, c.Redact(ids[1]))
+	require.NoError(t, c.SetRetention(0, 2))
+	require.NoError(t, c.Prune())
+	_, err = c.GetEvent(ids[1])
+	require.Error(t, err)
+	r, err := c.GetRetention()
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{ids[1]}, r.Redacted)
+
+	// A sink replaying the chain from the start still skips the redacted
+	// event, whose original content is in the blocks.
+	out := &testOutput{events: make(chan *ExportedEvent, 10)}
+	sink := NewSink(c, out, "")
+	done := make(chan error)
+	go func() {
+		done <- sink.Run()
+	}()
+	var got []*ExportedEvent
+	for len(got) < 3 {
+		select {
+		case ev := <-out.events:
+			got = append(got, ev)
+		case <-time.After(10 * testBlockInterval):
+			require.Fail(t, "should have got the events")
+		}
+	}
+	require.NoError(t, sink.Close())
+	require.NoError(t, <-done)
+	for i, j := range []int{0, 2, 3} {
+		require.Equal(t, ids[j], got[i].ID)
+	}
+	for _, ev := range got {
+		require.NotEqual(t, "secret", ev.Content)
+	}
+}
+
+func TestBatchClient(t *testing.T) {
+	s, c := newSer(t)
+	leader := s.services[0]
+	defer s.close()
+
+	require.Nil(t, c.Create())
+	waitForKey(t, leader.omni, c.ByzCoin.ID, c.Instance.Slice(), testBlockInterval)
+
+	bc, err := NewBatchClient(c, 10)
+	require.NoError(t, err)
+	bc.RetryDelay = testBlockInterval
+
+	var lock sync.Mutex
+	ids := make(map[int]LogID)
+	errs := make(map[int]error)
+	logEvent := func(i int, ev Event) {
+		require.NoError(t, bc.Log(ev, func(id LogID, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			ids[i] = id
+			errs[i] = err
+		}))
+	}
+
+	logEvent(0, NewEvent("batch", "0"))
+	bc.Flush()
+	require.NoError(t, errs[0])
+
+	// Another client using the same signer makes the counters of the batch
+	// client wrong.
+	c2 := NewClient(byzcoin.NewClient(c.ByzCoin.ID, c.ByzCoin.Roster))
+	c2.DarcID = c.DarcID
+	c2.Signers = c.Signers
+	c2.Instance = c.Instance
+	_, err = c2.Log(NewEvent("other", "x"))
+	require.NoError(t, err)
+
+	// The old event is refused by the contract, but not the others.
+	n := 30
+	for i := 1; i < n; i++ {
+		ev := NewEvent("batch", fmt.Sprint(i))
+		if i == 5 {
+			ev.When = time.Now().Add(-time.Hour).UnixNano()
+		}
+		logEvent(i, ev)
+	}
+	require.NoError(t, bc.Close())
+	require.Error(t, bc.Log(NewEvent("batch", "closed"), nil))
+
+	require.Equal(t, n, len(errs))
+	for i := 0; i < n; i++ {
+		if i == 5 {
+			require.Error(t, errs[i])
+			continue
+		}
+		require.NoError(t, errs[i])
+		ev, err := c.GetEvent(ids[i])
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprint(i), ev.Content)
+	}
+}
+
+// The first transaction is committed after waiting for it failed, and the
+// events must not be logged again.
+func TestBatchClient_LateCommit(t *testing.T) {
+	s, c := newSer(t)
+	leader := s.services[0]
+	defer s.close()
+
+	require.Nil(t, c.Create())
+	waitForKey(t, leader.omni, c.ByzCoin.ID, c.Instance.Slice(), testBlockInterval)
+
+	bc, err := NewBatchClient(c, 10)
+	require.NoError(t, err)
+	bc.RetryDelay = 2 * testBlockInterval
+	var sent []LogID
+	bc.addTx = func(tx byzcoin.ClientTransaction, wait int) (*byzcoin.AddTxResponse, error) {
+		sent = append(sent, LogID(tx.Instructions[0].DeriveID("").Slice()))
+		if len(sent) > 1 {
+			return c.ByzCoin.AddTransactionAndWait(tx, wait)
+		}
+		// Don't wait for the first transaction, so that it is committed
+		// after the client gave up waiting for it.
+		_, err := c.ByzCoin.AddTransaction(tx)
+		require.NoError(t, err)
+		return nil, errors.New("timeout")
+	}
+
+	var id LogID
+	require.NoError(t, bc.Log(NewEvent("late", "0"), func(i LogID, err error) {
+		require.NoError(t, err)
+		id = i
+	}))
+	require.NoError(t, bc.Close())
+	require.Equal(t, 1, len(sent))
+	require.Equal(t, sent[0], id)
+
+	resp, err := c.Search(&SearchRequest{Topic: "late"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Events))
+}
+
 func checkProof(t *testing.T, omni *byzcoin.Service, key []byte, scID skipchain.SkipBlockID) []byte {
 	req := &byzcoin.GetProof{
 		Version: byzcoin.CurrentVersion,
@@ -546,7 +1030,11 @@ func newSer(t *testing.T) (*ser, *Client) {
 
 	var err error
 	s.req, err = byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, s.roster,
-		[]string{"spawn:" + contractName, "invoke:" + contractName + "." + logCmd, "_name:" + contractName}, s.owner.Identity())
+		[]string{"spawn:" + contractName, "invoke:" + contractName + "." + logCmd,
+			"invoke:" + contractName + "." + schemaCmd,
+			"invoke:" + contractName + "." + retentionCmd,
+			"invoke:" + contractName + "." + pruneCmd,
+			"invoke:" + contractName + "." + redactCmd, "_name:" + contractName}, s.owner.Identity())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,300 @@
+package eventlog
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+)
+
+// LogCallback is called once an event given to BatchClient.Log is committed,
+// with the ID of the event, or once it couldn't be logged, with the error.
+type LogCallback func(id LogID, err error)
+
+// BatchClient logs events asynchronously, for producers logging many events.
+// The events are queued, and all the events that are queued while a
+// transaction is committed are sent together in the next transaction, up to
+// the maximum block size of the ledger.
+//
+// A transaction that fails is sent again with fresh signer counters, so
+// conflicts with other clients using the same signers are handled. If the
+// transaction is refused by the eventlog contract, it is split to find the
+// events that are refused, so that only their callbacks get an error.
+//
+// As the service refuses events that are more than 30 seconds old, the
+// retries and the number of pending events should be kept low enough for
+// the events to be committed in time.
+type BatchClient struct {
+	// Wait is how many block intervals to wait for a transaction to be
+	// committed.
+	Wait int
+	// MaxRetries is how many times a transaction is sent again after it
+	// failed, before the callbacks of its events get the error.
+	MaxRetries int
+	// RetryDelay is the delay before sending a transaction again. It is
+	// doubled after every failure.
+	RetryDelay time.Duration
+
+	client *Client
+	// addTx sends the transaction and waits for it to be committed.
+	addTx   func(tx byzcoin.ClientTransaction, wait int) (*byzcoin.AddTxResponse, error)
+	maxSize int
+	queue   chan batchEvent
+	slots   chan struct{}
+	once    sync.Once
+	done    chan struct{}
+
+	lock    sync.Mutex
+	idle    *sync.Cond
+	pending int
+	closed  bool
+}
+
+type batchEvent struct {
+	ev   Event
+	size int
+	cb   LogCallback
+}
+
+// instrOverhead is an upper bound of the size of an instruction logging an
+// event, without the event and the signatures.
+const instrOverhead = 100
+
+// signerOverhead is an upper bound of the size added to an instruction by a
+// signer.
+const signerOverhead = 150
+
+// NewBatchClient returns a client logging events with the signers of c, which
+// must not be used to send transactions any more. At most maxPending events
+// can wait to be committed: Log blocks until there is room for more events.
+func NewBatchClient(c *Client, maxPending int) (*BatchClient, error) {
+	if maxPending <= 0 {
+		return nil, errors.New("maxPending must be positive")
+	}
+	config, err := c.ByzCoin.GetChainConfig()
+	if err != nil {
+		return nil, err
+	}
+	b := &BatchClient{
+		Wait:       10,
+		MaxRetries: 5,
+		RetryDelay: time.Second,
+		client:     c,
+		addTx:      c.ByzCoin.AddTransactionAndWait,
+		maxSize:    config.MaxBlockSize,
+		queue:      make(chan batchEvent, maxPending),
+		slots:      make(chan struct{}, maxPending),
+		done:       make(chan struct{}),
+	}
+	b.idle = sync.NewCond(&b.lock)
+	return b, nil
+}
+
+// Log queues the event to be logged, and returns without waiting for it to
+// be committed. The callback, if it is not nil, is called once the event is
+// committed or couldn't be logged. The callbacks are called one after the
+// other, so they should return quickly, and they must not call Flush or
+// Close. Log blocks while there are too many pending events, and returns an
+// error if the client is closed.
+func (b *BatchClient) Log(ev Event, cb LogCallback) error {
+	buf, err := protobuf.Encode(&ev)
+	if err != nil {
+		return err
+	}
+	size := len(buf) + instrOverhead + signerOverhead*len(b.client.Signers)
+	if size > b.maxSize {
+		return errors.New("event is bigger than a block")
+	}
+
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return errors.New("client is closed")
+	}
+	b.pending++
+	b.lock.Unlock()
+
+	b.once.Do(b.start)
+	b.slots <- struct{}{}
+	b.queue <- batchEvent{ev: ev, size: size, cb: cb}
+	return nil
+}
+
+// Flush blocks until all the events given to Log are committed or failed.
+func (b *BatchClient) Flush() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for b.pending > 0 {
+		b.idle.Wait()
+	}
+}
+
+// Close waits for the pending events, like Flush, and stops the client. The
+// Client given to NewBatchClient is not closed.
+func (b *BatchClient) Close() error {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return errors.New("client is already closed")
+	}
+	b.closed = true
+	b.lock.Unlock()
+
+	b.Flush()
+	b.once.Do(b.start)
+	close(b.queue)
+	<-b.done
+	return nil
+}
+
+func (b *BatchClient) start() {
+	go b.run()
+}
+
+// run sends the queued events in batches, until the queue is closed.
+func (b *BatchClient) run() {
+	defer close(b.done)
+	var next *batchEvent
+	for {
+		var batch []batchEvent
+		if next != nil {
+			batch = append(batch, *next)
+			next = nil
+		} else {
+			e, ok := <-b.queue
+			if !ok {
+				return
+			}
+			batch = append(batch, e)
+		}
+		size := batch[0].size
+
+	collect:
+		for {
+			select {
+			case e, ok := <-b.queue:
+				if !ok {
+					break collect
+				}
+				if size+e.size > b.maxSize {
+					next = &e
+					break collect
+				}
+				batch = append(batch, e)
+				size += e.size
+			default:
+				break collect
+			}
+		}
+		b.send(batch)
+	}
+}
+
+// send logs the events and calls their callbacks. If the transaction is
+// refused, the events are sent again in two halves, to find the events that
+// cause the refusal.
+func (b *BatchClient) send(batch []batchEvent) {
+	ids, refused, err := b.commit(batch)
+	if refused && len(batch) > 1 {
+		b.send(batch[:len(batch)/2])
+		b.send(batch[len(batch)/2:])
+		return
+	}
+	for i, e := range batch {
+		var id LogID
+		if err == nil {
+			id = ids[i]
+		}
+		if e.cb != nil {
+			e.cb(id, err)
+		}
+		<-b.slots
+		b.lock.Lock()
+		b.pending--
+		if b.pending == 0 {
+			b.idle.Broadcast()
+		}
+		b.lock.Unlock()
+	}
+}
+
+// commit sends the events in one transaction, and waits for it to be
+// committed. It returns whether the transaction has been refused, either by
+// the contract or because it is too large.
+func (b *BatchClient) commit(batch []batchEvent) ([]LogID, bool, error) {
+	events := make([]Event, len(batch))
+	for i, e := range batch {
+		events[i] = e.ev
+	}
+	c := b.client
+	delay := b.RetryDelay
+	// attempts holds the IDs of the events of every transaction that has
+	// been sent. A transaction could be committed after waiting for it
+	// failed, so all of them are checked before sending the events again.
+	var attempts [][]LogID
+	for i := 0; ; i++ {
+		if c.signerCtrs == nil {
+			c.RefreshSignerCounters()
+		}
+		// The counters are fetched before checking the earlier attempts,
+		// so that an attempt committed in between makes the new
+		// transaction fail.
+		if ids := b.committed(attempts); ids != nil {
+			return ids, false, nil
+		}
+		tx, ids, err := c.prepareTx(events)
+		if err != nil {
+			c.signerCtrs = nil
+			return nil, false, err
+		}
+		buf, err := protobuf.Encode(&byzcoin.TxResult{ClientTransaction: *tx})
+		if err != nil {
+			c.signerCtrs = nil
+			return nil, false, err
+		}
+		if len(buf) > b.maxSize {
+			c.signerCtrs = nil
+			return nil, true, errors.New("transaction too large")
+		}
+
+		reply, err := b.addTx(*tx, b.Wait)
+		if err == nil {
+			return ids, false, nil
+		}
+		attempts = append(attempts, ids)
+		// The transaction is refused if one of the counters is wrong, so
+		// the counters are fetched again in any case.
+		c.signerCtrs = nil
+		if reply != nil && reply.Error != "" &&
+			!strings.Contains(reply.Error, "got counter=") {
+			return nil, true, err
+		}
+		if ids := b.committed(attempts); ids != nil {
+			return ids, false, nil
+		}
+		if i >= b.MaxRetries {
+			return nil, false, err
+		}
+		log.Warnf("couldn't log %d events, trying again in %v: %v",
+			len(events), delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// committed returns the IDs of the events of the attempt that has been
+// committed, if any. As the events of a transaction are committed together,
+// only the first event of every attempt is checked.
+func (b *BatchClient) committed(attempts [][]LogID) []LogID {
+	for _, ids := range attempts {
+		p, err := b.client.ByzCoin.GetProofFromLatest(ids[0])
+		if err == nil && p.Proof.InclusionProof.Match(ids[0]) {
+			return ids
+		}
+	}
+	return nil
+}
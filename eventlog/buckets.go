@@ -2,6 +2,7 @@ package eventlog
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 
 	"go.dedis.ch/cothority/v3/byzcoin"
@@ -10,10 +11,20 @@ import (
 
 var errIndexMissing = errors.New("index does not exist")
 
+// cursorLength is the length of a search cursor: the ID of a bucket and the
+// position of an event in the bucket.
+const cursorLength = 32 + 4
+
 type bucket struct {
 	Start     int64
 	Prev      []byte
 	EventRefs [][]byte
+	// Pruned is set in the catch-all bucket once events have been deleted.
+	// It is the hash of the previous Pruned, followed by the ID and the
+	// hash of the value of every deleted bucket, each of them followed by
+	// the IDs and the hashes of the values of its events, from the oldest
+	// to the newest.
+	Pruned []byte `protobuf:"opt"`
 }
 
 func (b bucket) isFirst() bool {
@@ -46,15 +57,22 @@ func (e eventLog) getLatestBucket() ([]byte, *bucket, error) {
 }
 
 func (e eventLog) getBucketByID(objID []byte) (*bucket, error) {
-	v0, _, _, _, err := e.v.GetValues(objID)
+	b, _, err := e.getBucketAndVersion(objID)
+	return b, err
+}
+
+// getBucketAndVersion returns the bucket together with its version in the
+// trie, which is increased every time an event is added to the bucket.
+func (e eventLog) getBucketAndVersion(objID []byte) (*bucket, uint64, error) {
+	v0, version, _, _, err := e.v.GetValues(objID)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	var b bucket
 	if err := protobuf.Decode(v0, &b); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return &b, nil
+	return &b, version, nil
 }
 
 func (e eventLog) getIndexValue() ([]byte, error) {
@@ -67,3 +85,50 @@ func (e eventLog) getIndexValue() ([]byte, error) {
 	}
 	return v0, nil
 }
+
+// encodeCursor returns the search cursor pointing to the event at position
+// pos in the bucket.
+func encodeCursor(bucketID []byte, pos int) []byte {
+	cursor := make([]byte, cursorLength)
+	copy(cursor, bucketID)
+	binary.BigEndian.PutUint32(cursor[32:], uint32(pos))
+	return cursor
+}
+
+// decodeCursor returns the bucket ID and the position of the event the
+// cursor points to.
+func decodeCursor(cursor []byte) ([]byte, int, error) {
+	if len(cursor) != cursorLength {
+		return nil, 0, errors.New("invalid cursor length")
+	}
+	return cursor[:32], int(binary.BigEndian.Uint32(cursor[32:])), nil
+}
+
+// getCursorEvent returns the event the cursor points to, as it is stored in
+// the search index.
+func (e eventLog) getCursorEvent(cursor []byte) (*indexedEvent, error) {
+	bucketID, pos, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	_, _, cid, _, err := e.v.GetValues(bucketID)
+	if err != nil {
+		return nil, err
+	}
+	if cid != contractName {
+		return nil, errors.New("cursor doesn't point to a bucket")
+	}
+	b, err := e.getBucketByID(bucketID)
+	if err != nil {
+		return nil, err
+	}
+	if pos >= len(b.EventRefs) {
+		return nil, errors.New("cursor points outside of the bucket")
+	}
+	ev, err := getEventByID(e.v, b.EventRefs[pos])
+	if err != nil {
+		return nil, err
+	}
+	return &indexedEvent{id: b.EventRefs[pos], when: ev.When,
+		bucketID: bucketID, bucket: b.Start, pos: pos}, nil
+}
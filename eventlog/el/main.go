@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -132,6 +133,14 @@ var cmds = cli.Commands{
 				Name:  "content, c",
 				Usage: "the text of the log",
 			},
+			cli.StringFlag{
+				Name:  "schema",
+				Usage: "the ID of the schema of the payload, from \"el schema register\"",
+			},
+			cli.StringFlag{
+				Name:  "payload, p",
+				Usage: "the payload of the log, as a JSON object (needs --schema)",
+			},
 			cli.IntFlag{
 				Name:  "wait, w",
 				Usage: "wait for block inclusion (default: do not wait)",
@@ -159,10 +168,22 @@ var cmds = cli.Commands{
 				Name:  "topic, t",
 				Usage: "limit results to logs with this topic",
 			},
+			cli.StringFlag{
+				Name:  "query, q",
+				Usage: "limit results to logs matching the query, like 'topic:auth* user=alice -logout'",
+			},
 			cli.IntFlag{
 				Name:  "count, c",
 				Usage: "limit results to X events",
 			},
+			cli.BoolFlag{
+				Name:  "desc",
+				Usage: "return the latest events first",
+			},
+			cli.BoolFlag{
+				Name:  "all",
+				Usage: "return all the events, using several requests if needed (count is ignored)",
+			},
 			cli.StringFlag{
 				Name:  "from",
 				Usage: "return events from this time (accepts mm-dd-yyyy or relative times like '10m ago')",
@@ -175,9 +196,237 @@ var cmds = cli.Commands{
 				Name:  "for",
 				Usage: "return events for this long after the from time (when for is given, to is ignored)",
 			},
+			cli.StringFlag{
+				Name:  "format",
+				Usage: "the output format, either \"text\" or \"json\" (one object per line, with decoded payloads)",
+				Value: "text",
+			},
+			cli.BoolFlag{
+				Name:  "ids",
+				Usage: "print the IDs of the events in the text format",
+			},
+			cli.BoolFlag{
+				Name:  "prove",
+				Usage: "verify that no events are missing, which downloads all the events of the time range",
+			},
 		},
 		Action: search,
 	},
+	{
+		Name:  "tail",
+		Usage: "follow the eventlog, and export the events as they are logged",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config",
+			},
+			cli.StringFlag{
+				Name:   "el",
+				EnvVar: "EL",
+				Usage:  "the eventlog id, from \"el create\"",
+			},
+			cli.StringFlag{
+				Name:  "checkpoint",
+				Usage: "the file storing the last exported event, to resume after it on the next run",
+			},
+			cli.BoolFlag{
+				Name:  "all",
+				Usage: "export all the events from the genesis block, instead of only the new ones, if there is no checkpoint",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Usage: "the format when printing the events, either \"text\" or \"json\"",
+				Value: "text",
+			},
+			cli.BoolFlag{
+				Name:  "ids",
+				Usage: "print the IDs of the events in the text format",
+			},
+			cli.StringFlag{
+				Name:  "file",
+				Usage: "append the events as JSON lines to this file, instead of printing them",
+			},
+			cli.Int64Flag{
+				Name:  "max-size",
+				Usage: "rotate the file before it gets bigger than this many bytes (0 for no rotation)",
+			},
+			cli.IntFlag{
+				Name:  "max-files",
+				Usage: "how many rotated files to keep",
+				Value: 5,
+			},
+			cli.StringFlag{
+				Name:  "syslog",
+				Usage: "send the events to this syslog server, like udp://localhost:514, or \"local\" for the local one, instead of printing them",
+			},
+			cli.StringFlag{
+				Name:  "syslog-tag",
+				Usage: "the syslog tag of the events",
+				Value: "eventlog",
+			},
+			cli.StringFlag{
+				Name:  "webhook",
+				Usage: "post the events as JSON to this URL, instead of printing them",
+			},
+		},
+		Action: tail,
+	},
+	{
+		Name:  "retention",
+		Usage: "work with the retention policy of the event log",
+		Subcommands: cli.Commands{
+			{
+				Name:  "set",
+				Usage: "set the retention policy, which is enforced by \"el prune\"",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "sign",
+						Usage: "the ed25519 private key that will sign the transaction",
+					},
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config",
+					},
+					cli.StringFlag{
+						Name:   "el",
+						EnvVar: "EL",
+						Usage:  "the eventlog id, from \"el create\"",
+					},
+					cli.DurationFlag{
+						Name:  "max-age",
+						Usage: "delete the events older than this (default: no limit)",
+					},
+					cli.IntFlag{
+						Name:  "max-count",
+						Usage: "only keep this many of the latest events (default: no limit)",
+					},
+				},
+				Action: retentionSet,
+			},
+			{
+				Name:  "show",
+				Usage: "show the retention policy and the redacted events",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config",
+					},
+					cli.StringFlag{
+						Name:   "el",
+						EnvVar: "EL",
+						Usage:  "the eventlog id, from \"el create\"",
+					},
+				},
+				Action: retentionShow,
+			},
+		},
+	},
+	{
+		Name:  "prune",
+		Usage: "delete the events that are out of the retention policy",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "sign",
+				Usage: "the ed25519 private key that will sign the transaction",
+			},
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config",
+			},
+			cli.StringFlag{
+				Name:   "el",
+				EnvVar: "EL",
+				Usage:  "the eventlog id, from \"el create\"",
+			},
+		},
+		Action: prune,
+	},
+	{
+		Name:  "redact",
+		Usage: "redact an event, only keeping its time and its hash",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "sign",
+				Usage: "the ed25519 private key that will sign the transaction",
+			},
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config",
+			},
+			cli.StringFlag{
+				Name:   "el",
+				EnvVar: "EL",
+				Usage:  "the eventlog id, from \"el create\"",
+			},
+			cli.StringFlag{
+				Name:  "id",
+				Usage: "the ID of the event, from \"el search -ids\"",
+			},
+		},
+		Action: redact,
+	},
+	{
+		Name:  "schema",
+		Usage: "work with the schemas of the payloads",
+		Subcommands: cli.Commands{
+			{
+				Name:  "register",
+				Usage: "register a new schema on the event log",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "sign",
+						Usage: "the ed25519 private key that will sign the transaction",
+					},
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config",
+					},
+					cli.StringFlag{
+						Name:   "el",
+						EnvVar: "EL",
+						Usage:  "the eventlog id, from \"el create\"",
+					},
+					cli.StringFlag{
+						Name:  "id",
+						Usage: "the ID of the schema",
+					},
+					cli.StringFlag{
+						Name:  "format",
+						Usage: "the format of the payloads, either \"json\" or \"protobuf\"",
+						Value: eventlog.SchemaFormatJSON,
+					},
+					cli.StringSliceFlag{
+						Name:  "field, f",
+						Usage: "a field as name:type, where type is string, int, float, bool or bytes. Add a ! to the type if the field is required. Can be repeated",
+					},
+				},
+				Action: schemaRegister,
+			},
+			{
+				Name:  "list",
+				Usage: "list the schemas of the event log",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config",
+					},
+					cli.StringFlag{
+						Name:   "el",
+						EnvVar: "EL",
+						Usage:  "the eventlog id, from \"el create\"",
+					},
+				},
+				Action: schemaList,
+			},
+		},
+	},
 	{
 		Name:    "key",
 		Usage:   "generates a new keypair and prints the public key in the stdout",
@@ -339,23 +588,280 @@ func doLog(c *cli.Context) error {
 	content := c.String("content")
 	w := c.Int("wait")
 
+	newEvent := func(content string) (eventlog.Event, error) {
+		return eventlog.NewEvent(t, content), nil
+	}
+	if c.String("schema") != "" {
+		// With a schema, the content is the payload.
+		if content != "" {
+			return errors.New("--content cannot be used with --schema, use --payload")
+		}
+		content = c.String("payload")
+		newEvent, err = structuredEvent(cl, t, c.String("schema"))
+		if err != nil {
+			return err
+		}
+	} else if c.String("payload") != "" {
+		return errors.New("--payload needs --schema")
+	}
+
 	// Content is set, so one shot log.
 	if content != "" {
-		_, err := cl.LogAndWait(w, eventlog.NewEvent(t, content))
+		ev, err := newEvent(content)
+		if err != nil {
+			return err
+		}
+		_, err = cl.LogAndWait(w, ev)
 		return err
 	}
 
-	// Content is empty, so read from stdin.
+	// Content is empty, so read from stdin, and log the lines in batches.
+	bc, err := eventlog.NewBatchClient(cl, 1000)
+	if err != nil {
+		return err
+	}
+	if w > 0 {
+		bc.Wait = w
+	}
+	// The callbacks are done once bc is closed.
+	var failed error
+	cb := func(id eventlog.LogID, err error) {
+		if err != nil {
+			log.Error(err)
+			failed = err
+		}
+	}
 	s := bufio.NewScanner(os.Stdin)
 	for s.Scan() {
-		_, err := cl.LogAndWait(w, eventlog.NewEvent(t, s.Text()))
+		ev, err := newEvent(s.Text())
+		if err == nil {
+			err = bc.Log(ev, cb)
+		}
 		if err != nil {
+			bc.Close()
 			return err
 		}
 	}
+	if err := bc.Close(); err != nil {
+		return err
+	}
+	if failed != nil {
+		return failed
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return bcadminlib.WaitPropagation(c, cl.ByzCoin)
+}
+
+// structuredEvent returns a function creating events with the topic and a
+// payload given as JSON, encoded following the schema.
+func structuredEvent(cl *eventlog.Client, topic,
+	schemaID string) (func(string) (eventlog.Event, error), error) {
+	reg, err := cl.GetSchemas()
+	if err != nil {
+		return nil, err
+	}
+	schema := reg.Get(schemaID)
+	if schema == nil {
+		return nil, fmt.Errorf("unknown schema \"%s\"", schemaID)
+	}
+	return func(in string) (eventlog.Event, error) {
+		dec := json.NewDecoder(strings.NewReader(in))
+		dec.UseNumber()
+		var fields map[string]interface{}
+		if err := dec.Decode(&fields); err != nil {
+			return eventlog.Event{}, fmt.Errorf("payload is not a JSON object: %v", err)
+		}
+		payload, err := schema.Encode(fields)
+		if err != nil {
+			return eventlog.Event{}, err
+		}
+		return eventlog.NewStructuredEvent(topic, schemaID, payload), nil
+	}, nil
+}
+
+func schemaRegister(c *cli.Context) error {
+	cl, err := getClient(c, true)
+	if err != nil {
+		return err
+	}
+	e := c.String("el")
+	if e == "" {
+		return errors.New("--el is required")
+	}
+	eb, err := hex.DecodeString(e)
+	if err != nil {
+		return err
+	}
+	cl.Instance = byzcoin.NewInstanceID(eb)
+
+	schema := eventlog.Schema{
+		ID:     c.String("id"),
+		Format: c.String("format"),
+	}
+	for _, f := range c.StringSlice("field") {
+		parts := strings.SplitN(f, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid field \"%s\", need name:type", f)
+		}
+		field := eventlog.SchemaField{Name: parts[0], Type: parts[1]}
+		if strings.HasSuffix(field.Type, "!") {
+			field.Type = strings.TrimSuffix(field.Type, "!")
+			field.Required = true
+		}
+		schema.Fields = append(schema.Fields, field)
+	}
+	if err := cl.RegisterSchema(schema); err != nil {
+		return err
+	}
+	return bcadminlib.WaitPropagation(c, cl.ByzCoin)
+}
+
+func schemaList(c *cli.Context) error {
+	cl, err := getClient(c, false)
+	if err != nil {
+		return err
+	}
+	e := c.String("el")
+	if e == "" {
+		return errors.New("--el is required")
+	}
+	eb, err := hex.DecodeString(e)
+	if err != nil {
+		return err
+	}
+	cl.Instance = byzcoin.NewInstanceID(eb)
+
+	reg, err := cl.GetSchemas()
+	if err != nil {
+		return err
+	}
+	for _, s := range reg.Schemas {
+		var fields []string
+		for _, f := range s.Fields {
+			field := f.Name + ":" + f.Type
+			if f.Required {
+				field += "!"
+			}
+			fields = append(fields, field)
+		}
+		log.Infof("%v\t%v\t%v", s.ID, s.Format, strings.Join(fields, " "))
+	}
+	return nil
+}
+
+func retentionSet(c *cli.Context) error {
+	cl, err := getClient(c, true)
+	if err != nil {
+		return err
+	}
+	e := c.String("el")
+	if e == "" {
+		return errors.New("--el is required")
+	}
+	eb, err := hex.DecodeString(e)
+	if err != nil {
+		return err
+	}
+	cl.Instance = byzcoin.NewInstanceID(eb)
+
+	if err := cl.SetRetention(c.Duration("max-age"), c.Int("max-count")); err != nil {
+		return err
+	}
 	return bcadminlib.WaitPropagation(c, cl.ByzCoin)
 }
 
+func retentionShow(c *cli.Context) error {
+	cl, err := getClient(c, false)
+	if err != nil {
+		return err
+	}
+	e := c.String("el")
+	if e == "" {
+		return errors.New("--el is required")
+	}
+	eb, err := hex.DecodeString(e)
+	if err != nil {
+		return err
+	}
+	cl.Instance = byzcoin.NewInstanceID(eb)
+
+	r, err := cl.GetRetention()
+	if err != nil {
+		return err
+	}
+	log.Infof("max-age: %v", time.Duration(r.MaxAge))
+	log.Infof("max-count: %v", r.MaxCount)
+	for _, id := range r.Redacted {
+		log.Infof("redacted: %x", id)
+	}
+	return nil
+}
+
+func prune(c *cli.Context) error {
+	cl, err := getClient(c, true)
+	if err != nil {
+		return err
+	}
+	e := c.String("el")
+	if e == "" {
+		return errors.New("--el is required")
+	}
+	eb, err := hex.DecodeString(e)
+	if err != nil {
+		return err
+	}
+	cl.Instance = byzcoin.NewInstanceID(eb)
+
+	if err := cl.Prune(); err != nil {
+		return err
+	}
+	return bcadminlib.WaitPropagation(c, cl.ByzCoin)
+}
+
+func redact(c *cli.Context) error {
+	cl, err := getClient(c, true)
+	if err != nil {
+		return err
+	}
+	e := c.String("el")
+	if e == "" {
+		return errors.New("--el is required")
+	}
+	eb, err := hex.DecodeString(e)
+	if err != nil {
+		return err
+	}
+	cl.Instance = byzcoin.NewInstanceID(eb)
+
+	id, err := hex.DecodeString(c.String("id"))
+	if err != nil {
+		return err
+	}
+	if len(id) == 0 {
+		return errors.New("--id is required")
+	}
+	if err := cl.Redact(id); err != nil {
+		return err
+	}
+	return bcadminlib.WaitPropagation(c, cl.ByzCoin)
+}
+
+// printText prints the event on one line, with its ID if ids is set.
+func printText(id []byte, x eventlog.Event, ids bool) {
+	const tsFormat = "2006-01-02 15:04:05"
+	content := x.Content
+	if x.Redacted != nil {
+		content = "[redacted]"
+	}
+	if ids {
+		log.Infof("%x\t%v\t%v\t%v", id, time.Unix(0, x.When).Format(tsFormat), x.Topic, content)
+	} else {
+		log.Infof("%v\t%v\t%v", time.Unix(0, x.When).Format(tsFormat), x.Topic, content)
+	}
+}
+
 var none = time.Unix(0, 0)
 
 // parseTime will accept either dates or "X ago" where X is a duration.
@@ -377,7 +883,11 @@ func parseTime(in string) (time.Time, error) {
 
 func search(c *cli.Context) error {
 	req := &eventlog.SearchRequest{
-		Topic: c.String("topic"),
+		Topic:      c.String("topic"),
+		Query:      c.String("query"),
+		Limit:      c.Int("count"),
+		Descending: c.Bool("desc"),
+		Prove:      c.Bool("prove"),
 	}
 
 	f := c.String("from")
@@ -419,29 +929,143 @@ func search(c *cli.Context) error {
 	}
 	cl.Instance = byzcoin.NewInstanceID(eb)
 
-	resp, err := cl.Search(req)
-	if err != nil {
-		return err
+	var printEvent func(id []byte, x eventlog.Event) error
+	switch c.String("format") {
+	case "text":
+		printEvent = func(id []byte, x eventlog.Event) error {
+			printText(id, x, c.Bool("ids"))
+			return nil
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		printEvent = func(id []byte, x eventlog.Event) error {
+			fields, err := cl.DecodePayload(x)
+			if err != nil {
+				return err
+			}
+			return enc.Encode(eventlog.ExportedEvent{ID: id, Event: x,
+				Fields: fields})
+		}
+	default:
+		return fmt.Errorf("unknown format \"%s\"", c.String("format"))
+	}
+
+	if c.Bool("all") {
+		req.Limit = 0
+	}
+	for {
+		resp, err := cl.Search(req)
+		if err != nil {
+			return err
+		}
+
+		for i, x := range resp.Events {
+			var id []byte
+			if i < len(resp.IDs) {
+				id = resp.IDs[i]
+			}
+			if err := printEvent(id, x); err != nil {
+				return err
+			}
+		}
+
+		if c.Bool("all") && resp.Truncated {
+			req.Cursor = resp.Cursor
+			continue
+		}
+		// Only signal truncation if the results were not limited by --count.
+		if resp.Truncated && req.Limit == 0 {
+			return cli.NewExitError("", 1)
+		}
+		return nil
 	}
+}
+
+// textOutput prints the events like "el search".
+type textOutput struct {
+	ids bool
+}
 
-	ct := c.Int("count")
+func (o textOutput) Write(ev *eventlog.ExportedEvent) error {
+	printText(ev.ID, ev.Event, o.ids)
+	return nil
+}
 
-	for _, x := range resp.Events {
-		const tsFormat = "2006-01-02 15:04:05"
-		log.Infof("%v\t%v\t%v", time.Unix(0, x.When).Format(tsFormat), x.Topic, x.Content)
+func (o textOutput) Close() error {
+	return nil
+}
 
-		if ct != 0 {
-			ct--
-			if ct == 0 {
-				break
+func tail(c *cli.Context) error {
+	cl, err := getClient(c, false)
+	if err != nil {
+		return err
+	}
+	e := c.String("el")
+	if e == "" {
+		return errors.New("--el is required")
+	}
+	eb, err := hex.DecodeString(e)
+	if err != nil {
+		return err
+	}
+	cl.Instance = byzcoin.NewInstanceID(eb)
+
+	var outputs []eventlog.SinkOutput
+	if f := c.String("file"); f != "" {
+		out, err := eventlog.NewFileOutput(f, c.Int64("max-size"),
+			c.Int("max-files"))
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, out)
+	}
+	if s := c.String("syslog"); s != "" {
+		var network, addr string
+		if s != "local" {
+			parts := strings.SplitN(s, "://", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid syslog address \"%s\"", s)
 			}
+			network, addr = parts[0], parts[1]
+		}
+		out, err := eventlog.NewSyslogOutput(network, addr, c.String("syslog-tag"))
+		if err != nil {
+			return err
 		}
+		outputs = append(outputs, out)
 	}
+	if u := c.String("webhook"); u != "" {
+		outputs = append(outputs, eventlog.NewWebhookOutput(u))
+	}
+	if len(outputs) == 0 {
+		switch c.String("format") {
+		case "text":
+			outputs = append(outputs, textOutput{ids: c.Bool("ids")})
+		case "json":
+			outputs = append(outputs, eventlog.NewWriterOutput(os.Stdout))
+		default:
+			return fmt.Errorf("unknown format \"%s\"", c.String("format"))
+		}
+	}
+	if len(outputs) > 1 {
+		for _, out := range outputs {
+			out.Close()
+		}
+		return errors.New("only one of --file, --syslog and --webhook can be given")
+	}
+	out := outputs[0]
+	defer out.Close()
 
-	if resp.Truncated {
-		return cli.NewExitError("", 1)
+	sink := eventlog.NewSink(cl, out, c.String("checkpoint"))
+	if !c.Bool("all") {
+		// Only the new events are exported, if there is no checkpoint.
+		p, err := cl.ByzCoin.GetProofFromLatest(cl.Instance.Slice())
+		if err != nil {
+			return err
+		}
+		sink.Start = p.Proof.Latest.Hash
 	}
-	return nil
+	return sink.Run()
 }
 
 func login(c *cli.Context) error {
@@ -39,6 +39,10 @@ testEventLog(){
 	testOK ./bcadmin -c . darc rule -rule spawn:eventlog -identity "$KEY"
 	./bcadmin debug counters bc*cfg key*cfg
 	testOK ./bcadmin -c . darc rule -rule invoke:eventlog.log -identity "$KEY"
+	testOK ./bcadmin -c . darc rule -rule invoke:eventlog.schema -identity "$KEY"
+	testOK ./bcadmin -c . darc rule -rule invoke:eventlog.retention -identity "$KEY"
+	testOK ./bcadmin -c . darc rule -rule invoke:eventlog.prune -identity "$KEY"
+	testOK ./bcadmin -c . darc rule -rule invoke:eventlog.redact -identity "$KEY"
 
 	runGrepSed "export EL=" "" $el create -sign "$KEY"
 	eval "$SED"
@@ -57,6 +61,42 @@ testEventLog(){
 	# The first form of relative date is for MacOS, the second for Linux.
 	testCountLines 0 $el search -t test -from '1h ago' -to `date -v -1d +%Y-%m-%d || date -d yesterday +%Y-%m-%d`
 	testCountLines 1 $el search -t test -to `date -v +1d +%Y-%m-%d || date -d tomorrow +%Y-%m-%d`
+
+	testCountLines 2 $el search -q 'abc OR def'
+	testCountLines 9 $el search -q 'topic:seq* -10'
+	testGrep "10" $el search -q 'topic:seq*' -count 1 -desc
+	testFail $el search -q '(abc'
+	testCountLines 13 $el search -all
+
+	testOK $el schema register -id login -field user:string! -field ok:bool -sign "$KEY"
+	testOK $el schema register -id pb -format protobuf -field n:int -sign "$KEY"
+	testFail $el schema register -id login -field user:string -sign "$KEY"
+	testCountLines 2 $el schema list
+	testOK $el log -t auth -schema login -payload '{"user": "alice", "ok": true}' -w 10 -sign "$KEY"
+	testOK $el log -t pb -schema pb -payload '{"n": -42}' -w 10 -sign "$KEY"
+	testFail $el log -t auth -schema login -payload '{"ok": true}' -w 10 -sign "$KEY"
+	testFail $el log -t auth -schema unknown -payload '{}' -w 10 -sign "$KEY"
+	testGrep '"user":"alice"' $el search -t auth -format json
+	testGrep '"n":-42' $el search -t pb -format json
+
+	rm -f tail.log tail.cp
+	$el tail -all -checkpoint tail.cp -file tail.log &
+	TAIL=$!
+	sleep 5
+	kill $TAIL
+	testGrep '"user":"alice"' cat tail.log
+	testCountLines 15 cat tail.log
+	testOK test -s tail.cp
+
+	runGrepSed "abc" "s/ .*//" $el search -t test -ids
+	testOK $el redact -id "$SED" -sign "$KEY"
+	testFail $el redact -id "$SED" -sign "$KEY"
+	testCountLines 0 $el search -q abc
+	testGrep "redacted" $el search -ids
+	testFail $el prune -sign "$KEY"
+	testOK $el retention set -max-count 1 -sign "$KEY"
+	testGrep "max-count: 1" $el retention show
+	testOK $el prune -sign "$KEY"
 }
 
 main
@@ -0,0 +1,409 @@
+package eventlog
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"go.dedis.ch/cothority/v3/skipchain"
+)
+
+// indexMargin is how long before the last update of an index the buckets
+// have to start to be sure they did not change since. Events can only be
+// logged maxEventAge in the past, so the margin leaves some room for clock
+// skew between the nodes.
+const indexMargin = 2 * maxEventAge
+
+// maxIndexes is how many search indexes are kept in memory. When a search
+// needs a new index, the least recently used one is dropped.
+const maxIndexes = 64
+
+// eventIndex is the search index of the events of one eventlog. It is kept in
+// memory and updated from the buckets of the eventlog before every search.
+// Only the buckets that can hold events in the time range of a search are
+// indexed.
+type eventIndex struct {
+	sync.Mutex
+	// used is the value of the clock of the service at the last search,
+	// and is protected by the lock of the service.
+	used uint64
+	// updated is the time of the last update of all the buckets holding
+	// events from low on, in UnixNano.
+	updated int64
+	low     int64
+	// retention is the version of the retention instance, as returned by
+	// getRetention, at the last update. It changes when events are deleted
+	// or redacted, and the index is then updated.
+	retention uint64
+	redacted  map[string]bool
+	buckets   map[string]*indexedBucket
+	// events holds all the events that have been indexed, and the sequence
+	// number of an event is its position in events. seqs maps the ID of an
+	// event to its sequence number.
+	events []indexedEvent
+	seqs   map[string]int
+	// order holds the sequence numbers of the events, sorted by time.
+	order []int
+	// topics and terms hold the sequence numbers of the events with a
+	// given topic or term, in increasing order.
+	topics map[string][]int
+	terms  map[string][]int
+}
+
+type indexedBucket struct {
+	version uint64
+	events  int
+}
+
+type indexedEvent struct {
+	id   []byte
+	when int64
+	// bucketID is the bucket holding the event, bucket its start and pos the
+	// position of the event in the bucket, used to order events logged at
+	// the same time.
+	bucketID []byte
+	bucket   int64
+	pos      int
+}
+
+func (e indexedEvent) before(o indexedEvent) bool {
+	if e.when != o.when {
+		return e.when < o.when
+	}
+	if e.bucket != o.bucket {
+		return e.bucket < o.bucket
+	}
+	return e.pos < o.pos
+}
+
+func newEventIndex() *eventIndex {
+	return &eventIndex{
+		low:      math.MaxInt64,
+		redacted: make(map[string]bool),
+		buckets:  make(map[string]*indexedBucket),
+		seqs:     make(map[string]int),
+		topics:   make(map[string][]int),
+		terms:    make(map[string][]int),
+	}
+}
+
+// add indexes the event, which is at position pos in the bucket bucketID
+// starting at bucketStart.
+func (idx *eventIndex) add(id, bucketID []byte, bucketStart int64, pos int,
+	ev *Event) {
+	seq := len(idx.events)
+	ie := indexedEvent{id: id, when: ev.When, bucketID: bucketID,
+		bucket: bucketStart, pos: pos}
+	idx.events = append(idx.events, ie)
+	idx.seqs[string(id)] = seq
+
+	// Events mostly arrive in order, so this is cheap.
+	i := sort.Search(len(idx.order), func(i int) bool {
+		return ie.before(idx.events[idx.order[i]])
+	})
+	idx.order = append(idx.order, 0)
+	copy(idx.order[i+1:], idx.order[i:])
+	idx.order[i] = seq
+
+	idx.topics[ev.Topic] = append(idx.topics[ev.Topic], seq)
+	for _, t := range contentTerms(ev.Content) {
+		idx.terms[t] = append(idx.terms[t], seq)
+	}
+}
+
+// remove takes the events out of the index. The sequence numbers of the
+// remaining events are changed.
+func (idx *eventIndex) remove(removed map[int]bool) {
+	if len(removed) == 0 {
+		return
+	}
+	renum := make([]int, len(idx.events))
+	var events []indexedEvent
+	for seq, ev := range idx.events {
+		if removed[seq] {
+			renum[seq] = -1
+			delete(idx.seqs, string(ev.id))
+			continue
+		}
+		renum[seq] = len(events)
+		idx.seqs[string(ev.id)] = len(events)
+		events = append(events, ev)
+	}
+	idx.events = events
+
+	// The renumbering keeps the order, so the lists stay sorted.
+	renumber := func(seqs []int) []int {
+		var out []int
+		for _, seq := range seqs {
+			if renum[seq] >= 0 {
+				out = append(out, renum[seq])
+			}
+		}
+		return out
+	}
+	idx.order = renumber(idx.order)
+	for _, m := range []map[string][]int{idx.topics, idx.terms} {
+		for k, seqs := range m {
+			if seqs = renumber(seqs); len(seqs) > 0 {
+				m[k] = seqs
+			} else {
+				delete(m, k)
+			}
+		}
+	}
+}
+
+// addBucket indexes the events of the bucket that are not yet in the index.
+func (idx *eventIndex) addBucket(el *eventLog, id []byte, b *bucket,
+	version uint64) error {
+	ib, ok := idx.buckets[string(id)]
+	if !ok {
+		ib = &indexedBucket{}
+		idx.buckets[string(id)] = ib
+	}
+	if ok && ib.version == version {
+		return nil
+	}
+	for pos := ib.events; pos < len(b.EventRefs); pos++ {
+		ev, err := getEventByID(el.v, b.EventRefs[pos])
+		if err != nil {
+			return err
+		}
+		idx.add(b.EventRefs[pos], id, b.Start, pos, ev)
+	}
+	ib.version = version
+	ib.events = len(b.EventRefs)
+	return nil
+}
+
+// retain updates the index after events have been deleted or redacted. The
+// events of the buckets that have been deleted or emptied are removed, and
+// the redacted events are indexed again.
+func (idx *eventIndex) retain(el *eventLog, r *Retention) error {
+	// The buckets that are removed from the index are indexed again if a
+	// search needs them.
+	gone := make(map[string]bool)
+	for id, ib := range idx.buckets {
+		p, err := el.v.GetProof([]byte(id))
+		if err != nil {
+			return err
+		}
+		if p.Match([]byte(id)) {
+			b, err := el.getBucketByID([]byte(id))
+			if err != nil {
+				return err
+			}
+			if len(b.EventRefs) >= ib.events {
+				continue
+			}
+		}
+		gone[id] = true
+		delete(idx.buckets, id)
+	}
+	removed := make(map[int]bool)
+	if len(gone) > 0 {
+		for seq, ev := range idx.events {
+			if gone[string(ev.bucketID)] {
+				removed[seq] = true
+			}
+		}
+	}
+
+	redacted := make(map[string]bool)
+	var readd []indexedEvent
+	for _, id := range r.Redacted {
+		redacted[string(id)] = true
+		if idx.redacted[string(id)] {
+			continue
+		}
+		if seq, ok := idx.seqs[string(id)]; ok && !removed[seq] {
+			removed[seq] = true
+			readd = append(readd, idx.events[seq])
+		}
+	}
+	idx.redacted = redacted
+	idx.remove(removed)
+
+	for _, ie := range readd {
+		ev, err := getEventByID(el.v, ie.id)
+		if err != nil {
+			return err
+		}
+		idx.add(ie.id, ie.bucketID, ie.bucket, ie.pos, ev)
+	}
+	return nil
+}
+
+// update indexes the buckets that can hold events with from <= When < to,
+// and that changed since they have been indexed. It walks back the buckets
+// from the latest one, until the start of the time range, or until it finds
+// a bucket that did not change and that cannot have changed since the last
+// update, as the next bucket started before the last update. If events
+// have been deleted or redacted since the last update, they are removed
+// from the index.
+func (idx *eventIndex) update(el *eventLog, now, from, to int64) error {
+	r, retention, err := getRetention(el.v, el.Instance)
+	if err != nil {
+		return err
+	}
+	if retention != idx.retention {
+		if err := idx.retain(el, r); err != nil {
+			return err
+		}
+		idx.retention = retention
+	}
+
+	id, b, err := el.getLatestBucket()
+	if err != nil || b == nil {
+		return err
+	}
+	_, version, err := el.getBucketAndVersion(id)
+	if err != nil {
+		return err
+	}
+
+	// Add the events from the newest bucket to the oldest, as the
+	// walk stops at the start of the time range.
+	next := int64(math.MaxInt64)
+	stopped := false
+	for {
+		ib, ok := idx.buckets[string(id)]
+		if ok && ib.version == version && from >= idx.low &&
+			next < idx.updated-indexMargin.Nanoseconds() {
+			stopped = true
+			break
+		}
+		if overlaps(b, next, from, to-1) {
+			if err := idx.addBucket(el, id, b, version); err != nil {
+				return err
+			}
+		}
+		if b.isFirst() || b.Start <= from-maxBucketOverlap.Nanoseconds() {
+			break
+		}
+		next = b.Start
+		id = b.Prev
+		b, version, err = el.getBucketAndVersion(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only a search up to the latest events indexes all the buckets after
+	// the start of its time range.
+	if to == math.MaxInt64 {
+		if !stopped {
+			idx.low = from
+		}
+		idx.updated = now
+	}
+	return nil
+}
+
+// find returns the events matching the query with From <= When < To, sorted
+// by time, and whether all of them are known to match the query. If not, the
+// caller has to match the events against the query.
+func (idx *eventIndex) find(q queryNode, from, to int64) ([]indexedEvent, bool) {
+	var set []int
+	exact := true
+	if q != nil {
+		set, exact = q.eval(idx)
+	}
+
+	var out []indexedEvent
+	if set == nil {
+		lo := sort.Search(len(idx.order), func(i int) bool {
+			return idx.events[idx.order[i]].when >= from
+		})
+		hi := sort.Search(len(idx.order), func(i int) bool {
+			return idx.events[idx.order[i]].when >= to
+		})
+		for _, seq := range idx.order[lo:hi] {
+			out = append(out, idx.events[seq])
+		}
+		return out, exact
+	}
+
+	for _, seq := range set {
+		if ev := idx.events[seq]; from <= ev.when && ev.when < to {
+			out = append(out, ev)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].before(out[j]) })
+	return out, exact
+}
+
+// orderEvents takes events sorted by time and returns the ones after the
+// cursor, if it is not nil, in the order of the search.
+func orderEvents(events []indexedEvent, cursor *indexedEvent,
+	descending bool) []indexedEvent {
+	if cursor != nil {
+		i := sort.Search(len(events), func(i int) bool {
+			return !events[i].before(*cursor)
+		})
+		if descending {
+			events = events[:i]
+		} else {
+			for i < len(events) && !cursor.before(events[i]) {
+				i++
+			}
+			events = events[i:]
+		}
+	}
+	if descending {
+		for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+			events[i], events[j] = events[j], events[i]
+		}
+	}
+	return events
+}
+
+// findEvents updates the index of the eventlog with the latest events and
+// returns the events matching the query, like eventIndex.find. The time now
+// must be taken before getting the state trie of the eventlog.
+func (s *Service) findEvents(scID skipchain.SkipBlockID, el *eventLog,
+	now int64, q queryNode, from, to int64) ([]indexedEvent, bool, error) {
+	key := string(scID) + string(el.Instance.Slice())
+	idx := s.getIndex(key)
+
+	idx.Lock()
+	defer idx.Unlock()
+	if err := idx.update(el, now, from, to); err != nil {
+		// Don't keep indexes for instances that are not eventlogs.
+		if len(idx.buckets) == 0 {
+			s.indexesLock.Lock()
+			if s.indexes[key] == idx {
+				delete(s.indexes, key)
+			}
+			s.indexesLock.Unlock()
+		}
+		return nil, false, err
+	}
+	events, exact := idx.find(q, from, to)
+	return events, exact, nil
+}
+
+// getIndex returns the search index of the eventlog with the given key, and
+// creates it if needed. Only maxIndexes indexes are kept, and the least
+// recently used one is dropped to make room for a new one.
+func (s *Service) getIndex(key string) *eventIndex {
+	s.indexesLock.Lock()
+	defer s.indexesLock.Unlock()
+	s.indexesClock++
+	idx, ok := s.indexes[key]
+	if !ok {
+		if len(s.indexes) >= maxIndexes {
+			var oldest string
+			for k, i := range s.indexes {
+				if oldest == "" || i.used < s.indexes[oldest].used {
+					oldest = k
+				}
+			}
+			delete(s.indexes, oldest)
+		}
+		idx = newEventIndex()
+		s.indexes[key] = idx
+	}
+	idx.used = s.indexesClock
+	return idx
+}
@@ -0,0 +1,263 @@
+package eventlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/protobuf"
+)
+
+// searchWindow returns the times between which, both included, the response
+// must hold all the events matching the search. cursor is the event the
+// cursor of the request points to, or nil.
+func searchWindow(req *SearchRequest, cursor *indexedEvent,
+	resp *SearchResponse) (int64, int64) {
+	lo, hi := req.From, req.To-1
+	if req.To == 0 {
+		hi = math.MaxInt64
+	}
+	if req.Descending {
+		if cursor != nil {
+			hi = cursor.when
+		}
+		if resp.Truncated {
+			lo = resp.Events[len(resp.Events)-1].When
+		}
+	} else {
+		if cursor != nil {
+			lo = cursor.when
+		}
+		if resp.Truncated {
+			hi = resp.Events[len(resp.Events)-1].When
+		}
+	}
+	return lo, hi
+}
+
+// proveSearch returns the proof of the response to the search. It holds the
+// proofs of all the buckets from the latest one to the one holding the
+// earliest events of the search window, and the proofs of all the events of
+// the buckets which can hold events of the window.
+func (s *Service) proveSearch(req *SearchRequest, el *eventLog,
+	cursor *indexedEvent, resp *SearchResponse) (*SearchProof, error) {
+	from := req.ProofFrom
+	if from == nil {
+		from = req.ID
+	}
+	index, err := byzcoin.NewProof(el.v, s.skService().GetDB(), from,
+		el.Instance.Slice())
+	if err != nil {
+		return nil, err
+	}
+	sp := &SearchProof{Index: *index}
+
+	id, b, err := el.getLatestBucket()
+	if err != nil || b == nil {
+		return sp, err
+	}
+	lo, hi := searchWindow(req, cursor, resp)
+	// next is the start of the bucket after b.
+	next := int64(math.MaxInt64)
+	for {
+		p, err := el.v.GetProof(id)
+		if err != nil {
+			return nil, err
+		}
+		sp.Buckets = append(sp.Buckets, *p)
+		if overlaps(b, next, lo, hi) {
+			for _, ref := range b.EventRefs {
+				p, err := el.v.GetProof(ref)
+				if err != nil {
+					return nil, err
+				}
+				sp.Events = append(sp.Events, *p)
+			}
+		}
+		if b.isFirst() || b.Start <= lo-maxBucketOverlap.Nanoseconds() {
+			return sp, nil
+		}
+		next = b.Start
+		id = b.Prev
+		b, err = el.getBucketByID(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// overlaps returns whether the bucket, followed by a bucket starting at next,
+// can hold events between lo and hi, both included.
+func overlaps(b *bucket, next, lo, hi int64) bool {
+	if next < math.MaxInt64-maxBucketOverlap.Nanoseconds() {
+		next += maxBucketOverlap.Nanoseconds()
+	}
+	return b.Start <= hi && next > lo
+}
+
+// getValue returns the value of the key in the trie proof, which must be an
+// existence proof for the trie with the given root, of an eventlog instance.
+func getValue(p *trie.Proof, root, key []byte) ([]byte, error) {
+	if !bytes.Equal(p.GetRoot(), root) {
+		return nil, errors.New("proof is for another trie")
+	}
+	if !p.Match(key) {
+		return nil, fmt.Errorf("not a proof of %x", key)
+	}
+	_, value, cid, _, err := byzcoin.Proof{InclusionProof: *p}.KeyValue()
+	if err != nil {
+		return nil, err
+	}
+	if cid != contractName {
+		return nil, fmt.Errorf("%x is not an eventlog instance", key)
+	}
+	return value, nil
+}
+
+// verify checks that the response holds all the events matching the search,
+// using the proofs. The skipchain proof of Index has to be verified by the
+// caller.
+func (sp *SearchProof) verify(req *SearchRequest, resp *SearchResponse) error {
+	q, err := searchQuery(req)
+	if err != nil {
+		return err
+	}
+	if resp.Truncated && len(resp.Events) == 0 {
+		return errors.New("truncated response without events")
+	}
+	root := sp.Index.InclusionProof.GetRoot()
+	head, err := getValue(&sp.Index.InclusionProof, root, req.Instance.Slice())
+	if err != nil {
+		return fmt.Errorf("invalid eventlog proof: %v", err)
+	}
+	events := make(map[string]*Event)
+	for i := range sp.Events {
+		key := sp.Events[i].Key()
+		buf, err := getValue(&sp.Events[i], root, key)
+		if err != nil {
+			return fmt.Errorf("invalid event proof: %v", err)
+		}
+		var ev Event
+		if err := protobuf.Decode(buf, &ev); err != nil {
+			return fmt.Errorf("invalid event: %v", err)
+		}
+		events[string(key)] = &ev
+	}
+
+	// Follow the buckets from the latest one.
+	var buckets []*bucket
+	var ids [][]byte
+	id := head
+	if bytes.Equal(id, make([]byte, len(id))) {
+		// There are no events in the eventlog.
+		id = nil
+	}
+	for i := range sp.Buckets {
+		if id == nil {
+			return errors.New("too many bucket proofs")
+		}
+		buf, err := getValue(&sp.Buckets[i], root, id)
+		if err != nil {
+			return fmt.Errorf("invalid bucket proof: %v", err)
+		}
+		var b bucket
+		if err := protobuf.Decode(buf, &b); err != nil {
+			return fmt.Errorf("invalid bucket: %v", err)
+		}
+		buckets = append(buckets, &b)
+		ids = append(ids, id)
+		id = b.Prev
+	}
+	if id != nil && len(buckets) == 0 {
+		return errors.New("missing bucket proofs")
+	}
+
+	var cursor *indexedEvent
+	if req.Cursor != nil {
+		bucketID, pos, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return err
+		}
+		for i, b := range buckets {
+			if bytes.Equal(ids[i], bucketID) && pos < len(b.EventRefs) {
+				if ev, ok := events[string(b.EventRefs[pos])]; ok {
+					cursor = &indexedEvent{when: ev.When, bucket: b.Start,
+						pos: pos}
+				}
+			}
+		}
+		if cursor == nil {
+			return errors.New("missing proof of the cursor event")
+		}
+	}
+
+	lo, hi := searchWindow(req, cursor, resp)
+	if len(buckets) > 0 {
+		last := buckets[len(buckets)-1]
+		if !last.isFirst() && last.Start > lo-maxBucketOverlap.Nanoseconds() {
+			return errors.New("missing proofs of earlier buckets")
+		}
+	}
+	to := req.To
+	if to == 0 {
+		to = math.MaxInt64
+	}
+	var found []indexedEvent
+	var foundEvents []*Event
+	next := int64(math.MaxInt64)
+	for i, b := range buckets {
+		if overlaps(b, next, lo, hi) {
+			for pos, ref := range b.EventRefs {
+				ev, ok := events[string(ref)]
+				if !ok {
+					return fmt.Errorf("missing proof of event %x", ref)
+				}
+				if ev.When < req.From || ev.When >= to ||
+					q != nil && !q.match(newIndexedTerms(ev)) {
+					continue
+				}
+				found = append(found, indexedEvent{id: ref, when: ev.When,
+					bucketID: ids[i], bucket: b.Start, pos: pos})
+				foundEvents = append(foundEvents, ev)
+			}
+		}
+		next = b.Start
+	}
+	byID := make(map[string]*Event)
+	for i, e := range found {
+		byID[string(e.id)] = foundEvents[i]
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].before(found[j]) })
+	found = orderEvents(found, cursor, req.Descending)
+
+	if resp.Truncated {
+		if len(resp.Events) > len(found) {
+			return errors.New("got more events than proven")
+		}
+		last := found[len(resp.Events)-1]
+		if !bytes.Equal(resp.Cursor, encodeCursor(last.bucketID, last.pos)) {
+			return errors.New("wrong cursor in response")
+		}
+		found = found[:len(resp.Events)]
+	} else if len(resp.Events) != len(found) {
+		return fmt.Errorf("got %d events, but %d match the search",
+			len(resp.Events), len(found))
+	}
+	if resp.IDs != nil && len(resp.IDs) != len(resp.Events) {
+		return errors.New("wrong number of event IDs")
+	}
+	for i, e := range found {
+		if !reflect.DeepEqual(resp.Events[i], *byID[string(e.id)]) {
+			return fmt.Errorf("event %d is not the proven one", i)
+		}
+		if resp.IDs != nil && !bytes.Equal(resp.IDs[i], e.id) {
+			return fmt.Errorf("wrong ID of event %d", i)
+		}
+	}
+	return nil
+}
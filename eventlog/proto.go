@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
 	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/onet/v3/network"
 )
@@ -12,6 +13,7 @@ func init() {
 	network.RegisterMessages(
 		&Event{},
 		&SearchRequest{}, &SearchResponse{},
+		&SchemaRegistry{}, &Retention{},
 	)
 }
 
@@ -30,6 +32,8 @@ func NewEvent(topic, content string) Event {
 // type :byzcoin.InstanceID:bytes
 //
 // package eventlog;
+// import "byzcoin.proto";
+// import "trie.proto";
 //
 // option java_package = "ch.epfl.dedis.lib.proto";
 // option java_outer_classname = "EventLogProto";
@@ -41,7 +45,9 @@ func NewEvent(topic, content string) Event {
 // SearchRequest includes all the search parameters (AND of all provided search
 // parameters). Topic == "" means "any topic". From == 0 means "from the first
 // event", and To == 0 means "until now". From and To should be set using the
-// UnixNano() method in package time.
+// UnixNano() method in package time. Query == "" means "any event", else it is
+// a query like `topic:auth* (user=alice OR "access denied") -logout`, which is
+// explained in the README.
 type SearchRequest struct {
 	Instance byzcoin.InstanceID
 	ID       skipchain.SkipBlockID
@@ -51,15 +57,53 @@ type SearchRequest struct {
 	From int64
 	// Return events where When is <= To.
 	To int64
+	// Return events matching the query, if Query != "".
+	Query string `protobuf:"opt"`
+	// Return at most Limit events, if Limit > 0.
+	Limit int `protobuf:"opt"`
+	// Return the latest events first, instead of the earliest ones.
+	Descending bool `protobuf:"opt"`
+	// Return the events after the one the cursor points to, if Cursor is
+	// set. It is the Cursor of a previous SearchResponse to the same search.
+	Cursor []byte `protobuf:"opt"`
+	// Return a SearchProof with the response, if Prove is set.
+	Prove bool `protobuf:"opt"`
+	// The block the skipchain proof of the SearchProof starts from, or the
+	// genesis block if ProofFrom is nil.
+	ProofFrom skipchain.SkipBlockID `protobuf:"opt"`
 }
 
 // SearchResponse is the reply to LogRequest.
 type SearchResponse struct {
 	Events []Event
-	// Events does not contain all the results. The caller should formulate
-	// a new SearchRequest to continue searching, for instance by setting
-	// From to the time of the last received event.
+	// Events does not contain all the results. The caller should send the
+	// same SearchRequest with the Cursor of this response to continue
+	// searching.
 	Truncated bool
+	// Cursor points to the last event of Events if the response is
+	// truncated. It is stable, so it can be used to continue a search even
+	// after new events have been logged.
+	Cursor []byte `protobuf:"opt"`
+	// Proof proves that Events holds all the events matching the search, if
+	// SearchRequest.Prove is set.
+	Proof *SearchProof `protobuf:"opt"`
+	// IDs are the IDs of the events, in the same order as Events.
+	IDs [][]byte `protobuf:"opt"`
+}
+
+// SearchProof proves that a SearchResponse holds all the events matching a
+// search, up to the last returned event if the response is truncated. The
+// proofs of the buckets and the events are for the same trie as Index.
+type SearchProof struct {
+	// Index proves the eventlog instance, which points to the latest
+	// bucket.
+	Index byzcoin.Proof
+	// Buckets are the proofs of the buckets from the latest one back to the
+	// one holding the earliest events of the search.
+	Buckets []trie.Proof
+	// Events are the proofs of all the events of the buckets which can hold
+	// events of the search.
+	Events []trie.Proof
 }
 
 // Event is sent to create an event log. When should be set using the UnixNano() method
@@ -68,4 +112,51 @@ type Event struct {
 	When    int64
 	Topic   string
 	Content string
+	// Schema is the ID of the schema of the payload, if it is set.
+	Schema string `protobuf:"opt"`
+	// Payload is a JSON object or a protobuf message, encoded following the
+	// schema, which is checked when the event is logged.
+	Payload []byte `protobuf:"opt"`
+	// Redacted is the hash of the original event if it has been redacted.
+	// A redacted event only keeps its time.
+	Redacted []byte `protobuf:"opt"`
+}
+
+// Retention is the retention policy of an eventlog. The events that are out
+// of the policy are deleted by the "prune" command of the eventlog contract.
+type Retention struct {
+	// MaxAge is how long the events are kept, in nanoseconds, if it is
+	// bigger than 0.
+	MaxAge int64
+	// MaxCount is how many of the latest events are kept, if it is bigger
+	// than 0.
+	MaxCount int
+	// Redacted holds the IDs of the redacted events, including the ones
+	// that have been deleted since.
+	Redacted [][]byte
+}
+
+// SchemaRegistry holds the schemas registered on an eventlog.
+type SchemaRegistry struct {
+	Schemas []Schema
+}
+
+// Schema describes the payloads of structured events. Schemas are registered
+// on an eventlog, and cannot be changed afterwards.
+type Schema struct {
+	// ID is used by the events to refer to the schema.
+	ID string
+	// Format is either "json" or "protobuf".
+	Format string
+	// Fields are the fields of the payloads. For the protobuf format, the
+	// number of a field is its position in Fields, starting at 1.
+	Fields []SchemaField
+}
+
+// SchemaField is a field of a schema. Type is one of "string", "int",
+// "float", "bool" or "bytes".
+type SchemaField struct {
+	Name     string
+	Type     string
+	Required bool
 }
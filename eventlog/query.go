@@ -0,0 +1,577 @@
+package eventlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The query language of SearchRequest.Query is made of the following terms,
+// which are all case-insensitive, except for topics:
+//
+//	topic:auth        events with the topic "auth"
+//	topic:auth.*      events with a topic matching the pattern
+//	user=alice        events with the field user=alice in their content
+//	denied            events with the word "denied" in their content
+//	deni*             events with a word matching the pattern
+//	"access denied"   events with the words in this order in their content
+//
+// Patterns can use '*' for any sequence of characters and '?' for any
+// single character. Fields are either written as key=value in the content,
+// or are the top-level fields of a content holding a JSON object.
+//
+// Terms are combined with AND, OR and NOT (or a leading '-'), and grouped
+// with parentheses. Terms that are only separated by spaces are combined
+// with AND, which binds stronger than OR:
+//
+//	topic:auth* (user=alice OR user=bob) -logout
+
+// queryNode is a node of a parsed query.
+type queryNode interface {
+	// eval returns a superset of the sequence numbers of the events of the
+	// index matching the node, sorted in increasing order, and whether the
+	// returned set is exact. A nil set means all events.
+	eval(idx *eventIndex) ([]int, bool)
+	// match returns whether the event matches the node.
+	match(ev *indexedTerms) bool
+}
+
+// indexedTerms holds the information of an event which is needed to match it
+// against a query.
+type indexedTerms struct {
+	topic string
+	words []string
+	terms map[string]bool
+}
+
+func newIndexedTerms(ev *Event) *indexedTerms {
+	it := &indexedTerms{
+		topic: ev.Topic,
+		words: contentWords(ev.Content),
+		terms: make(map[string]bool),
+	}
+	for _, t := range contentTerms(ev.Content) {
+		it.terms[t] = true
+	}
+	return it
+}
+
+// contentWords splits the content in lower-case words made of letters,
+// digits and underscores.
+func contentWords(content string) []string {
+	return strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// contentTerms returns the distinct words and key=value fields of the
+// content, in lower-case.
+func contentTerms(content string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	add := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	for _, w := range contentWords(content) {
+		add(w)
+	}
+	for _, f := range strings.Fields(content) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.Trim(kv[0], `"',;{}`)
+		if key != "" {
+			add(fieldTerm(key, strings.Trim(kv[1], `"',;{}`)))
+		}
+	}
+	for key, value := range jsonFields(content) {
+		add(fieldTerm(key, value))
+	}
+	return terms
+}
+
+// jsonFields returns the top-level scalar fields of the content, if it holds
+// a JSON object.
+func jsonFields(content string) map[string]string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "{") {
+		return nil
+	}
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if dec.Decode(&obj) != nil {
+		return nil
+	}
+	fields := make(map[string]string)
+	for key, value := range obj {
+		switch v := value.(type) {
+		case string:
+			fields[key] = v
+		case json.Number:
+			fields[key] = v.String()
+		case bool:
+			fields[key] = fmt.Sprint(v)
+		}
+	}
+	return fields
+}
+
+func fieldTerm(key, value string) string {
+	return strings.ToLower(key) + "=" + strings.ToLower(value)
+}
+
+func isPattern(s string) bool {
+	return strings.ContainsAny(s, "*?")
+}
+
+// matchPattern returns whether s matches the pattern, where '*' matches any
+// sequence of characters and '?' any single character.
+func matchPattern(pattern, s string) bool {
+	p, str := []rune(pattern), []rune(s)
+	// Position of the last '*' in the pattern, and of the string when it
+	// was seen, to backtrack to.
+	star, mark := -1, 0
+	i, j := 0, 0
+	for j < len(str) {
+		switch {
+		case i < len(p) && (p[i] == '?' || p[i] == str[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '*':
+			star, mark = i, j
+			i++
+		case star >= 0:
+			mark++
+			i, j = star+1, mark
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// topicNode matches the topic of the events against a topic or, if pattern
+// is true, a pattern.
+type topicNode struct {
+	topic   string
+	pattern bool
+}
+
+func (n topicNode) eval(idx *eventIndex) ([]int, bool) {
+	if !n.pattern {
+		return nonNil(idx.topics[n.topic]), true
+	}
+	var sets [][]int
+	for topic, seqs := range idx.topics {
+		if matchPattern(n.topic, topic) {
+			sets = append(sets, seqs)
+		}
+	}
+	return unionAll(sets), true
+}
+
+func (n topicNode) match(it *indexedTerms) bool {
+	if !n.pattern {
+		return n.topic == it.topic
+	}
+	return matchPattern(n.topic, it.topic)
+}
+
+// termNode matches a word or a key=value field of the content against a term
+// or a pattern.
+type termNode struct {
+	term string
+}
+
+func (n termNode) eval(idx *eventIndex) ([]int, bool) {
+	if !isPattern(n.term) {
+		return nonNil(idx.terms[n.term]), true
+	}
+	var sets [][]int
+	for term, seqs := range idx.terms {
+		if n.matchTerm(term) {
+			sets = append(sets, seqs)
+		}
+	}
+	return unionAll(sets), true
+}
+
+func (n termNode) match(it *indexedTerms) bool {
+	if !isPattern(n.term) {
+		return it.terms[n.term]
+	}
+	for term := range it.terms {
+		if n.matchTerm(term) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTerm makes sure that a pattern for a word only matches words and a
+// pattern for a field only matches fields with the same key.
+func (n termNode) matchTerm(term string) bool {
+	if strings.Contains(n.term, "=") != strings.Contains(term, "=") {
+		return false
+	}
+	return matchPattern(n.term, term)
+}
+
+// phraseNode matches a sequence of words in the content.
+type phraseNode struct {
+	words []string
+}
+
+func (n phraseNode) eval(idx *eventIndex) ([]int, bool) {
+	var set []int
+	for i, w := range n.words {
+		if i == 0 {
+			set = nonNil(idx.terms[w])
+		} else {
+			set = intersect(set, idx.terms[w])
+		}
+	}
+	return set, len(n.words) == 1
+}
+
+func (n phraseNode) match(it *indexedTerms) bool {
+	if len(n.words) == 0 {
+		return true
+	}
+search:
+	for i := 0; i+len(n.words) <= len(it.words); i++ {
+		for j, w := range n.words {
+			if it.words[i+j] != w {
+				continue search
+			}
+		}
+		return true
+	}
+	return false
+}
+
+type andNode struct {
+	left, right queryNode
+}
+
+func (n andNode) eval(idx *eventIndex) ([]int, bool) {
+	l, lExact := n.left.eval(idx)
+	r, rExact := n.right.eval(idx)
+	switch {
+	case l == nil:
+		return r, lExact && rExact
+	case r == nil:
+		return l, lExact && rExact
+	}
+	return intersect(l, r), lExact && rExact
+}
+
+func (n andNode) match(it *indexedTerms) bool {
+	return n.left.match(it) && n.right.match(it)
+}
+
+type orNode struct {
+	left, right queryNode
+}
+
+func (n orNode) eval(idx *eventIndex) ([]int, bool) {
+	l, lExact := n.left.eval(idx)
+	r, rExact := n.right.eval(idx)
+	if l == nil || r == nil {
+		return nil, lExact && rExact
+	}
+	return unionAll([][]int{l, r}), lExact && rExact
+}
+
+func (n orNode) match(it *indexedTerms) bool {
+	return n.left.match(it) || n.right.match(it)
+}
+
+type notNode struct {
+	child queryNode
+}
+
+func (n notNode) eval(idx *eventIndex) ([]int, bool) {
+	c, exact := n.child.eval(idx)
+	if !exact {
+		// The complement of a superset is not a superset.
+		return nil, false
+	}
+	if c == nil {
+		return []int{}, true
+	}
+	all := make([]int, 0, len(idx.events)-len(c))
+	for seq, i := 0, 0; seq < len(idx.events); seq++ {
+		if i < len(c) && c[i] == seq {
+			i++
+			continue
+		}
+		all = append(all, seq)
+	}
+	return all, true
+}
+
+func (n notNode) match(it *indexedTerms) bool {
+	return !n.child.match(it)
+}
+
+// nonNil makes sure that an empty set is not taken for all events.
+func nonNil(set []int) []int {
+	if set == nil {
+		return []int{}
+	}
+	return set
+}
+
+func intersect(a, b []int) []int {
+	out := []int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func unionAll(sets [][]int) []int {
+	out := []int{}
+	for _, s := range sets {
+		merged := make([]int, 0, len(out)+len(s))
+		i, j := 0, 0
+		for i < len(out) && j < len(s) {
+			switch {
+			case out[i] < s[j]:
+				merged = append(merged, out[i])
+				i++
+			case out[i] > s[j]:
+				merged = append(merged, s[j])
+				j++
+			default:
+				merged = append(merged, out[i])
+				i++
+				j++
+			}
+		}
+		merged = append(merged, out[i:]...)
+		out = append(merged, s[j:]...)
+	}
+	return out
+}
+
+// queryToken is a token of a query: a parenthesis, an operator, a term or a
+// quoted phrase.
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+func tokenizeQuery(q string) ([]queryToken, error) {
+	var tokens []queryToken
+	r := []rune(q)
+	for i := 0; i < len(r); {
+		switch {
+		case unicode.IsSpace(r[i]):
+			i++
+		case r[i] == '(' || r[i] == ')':
+			tokens = append(tokens, queryToken{text: string(r[i])})
+			i++
+		default:
+			// Quotes can be used anywhere in a term, to include spaces or
+			// parentheses.
+			tok := queryToken{quoted: r[i] == '"'}
+			var text []rune
+			inQuote := false
+			for ; i < len(r); i++ {
+				if r[i] == '"' {
+					inQuote = !inQuote
+					continue
+				}
+				if !inQuote && (unicode.IsSpace(r[i]) || r[i] == '(' ||
+					r[i] == ')') {
+					break
+				}
+				text = append(text, r[i])
+			}
+			if inQuote {
+				return nil, errors.New("missing closing quote in query")
+			}
+			tok.text = string(text)
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens, nil
+}
+
+// searchQuery returns the query of a search, including its topic. A nil node
+// matches all events.
+func searchQuery(req *SearchRequest) (queryNode, error) {
+	q, err := parseQuery(req.Query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+	if req.Topic != "" {
+		t := topicNode{topic: req.Topic}
+		if q == nil {
+			return t, nil
+		}
+		q = andNode{t, q}
+	}
+	return q, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+// parseQuery parses a query of SearchRequest.Query. An empty query returns a
+// nil node, which matches all events.
+func parseQuery(q string) (queryNode, error) {
+	tokens, err := tokenizeQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := &queryParser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in query", p.tokens[p.pos].text)
+	}
+	return n, nil
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) isOperator(text string) bool {
+	tok, ok := p.peek()
+	return ok && !tok.quoted && tok.text == text
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if p.isOperator("AND") {
+			p.pos++
+		} else if _, ok := p.peek(); !ok || p.isOperator("OR") ||
+			p.isOperator(")") {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of query")
+	}
+	switch {
+	case !tok.quoted && tok.text == "NOT":
+		p.pos++
+	case !tok.quoted && len(tok.text) > 1 && tok.text[0] == '-':
+		p.tokens[p.pos].text = tok.text[1:]
+	default:
+		return p.parsePrimary()
+	}
+	child, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return notNode{child}, nil
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok, _ := p.peek()
+	p.pos++
+	if tok.quoted {
+		return phraseNode{words: contentWords(tok.text)}, nil
+	}
+	switch tok.text {
+	case "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOperator(")") {
+			return nil, errors.New("missing ')' in query")
+		}
+		p.pos++
+		return n, nil
+	case ")", "AND", "OR":
+		return nil, fmt.Errorf("unexpected '%s' in query", tok.text)
+	}
+	return parseTerm(tok.text)
+}
+
+// parseTerm returns the node of a single term of a query.
+func parseTerm(text string) (queryNode, error) {
+	if strings.HasPrefix(text, "topic:") {
+		topic := strings.TrimPrefix(text, "topic:")
+		return topicNode{topic: topic, pattern: isPattern(topic)}, nil
+	}
+	if kv := strings.SplitN(text, "=", 2); len(kv) == 2 {
+		if kv[0] == "" {
+			return nil, fmt.Errorf("missing key in '%s'", text)
+		}
+		return termNode{term: fieldTerm(kv[0], kv[1])}, nil
+	}
+	if isPattern(text) {
+		return termNode{term: strings.ToLower(text)}, nil
+	}
+	words := contentWords(text)
+	if len(words) == 1 {
+		return termNode{term: words[0]}, nil
+	}
+	// Something like "user@example.com" is indexed as several words.
+	return phraseNode{words: words}, nil
+}
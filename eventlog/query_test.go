@@ -0,0 +1,119 @@
+package eventlog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery_Parse(t *testing.T) {
+	for _, q := range []string{"", "abc", "topic:a* OR (user=bob -x)",
+		`"access denied" AND NOT topic:"a b"`, "a OR b c OR d"} {
+		_, err := parseQuery(q)
+		require.NoError(t, err, q)
+	}
+	for _, q := range []string{"(abc", "abc)", `"abc`, "a OR", "AND a",
+		"NOT", "=value"} {
+		_, err := parseQuery(q)
+		require.Error(t, err, q)
+	}
+}
+
+func TestQuery_MatchPattern(t *testing.T) {
+	require.True(t, matchPattern("auth*", "auth.login"))
+	require.True(t, matchPattern("*.login", "auth.login"))
+	require.True(t, matchPattern("a?th*n", "auth.login"))
+	require.True(t, matchPattern("*", ""))
+	require.False(t, matchPattern("auth", "auth.login"))
+	require.False(t, matchPattern("a?", "a"))
+	require.False(t, matchPattern("*x*", "auth"))
+}
+
+func TestQuery_Search(t *testing.T) {
+	events := []Event{
+		{When: 10, Topic: "auth.login", Content: "user=alice access granted"},
+		{When: 11, Topic: "auth.logout", Content: "user=bob logged out"},
+		{When: 12, Topic: "auth.login", Content: "user=bob access denied"},
+		{When: 13, Topic: "db", Content: `{"user": "alice", "rows": 12}`},
+		{When: 14, Topic: "db", Content: "Denied: access for carol"},
+		// Out of order, but same time as the first one.
+		{When: 10, Topic: "auth.login", Content: "user=carol access denied"},
+	}
+	idx := newEventIndex()
+	for i := range events {
+		idx.add([]byte{byte(i)}, nil, 0, i, &events[i])
+	}
+
+	for _, c := range []struct {
+		query    string
+		from, to int64
+		expected []int
+	}{
+		{"", 0, 100, []int{0, 5, 1, 2, 3, 4}},
+		{"", 11, 13, []int{1, 2}},
+		{"topic:auth.login", 0, 100, []int{0, 5, 2}},
+		{"topic:auth.*", 0, 100, []int{0, 5, 1, 2}},
+		{"topic:auth", 0, 100, nil},
+		{"user=alice", 0, 100, []int{0, 3}},
+		{"USER=B*", 0, 100, []int{1, 2}},
+		{"rows=12", 0, 100, []int{3}},
+		{"denied", 0, 100, []int{5, 2, 4}},
+		{`"access denied"`, 0, 100, []int{5, 2}},
+		{`-"access denied"`, 0, 100, []int{0, 1, 3, 4}},
+		{"den*", 0, 100, []int{5, 2, 4}},
+		{"topic:auth.* (user=alice OR user=bob) -out", 0, 100, []int{0, 2}},
+		{"topic:db OR access granted", 0, 100, []int{0, 3, 4}},
+		{"NOT topic:db", 11, 100, []int{1, 2}},
+		{"user=bob AND NOT (topic:auth.login OR denied)", 0, 100, []int{1}},
+	} {
+		q, err := parseQuery(c.query)
+		require.NoError(t, err)
+		found, exact := idx.find(q, c.from, c.to)
+		var ids []int
+		for _, e := range found {
+			if exact || q.match(newIndexedTerms(&events[e.id[0]])) {
+				ids = append(ids, int(e.id[0]))
+			}
+		}
+		require.Equal(t, c.expected, ids, c.query)
+	}
+}
+
+func TestQuery_Remove(t *testing.T) {
+	events := []Event{
+		{When: 10, Topic: "a", Content: "x y"},
+		{When: 11, Topic: "b", Content: "y"},
+		{When: 12, Topic: "a", Content: "x"},
+	}
+	idx := newEventIndex()
+	for i := range events {
+		idx.add([]byte{byte(i)}, nil, 0, i, &events[i])
+	}
+	idx.remove(map[int]bool{1: true})
+	require.Equal(t, 2, len(idx.events))
+	require.Equal(t, []int{0, 1}, idx.order)
+	require.Equal(t, []int{0, 1}, idx.topics["a"])
+	require.Nil(t, idx.topics["b"])
+	require.Equal(t, []int{0}, idx.terms["y"])
+	require.Equal(t, 1, idx.seqs[string([]byte{2})])
+
+	found, exact := idx.find(nil, 0, 100)
+	require.True(t, exact)
+	require.Equal(t, 2, len(found))
+	require.Equal(t, []byte{2}, found[1].id)
+}
+
+func TestService_IndexesLRU(t *testing.T) {
+	s := &Service{indexes: make(map[string]*eventIndex)}
+	first := s.getIndex("0")
+	for i := 1; i < maxIndexes; i++ {
+		s.getIndex(fmt.Sprint(i))
+	}
+	// Using the first index again makes the second one the oldest.
+	require.Equal(t, first, s.getIndex("0"))
+	s.getIndex("new")
+	require.Equal(t, maxIndexes, len(s.indexes))
+	require.NotNil(t, s.indexes["0"])
+	require.Nil(t, s.indexes["1"])
+}
@@ -0,0 +1,315 @@
+package eventlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// retentionID returns the ID of the instance holding the retention policy of
+// the eventlog.
+func retentionID(el byzcoin.InstanceID) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte("eventlog retention"))
+	h.Write(el.Slice())
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// getRetention returns the retention policy of the eventlog, and its version
+// plus one, so that the version is 0 only if there is no policy.
+func getRetention(rst byzcoin.ReadOnlyStateTrie,
+	el byzcoin.InstanceID) (*Retention, uint64, error) {
+	key := retentionID(el).Slice()
+	p, err := rst.GetProof(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !p.Match(key) {
+		return &Retention{}, 0, nil
+	}
+	buf, version, cid, _, err := rst.GetValues(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if cid != contractName {
+		return nil, 0, errors.New("retention instance is not an eventlog instance")
+	}
+	var r Retention
+	if err := protobuf.Decode(buf, &r); err != nil {
+		return nil, 0, err
+	}
+	return &r, version + 1, nil
+}
+
+// retentionChange returns the state change storing the retention policy.
+func retentionChange(el byzcoin.InstanceID, r *Retention, version uint64,
+	darcID darc.ID) (byzcoin.StateChange, error) {
+	buf, err := protobuf.Encode(r)
+	if err != nil {
+		return byzcoin.StateChange{}, err
+	}
+	action := byzcoin.Update
+	if version == 0 {
+		action = byzcoin.Create
+	}
+	return byzcoin.NewStateChange(action, retentionID(el), contractName, buf,
+		darcID), nil
+}
+
+// setRetention sets the retention policy of the eventlog to the one in the
+// "retention" argument.
+func setRetention(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction,
+	darcID darc.ID) ([]byzcoin.StateChange, error) {
+	var policy Retention
+	err := protobuf.Decode(inst.Invoke.Args.Search("retention"), &policy)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode retention policy: %v", err)
+	}
+	if policy.MaxAge < 0 || policy.MaxCount < 0 {
+		return nil, errors.New("negative retention policy")
+	}
+	r, version, err := getRetention(rst, inst.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	r.MaxAge = policy.MaxAge
+	r.MaxCount = policy.MaxCount
+	sc, err := retentionChange(inst.InstanceID, r, version, darcID)
+	if err != nil {
+		return nil, err
+	}
+	return []byzcoin.StateChange{sc}, nil
+}
+
+// pruneEvents deletes the buckets holding only events that are out of the
+// retention policy, at the time given in the "time" argument, together with
+// their events. The catch-all bucket at the start of the chain is kept, but
+// its events are deleted, and the oldest bucket that is kept is linked to it.
+// The catch-all bucket holds a hash commitment of everything that has been
+// deleted, so that the deleted buckets and events can still be verified
+// against it.
+func pruneEvents(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction,
+	darcID darc.ID) ([]byzcoin.StateChange, error) {
+	timeBuf := inst.Invoke.Args.Search("time")
+	if len(timeBuf) != 8 {
+		return nil, errors.New("expected a named argument of \"time\"")
+	}
+	now := int64(binary.LittleEndian.Uint64(timeBuf))
+	if err := checkTime(now); err != nil {
+		return nil, err
+	}
+	r, version, err := getRetention(rst, inst.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	if r.MaxAge == 0 && r.MaxCount == 0 {
+		return nil, errors.New("the eventlog has no retention policy")
+	}
+
+	el := &eventLog{Instance: inst.InstanceID, v: rst}
+	id, b, err := el.getLatestBucket()
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	// Walk back all the buckets, and find the first one holding only events
+	// that are out of the retention policy. As the head bucket can still
+	// get new events, it is never deleted, and the events of the other
+	// buckets can be up to maxBucketOverlap later than the start of the
+	// next bucket.
+	type chained struct {
+		id []byte
+		b  *bucket
+	}
+	var chain []chained
+	expired := -1
+	count := 0
+	for {
+		if expired < 0 && len(chain) > 0 {
+			next := chain[len(chain)-1].b.Start
+			if r.MaxAge > 0 &&
+				next+maxBucketOverlap.Nanoseconds() <= now-r.MaxAge ||
+				r.MaxCount > 0 && count >= r.MaxCount {
+				expired = len(chain)
+			}
+		}
+		chain = append(chain, chained{id, b})
+		count += len(b.EventRefs)
+		if b.isFirst() {
+			break
+		}
+		id = b.Prev
+		b, err = el.getBucketByID(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	first := chain[len(chain)-1]
+	if expired < 0 ||
+		expired == len(chain)-1 && len(first.b.EventRefs) == 0 {
+		return nil, nil
+	}
+
+	// Delete the expired buckets and events from the oldest to the newest,
+	// and add them to the commitment.
+	var sc []byzcoin.StateChange
+	h := sha256.New()
+	h.Write(first.b.Pruned)
+	for i := len(chain) - 1; i >= expired; i-- {
+		c := chain[i]
+		if err := commitValue(h, rst, c.id); err != nil {
+			return nil, err
+		}
+		for _, ref := range c.b.EventRefs {
+			if err := commitValue(h, rst, ref); err != nil {
+				return nil, err
+			}
+			sc = append(sc, byzcoin.NewStateChange(byzcoin.Remove,
+				byzcoin.NewInstanceID(ref), contractName, nil, darcID))
+		}
+		if i < len(chain)-1 {
+			sc = append(sc, byzcoin.NewStateChange(byzcoin.Remove,
+				byzcoin.NewInstanceID(c.id), contractName, nil, darcID))
+		}
+	}
+
+	first.b.EventRefs = nil
+	first.b.Pruned = h.Sum(nil)
+	buf, err := protobuf.Encode(first.b)
+	if err != nil {
+		return nil, err
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update,
+		byzcoin.NewInstanceID(first.id), contractName, buf, darcID))
+
+	if kept := chain[expired-1]; !bytes.Equal(kept.b.Prev, first.id) {
+		kept.b.Prev = first.id
+		buf, err := protobuf.Encode(kept.b)
+		if err != nil {
+			return nil, err
+		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update,
+			byzcoin.NewInstanceID(kept.id), contractName, buf, darcID))
+	}
+
+	// The IDs of the redacted events are kept, even once they are
+	// deleted, as their original content is still in the blocks, and the
+	// sinks must not export them. The retention instance is always updated,
+	// so that the search indexes are updated.
+	rc, err := retentionChange(inst.InstanceID, r, version, darcID)
+	if err != nil {
+		return nil, err
+	}
+	return append(sc, rc), nil
+}
+
+// commitValue adds the key and the hash of its value to the commitment.
+func commitValue(h hash.Hash, rst byzcoin.ReadOnlyStateTrie, key []byte) error {
+	buf, _, _, _, err := rst.GetValues(key)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(buf)
+	h.Write(key)
+	h.Write(sum[:])
+	return nil
+}
+
+// redactEvent replaces the event in the "id" argument with an event holding
+// only its time and the hash of the original event.
+func redactEvent(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction,
+	darcID darc.ID) ([]byzcoin.StateChange, error) {
+	id := inst.Invoke.Args.Search("id")
+	if id == nil {
+		return nil, errors.New("expected a named argument of \"id\"")
+	}
+	buf, _, cid, _, err := rst.GetValues(id)
+	if err != nil {
+		return nil, err
+	}
+	if cid != contractName {
+		return nil, errors.New("not an event")
+	}
+	var ev Event
+	if err := protobuf.Decode(buf, &ev); err != nil {
+		return nil, err
+	}
+	if ev.Redacted != nil {
+		return nil, errors.New("the event is already redacted")
+	}
+	el := &eventLog{Instance: inst.InstanceID, v: rst}
+	found, err := el.hasEvent(id, ev.When)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("the event is not in the eventlog")
+	}
+
+	sum := sha256.Sum256(buf)
+	buf, err = protobuf.Encode(&Event{When: ev.When, Redacted: sum[:]})
+	if err != nil {
+		return nil, err
+	}
+	r, version, err := getRetention(rst, inst.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	r.Redacted = append(r.Redacted, id)
+	rc, err := retentionChange(inst.InstanceID, r, version, darcID)
+	if err != nil {
+		return nil, err
+	}
+	return []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Update, byzcoin.NewInstanceID(id),
+			contractName, buf, darcID),
+		rc,
+	}, nil
+}
+
+// hasEvent returns whether the event, logged at the given time, is in one of
+// the buckets of the eventlog. The event can be in a bucket that started up
+// to maxBucketOverlap before the bucket its time belongs to.
+func (e eventLog) hasEvent(id []byte, when int64) (bool, error) {
+	_, b, err := e.getLatestBucket()
+	if err != nil || b == nil {
+		return false, err
+	}
+	oldest := when - maxBucketOverlap.Nanoseconds()
+	for {
+		for _, ref := range b.EventRefs {
+			if bytes.Equal(ref, id) {
+				return true, nil
+			}
+		}
+		if b.isFirst() || b.Start <= oldest {
+			return false, nil
+		}
+		b, err = e.getBucketByID(b.Prev)
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// checkTime returns an error if the time is too far from the current time
+// of the node.
+func checkTime(t int64) error {
+	when := time.Unix(0, t)
+	now := time.Now()
+	if when.Before(now.Add(-maxEventAge)) {
+		return fmt.Errorf("timestamp too long ago - when=%v, now=%v", when, now)
+	}
+	if when.After(now.Add(maxEventFuture)) {
+		return errors.New("timestamp is too far in the future")
+	}
+	return nil
+}
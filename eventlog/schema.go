@@ -0,0 +1,452 @@
+package eventlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// The formats of the payloads of the events.
+const (
+	// SchemaFormatJSON is for payloads holding a JSON object.
+	SchemaFormatJSON = "json"
+	// SchemaFormatProtobuf is for payloads holding a protobuf message, where
+	// the number of every field is its position in Schema.Fields, starting
+	// at 1.
+	SchemaFormatProtobuf = "protobuf"
+)
+
+// The types of the fields of a schema. In JSON, bytes are base64-encoded
+// strings. In protobuf, int is a sint64, float a double and the other types
+// are the same as in protobuf.
+const (
+	FieldString = "string"
+	FieldInt    = "int"
+	FieldFloat  = "float"
+	FieldBool   = "bool"
+	FieldBytes  = "bytes"
+)
+
+// Protobuf wire types used by the schemas.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// schemasID returns the ID of the instance holding the schemas of the
+// eventlog.
+func schemasID(el byzcoin.InstanceID) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte("eventlog schemas"))
+	h.Write(el.Slice())
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// NewStructuredEvent returns a new event with the current time as its
+// timestamp, and a payload which is encoded following the schema registered
+// on the eventlog with the given ID.
+func NewStructuredEvent(topic, schemaID string, payload []byte) Event {
+	ev := NewEvent(topic, "")
+	ev.Schema = schemaID
+	ev.Payload = payload
+	return ev
+}
+
+// Get returns the schema with the given ID, or nil if there is none.
+func (r SchemaRegistry) Get(id string) *Schema {
+	for i := range r.Schemas {
+		if r.Schemas[i].ID == id {
+			return &r.Schemas[i]
+		}
+	}
+	return nil
+}
+
+// verify checks that the schema can be registered.
+func (s Schema) verify() error {
+	if s.ID == "" {
+		return errors.New("the schema needs an ID")
+	}
+	if s.Format != SchemaFormatJSON && s.Format != SchemaFormatProtobuf {
+		return fmt.Errorf("unknown schema format \"%s\"", s.Format)
+	}
+	if len(s.Fields) == 0 {
+		return errors.New("the schema needs fields")
+	}
+	names := make(map[string]bool)
+	for _, f := range s.Fields {
+		if f.Name == "" || names[f.Name] {
+			return fmt.Errorf("empty or duplicate field name \"%s\"", f.Name)
+		}
+		names[f.Name] = true
+		switch f.Type {
+		case FieldString, FieldInt, FieldFloat, FieldBool, FieldBytes:
+		default:
+			return fmt.Errorf("unknown type \"%s\" of field %s", f.Type,
+				f.Name)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the payload is not encoded following the
+// schema.
+func (s Schema) Validate(payload []byte) error {
+	_, err := s.Decode(payload)
+	return err
+}
+
+// Decode returns the fields of the payload, which has to be encoded following
+// the schema. Strings and bytes are returned as string and []byte, ints as
+// int64, floats as float64 and bools as bool.
+func (s Schema) Decode(payload []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	var err error
+	switch s.Format {
+	case SchemaFormatJSON:
+		fields, err = s.decodeJSON(payload)
+	case SchemaFormatProtobuf:
+		fields, err = s.decodeProtobuf(payload)
+	default:
+		err = fmt.Errorf("unknown schema format \"%s\"", s.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range s.Fields {
+		if _, ok := fields[f.Name]; f.Required && !ok {
+			return nil, fmt.Errorf("missing required field %s", f.Name)
+		}
+	}
+	return fields, nil
+}
+
+// Encode returns the payload holding the fields, encoded following the
+// schema. The fields can either have the types returned by Decode, or the
+// types returned by json.Unmarshal.
+func (s Schema) Encode(fields map[string]interface{}) ([]byte, error) {
+	values := make(map[string]interface{})
+	for name, v := range fields {
+		f := s.field(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+		value, err := f.convert(v)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+
+	var payload []byte
+	switch s.Format {
+	case SchemaFormatJSON:
+		// Bytes are base64-encoded by encoding/json.
+		buf, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		payload = buf
+	case SchemaFormatProtobuf:
+		var buf bytes.Buffer
+		for i, f := range s.Fields {
+			if v, ok := values[f.Name]; ok {
+				f.appendProtobuf(&buf, uint64(i+1), v)
+			}
+		}
+		payload = buf.Bytes()
+	default:
+		return nil, fmt.Errorf("unknown schema format \"%s\"", s.Format)
+	}
+	return payload, s.Validate(payload)
+}
+
+func (s Schema) field(name string) *SchemaField {
+	for i := range s.Fields {
+		if s.Fields[i].Name == name {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+func (s Schema) decodeJSON(payload []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("payload is not a JSON object: %v", err)
+	}
+	if dec.More() {
+		return nil, errors.New("trailing data after the JSON object")
+	}
+	fields := make(map[string]interface{})
+	for name, v := range obj {
+		f := s.field(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+		value, err := f.convert(v)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = value
+	}
+	return fields, nil
+}
+
+func (s Schema) decodeProtobuf(payload []byte) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	for len(payload) > 0 {
+		key, n := binary.Uvarint(payload)
+		if n <= 0 {
+			return nil, errors.New("invalid protobuf field key")
+		}
+		payload = payload[n:]
+		num, wire := key>>3, key&7
+		if num == 0 || num > uint64(len(s.Fields)) {
+			return nil, fmt.Errorf("unknown field number %d", num)
+		}
+		f := s.Fields[num-1]
+		if _, ok := fields[f.Name]; ok {
+			return nil, fmt.Errorf("duplicate field %s", f.Name)
+		}
+		if wire != f.wireType() {
+			return nil, fmt.Errorf("wrong wire type for field %s", f.Name)
+		}
+
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(payload)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint in field %s", f.Name)
+			}
+			payload = payload[n:]
+			if f.Type == FieldBool {
+				if v > 1 {
+					return nil, fmt.Errorf("invalid bool in field %s", f.Name)
+				}
+				fields[f.Name] = v == 1
+			} else {
+				// Zigzag decoding of a sint64.
+				fields[f.Name] = int64(v>>1) ^ -int64(v&1)
+			}
+		case wireFixed64:
+			if len(payload) < 8 {
+				return nil, fmt.Errorf("truncated field %s", f.Name)
+			}
+			fields[f.Name] = math.Float64frombits(
+				binary.LittleEndian.Uint64(payload))
+			payload = payload[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(payload)
+			if n <= 0 || l > uint64(len(payload)-n) {
+				return nil, fmt.Errorf("truncated field %s", f.Name)
+			}
+			buf := payload[n : n+int(l)]
+			payload = payload[n+int(l):]
+			if f.Type == FieldString {
+				fields[f.Name] = string(buf)
+			} else {
+				fields[f.Name] = append([]byte{}, buf...)
+			}
+		}
+	}
+	return fields, nil
+}
+
+func (f SchemaField) wireType() uint64 {
+	switch f.Type {
+	case FieldInt, FieldBool:
+		return wireVarint
+	case FieldFloat:
+		return wireFixed64
+	default:
+		return wireBytes
+	}
+}
+
+// convert returns the value with the type returned by Schema.Decode, or an
+// error if it cannot be used for the field.
+func (f SchemaField) convert(v interface{}) (interface{}, error) {
+	err := fmt.Errorf("wrong type %T for field %s of type %s", v, f.Name,
+		f.Type)
+	switch f.Type {
+	case FieldString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case FieldBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case FieldBytes:
+		switch b := v.(type) {
+		case []byte:
+			return b, nil
+		case string:
+			buf, err := base64.StdEncoding.DecodeString(b)
+			if err != nil {
+				return nil, fmt.Errorf("field %s is not base64: %v", f.Name,
+					err)
+			}
+			return buf, nil
+		}
+	case FieldInt:
+		switch i := v.(type) {
+		case int64:
+			return i, nil
+		case int:
+			return int64(i), nil
+		case json.Number:
+			n, err := i.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("field %s is not an int: %v", f.Name,
+					err)
+			}
+			return n, nil
+		case float64:
+			if i == math.Trunc(i) && math.Abs(i) < 1<<53 {
+				return int64(i), nil
+			}
+		}
+	case FieldFloat:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int64:
+			return float64(n), nil
+		case int:
+			return float64(n), nil
+		case json.Number:
+			fl, err := n.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("field %s is not a float: %v", f.Name,
+					err)
+			}
+			return fl, nil
+		}
+	}
+	return nil, err
+}
+
+func (f SchemaField) appendProtobuf(buf *bytes.Buffer, num uint64,
+	v interface{}) {
+	var tmp [binary.MaxVarintLen64]byte
+	putUvarint := func(x uint64) {
+		buf.Write(tmp[:binary.PutUvarint(tmp[:], x)])
+	}
+	putUvarint(num<<3 | f.wireType())
+	switch value := v.(type) {
+	case string:
+		putUvarint(uint64(len(value)))
+		buf.WriteString(value)
+	case []byte:
+		putUvarint(uint64(len(value)))
+		buf.Write(value)
+	case bool:
+		if value {
+			putUvarint(1)
+		} else {
+			putUvarint(0)
+		}
+	case int64:
+		// Zigzag encoding of a sint64.
+		putUvarint(uint64(value<<1) ^ uint64(value>>63))
+	case float64:
+		binary.LittleEndian.PutUint64(tmp[:8], math.Float64bits(value))
+		buf.Write(tmp[:8])
+	}
+}
+
+// getSchemas returns the schemas registered on the eventlog.
+func getSchemas(rst byzcoin.ReadOnlyStateTrie,
+	el byzcoin.InstanceID) (*SchemaRegistry, error) {
+	key := schemasID(el).Slice()
+	p, err := rst.GetProof(key)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Match(key) {
+		return &SchemaRegistry{}, nil
+	}
+	buf, _, cid, _, err := rst.GetValues(key)
+	if err != nil {
+		return nil, err
+	}
+	if cid != contractName {
+		return nil, errors.New("schemas instance is not an eventlog instance")
+	}
+	var reg SchemaRegistry
+	if err := protobuf.Decode(buf, &reg); err != nil {
+		return nil, err
+	}
+	return &reg, nil
+}
+
+// checkPayload returns an error if the event has a payload that is not
+// encoded following a schema of the eventlog.
+func checkPayload(rst byzcoin.ReadOnlyStateTrie, el byzcoin.InstanceID,
+	event *Event) error {
+	if event.Schema == "" {
+		if len(event.Payload) > 0 {
+			return errors.New("an event with a payload needs a schema")
+		}
+		return nil
+	}
+	reg, err := getSchemas(rst, el)
+	if err != nil {
+		return err
+	}
+	s := reg.Get(event.Schema)
+	if s == nil {
+		return fmt.Errorf("unknown schema \"%s\"", event.Schema)
+	}
+	if err := s.Validate(event.Payload); err != nil {
+		return fmt.Errorf("invalid payload: %v", err)
+	}
+	return nil
+}
+
+// registerSchema adds the schema in the "schema" argument to the schemas of
+// the eventlog. Schemas cannot be changed once they are registered, so that
+// the payloads of the events can always be decoded.
+func registerSchema(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction,
+	darcID darc.ID) ([]byzcoin.StateChange, error) {
+	var s Schema
+	err := protobuf.Decode(inst.Invoke.Args.Search("schema"), &s)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode schema: %v", err)
+	}
+	if err := s.verify(); err != nil {
+		return nil, err
+	}
+	reg, err := getSchemas(rst, inst.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	if reg.Get(s.ID) != nil {
+		return nil, fmt.Errorf("schema \"%s\" is already registered", s.ID)
+	}
+	action := byzcoin.Update
+	if len(reg.Schemas) == 0 {
+		action = byzcoin.Create
+	}
+	reg.Schemas = append(reg.Schemas, s)
+	buf, err := protobuf.Encode(reg)
+	if err != nil {
+		return nil, err
+	}
+	return []byzcoin.StateChange{byzcoin.NewStateChange(action,
+		schemasID(inst.InstanceID), contractName, buf, darcID)}, nil
+}
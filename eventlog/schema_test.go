@@ -0,0 +1,81 @@
+package eventlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema_Verify(t *testing.T) {
+	fields := []SchemaField{{Name: "a", Type: FieldString}}
+	require.NoError(t, Schema{ID: "s", Format: SchemaFormatJSON, Fields: fields}.verify())
+	require.NoError(t, Schema{ID: "s", Format: SchemaFormatProtobuf, Fields: fields}.verify())
+	require.Error(t, Schema{Format: SchemaFormatJSON, Fields: fields}.verify())
+	require.Error(t, Schema{ID: "s", Format: "xml", Fields: fields}.verify())
+	require.Error(t, Schema{ID: "s", Format: SchemaFormatJSON}.verify())
+	require.Error(t, Schema{ID: "s", Format: SchemaFormatJSON,
+		Fields: []SchemaField{{Name: "a", Type: "date"}}}.verify())
+	require.Error(t, Schema{ID: "s", Format: SchemaFormatJSON,
+		Fields: append(fields, fields...)}.verify())
+}
+
+func TestSchema_Encode(t *testing.T) {
+	fields := []SchemaField{
+		{Name: "s", Type: FieldString, Required: true},
+		{Name: "i", Type: FieldInt},
+		{Name: "f", Type: FieldFloat},
+		{Name: "b", Type: FieldBool},
+		{Name: "x", Type: FieldBytes},
+	}
+	values := map[string]interface{}{"s": "héllo", "i": int64(-300),
+		"f": 1.5, "b": true, "x": []byte{0, 1, 255}}
+
+	for _, format := range []string{SchemaFormatJSON, SchemaFormatProtobuf} {
+		s := Schema{ID: "test", Format: format, Fields: fields}
+		payload, err := s.Encode(values)
+		require.NoError(t, err, format)
+		decoded, err := s.Decode(payload)
+		require.NoError(t, err, format)
+		require.Equal(t, values, decoded, format)
+
+		// Optional fields can be left out.
+		payload, err = s.Encode(map[string]interface{}{"s": ""})
+		require.NoError(t, err, format)
+		decoded, err = s.Decode(payload)
+		require.NoError(t, err, format)
+		require.Equal(t, map[string]interface{}{"s": ""}, decoded, format)
+
+		_, err = s.Encode(map[string]interface{}{"i": 1})
+		require.Error(t, err, format)
+		_, err = s.Encode(map[string]interface{}{"s": "", "y": 1})
+		require.Error(t, err, format)
+		_, err = s.Encode(map[string]interface{}{"s": 1})
+		require.Error(t, err, format)
+		_, err = s.Encode(map[string]interface{}{"s": "", "i": 1.5})
+		require.Error(t, err, format)
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	fields := []SchemaField{
+		{Name: "user", Type: FieldString, Required: true},
+		{Name: "n", Type: FieldInt},
+	}
+	s := Schema{ID: "test", Format: SchemaFormatJSON, Fields: fields}
+	require.NoError(t, s.Validate([]byte(`{"user": "alice", "n": 12}`)))
+	require.Error(t, s.Validate([]byte(`{"n": 12}`)))
+	require.Error(t, s.Validate([]byte(`{"user": "alice", "n": 1.5}`)))
+	require.Error(t, s.Validate([]byte(`{"user": "alice", "x": 1}`)))
+	require.Error(t, s.Validate([]byte(`{"user": "alice"} {}`)))
+	require.Error(t, s.Validate([]byte(`["alice"]`)))
+
+	s.Format = SchemaFormatProtobuf
+	// Field 1 is the string "alice", and field 2 is 12 as a sint64.
+	require.NoError(t, s.Validate([]byte("\x0a\x05alice\x10\x18")))
+	require.Error(t, s.Validate([]byte("\x10\x18")))
+	// Wrong wire type, truncated string, unknown field and duplicate field.
+	require.Error(t, s.Validate([]byte("\x08\x05")))
+	require.Error(t, s.Validate([]byte("\x0a\x06alice")))
+	require.Error(t, s.Validate([]byte("\x0a\x05alice\x18\x01")))
+	require.Error(t, s.Validate([]byte("\x0a\x05alice\x0a\x01a")))
+}
@@ -3,9 +3,12 @@ package eventlog
 import (
 	"errors"
 	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/protobuf"
@@ -18,6 +21,10 @@ var sid onet.ServiceID
 
 const contractName = "eventlog"
 const logCmd = "log"
+const schemaCmd = "schema"
+const retentionCmd = "retention"
+const pruneCmd = "prune"
+const redactCmd = "redact"
 
 // Set a relatively low time for bucketMaxAge: during peak message arrival
 // this will pretect the buckets from getting too big. During low message
@@ -43,21 +50,53 @@ type Service struct {
 	*onet.ServiceProcessor
 	omni         *byzcoin.Service
 	bucketMaxAge time.Duration
+	// indexes holds the search indexes of the eventlogs, by skipchain ID
+	// and instance ID, and indexesClock is increased on every search to
+	// find the least recently used index.
+	indexes      map[string]*eventIndex
+	indexesClock uint64
+	indexesLock  sync.Mutex
 }
 
 const defaultBlockInterval = 5 * time.Second
 
+// maxEventAge is how old the timestamp of an event can be when it is logged.
+const maxEventAge = 30 * time.Second
+
+// maxEventFuture is how far in the future the timestamp of an event can be
+// when it is logged.
+const maxEventFuture = 5 * time.Second
+
+// maxBucketOverlap is how much later than the start of the next bucket an
+// event of a bucket can be. It happens when the next bucket is started by an
+// event logged in the past after an event logged in the future.
+const maxBucketOverlap = maxEventAge + maxEventFuture
+
 // This should be a const, but we want to be able to hack it from tests.
 var searchMax = 10000
 
-// Search will search the event log for matching entries.
+// Search will search the event log for matching entries. The events are
+// found using the search index of the eventlog, which is updated with the
+// latest events before every search.
 func (s *Service) Search(req *SearchRequest) (*SearchResponse, error) {
 	if req.ID.IsNull() {
 		return nil, errors.New("skipchain ID required")
 	}
 
+	q, err := searchQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	limit := searchMax
+	if req.Limit > 0 && req.Limit < limit {
+		limit = req.Limit
+	}
+
+	now := time.Now().UnixNano()
 	if req.To == 0 {
-		req.To = time.Now().UnixNano()
+		// Events cannot be logged too far in the future, so this is the
+		// same as until now, but it can be verified by the client.
+		req.To = math.MaxInt64
 	}
 
 	v, err := s.omni.GetReadOnlyStateTrie(req.ID)
@@ -66,80 +105,50 @@ func (s *Service) Search(req *SearchRequest) (*SearchResponse, error) {
 	}
 	el := &eventLog{Instance: req.Instance, v: v}
 
-	id, b, err := el.getLatestBucket()
+	events, exact, err := s.findEvents(req.ID, el, now, q, req.From, req.To)
 	if err != nil {
 		return nil, err
 	}
-	if b == nil {
-		// There are no events yet on this chain, so return no results.
-		return &SearchResponse{}, nil
+	var cursor *indexedEvent
+	if req.Cursor != nil {
+		cursor, err = el.getCursorEvent(req.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %v", err)
+		}
 	}
+	events = orderEvents(events, cursor, req.Descending)
 
-	// bEnd is normally updated from the last bucket's start. For the latest
-	// bucket, bEnd is now.
-	bEnd := time.Now().UnixNano()
-
-	// Walk backwards in the bucket chain through 2 zones: first where the
-	// bucket covers time that is not in our search range, and then where the buckets
-	// do cover the search range. When we see a bucket that ends before our search
-	// range, we can stop walking buckets.
-	var buckets []*bucket
-	var bids [][]byte
-	for {
-		if req.From > bEnd {
-			// This bucket is before the search range, so we are done walking back the bucket chain.
-			break
+	// If the reply is truncated, the events that are not returned are
+	// the latest ones, or the earliest ones for a descending search, and
+	// the cursor points to the last returned event.
+	reply := &SearchResponse{}
+	for _, e := range events {
+		ev, err := getEventByID(v, e.id)
+		if err != nil {
+			log.Errorf("index points to event %x, but the event was not found: %v", e.id, err)
+			return nil, err
 		}
-
-		if req.To < b.Start {
-			// This bucket is after the search range, so we do not add it to buckets, but
-			// we keep walking up the chain.
-		} else {
-			buckets = append(buckets, b)
-			bids = append(bids, id)
+		if !exact && !q.match(newIndexedTerms(ev)) {
+			continue
 		}
-
-		if b.isFirst() {
+		if len(reply.Events) >= limit {
+			reply.Truncated = true
 			break
 		}
-		bEnd = b.Start
-		id = b.Prev
-		b, err = el.getBucketByID(id)
-		if err != nil {
-			// This indicates that the event log data structure is wrong, so
-			// we cannot claim to correctly search it. Give up instead.
-			log.Errorf("expected event log bucket id %v not found: %v", string(id), err)
-			return nil, err
-		}
+		reply.Events = append(reply.Events, *ev)
+		reply.IDs = append(reply.IDs, e.id)
+		reply.Cursor = encodeCursor(e.bucketID, e.pos)
+	}
+	if !reply.Truncated {
+		reply.Cursor = nil
 	}
 
-	reply := &SearchResponse{}
-
-	// Process the time buckets from earliest to latest so that
-	// if we truncate, it is the latest events that are not returned,
-	// so that they can set req.From = resp.Events[len(resp.Events)-1].When.
-filter:
-	for i := len(buckets) - 1; i >= 0; i-- {
-		b := buckets[i]
-		for _, e := range b.EventRefs {
-			ev, err := getEventByID(v, e)
-			if err != nil {
-				log.Errorf("bucket %x points to event %x, but the event was not found: %v", bids[i], e, err)
-				return nil, err
-			}
-
-			if req.From <= ev.When && ev.When < req.To {
-				if req.Topic == "" || req.Topic == ev.Topic {
-					reply.Events = append(reply.Events, *ev)
-					if len(reply.Events) >= searchMax {
-						reply.Truncated = true
-						break filter
-					}
-				}
-			}
+	if req.Prove {
+		reply.Proof, err = s.proveSearch(req, el, cursor, reply)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create proof: %v", err)
 		}
 	}
-
 	return reply, nil
 }
 
@@ -159,10 +168,10 @@ func decodeAndCheckEvent(coll byzcoin.ReadOnlyStateTrie, eventBuf []byte) (*Even
 	}
 	when := time.Unix(0, event.When)
 	now := time.Now()
-	if when.Before(now.Add(-30 * time.Second)) {
+	if when.Before(now.Add(-maxEventAge)) {
 		return nil, fmt.Errorf("event timestamp too long ago - when=%v, now=%v", when, now)
 	}
-	if when.After(now.Add(5 * time.Second)) {
+	if when.After(now.Add(maxEventFuture)) {
 		return nil, errors.New("event timestamp is too far in the future")
 	}
 	return event, nil
@@ -179,8 +188,22 @@ func (c *contract) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instructio
 	if cid != contractName {
 		return nil, nil, fmt.Errorf("expected contract ID to be \"%s\" but got \"%s\"", contractName, cid)
 	}
-	if inst.Invoke.Command != logCmd {
-		return nil, nil, fmt.Errorf("invalid command, got \"%s\" but need \"%s\"", inst.Invoke.Command, logCmd)
+	switch inst.Invoke.Command {
+	case logCmd:
+	case schemaCmd:
+		sc, err = registerSchema(rst, inst, darcID)
+		return
+	case retentionCmd:
+		sc, err = setRetention(rst, inst, darcID)
+		return
+	case pruneCmd:
+		sc, err = pruneEvents(rst, inst, darcID)
+		return
+	case redactCmd:
+		sc, err = redactEvent(rst, inst, darcID)
+		return
+	default:
+		return nil, nil, fmt.Errorf("invalid command \"%s\"", inst.Invoke.Command)
 	}
 
 	eventBuf := inst.Invoke.Args.Search("event")
@@ -192,6 +215,12 @@ func (c *contract) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instructio
 	if err != nil {
 		return nil, nil, err
 	}
+	if event.Redacted != nil {
+		return nil, nil, errors.New("cannot log a redacted event")
+	}
+	if err := checkPayload(rst, inst.InstanceID, event); err != nil {
+		return nil, nil, err
+	}
 
 	// Even though this is an invoke, we'll use the Spawn convention,
 	// since the new event is essentially being spawned on this eventlog.
@@ -326,6 +355,7 @@ func newService(c *onet.Context) (onet.Service, error) {
 	s := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
 		omni:             c.Service(byzcoin.ServiceName).(*byzcoin.Service),
+		indexes:          make(map[string]*eventIndex),
 	}
 	if err := s.RegisterHandlers(s.Search); err != nil {
 		log.ErrFatal(err, "Couldn't register messages")
@@ -333,6 +363,10 @@ func newService(c *onet.Context) (onet.Service, error) {
 	return s, nil
 }
 
+func (s *Service) skService() *skipchain.Service {
+	return s.Service(skipchain.ServiceName).(*skipchain.Service)
+}
+
 func getEventByID(view byzcoin.ReadOnlyStateTrie, eid []byte) (*Event, error) {
 	v0, _, _, _, err := view.GetValues(eid)
 	if err != nil {
@@ -0,0 +1,478 @@
+package eventlog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// ExportedEvent is an event as it is delivered by a Sink.
+type ExportedEvent struct {
+	// ID is the ID of the event, and BlockID the ID of the block in which
+	// it has been logged.
+	ID      LogID
+	BlockID skipchain.SkipBlockID
+	Event
+	// Fields are the fields of the payload, decoded following the schema of
+	// the event, if it has one.
+	Fields map[string]interface{}
+}
+
+// MarshalJSON returns the event as a JSON object, with the IDs in hex, the
+// time in RFC 3339 format and the decoded payload.
+func (e ExportedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID       string                 `json:"id,omitempty"`
+		BlockID  string                 `json:"block,omitempty"`
+		When     string                 `json:"when"`
+		Topic    string                 `json:"topic"`
+		Content  string                 `json:"content,omitempty"`
+		Schema   string                 `json:"schema,omitempty"`
+		Payload  map[string]interface{} `json:"payload,omitempty"`
+		Redacted string                 `json:"redacted,omitempty"`
+	}{
+		ID:       hex.EncodeToString(e.ID),
+		BlockID:  hex.EncodeToString(e.BlockID),
+		When:     time.Unix(0, e.When).UTC().Format(time.RFC3339Nano),
+		Topic:    e.Topic,
+		Content:  e.Content,
+		Schema:   e.Schema,
+		Payload:  e.Fields,
+		Redacted: hex.EncodeToString(e.Redacted),
+	})
+}
+
+// SinkOutput is where a Sink delivers the events.
+type SinkOutput interface {
+	// Write delivers the event. It must only return once the event is
+	// safely stored, as the sink will not deliver it again. If it returns
+	// an error, the sink tries again to deliver the event.
+	Write(ev *ExportedEvent) error
+	// Close releases the resources of the output.
+	Close() error
+}
+
+// Sink delivers the events of an eventlog to an output, as they are logged.
+// The last delivered event is stored in a checkpoint file, so that the sink
+// resumes right after it when it is started again. As the checkpoint is
+// updated after the event is delivered, an event can be delivered twice if
+// the sink stops in between, but it is never lost.
+//
+// The events are read from the blocks, so they are exported as they were
+// logged, even if they have been deleted since. The events that are redacted
+// when their block is read are skipped.
+type Sink struct {
+	// Start is the block from which the events are exported if there is no
+	// checkpoint. If it is nil, they are exported from the genesis block.
+	Start skipchain.SkipBlockID
+	// RetryDelay is the delay before trying again to deliver an event. It
+	// is doubled after every failed attempt.
+	RetryDelay time.Duration
+	// MaxRetries is how many times the delivery of an event is tried again
+	// before Run returns with an error.
+	MaxRetries int
+
+	client     *Client
+	output     SinkOutput
+	checkpoint string
+	closed     bool
+	closedLock sync.Mutex
+}
+
+// sinkCheckpoint is the content of the checkpoint file of a sink.
+type sinkCheckpoint struct {
+	BlockID string `json:"block"`
+	EventID string `json:"event"`
+}
+
+// NewSink returns a sink delivering the events of the eventlog of the client
+// to the output. The last delivered event is stored in the checkpoint file,
+// unless checkpoint is empty. The sink uses its own connections to the
+// nodes, so the client can still be used.
+func NewSink(c *Client, output SinkOutput, checkpoint string) *Sink {
+	sc := NewClient(byzcoin.NewClient(c.ByzCoin.ID, c.ByzCoin.Roster))
+	sc.Instance = c.Instance
+	return &Sink{
+		RetryDelay: time.Second,
+		MaxRetries: 5,
+		client:     sc,
+		output:     output,
+		checkpoint: checkpoint,
+	}
+}
+
+// Run delivers the events to the output, starting after the event stored in
+// the checkpoint file. It blocks until Close is called, in which case it
+// returns nil, or until the streaming of the blocks stops or an event cannot
+// be delivered, in which case it returns an error. The output is not closed.
+func (s *Sink) Run() error {
+	blockID, eventID, err := s.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+	from := blockID
+	if from == nil {
+		from = s.Start
+	}
+	if from == nil {
+		from = s.client.ByzCoin.ID
+	}
+
+	// skip is set while the events up to the one of the checkpoint are
+	// streamed again.
+	skip := eventID != nil
+	var runErr error
+	fail := func(err error) {
+		if runErr == nil {
+			runErr = err
+		}
+		// The stream is closed once the connections are closed. As the
+		// stream might not be started yet, they are closed again on every
+		// new block.
+		s.client.Close()
+	}
+	err = s.client.streamBlocksFrom(func(sb *skipchain.SkipBlock, err error) {
+		if runErr != nil || err != nil {
+			fail(err)
+			return
+		}
+		events, err := blockEvents(sb)
+		if err != nil {
+			fail(err)
+			return
+		}
+		// The redacted events are only looked up for the blocks holding
+		// events of the eventlog.
+		var redacted map[string]bool
+		for _, e := range events {
+			if !e.instance.Equal(s.client.Instance) {
+				continue
+			}
+			if redacted == nil {
+				redacted, err = s.redacted()
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+			if skip {
+				if sb.Hash.Equal(blockID) {
+					skip = !bytes.Equal(e.id, eventID)
+					continue
+				}
+				skip = false
+			}
+			if e.err != nil {
+				fail(e.err)
+				return
+			}
+			if redacted[string(e.id)] {
+				continue
+			}
+			if err := s.deliver(sb.Hash, e); err != nil {
+				fail(err)
+				return
+			}
+		}
+	}, from)
+
+	if s.isClosed() {
+		return nil
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if err != nil {
+		return err
+	}
+	return errors.New("the streaming of the blocks stopped")
+}
+
+// Close stops the sink, and Run returns.
+func (s *Sink) Close() error {
+	s.closedLock.Lock()
+	s.closed = true
+	s.closedLock.Unlock()
+	return s.client.Close()
+}
+
+func (s *Sink) isClosed() bool {
+	s.closedLock.Lock()
+	defer s.closedLock.Unlock()
+	return s.closed
+}
+
+// redacted returns the IDs of the events of the eventlog that have been
+// redacted.
+func (s *Sink) redacted() (map[string]bool, error) {
+	r, err := s.client.GetRetention()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the redacted events: %v", err)
+	}
+	redacted := make(map[string]bool)
+	for _, id := range r.Redacted {
+		redacted[string(id)] = true
+	}
+	return redacted, nil
+}
+
+// deliver writes the event to the output, trying again if it fails, and
+// stores it in the checkpoint.
+func (s *Sink) deliver(blockID skipchain.SkipBlockID, e loggedEvent) error {
+	ev := &ExportedEvent{ID: e.id, BlockID: blockID, Event: *e.event}
+	delay := s.RetryDelay
+	for i := 0; ; i++ {
+		var err error
+		ev.Fields, err = s.client.DecodePayload(ev.Event)
+		if err == nil {
+			err = s.output.Write(ev)
+		}
+		if err == nil {
+			break
+		}
+		if i >= s.MaxRetries || s.isClosed() {
+			return fmt.Errorf("couldn't deliver event %x: %v", e.id, err)
+		}
+		log.Warnf("couldn't deliver event %x, trying again in %v: %v", e.id,
+			delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return s.saveCheckpoint(blockID, e.id)
+}
+
+func (s *Sink) loadCheckpoint() (skipchain.SkipBlockID, LogID, error) {
+	if s.checkpoint == "" {
+		return nil, nil, nil
+	}
+	buf, err := ioutil.ReadFile(s.checkpoint)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var cp sinkCheckpoint
+	if err := json.Unmarshal(buf, &cp); err != nil {
+		return nil, nil, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	blockID, err := hex.DecodeString(cp.BlockID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	eventID, err := hex.DecodeString(cp.EventID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	return blockID, eventID, nil
+}
+
+// saveCheckpoint replaces the checkpoint file, so that it is never left
+// half-written.
+func (s *Sink) saveCheckpoint(blockID skipchain.SkipBlockID, eventID LogID) error {
+	if s.checkpoint == "" {
+		return nil
+	}
+	buf, err := json.Marshal(sinkCheckpoint{
+		BlockID: hex.EncodeToString(blockID),
+		EventID: hex.EncodeToString(eventID),
+	})
+	if err != nil {
+		return err
+	}
+	tmp := s.checkpoint + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.checkpoint)
+}
+
+// WriterOutput writes the events to a writer as newline-delimited JSON.
+type WriterOutput struct {
+	w io.Writer
+}
+
+// NewWriterOutput returns an output writing the events to w.
+func NewWriterOutput(w io.Writer) *WriterOutput {
+	return &WriterOutput{w: w}
+}
+
+// Write writes the event as JSON, followed by a newline.
+func (o *WriterOutput) Write(ev *ExportedEvent) error {
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = o.w.Write(append(buf, '\n'))
+	return err
+}
+
+// Close does nothing, the writer has to be closed by the caller.
+func (o *WriterOutput) Close() error {
+	return nil
+}
+
+// FileOutput writes the events to a file as newline-delimited JSON. When the
+// file gets too big, it is rotated: it is renamed with the suffix ".1", the
+// previous ".1" file is renamed with ".2", and so on, and a new file is
+// started.
+type FileOutput struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+// NewFileOutput returns an output appending the events to the file. The
+// file is rotated before it gets bigger than maxSize bytes, unless maxSize
+// is 0, and maxFiles rotated files are kept.
+func NewFileOutput(path string, maxSize int64, maxFiles int) (*FileOutput, error) {
+	o := &FileOutput{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := o.open(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *FileOutput) open() error {
+	if err := os.MkdirAll(filepath.Dir(o.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(o.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	o.f = f
+	o.size = st.Size()
+	return nil
+}
+
+// Write appends the event to the file, and syncs the file.
+func (o *FileOutput) Write(ev *ExportedEvent) error {
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+	if o.maxSize > 0 && o.size > 0 && o.size+int64(len(buf)) > o.maxSize {
+		if err := o.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := o.f.Write(buf)
+	o.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return o.f.Sync()
+}
+
+func (o *FileOutput) rotate() error {
+	if err := o.f.Close(); err != nil {
+		return err
+	}
+	rotated := func(i int) string {
+		return fmt.Sprintf("%s.%d", o.path, i)
+	}
+	err := os.Remove(rotated(o.maxFiles))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := o.maxFiles - 1; i >= 1; i-- {
+		err := os.Rename(rotated(i), rotated(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if o.maxFiles > 0 {
+		err = os.Rename(o.path, rotated(1))
+	} else {
+		err = os.Remove(o.path)
+	}
+	if err != nil {
+		return err
+	}
+	return o.open()
+}
+
+// Close closes the file.
+func (o *FileOutput) Close() error {
+	return o.f.Close()
+}
+
+// WebhookOutput posts every event as JSON to a URL. The ID of the event is
+// also sent in the X-Event-ID header, so that the receiver can recognize
+// events that are delivered twice.
+type WebhookOutput struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookOutput returns an output posting the events to the URL.
+func NewWebhookOutput(url string) *WebhookOutput {
+	return &WebhookOutput{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Write posts the event, and returns an error if the response doesn't have
+// a 2xx status code.
+func (o *WebhookOutput) Write(ev *ExportedEvent) error {
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, o.URL, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", hex.EncodeToString(ev.ID))
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Close does nothing.
+func (o *WebhookOutput) Close() error {
+	return nil
+}
@@ -0,0 +1,24 @@
+// +build windows plan9
+
+package eventlog
+
+import "errors"
+
+// SyslogOutput is not supported on this system.
+type SyslogOutput struct{}
+
+// NewSyslogOutput always returns an error, as syslog is not supported on this
+// system.
+func NewSyslogOutput(network, raddr, tag string) (*SyslogOutput, error) {
+	return nil, errors.New("syslog is not supported on this system")
+}
+
+// Write does nothing.
+func (o *SyslogOutput) Write(ev *ExportedEvent) error {
+	return nil
+}
+
+// Close does nothing.
+func (o *SyslogOutput) Close() error {
+	return nil
+}
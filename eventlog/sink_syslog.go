@@ -0,0 +1,39 @@
+// +build !windows,!plan9
+
+package eventlog
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// SyslogOutput sends every event as JSON to a syslog server, with the info
+// priority.
+type SyslogOutput struct {
+	w *syslog.Writer
+}
+
+// NewSyslogOutput connects to the syslog server at raddr, using the network,
+// which is "udp", "tcp" or "unix". If network is empty, it connects to the
+// local syslog server. The events are sent with the tag.
+func NewSyslogOutput(network, raddr, tag string) (*SyslogOutput, error) {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogOutput{w: w}, nil
+}
+
+// Write sends the event.
+func (o *SyslogOutput) Write(ev *ExportedEvent) error {
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return o.w.Info(string(buf))
+}
+
+// Close closes the connection to the syslog server.
+func (o *SyslogOutput) Close() error {
+	return o.w.Close()
+}
@@ -0,0 +1,100 @@
+package eventlog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportedEvent_MarshalJSON(t *testing.T) {
+	ev := ExportedEvent{ID: LogID{1, 2}, BlockID: []byte{3},
+		Event:  Event{When: 1e9, Topic: "auth", Schema: "login"},
+		Fields: map[string]interface{}{"user": "alice"}}
+	buf, err := json.Marshal(ev)
+	require.NoError(t, err)
+	require.Equal(t, `{"id":"0102","block":"03","when":"1970-01-01T00:00:01Z",`+
+		`"topic":"auth","schema":"login","payload":{"user":"alice"}}`, string(buf))
+}
+
+func TestFileOutput_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.log")
+
+	ev := &ExportedEvent{ID: LogID{1}, Event: Event{Topic: "t"}}
+	line, err := json.Marshal(ev)
+	require.NoError(t, err)
+	// Two events fit in a file.
+	out, err := NewFileOutput(path, int64(2*(len(line)+1)), 2)
+	require.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		require.NoError(t, out.Write(ev))
+	}
+	require.NoError(t, out.Close())
+
+	for name, lines := range map[string]int{"": 1, ".1": 2, ".2": 2} {
+		buf, err := ioutil.ReadFile(path + name)
+		require.NoError(t, err)
+		require.Equal(t, lines, strings.Count(string(buf), "\n"), name)
+	}
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err))
+
+	// The file is appended to when it is opened again.
+	out, err = NewFileOutput(path, 0, 2)
+	require.NoError(t, err)
+	require.NoError(t, out.Write(ev))
+	require.NoError(t, out.Close())
+	buf, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(buf), "\n"))
+}
+
+func TestWebhookOutput(t *testing.T) {
+	var got []string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		got = append(got, r.Header.Get("X-Event-ID"))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	out := NewWebhookOutput(srv.URL)
+	require.NoError(t, out.Write(&ExportedEvent{ID: LogID{1}}))
+	status = http.StatusInternalServerError
+	require.Error(t, out.Write(&ExportedEvent{ID: LogID{2}}))
+	require.Equal(t, []string{"01", "02"}, got)
+}
+
+func TestSink_Checkpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &Sink{checkpoint: filepath.Join(dir, "checkpoint")}
+	blockID, eventID, err := s.loadCheckpoint()
+	require.NoError(t, err)
+	require.Nil(t, blockID)
+	require.Nil(t, eventID)
+
+	require.NoError(t, s.saveCheckpoint([]byte{1, 2}, LogID{3}))
+	require.NoError(t, s.saveCheckpoint([]byte{4, 5}, LogID{6}))
+	blockID, eventID, err = s.loadCheckpoint()
+	require.NoError(t, err)
+	require.Equal(t, []byte{4, 5}, []byte(blockID))
+	require.Equal(t, LogID{6}, eventID)
+
+	require.NoError(t, ioutil.WriteFile(s.checkpoint, []byte("{"), 0644))
+	_, _, err = s.loadCheckpoint()
+	require.Error(t, err)
+}
@@ -0,0 +1,191 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// AttrCredential is the name of the attr interpreter checking the ReadPolicy
+// of a calypso write against the credential of the reader. To use it, the
+// darc of the write needs a rule like
+//
+//	spawn:calypsoRead - "attr:credential:"
+//
+// and the read spawn needs a "credential" argument with the instance ID of
+// the credential of the reader. The credential is accepted if:
+//   - its darc lets one of the signers of the read sign, and
+//   - its "_evolve" and "invoke:credential.update" rules are the PolicyIssuer
+//     of the write, so that the reader cannot change the attributes, and
+//   - the "credentialSignature" argument is a signature on
+//     CredentialIssuerMessage by the identity in the "credentialSigner"
+//     argument, which fulfills the PolicyIssuer, and
+//   - its attributes fulfill the ReadPolicy of the write.
+//
+// The signature of the issuer is needed, as the reader could create a
+// credential with any attributes and a darc copying the rules of the issuer.
+//
+// The attributes are available in the policy as "credential.attribute", and
+// as "attribute" if no other credential has the same attribute.
+const AttrCredential = "credential"
+
+func makeCredentialAttr(c calypso.ContractWrite, rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction) func(string) error {
+	return func(string) error {
+		if c.ReadPolicy == "" {
+			return xerrors.New("the write has no read policy")
+		}
+		policy, err := calypso.ParseReadPolicy(c.ReadPolicy)
+		if err != nil {
+			return xerrors.Errorf("invalid read policy: %v", err)
+		}
+
+		credID := inst.Spawn.Args.Search("credential")
+		if len(credID) != len(byzcoin.InstanceID{}) {
+			return xerrors.New("need the credential of the reader in the " +
+				"'credential' argument")
+		}
+		credBuf, _, cid, darcID, err := rst.GetValues(credID)
+		if err == nil && cid != ContractCredentialID {
+			err = xerrors.New("not a credential instance")
+		}
+		if err != nil {
+			return xerrors.Errorf("getting credential: %v", err)
+		}
+		d, err := getDarc(rst, darcID)
+		if err != nil {
+			return xerrors.Errorf("getting darc of credential: %v", err)
+		}
+
+		issuer := strings.TrimSpace(c.PolicyIssuer)
+		for _, action := range []darc.Action{"_evolve",
+			darc.Action("invoke:" + ContractCredentialID + ".update")} {
+			if !d.Rules.Contains(action) ||
+				strings.TrimSpace(string(d.Rules.Get(action))) != issuer {
+				return xerrors.Errorf("rule %s of the credential is not "+
+					"controlled by the issuer", action)
+			}
+		}
+		if err := checkCredentialSigner(rst, d, inst); err != nil {
+			return err
+		}
+
+		var cs CredentialStruct
+		err = protobuf.Decode(credBuf, &cs)
+		if err != nil {
+			return xerrors.Errorf("decoding credential: %v", err)
+		}
+		err = checkIssuerSignature(rst, issuer, byzcoin.NewInstanceID(credID),
+			cs, inst)
+		if err != nil {
+			return err
+		}
+		return policy.Eval(credentialAttributes(cs))
+	}
+}
+
+// CredentialIssuerMessage returns the message the issuer signs to vouch for
+// the attributes of the credential, so that they can be used for the read
+// policies of calypso.
+func CredentialIssuerMessage(credID byzcoin.InstanceID,
+	cs CredentialStruct) ([]byte, error) {
+	buf, err := protobuf.Encode(&cs)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding credential: %v", err)
+	}
+	h := sha256.New()
+	h.Write([]byte("calypso credential"))
+	h.Write(credID.Slice())
+	h.Write(buf)
+	return h.Sum(nil), nil
+}
+
+// checkIssuerSignature returns nil if the instruction holds a signature on
+// the attributes of the credential by an identity fulfilling the issuer.
+func checkIssuerSignature(rst byzcoin.ReadOnlyStateTrie, issuer string,
+	credID byzcoin.InstanceID, cs CredentialStruct,
+	inst byzcoin.Instruction) error {
+	signer, err := darc.ParseIdentity(string(inst.Spawn.Args.Search(
+		"credentialSigner")))
+	if err != nil {
+		return xerrors.Errorf("need the identity of the issuer in the "+
+			"'credentialSigner' argument: %v", err)
+	}
+	msg, err := CredentialIssuerMessage(credID, cs)
+	if err != nil {
+		return err
+	}
+	err = signer.Verify(msg, inst.Spawn.Args.Search("credentialSignature"))
+	if err != nil {
+		return xerrors.Errorf("the issuer didn't sign the credential: %v", err)
+	}
+	err = darc.EvalExpr(expression.Expr(issuer), darcGetter(rst),
+		signer.String())
+	if err != nil {
+		return xerrors.Errorf("the credential is not signed by the issuer: %v",
+			err)
+	}
+	return nil
+}
+
+// checkCredentialSigner returns nil if one of the signers of the instruction
+// fulfills the "_sign" rule of the darc of the credential.
+func checkCredentialSigner(rst byzcoin.ReadOnlyStateTrie, d *darc.Darc,
+	inst byzcoin.Instruction) error {
+	var ids []string
+	for _, id := range inst.SignerIdentities {
+		ids = append(ids, id.String())
+	}
+	err := darc.EvalExpr(d.Rules.Get(darc.Action("_sign")), darcGetter(rst),
+		ids...)
+	if err != nil {
+		return xerrors.Errorf("the reader doesn't own the credential: %v", err)
+	}
+	return nil
+}
+
+// darcGetter returns a function loading the darcs referenced in
+// expressions from the trie.
+func darcGetter(rst byzcoin.ReadOnlyStateTrie) darc.GetDarc {
+	return func(str string, latest bool) *darc.Darc {
+		if !strings.HasPrefix(str, "darc:") {
+			return nil
+		}
+		darcID, err := hex.DecodeString(str[5:])
+		if err != nil {
+			return nil
+		}
+		d, err := rst.LoadDarc(darcID)
+		if err != nil {
+			return nil
+		}
+		return d
+	}
+}
+
+// credentialAttributes returns the attributes of all credentials, both
+// qualified with the name of their credential and unqualified.
+func credentialAttributes(cs CredentialStruct) map[string]string {
+	attrs := make(map[string]string)
+	ambiguous := make(map[string]bool)
+	for _, cred := range cs.Credentials {
+		for _, a := range cred.Attributes {
+			attrs[cred.Name+"."+a.Name] = string(a.Value)
+			if _, ok := attrs[a.Name]; ok {
+				ambiguous[a.Name] = true
+			}
+			attrs[a.Name] = string(a.Value)
+		}
+	}
+	for name := range ambiguous {
+		delete(attrs, name)
+	}
+	return attrs
+}
@@ -0,0 +1,85 @@
+package contracts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+)
+
+func TestCredentialAttr(t *testing.T) {
+	rost := byzcoin.NewROSTSimul()
+	issuerSigner := darc.NewSignerEd25519(nil, nil)
+	issuer := issuerSigner.Identity()
+	readerSigner := darc.NewSignerEd25519(nil, nil)
+	reader := readerSigner.Identity()
+
+	newCredential := func(updater darc.Identity, clearance string) byzcoin.InstanceID {
+		rules := darc.InitRules([]darc.Identity{issuer}, []darc.Identity{reader})
+		require.NoError(t, rules.AddRule(darc.Action("invoke:"+ContractCredentialID+".update"),
+			expression.Expr(updater.String())))
+		d := darc.NewDarc(rules, []byte("credential of the reader"))
+		require.NoError(t, rost.CreateSCB(byzcoin.Create, byzcoin.ContractDarcID,
+			byzcoin.NewInstanceID(d.GetBaseID()), d, nil))
+		id, err := rost.CreateRandomInstance(ContractCredentialID,
+			newCredentialStruct(clearance), d.GetBaseID())
+		require.NoError(t, err)
+		return id
+	}
+	sign := func(signer darc.Signer, credID byzcoin.InstanceID, clearance string) []byte {
+		msg, err := CredentialIssuerMessage(credID, *newCredentialStruct(clearance))
+		require.NoError(t, err)
+		sig, err := signer.Sign(msg)
+		require.NoError(t, err)
+		return sig
+	}
+	eval := func(credID byzcoin.InstanceID, signer darc.Identity,
+		credSigner darc.Identity, credSig []byte) error {
+		cw := calypso.ContractWrite{Write: calypso.Write{
+			ReadPolicy:   "department=research AND employee.clearance>=2",
+			PolicyIssuer: issuer.String(),
+		}}
+		inst := byzcoin.Instruction{
+			Spawn: &byzcoin.Spawn{
+				ContractID: calypso.ContractReadID,
+				Args: byzcoin.Arguments{
+					{Name: "credential", Value: credID.Slice()},
+					{Name: "credentialSigner", Value: []byte(credSigner.String())},
+					{Name: "credentialSignature", Value: credSig},
+				},
+			},
+			SignerIdentities: []darc.Identity{signer},
+		}
+		return makeCredentialAttr(cw, rost, inst)("")
+	}
+
+	cred := newCredential(issuer, "2")
+	require.NoError(t, eval(cred, reader, issuer, sign(issuerSigner, cred, "2")))
+	low := newCredential(issuer, "1")
+	require.Error(t, eval(low, reader, issuer, sign(issuerSigner, low, "1")))
+	// Only the owner of the credential can use it.
+	require.Error(t, eval(cred, issuer, issuer, sign(issuerSigner, cred, "2")))
+	// Attributes that the reader can change are not accepted.
+	mutable := newCredential(reader, "2")
+	require.Error(t, eval(mutable, reader, issuer, sign(issuerSigner, mutable, "2")))
+
+	// A reader can build a credential with a darc copying the rules of the
+	// issuer, but cannot get it signed by the issuer.
+	forged := newCredential(issuer, "2")
+	require.Error(t, eval(forged, reader, issuer, nil))
+	require.Error(t, eval(forged, reader, reader, sign(readerSigner, forged, "2")))
+	require.Error(t, eval(forged, reader, issuer, sign(issuerSigner, cred, "2")))
+}
+
+func newCredentialStruct(clearance string) *CredentialStruct {
+	return &CredentialStruct{Credentials: []Credential{{
+		Name: "employee",
+		Attributes: []Attribute{
+			{Name: "department", Value: []byte("research")},
+			{Name: "clearance", Value: []byte(clearance)},
+		},
+	}}}
+}
@@ -2,6 +2,7 @@ package contracts
 
 import (
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso"
 	"go.dedis.ch/onet/v3/log"
 )
 
@@ -14,6 +15,7 @@ func init() {
 		ContractCredentialFromBytes))
 	log.ErrFatal(byzcoin.RegisterGlobalContract(ContractRoPaSciID,
 		ContractRoPaSciFromBytes))
+	calypso.AddReadAttrInterpreter(AttrCredential, makeCredentialAttr)
 }
 
 func newArg(name string, val []byte) byzcoin.Argument {
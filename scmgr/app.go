@@ -275,6 +275,66 @@ func followList(c *cli.Context) error {
 	return nil
 }
 
+func observeAdd(c *cli.Context) error {
+	if c.NArg() != 3 {
+		return errors.New("please give: group-file skipchain-id ip:port")
+	}
+	cfg := getConfigOrFail(c)
+	group := readGroupArgs(c, 0)
+	scid, err := hex.DecodeString(c.Args().Get(1))
+	if err != nil {
+		return errors.New("invalid skipchain-id: " + err.Error())
+	}
+	link, err := findLinkFromAddress(cfg, c.Args().Get(2))
+	if err != nil {
+		return errors.New("couldn't parse node-address or not linked yet: " + err.Error())
+	}
+	log.Infof("Observing skipchain %x with conode %s", scid, link.Address)
+	err = skipchain.NewClient().AddObserve(link.Conode, link.Private, group.Roster, scid)
+	if err != nil {
+		return errors.New("couldn't observe skipchain: " + err.Error())
+	}
+	return nil
+}
+func observeDel(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("please give skipchain-id and ip:port to delete")
+	}
+	cfg := getConfigOrFail(c)
+	scid, err := hex.DecodeString(c.Args().First())
+	if err != nil {
+		return err
+	}
+	link, err := findLinkFromAddress(cfg, c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	err = skipchain.NewClient().DelObserve(link.Conode, link.Private, scid)
+	if err != nil {
+		return err
+	}
+	log.Infof("Conode %s stopped observing skipchain %x", link.Conode, scid)
+	return nil
+}
+func observeList(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("please give ip:port of the host to list")
+	}
+	cfg := getConfigOrFail(c)
+	link, err := findLinkFromAddress(cfg, c.Args().First())
+	if err != nil {
+		return err
+	}
+	list, err := skipchain.NewClient().ListObserve(link.Conode, link.Private)
+	if err != nil {
+		return err
+	}
+	for i, id := range list.SkipchainIDs {
+		fmt.Fprintf(c.App.Writer, "%x latest index %d\n", id, list.Indexes[i])
+	}
+	return nil
+}
+
 // Creates a new skipchain with the given roster
 func scCreate(c *cli.Context) error {
 	cfg := getConfigOrFail(c)
@@ -449,6 +509,53 @@ func scPrint(c *cli.Context) error {
 	return nil
 }
 
+// Exports a proof bundle that can be verified offline.
+func scProofExport(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("Please give a group-file and a skipchain-id")
+	}
+	group := readGroupArgs(c, 0)
+	id, err := hex.DecodeString(c.Args().Get(1))
+	if err != nil {
+		return errors.New("Failed to decode skipchain-id " + c.Args().Get(1))
+	}
+
+	var buf []byte
+	if c.String("key") != "" {
+		key, err := hex.DecodeString(c.String("key"))
+		if err != nil {
+			return errors.New("Failed to decode -key " + c.String("key"))
+		}
+		genesis, err := skipchain.NewClient().GetSingleBlock(group.Roster, id)
+		if err != nil {
+			return err
+		}
+		reply, err := byzcoin.NewClient(id, *group.Roster).GetProof(key)
+		if err != nil {
+			return err
+		}
+		buf, err = reply.Proof.Export(genesis, key)
+		if err != nil {
+			return err
+		}
+	} else {
+		guc, err := skipchain.NewClient().GetUpdateChain(group.Roster, id)
+		if err != nil {
+			return err
+		}
+		buf, err = skipchain.Proof(guc.Update).Export()
+		if err != nil {
+			return err
+		}
+	}
+
+	if out := c.String("out"); out != "" {
+		return ioutil.WriteFile(out, buf, 0644)
+	}
+	_, err = c.App.Writer.Write(buf)
+	return err
+}
+
 func scOptimize(c *cli.Context) error {
 	rosterFile := c.String("roster")
 	if rosterFile == "" {
@@ -92,6 +92,35 @@ func getCommands() cli.Commands {
 			},
 		},
 
+		{
+			Name:    "observe",
+			Usage:   "keep a read-only copy of a skipchain on a conode that is not in its roster",
+			Aliases: []string{"o"},
+			Subcommands: cli.Commands{
+				{
+					Name:      "add",
+					Usage:     "start observing a skipchain",
+					ArgsUsage: groupsDef + " skipchain-id ip:port",
+					Aliases:   []string{"a"},
+					Action:    observeAdd,
+				},
+				{
+					Name:      "delete",
+					Usage:     "stop observing a skipchain",
+					Aliases:   []string{"del", "rm", "d"},
+					ArgsUsage: "skipchain-id ip:port",
+					Action:    observeDel,
+				},
+				{
+					Name:      "list",
+					Usage:     "list all skipchains a conode observes",
+					ArgsUsage: "ip:port",
+					Aliases:   []string{"ls"},
+					Action:    observeList,
+				},
+			},
+		},
+
 		{
 			Name:    "skipchain",
 			Usage:   "work with skipchains in cothority",
@@ -172,6 +201,30 @@ func getCommands() cli.Commands {
 						},
 					},
 				},
+				{
+					Name:    "proof",
+					Usage:   "work with proof bundles",
+					Aliases: []string{"p"},
+					Subcommands: cli.Commands{
+						{
+							Name:      "export",
+							Usage:     "export the proof of the latest block, or of a ByzCoin key, to be verified offline",
+							Aliases:   []string{"e"},
+							ArgsUsage: groupsDef + " skipchain-id",
+							Action:    scProofExport,
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "out, o",
+									Usage: "file to write the bundle to (default: stdout)",
+								},
+								cli.StringFlag{
+									Name:  "key",
+									Usage: "ByzCoin key to prove, in hex",
+								},
+							},
+						},
+					},
+				},
 				{
 					Name:    "optimize",
 					Usage:   "create missing forward link to optimize the proof of a given block",
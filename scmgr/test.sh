@@ -12,6 +12,7 @@ main(){
 	buildConode go.dedis.ch/cothority/v3/skipchain
 	CFG=$BUILDDIR/scmgr_config
 	run testOptimize
+	run testProofExport
 	run testDNSUpdate
 	run testRestart
 	run testConfig
@@ -294,6 +295,16 @@ testOptimize() {
 	testGrep "Chain optimized with 3 blocks" runSc skipchain optimize --roster public.toml --id $ID
 }
 
+testProofExport() {
+	startCl
+	setupGenesis
+	testOK runSc skipchain block add --roster public.toml $ID
+	testFail runSc skipchain proof export public.toml
+	testFail runSc skipchain proof export public.toml abcd
+	testOK runSc skipchain proof export -o proof.bin public.toml $ID
+	testFile proof.bin
+}
+
 runSc(){
 	dbgRun ./$APP -c $CFG -d $DBG_APP "$@"
 }
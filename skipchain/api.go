@@ -267,6 +267,23 @@ func (c *Client) GetUpdateChain(roster *onet.Roster, latest SkipBlockID) (reply
 func (c *Client) GetUpdateChainLevel(initRoster *onet.Roster,
 	latest SkipBlockID, maxLevel int,
 	maxBlocks int) (update []*SkipBlock, err error) {
+	return c.getUpdateChain(initRoster, latest, maxLevel, maxBlocks, false)
+}
+
+// GetUpdateChainHeaders works like GetUpdateChainLevel, but the nodes only
+// send the headers of the blocks, which are verified the same way. The
+// returned blocks have no payload, and the nodes only send their rosters when
+// they change, so it needs much less bandwidth to follow a chain. The
+// payload of a block can still be fetched with GetSingleBlock.
+func (c *Client) GetUpdateChainHeaders(initRoster *onet.Roster,
+	latest SkipBlockID, maxLevel int,
+	maxBlocks int) ([]*SkipBlock, error) {
+	return c.getUpdateChain(initRoster, latest, maxLevel, maxBlocks, true)
+}
+
+func (c *Client) getUpdateChain(initRoster *onet.Roster,
+	latest SkipBlockID, maxLevel int,
+	maxBlocks int, headersOnly bool) (update []*SkipBlock, err error) {
 	roster := initRoster
 	for {
 		r2 := &GetUpdateChainReply{}
@@ -279,9 +296,10 @@ func (c *Client) GetUpdateChainLevel(initRoster *onet.Roster,
 			}
 		}
 		node, err := c.SendProtobufParallel(roster.List, &GetUpdateChain{
-			LatestID:  latest,
-			MaxHeight: maxLevel,
-			MaxBlocks: mb,
+			LatestID:    latest,
+			MaxHeight:   maxLevel,
+			MaxBlocks:   mb,
+			HeadersOnly: headersOnly,
 		}, r2, c.options)
 		if err != nil {
 			same, err := roster.Equal(initRoster)
@@ -294,16 +312,27 @@ func (c *Client) GetUpdateChainLevel(initRoster *onet.Roster,
 			continue
 		}
 
-		log.Lvlf3("Got %d blocks from node %s", len(r2.Update), node)
+		// Nodes that don't know about headers send the full blocks.
+		blocks := r2.Update
+		if headersOnly && len(r2.Headers) > 0 {
+			blocks, err = BlocksFromHeaders(r2.Headers)
+			if err != nil {
+				return nil, err
+			}
+		}
+		log.Lvlf3("Got %d blocks from node %s", len(blocks), node)
+		if len(blocks) == 0 {
+			return nil, errors.New("got an empty update chain")
+		}
 
 		// Does this chain start where we expect it to?
-		if !r2.Update[0].Hash.Equal(latest) {
+		if !blocks[0].Hash.Equal(latest) {
 			return nil, errors.New("first returned block does not match requested hash")
 		}
 
 		// Step through the returned blocks one at a time, verifying
 		// the forward links, and that they link correctly backwards.
-		for j, b := range r2.Update {
+		for j, b := range blocks {
 			if j == 0 && len(update) > 0 {
 				last := update[len(update)-1]
 				if last.Hash.Equal(b.Hash) {
@@ -570,3 +599,46 @@ func (c *Client) ListFollow(si *network.ServerIdentity, clientPriv kyber.Scalar)
 	}
 	return reply, nil
 }
+
+// AddObserve asks the conode to keep a read-only copy of the skipchain, that
+// it fetches from the given roster, and to serve it to clients. The conode
+// must not be in the roster of the skipchain.
+func (c *Client) AddObserve(si *network.ServerIdentity, clientPriv kyber.Scalar,
+	roster *onet.Roster, scid SkipBlockID) error {
+	msg := append([]byte("addobserve:"), scid...)
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, msg)
+	if err != nil {
+		return err
+	}
+	return c.SendProtobuf(si, &AddObserve{SkipchainID: scid, Roster: roster,
+		Signature: sig}, nil)
+}
+
+// DelObserve asks the conode to stop updating its copy of the skipchain.
+func (c *Client) DelObserve(si *network.ServerIdentity, clientPriv kyber.Scalar, scid SkipBlockID) error {
+	msg := append([]byte("delobserve:"), scid...)
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, msg)
+	if err != nil {
+		return err
+	}
+	return c.SendProtobuf(si, &DelObserve{SkipchainID: scid, Signature: sig}, nil)
+}
+
+// ListObserve returns the skipchains observed by the conode.
+func (c *Client) ListObserve(si *network.ServerIdentity, clientPriv kyber.Scalar) (*ListObserveReply, error) {
+	msg, err := si.Public.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	msg = append([]byte("listobserve:"), msg...)
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, msg)
+	if err != nil {
+		return nil, err
+	}
+	reply := &ListObserveReply{}
+	err = c.SendProtobuf(si, &ListObserve{Signature: sig}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
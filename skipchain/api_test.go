@@ -10,6 +10,7 @@ import (
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
 	"strings"
 	"sync"
 	"testing"
@@ -155,6 +156,60 @@ func TestClient_GetUpdateChain(t *testing.T) {
 	}
 }
 
+func TestClient_GetUpdateChainHeaders(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+
+	_, roster, gs := local.MakeSRS(cothority.Suite, 4, skipchainSID)
+	s := gs.(*Service)
+	c := newTestClient(local)
+
+	genesis, err := makeGenesisRosterArgs(s, onet.NewRoster(roster.List[0:3]),
+		nil, VerificationNone, 2, 3)
+	require.NoError(t, err)
+	latest := genesis
+	for i := 1; i < 6; i++ {
+		newSB := NewSkipBlock()
+		newSB.Payload = make([]byte, 1000)
+		if i == 3 {
+			newSB.Roster = roster
+		} else {
+			newSB.Roster = latest.Roster
+		}
+		reply, err := s.StoreSkipBlock(&StoreSkipBlock{
+			TargetSkipChainID: latest.Hash, NewBlock: newSB})
+		require.NoError(t, err)
+		latest = reply.Latest
+	}
+
+	full, err := c.GetUpdateChainLevel(roster, genesis.Hash, 1, -1)
+	require.NoError(t, err)
+	headers, err := c.GetUpdateChainHeaders(roster, genesis.Hash, 1, -1)
+	require.NoError(t, err)
+	require.Equal(t, len(full), len(headers))
+	for i, sb := range headers {
+		require.True(t, sb.Equal(full[i]))
+		require.NoError(t, sb.VerifyForwardSignatures())
+		require.Equal(t, 0, len(sb.Payload))
+	}
+	require.True(t, headers[len(headers)-1].Equal(latest))
+
+	// The headers need less bandwidth than the blocks.
+	fullReply, err := s.GetUpdateChain(&GetUpdateChain{LatestID: genesis.Hash,
+		MaxHeight: 1})
+	require.NoError(t, err)
+	headersReply, err := s.GetUpdateChain(&GetUpdateChain{LatestID: genesis.Hash,
+		MaxHeight: 1, HeadersOnly: true})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(headersReply.Update))
+	fullBuf, err := protobuf.Encode(fullReply)
+	require.NoError(t, err)
+	headersBuf, err := protobuf.Encode(headersReply)
+	require.NoError(t, err)
+	require.True(t, len(headersBuf) < len(fullBuf)/2)
+}
+
 func TestClient_StoreSkipBlock(t *testing.T) {
 	nbrHosts := 3
 	l := onet.NewTCPTest(cothority.Suite)
@@ -0,0 +1,130 @@
+package skipchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+)
+
+// ProofBundleVersion is the version of the proof bundles created by this
+// package. Bundles with a higher version are refused.
+const ProofBundleVersion = 1
+
+// The types of proof bundles.
+const (
+	// ProofBundleSkipchain is the type of the bundles of a skipchain Proof.
+	ProofBundleSkipchain = "skipchain"
+	// ProofBundleByzCoin is the type of the bundles of a ByzCoin proof of a
+	// key.
+	ProofBundleByzCoin = "byzcoin"
+)
+
+// proofBundleMagic starts every encoded proof bundle, so that it can be
+// recognized.
+var proofBundleMagic = []byte("cothority proof bundle\n")
+
+// ProofBundle is a self-describing format for proofs, so that they can be
+// stored, sent to a third party and verified offline, without contacting
+// any node. It holds all the blocks and links needed to verify the proof from
+// the genesis block, and for ByzCoin proofs, the trie proof of a key
+// together with its value.
+type ProofBundle struct {
+	// Version is the version of the format.
+	Version int
+	// Type is the type of the proof, like ProofBundleSkipchain.
+	Type string
+	// GenesisID is the ID of the skipchain. The proof is only worth
+	// something if the verifier trusts this ID.
+	GenesisID SkipBlockID
+	// Blocks are the blocks of the proof. For a skipchain proof, they go
+	// from the genesis block to the proven block. For a ByzCoin proof, they
+	// are the genesis block and the block holding the root of the trie.
+	Blocks []*SkipBlock
+	// Links are the forward links from the genesis block to the latest
+	// block, for a ByzCoin proof.
+	Links []ForwardLink `protobuf:"opt"`
+	// TrieProof is the encoded proof of the key in the trie, for a ByzCoin
+	// proof.
+	TrieProof []byte `protobuf:"opt"`
+	// Key is the key of the ByzCoin proof.
+	Key []byte `protobuf:"opt"`
+	// Value and ContractID are the value of the key, and the contract of its
+	// instance, if the key is in the trie. They are also in the trie proof,
+	// and checked against it when the proof is imported.
+	Value      []byte `protobuf:"opt"`
+	ContractID string `protobuf:"opt"`
+}
+
+// Encode returns the encoded bundle.
+func (b *ProofBundle) Encode() ([]byte, error) {
+	buf, err := protobuf.Encode(b)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, proofBundleMagic...), buf...), nil
+}
+
+// DecodeProofBundle decodes a bundle returned by ProofBundle.Encode. It
+// returns an error if the bundle has an unknown version, but doesn't verify
+// the proof.
+func DecodeProofBundle(buf []byte) (*ProofBundle, error) {
+	if !bytes.HasPrefix(buf, proofBundleMagic) {
+		return nil, errors.New("not a proof bundle")
+	}
+	var b ProofBundle
+	err := protobuf.DecodeWithConstructors(buf[len(proofBundleMagic):], &b,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode proof bundle: %v", err)
+	}
+	if b.Version < 1 || b.Version > ProofBundleVersion {
+		return nil, fmt.Errorf("unknown proof bundle version %d", b.Version)
+	}
+	if len(b.Blocks) == 0 {
+		return nil, errors.New("proof bundle without blocks")
+	}
+	return &b, nil
+}
+
+// Export returns the proof as an encoded bundle. The proof must start at the
+// genesis block.
+func (sbs Proof) Export() ([]byte, error) {
+	if len(sbs) == 0 || sbs[0].Index != 0 {
+		return nil, errors.New("the proof must start at the genesis block")
+	}
+	b := &ProofBundle{
+		Version:   ProofBundleVersion,
+		Type:      ProofBundleSkipchain,
+		GenesisID: sbs[0].Hash,
+		Blocks:    sbs,
+	}
+	return b.Encode()
+}
+
+// ImportProof returns the skipchain proof of the encoded bundle, once it has
+// been verified to go from the genesis block with the given ID to its last
+// block.
+func ImportProof(buf []byte, genesisID SkipBlockID) (Proof, error) {
+	b, err := DecodeProofBundle(buf)
+	if err != nil {
+		return nil, err
+	}
+	if b.Type != ProofBundleSkipchain {
+		return nil, fmt.Errorf("not a skipchain proof, but a %s proof", b.Type)
+	}
+	if !b.GenesisID.Equal(genesisID) {
+		return nil, errors.New("the proof is for another skipchain")
+	}
+	sbs := Proof(b.Blocks)
+	if err := sbs.Verify(); err != nil {
+		return nil, err
+	}
+	if !sbs[0].Hash.Equal(genesisID) {
+		return nil, errors.New("the proof doesn't start at the genesis block")
+	}
+	return sbs, nil
+}
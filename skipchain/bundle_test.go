@@ -0,0 +1,63 @@
+package skipchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestProof_Export(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+
+	_, roster, gs := local.MakeSRS(cothority.Suite, 3, skipchainSID)
+	s := gs.(*Service)
+
+	genesis, err := makeGenesisRosterArgs(s, roster, nil, VerificationNone, 2, 3)
+	require.NoError(t, err)
+	latest := genesis
+	for i := 0; i < 4; i++ {
+		newSB := NewSkipBlock()
+		newSB.Roster = roster
+		reply, err := s.StoreSkipBlock(&StoreSkipBlock{
+			TargetSkipChainID: latest.Hash, NewBlock: newSB})
+		require.NoError(t, err)
+		latest = reply.Latest
+	}
+	reply, err := s.GetUpdateChain(&GetUpdateChain{LatestID: genesis.Hash})
+	require.NoError(t, err)
+	proof := Proof(reply.Update)
+
+	buf, err := proof.Export()
+	require.NoError(t, err)
+	imported, err := ImportProof(buf, genesis.Hash)
+	require.NoError(t, err)
+	require.Equal(t, len(proof), len(imported))
+	require.True(t, imported[len(imported)-1].Hash.Equal(latest.Hash))
+
+	_, err = ImportProof(buf, latest.Hash)
+	require.Error(t, err)
+	_, err = ImportProof(buf[1:], genesis.Hash)
+	require.Error(t, err)
+	_, err = proof[1:].Export()
+	require.Error(t, err)
+
+	// A tampered block is detected.
+	proof[1].Data = []byte("tampered")
+	buf, err = proof.Export()
+	require.NoError(t, err)
+	_, err = ImportProof(buf, genesis.Hash)
+	require.Error(t, err)
+
+	// Bundles of a newer version are refused.
+	b, err := DecodeProofBundle(buf)
+	require.NoError(t, err)
+	b.Version = ProofBundleVersion + 1
+	buf, err = b.Encode()
+	require.NoError(t, err)
+	_, err = DecodeProofBundle(buf)
+	require.Error(t, err)
+}
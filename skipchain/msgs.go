@@ -44,6 +44,11 @@ func init() {
 		&ListFollow{},
 		// Returns the genesis-blocks of all skipchains we follow
 		&ListFollowReply{},
+		// Observing skipchains read-only
+		&AddObserve{},
+		&DelObserve{},
+		&ListObserve{},
+		&ListObserveReply{},
 		// - Internal calls
 		// Propagation
 		&PropagateGenesis{},
@@ -114,12 +119,18 @@ type GetUpdateChain struct {
 	// MaxBlocks is the maximum number of blocks to be returned. If it is not
 	// given, or equal to 0, all available blocks will be returned.
 	MaxBlocks int `protobuf:"opt"`
+	// HeadersOnly asks for the headers of the blocks in Headers, instead of
+	// the blocks in Update.
+	HeadersOnly bool `protobuf:"opt"`
 }
 
 // GetUpdateChainReply - returns the shortest chain to the current SkipBlock,
 // starting from the SkipBlock the client sent
 type GetUpdateChainReply struct {
 	Update []*SkipBlock
+	// Headers holds the headers of the blocks if HeadersOnly was set in the
+	// request.
+	Headers []*BlockHeader `protobuf:"opt"`
 }
 
 // GetAllSkipchains - erronously returns all blocks. Deprecated.
@@ -363,3 +374,34 @@ type ListFollowReply struct {
 	Follow    *[]FollowChainType
 	FollowIDs *[]SkipBlockID
 }
+
+// AddObserve asks a conode to keep a read-only copy of a skipchain it is not
+// part of. The Roster is used to fetch the genesis block if the conode
+// doesn't know the skipchain. The signature has to be on the following
+// message: "addobserve:" + the SkipchainID
+type AddObserve struct {
+	SkipchainID SkipBlockID
+	Roster      *onet.Roster
+	Signature   []byte
+}
+
+// DelObserve stops the observation of a skipchain. The signature has to be
+// on the following message: "delobserve:" + the SkipchainID
+type DelObserve struct {
+	SkipchainID SkipBlockID
+	Signature   []byte
+}
+
+// ListObserve returns the skipchains observed by a conode. The signature has
+// to be on the following message: "listobserve:" + the public key of the
+// conode
+type ListObserve struct {
+	Signature []byte
+}
+
+// ListObserveReply returns the IDs of the observed skipchains, and the index
+// of the latest block the conode has for each of them.
+type ListObserveReply struct {
+	SkipchainIDs []SkipBlockID
+	Indexes      []int
+}
@@ -0,0 +1,211 @@
+package skipchain
+
+import (
+	"errors"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// defaultObserveInterval is how often the observed skipchains are updated.
+const defaultObserveInterval = 2 * time.Second
+
+// observeBatch is how many blocks are fetched at once when updating an
+// observed skipchain.
+const observeBatch = 100
+
+// errObserved is returned when a conode is asked to sign or add a block to a
+// skipchain it only observes.
+var errObserved = errors.New("this conode only observes the skipchain")
+
+// AddObserve makes the conode keep a read-only copy of a skipchain it is not
+// part of, so that it can serve the blocks and proofs of the skipchain to
+// clients. The genesis block is fetched from the given roster, and all the
+// following blocks are fetched from the roster of the latest known block,
+// and verified with their forward links before being stored. The conode
+// never signs the blocks of an observed skipchain.
+//
+// The signature is on "addobserve:" + the skipchain ID.
+func (s *Service) AddObserve(req *AddObserve) (*EmptyReply, error) {
+	msg := append([]byte("addobserve:"), req.SkipchainID...)
+	if !s.verifySigs(msg, req.Signature) {
+		return nil, errors.New("wrong signature of unknown signer")
+	}
+	if s.isObserved(req.SkipchainID) {
+		return nil, errors.New("skipchain is already observed")
+	}
+
+	latest, err := s.db.GetLatestByID(req.SkipchainID)
+	if err != nil {
+		if req.Roster == nil || len(req.Roster.List) == 0 {
+			return nil, errors.New("empty roster")
+		}
+		blocks, err := s.getBlocksSkipping(req.Roster, req.SkipchainID, 1, false)
+		if err != nil {
+			return nil, errors.New("couldn't get genesis block: " + err.Error())
+		}
+		if len(blocks) == 0 || blocks[0].Index != 0 {
+			return nil, errors.New("this is not the ID of a skipchain")
+		}
+		// The forward links are stored together with the blocks they
+		// point to.
+		blocks[0].ForwardLink = nil
+		if s.db.Store(blocks[0]) == nil {
+			return nil, errors.New("couldn't store genesis block")
+		}
+		latest = blocks[0]
+	}
+	if i, _ := latest.Roster.Search(s.ServerIdentity().ID); i >= 0 {
+		return nil, errors.New("this conode is in the roster of the skipchain")
+	}
+
+	s.storageMutex.Lock()
+	s.Storage.Observe = append(s.Storage.Observe, req.SkipchainID)
+	s.storageMutex.Unlock()
+	s.save()
+	log.Lvlf2("%s observing skipchain %x", s.ServerIdentity(), req.SkipchainID)
+
+	// Start updating the skipchain right away.
+	select {
+	case s.observeTrigger <- struct{}{}:
+	default:
+	}
+	return &EmptyReply{}, nil
+}
+
+// DelObserve stops updating an observed skipchain. The blocks that are
+// already stored are kept. The signature is on "delobserve:" + the skipchain
+// ID.
+func (s *Service) DelObserve(req *DelObserve) (*EmptyReply, error) {
+	msg := append([]byte("delobserve:"), req.SkipchainID...)
+	if !s.verifySigs(msg, req.Signature) {
+		return nil, errors.New("wrong signature of unknown signer")
+	}
+
+	s.storageMutex.Lock()
+	deleted := false
+	for i, id := range s.Storage.Observe {
+		if id.Equal(req.SkipchainID) {
+			s.Storage.Observe = append(s.Storage.Observe[:i],
+				s.Storage.Observe[i+1:]...)
+			deleted = true
+			break
+		}
+	}
+	s.storageMutex.Unlock()
+	if !deleted {
+		return nil, errors.New("skipchain is not observed")
+	}
+	s.save()
+	return &EmptyReply{}, nil
+}
+
+// ListObserve returns the observed skipchains, with the index of the latest
+// block the conode has for each of them. The signature is on
+// "listobserve:" + the public key of the conode.
+func (s *Service) ListObserve(req *ListObserve) (*ListObserveReply, error) {
+	msg, err := s.ServerIdentity().Public.MarshalBinary()
+	if err != nil {
+		return nil, errors.New("couldn't marshal public key")
+	}
+	msg = append([]byte("listobserve:"), msg...)
+	if !s.verifySigs(msg, req.Signature) {
+		return nil, errors.New("wrong signature of unknown signer")
+	}
+
+	reply := &ListObserveReply{}
+	for _, id := range s.observedChains() {
+		index := -1
+		if latest, err := s.db.GetLatestByID(id); err == nil {
+			index = latest.Index
+		}
+		reply.SkipchainIDs = append(reply.SkipchainIDs, id)
+		reply.Indexes = append(reply.Indexes, index)
+	}
+	return reply, nil
+}
+
+// SetObserveInterval sets how often the observed skipchains are updated.
+func (s *Service) SetObserveInterval(t time.Duration) {
+	s.storageMutex.Lock()
+	s.observeInterval = t
+	s.storageMutex.Unlock()
+}
+
+// isObserved returns whether the skipchain is only observed by this conode.
+func (s *Service) isObserved(scID SkipBlockID) bool {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
+	for _, id := range s.Storage.Observe {
+		if id.Equal(scID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) observedChains() []SkipBlockID {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
+	return append([]SkipBlockID{}, s.Storage.Observe...)
+}
+
+func (s *Service) getObserveInterval() time.Duration {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
+	return s.observeInterval
+}
+
+// observeLoop updates the observed skipchains regularly, until closing is
+// closed.
+func (s *Service) observeLoop(closing chan bool) {
+	for {
+		select {
+		case <-closing:
+			return
+		case <-s.observeTrigger:
+		case <-time.After(s.getObserveInterval()):
+		}
+		if err := s.incrementWorking(); err != nil {
+			return
+		}
+		for _, id := range s.observedChains() {
+			if err := s.syncObserved(id); err != nil {
+				log.Lvlf2("%s couldn't update observed skipchain %x: %v",
+					s.ServerIdentity(), id, err)
+			}
+		}
+		s.decrementWorking()
+	}
+}
+
+// syncObserved fetches the blocks following the latest known block of the
+// observed skipchain. The blocks are fetched one after the other, so that
+// the services using the skipchain, like ByzCoin, can apply all of them.
+func (s *Service) syncObserved(id SkipBlockID) error {
+	latest, err := s.db.GetLatestByID(id)
+	if err != nil {
+		return err
+	}
+	for {
+		blocks, err := s.getBlocksSkipping(latest.Roster, latest.Hash,
+			observeBatch, false)
+		if err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return errors.New("didn't find the latest block")
+		}
+		last := blocks[len(blocks)-1]
+		if len(blocks) == 1 && len(last.ForwardLink) == 0 {
+			return nil
+		}
+		if _, err := s.db.StoreBlocks(blocks); err != nil {
+			return err
+		}
+		if len(last.ForwardLink) == 0 {
+			return nil
+		}
+		latest = last
+	}
+}
@@ -74,6 +74,8 @@ type Service struct {
 	closedMutex             sync.Mutex
 	working                 sync.WaitGroup
 	closing                 chan bool
+	observeInterval         time.Duration
+	observeTrigger          chan struct{}
 
 	// disableForwardLink is useful in testing mode
 	disableForwardLink bool
@@ -152,6 +154,9 @@ type Storage struct {
 	// to this service. Once a client is linked to a service, only blocks signed
 	// by this client will be allowed.
 	Clients []kyber.Point
+	// Observe is a slice of IDs of skipchains that are followed read-only,
+	// without being part of their roster.
+	Observe []SkipBlockID
 }
 
 // StoreSkipBlock stores a new skipblock in the system. This can be either a
@@ -278,6 +283,10 @@ func (s *Service) StoreSkipBlockInternal(psbd *StoreSkipBlock) (*StoreSkipBlockR
 		s.chains.lock(scID)
 		defer s.chains.unlock(scID)
 
+		if s.isObserved(scID) {
+			return nil, errObserved
+		}
+
 		var err error
 		prev, err = s.db.GetLatestByID(scID)
 		if err != nil {
@@ -534,8 +543,10 @@ func (s *Service) GetUpdateChain(guc *GetUpdateChain) (*GetUpdateChainReply, err
 	}
 
 	// Remove all blocks from the end of the result until a block is found
-	// where this node is part of.
-	for b := len(blocks) - 1; b > 0; b-- {
+	// where this node is part of, except for observed skipchains, where
+	// this node is never part of the roster.
+	observed := s.isObserved(block.SkipChainID())
+	for b := len(blocks) - 1; b > 0 && !observed; b-- {
 		if i, _ := blocks[b].Roster.Search(s.ServerIdentity().ID); i < 0 {
 			blocks = blocks[:b]
 		} else {
@@ -544,6 +555,9 @@ func (s *Service) GetUpdateChain(guc *GetUpdateChain) (*GetUpdateChainReply, err
 	}
 
 	log.Lvlf3("Found %d blocks", len(blocks))
+	if guc.HeadersOnly {
+		return &GetUpdateChainReply{Headers: NewBlockHeaders(blocks)}, nil
+	}
 	reply := &GetUpdateChainReply{Update: blocks}
 
 	return reply, nil
@@ -602,6 +616,12 @@ func (s *Service) SyncChain(roster *onet.Roster, latest SkipBlockID) error {
 // in the roster, in order to find an answer, even in the case that a few
 // nodes in the network are down.
 func (s *Service) getBlocks(roster *onet.Roster, id SkipBlockID, n int) ([]*SkipBlock, error) {
+	return s.getBlocksSkipping(roster, id, n, true)
+}
+
+// getBlocksSkipping is like getBlocks, but only follows the highest forward
+// links if skipping is true, else it returns consecutive blocks.
+func (s *Service) getBlocksSkipping(roster *onet.Roster, id SkipBlockID, n int, skipping bool) ([]*SkipBlock, error) {
 	subCount := len(roster.List)
 	if subCount > 10 {
 		// Only take half of the nodes to not spam the whole network.
@@ -618,7 +638,7 @@ func (s *Service) getBlocks(roster *onet.Roster, id SkipBlockID, n int) ([]*Skip
 	pisc.GetBlocks = &ProtoGetBlocks{
 		SBID:     id,
 		Count:    n,
-		Skipping: true,
+		Skipping: skipping,
 	}
 	if err := pi.Start(); err != nil {
 		return nil, err
@@ -1083,7 +1103,11 @@ func (s *Service) TestRestart() error {
 	s.closed = false
 	s.closing = make(chan bool)
 	s.closedMutex.Unlock()
-	return s.tryLoad()
+	if err := s.tryLoad(); err != nil {
+		return err
+	}
+	go s.observeLoop(s.closing)
+	return nil
 }
 
 func (s *Service) verifySigs(msg, sig []byte) bool {
@@ -1206,6 +1230,10 @@ func (s *Service) bftForwardLinkLevel0(msg, data []byte) bool {
 		log.Errorf("got unexpected target height: %d", fs.TargetHeight)
 		return false
 	}
+	if s.isObserved(fs.Newest.SkipChainID()) {
+		log.Lvlf2("%s: %v", s.ServerIdentity(), errObserved)
+		return false
+	}
 
 	prevSB := s.db.GetByID(fs.Previous)
 	if prevSB == nil {
@@ -1336,6 +1364,9 @@ func (s *Service) ForwardLinkHandler(req *ForwardSignature) (*ForwardSignatureRe
 	}
 
 	fl, err := func() (*ForwardLink, error) {
+		if s.isObserved(fs.Newest.SkipChainID()) {
+			return nil, errObserved
+		}
 		if fs.TargetHeight >= len(fs.Newest.BackLinkIDs) {
 			return nil, fmt.Errorf("This backlink-height doesn't exist for block at index %d: %d / %d",
 				fs.Newest.Index, fs.TargetHeight, len(fs.Newest.BackLinkIDs))
@@ -1442,6 +1473,9 @@ func (s *Service) bftForwardLink(msg, data []byte) bool {
 		if !src.SkipChainID().Equal(dst.SkipChainID()) {
 			return errors.New("src and newest not from same skipchain")
 		}
+		if s.isObserved(src.SkipChainID()) {
+			return errObserved
+		}
 
 		// Make sure the links are correctly linking src to dst:
 		// - every link is correctly linked to the previous and next link
@@ -1888,6 +1922,8 @@ func newSkipchainService(c *onet.Context) (onet.Service, error) {
 		propTimeout:      defaultPropagateTimeout,
 		closing:          make(chan bool),
 		blockBuffer:      newSkipBlockBuffer(),
+		observeInterval:  defaultObserveInterval,
+		observeTrigger:   make(chan struct{}, 1),
 	}
 
 	if err := s.tryLoad(); err != nil {
@@ -1897,7 +1933,8 @@ func newSkipchainService(c *onet.Context) (onet.Service, error) {
 		s.GetSingleBlock, s.GetSingleBlockByIndex, s.GetAllSkipchains,
 		s.GetAllSkipChainIDs, s.OptimizeProof,
 		s.CreateLinkPrivate, s.Unlink, s.AddFollow, s.ListFollow,
-		s.DelFollow, s.Listlink, s.ForwardLinkHandler))
+		s.DelFollow, s.Listlink, s.ForwardLinkHandler, s.AddObserve,
+		s.DelObserve, s.ListObserve))
 	s.ServiceProcessor.RegisterStatusReporter("Skipblock", s.db)
 	// Deprecated: the handler should be used instead
 	s.RegisterProcessorFunc(network.RegisterMessage(&ForwardSignature{}), s.forwardLink)
@@ -1905,6 +1942,7 @@ func newSkipchainService(c *onet.Context) (onet.Service, error) {
 	if err := s.registerVerification(VerifyBase, s.verifyFuncBase); err != nil {
 		return nil, err
 	}
+	go s.observeLoop(s.closing)
 
 	var err error
 	s.propagateGenesis, err = messaging.NewPropagationFunc(c, "SkipchainPropagate", s.propagateGenesisHandler, -1)
@@ -1017,6 +1017,93 @@ func TestService_ListFollow(t *testing.T) {
 	require.Equal(t, 2, len(*lf.FollowIDs))
 }
 
+func TestService_Observe(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, ro, _ := local.MakeSRS(cothority.Suite, 4, skipchainSID)
+	services := make([]*Service, len(servers))
+	for i, s := range local.GetServices(servers, skipchainSID) {
+		services[i] = s.(*Service)
+	}
+	service := services[0]
+	observer := services[3]
+	observer.SetObserveInterval(100 * time.Millisecond)
+	roster := onet.NewRoster(ro.List[:3])
+
+	genesis, err := makeGenesisRosterArgs(service, roster, nil, VerificationNone, 2, 3)
+	require.NoError(t, err)
+	sb := NewSkipBlock()
+	sb.Roster = roster
+	_, err = addBlockToChain(service, genesis.Hash, sb)
+	require.NoError(t, err)
+
+	_, err = service.AddObserve(&AddObserve{SkipchainID: genesis.Hash})
+	require.Error(t, err)
+	_, err = observer.AddObserve(&AddObserve{SkipchainID: genesis.Hash})
+	require.Error(t, err)
+	_, err = observer.AddObserve(&AddObserve{SkipchainID: genesis.Hash, Roster: roster})
+	require.NoError(t, err)
+	_, err = observer.AddObserve(&AddObserve{SkipchainID: genesis.Hash, Roster: roster})
+	require.Error(t, err)
+
+	var latest *SkipBlock
+	for i := 0; i < 4; i++ {
+		latest, err = addBlockToChain(service, genesis.Hash, sb.Copy())
+		require.NoError(t, err)
+	}
+
+	// The observer gets all the blocks.
+	for i := 0; i < 50; i++ {
+		sb, err := observer.db.GetLatestByID(genesis.Hash)
+		require.NoError(t, err)
+		if sb.Index == latest.Index {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	for i := 0; i <= latest.Index; i++ {
+		reply, err := observer.GetSingleBlockByIndex(&GetSingleBlockByIndex{
+			Genesis: genesis.Hash, Index: i})
+		require.NoError(t, err)
+		require.Equal(t, i, reply.SkipBlock.Index)
+	}
+	guc, err := observer.GetUpdateChain(&GetUpdateChain{LatestID: genesis.Hash})
+	require.NoError(t, err)
+	require.True(t, guc.Update[len(guc.Update)-1].Hash.Equal(latest.Hash))
+	require.NoError(t, Proof(guc.Update).Verify())
+
+	list, err := observer.ListObserve(&ListObserve{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(list.SkipchainIDs))
+	require.Equal(t, latest.Index, list.Indexes[0])
+
+	// The observer refuses to add or sign blocks.
+	sb = NewSkipBlock()
+	sb.Roster = onet.NewRoster(append([]*network.ServerIdentity{ro.List[3]},
+		roster.List...))
+	_, err = addBlockToChain(observer, genesis.Hash, sb)
+	require.Equal(t, errObserved, err)
+	newest := latest.Copy()
+	newest.Index++
+	newest.BackLinkIDs = []SkipBlockID{latest.Hash}
+	newest.ForwardLink = nil
+	newest.updateHash()
+	data, err := network.Marshal(&ForwardSignature{Previous: latest.Hash,
+		Newest: newest})
+	require.NoError(t, err)
+	msg := NewForwardLink(latest, newest).Hash()
+	require.False(t, observer.bftForwardLinkLevel0(msg, data))
+
+	_, err = observer.DelObserve(&DelObserve{SkipchainID: genesis.Hash})
+	require.NoError(t, err)
+	_, err = observer.DelObserve(&DelObserve{SkipchainID: genesis.Hash})
+	require.Error(t, err)
+	list, err = observer.ListObserve(&ListObserve{})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(list.SkipchainIDs))
+}
+
 func TestService_MissingForwardlink(t *testing.T) {
 	// Tests how a missing forward link is handled by the system
 	// by 'Pause()' the leader of the genesis-block for one forwardlink
@@ -344,6 +344,70 @@ type SkipBlock struct {
 	SignatureScheme uint32
 }
 
+// BlockHeader is a SkipBlock without its Payload, which is enough to check
+// its hash and its forward links. As most blocks have the same roster as the
+// previous block, a list of headers only holds the rosters where they change:
+// the Roster of a header is nil if it is the same as the one of the previous
+// header.
+type BlockHeader struct {
+	*SkipBlockFix
+	Hash            SkipBlockID
+	ForwardLink     []*ForwardLink
+	SignatureScheme uint32
+}
+
+// NewBlockHeaders returns the headers of the blocks, with the rosters only
+// where they change.
+func NewBlockHeaders(blocks []*SkipBlock) []*BlockHeader {
+	headers := make([]*BlockHeader, len(blocks))
+	var roster *onet.Roster
+	for i, sb := range blocks {
+		fix := *sb.SkipBlockFix
+		if roster != nil && fix.Roster != nil &&
+			roster.ID.Equal(fix.Roster.ID) {
+			fix.Roster = nil
+		} else {
+			roster = fix.Roster
+		}
+		headers[i] = &BlockHeader{
+			SkipBlockFix:    &fix,
+			Hash:            sb.Hash,
+			ForwardLink:     sb.ForwardLink,
+			SignatureScheme: sb.SignatureScheme,
+		}
+	}
+	return headers
+}
+
+// BlocksFromHeaders returns the blocks of the headers, without their payloads,
+// and with the rosters set again. The first header must have a roster. The
+// blocks are not verified: as the rosters are part of the hashes, it is done
+// by checking their hashes and forward links.
+func BlocksFromHeaders(headers []*BlockHeader) ([]*SkipBlock, error) {
+	blocks := make([]*SkipBlock, len(headers))
+	var roster *onet.Roster
+	for i, h := range headers {
+		if h.SkipBlockFix == nil {
+			return nil, errors.New("header without fixed part")
+		}
+		fix := *h.SkipBlockFix
+		if fix.Roster == nil {
+			if roster == nil {
+				return nil, errors.New("missing roster in the first header")
+			}
+			fix.Roster = roster
+		}
+		roster = fix.Roster
+		blocks[i] = &SkipBlock{
+			SkipBlockFix:    &fix,
+			Hash:            h.Hash,
+			ForwardLink:     h.ForwardLink,
+			SignatureScheme: h.SignatureScheme,
+		}
+	}
+	return blocks, nil
+}
+
 // NewSkipBlock pre-initialises the block so it can be sent over
 // the network
 func NewSkipBlock() *SkipBlock {
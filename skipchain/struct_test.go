@@ -325,6 +325,43 @@ func TestSkipBlock_Payload(t *testing.T) {
 	require.Equal(t, h, sb.CalculateHash())
 }
 
+func TestBlockHeaders(t *testing.T) {
+	l := onet.NewTCPTest(suite)
+	_, roster3, _ := l.GenTree(3, true)
+	defer l.CloseAll()
+	roster2 := onet.NewRoster(roster3.List[0:2])
+
+	var blocks []*SkipBlock
+	for i, ro := range []*onet.Roster{roster2, roster2, roster3} {
+		sb := NewSkipBlock()
+		sb.Index = i
+		sb.Roster = ro
+		sb.Data = []byte{byte(i)}
+		sb.Payload = []byte{1, 2, 3}
+		sb.updateHash()
+		blocks = append(blocks, sb)
+	}
+
+	headers := NewBlockHeaders(blocks)
+	require.Equal(t, 3, len(headers))
+	require.NotNil(t, headers[0].Roster)
+	require.Nil(t, headers[1].Roster)
+	require.NotNil(t, headers[2].Roster)
+	// The blocks are not changed.
+	require.NotNil(t, blocks[1].Roster)
+
+	got, err := BlocksFromHeaders(headers)
+	require.NoError(t, err)
+	for i, sb := range got {
+		require.True(t, sb.Hash.Equal(blocks[i].Hash))
+		require.True(t, sb.CalculateHash().Equal(sb.Hash))
+		require.Equal(t, 0, len(sb.Payload))
+	}
+
+	_, err = BlocksFromHeaders(headers[1:])
+	require.Error(t, err)
+}
+
 // Vector testing of the function to get the index of the next
 // block when following the chain.
 func TestSkipBlock_PathForIndex(t *testing.T) {